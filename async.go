@@ -0,0 +1,164 @@
+package luajit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// An Asyncfunc is a Go operation that Lua code can wait for without
+// blocking other coroutines; see Loop.Async. It receives the Lua
+// arguments converted as by Tovalue and runs on its own goroutine, so it
+// must not use the state.
+type Asyncfunc func(args []interface{}) ([]interface{}, error)
+
+// A Loop runs Lua coroutines that wait for Go operations, such as HTTP
+// requests or timers, resuming each coroutine when its operation
+// completes. Meanwhile, other coroutines run, so scripts can do
+// non-blocking work in a plain sequential style:
+//
+//	local body = http_get(url)	-- yields until the request is done
+//
+// All Lua code runs on the goroutine calling Run; the operations run on
+// goroutines of their own.
+type Loop struct {
+	s          *State
+	coroutines map[unsafe.Pointer]*Coroutine // by thread
+	waiting    map[*Coroutine]bool           // waiting for an operation
+	runnable   []*Coroutine
+	completed  chan completion
+	pending    int // operations in flight
+
+	timers    map[int]*looptimer // see Opentimer
+	lasttimer int
+	firedmu   sync.Mutex
+	fired     []int         // ids of timers that fired, guarded by firedmu
+	wake      chan struct{} // signalled when a timer fires
+}
+
+// The outcome of an operation started by a coroutine.
+type completion struct {
+	co      *Coroutine
+	results []interface{}
+	err     error
+}
+
+// Creates a loop running coroutines of the state s.
+func (s *State) Newloop() *Loop {
+	return &Loop{
+		s:          s,
+		coroutines: make(map[unsafe.Pointer]*Coroutine),
+		waiting:    make(map[*Coroutine]bool),
+		completed:  make(chan completion),
+		timers:     make(map[int]*looptimer),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// Returns a Go function that starts op and makes the calling coroutine
+// wait for it. When op completes, the coroutine is resumed, and the Go
+// function returns the results of op or, if op fails, nil and the error
+// message. Called outside of a coroutine spawned by the loop, the Go
+// function runs op and waits for it, blocking the state.
+func (l *Loop) Async(op Asyncfunc) Gofunction {
+	return func(s *State) int {
+		args, err := s.Resultssince(0)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		return l.wait(s, func() ([]interface{}, error) { return op(args) })
+	}
+}
+
+// Runs op for the Go function running on s, as described for Async, and
+// returns what the Go function must return.
+func (l *Loop) wait(s *State, op func() ([]interface{}, error)) int {
+	co, ok := l.coroutines[unsafe.Pointer(s.l)]
+	if !ok {
+		results, err := op()
+		return pushoutcome(s, results, err)
+	}
+	l.waiting[co] = true
+	l.pending++
+	go func() {
+		results, err := op()
+		l.completed <- completion{co, results, err}
+	}()
+	return s.Yield(0)
+}
+
+// Pushes the outcome of an operation as the results of a Go function.
+func pushoutcome(s *State, results []interface{}, err error) int {
+	if err != nil {
+		s.Pushnil()
+		s.Pushstring(err.Error())
+		return 2
+	}
+	if err := s.pushargs(results); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return len(results)
+}
+
+// Starts a coroutine running the function at the given valid index with
+// args, converted as by Push. The coroutine runs until it first waits or
+// yields; Run runs it further. A coroutine that yields with
+// coroutine.yield is resumed, without values, after the other runnable
+// coroutines have had a turn.
+func (l *Loop) Spawn(index int, args ...interface{}) error {
+	co, err := l.s.Newcoroutine(index)
+	if err != nil {
+		return err
+	}
+	l.coroutines[unsafe.Pointer(co.t.l)] = co
+	return l.resume(co, args)
+}
+
+// Resumes co and schedules it according to how it stops.
+func (l *Loop) resume(co *Coroutine, args []interface{}) error {
+	_, done, err := co.Resume(args...)
+	switch {
+	case done:
+		delete(l.coroutines, unsafe.Pointer(co.t.l))
+	case !l.waiting[co]:
+		l.runnable = append(l.runnable, co)
+	}
+	return err
+}
+
+// Runs the coroutines until all of them are done and no timers are
+// active, one of them fails, or ctx is done, and returns the error, if
+// any. Operations still in flight when Run returns are left to complete;
+// a later Run resumes their coroutines.
+func (l *Loop) Run(ctx context.Context) error {
+	for len(l.runnable) > 0 || l.pending > 0 || len(l.timers) > 0 {
+		if len(l.runnable) > 0 {
+			co := l.runnable[0]
+			l.runnable = l.runnable[1:]
+			if err := l.resume(co, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case c := <-l.completed:
+			l.pending--
+			delete(l.waiting, c.co)
+			args := c.results
+			if c.err != nil {
+				args = []interface{}{nil, c.err.Error()}
+			}
+			if err := l.resume(c.co, args); err != nil {
+				return fmt.Errorf("coroutine: %w", err)
+			}
+		case <-l.wake:
+			if err := l.firetimers(); err != nil {
+				return fmt.Errorf("timer: %w", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
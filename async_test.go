@@ -0,0 +1,60 @@
+package luajit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoop(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	l := s.Newloop()
+	s.Register(l.Async(func(args []interface{}) ([]interface{}, error) {
+		d := time.Duration(args[0].(float64)) * time.Millisecond
+		time.Sleep(d)
+		if d == 0 {
+			return nil, errors.New("zero delay")
+		}
+		return []interface{}{args[1]}, nil
+	}), "sleep")
+
+	err := s.Loadstring(`
+		log = {}
+		return function(d, name)
+			local v, err = sleep(d, name)
+			log[#log + 1] = v or err
+		end
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for _, d := range []int{40, 20, 0} {
+		if err := l.Spawn(-1, d, "slept"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Pop(1)
+	if err := l.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Getglobal("log")
+	got, err := s.Tostringslice(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pop(1)
+	if len(got) != 3 || got[0] != "zero delay" || got[1] != "slept" {
+		t.Errorf("expected [zero delay slept slept], got %v", got)
+	}
+}
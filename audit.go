@@ -0,0 +1,83 @@
+package luajit
+
+/*
+#include <lua.h>
+*/
+import "C"
+import "errors"
+
+// An Auditfunc is called by the globals table after Auditglobals for each
+// access to a global variable. name is the variable's name, write tells
+// whether it is being assigned, and defined whether it had a non-nil
+// value before the access. A non-nil error is raised in Lua instead of
+// performing the access, so that an Auditfunc can reject, for instance,
+// reads of undefined globals.
+type Auditfunc func(s *State, name string, write, defined bool) error
+
+// Installs fn to audit reads and writes of global variables, whether by
+// Lua code or through Getglobal and Setglobal. This is meant for logging,
+// deprecation warnings and catching misspelled or undeclared globals, at
+// the cost of a Go call on every global access.
+//
+// To see every access, Auditglobals moves the globals into a separate
+// table and leaves the globals table empty, with a metatable forwarding
+// to it. As a result, pairs, next and rawget no longer see the globals
+// through _G. Returns an error if the globals table already has a
+// metatable.
+func (s *State) Auditglobals(fn Auditfunc) error {
+	defer s.balanced("Auditglobals", 0)()
+	if err := s.grow(5); err != nil {
+		return err
+	}
+	if int(C.lua_getmetatable(s.live(), C.int(Globalsindex))) != 0 {
+		s.Pop(1)
+		return errors.New("globals table already has a metatable")
+	}
+
+	// Move the globals, clearing fields of the table being traversed as
+	// next allows.
+	s.Newtable()
+	store := s.Gettop()
+	s.Pushnil()
+	for s.Next(Globalsindex) != 0 {
+		s.Pushvalue(-2)
+		s.Insert(-2)
+		s.Rawset(store)
+		s.Pushvalue(-1)
+		s.Pushnil()
+		s.Rawset(Globalsindex)
+	}
+
+	s.Createtable(0, 2)
+	s.Pushvalue(store)
+	s.Pushclosure(func(s *State) int {
+		s.Pushvalue(2)
+		s.Rawget(Upvalueindex(1))
+		if s.Type(2) == Tstring {
+			if err := fn(s, s.Tostring(2), false, !s.Isnil(-1)); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+		}
+		return 1
+	}, 1)
+	s.Setfield(-2, "__index")
+	s.Pushvalue(store)
+	s.Pushclosure(func(s *State) int {
+		if s.Type(2) == Tstring {
+			s.Pushvalue(2)
+			s.Rawget(Upvalueindex(1))
+			defined := !s.Isnil(-1)
+			s.Pop(1)
+			if err := fn(s, s.Tostring(2), true, defined); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+		}
+		s.Settop(3)
+		s.Rawset(Upvalueindex(1))
+		return 0
+	}, 1)
+	s.Setfield(-2, "__newindex")
+	s.Setmetatable(Globalsindex)
+	s.Pop(1)
+	return nil
+}
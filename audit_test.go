@@ -0,0 +1,50 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAuditglobals(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	var log []string
+	err := s.Auditglobals(func(s *State, name string, write, defined bool) error {
+		log = append(log, fmt.Sprintf("%s %t %t", name, write, defined))
+		if !write && !defined && name == "undeclared" {
+			return fmt.Errorf("undeclared global %s", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Auditglobals(nil); err == nil {
+		t.Error("expected error when installing twice")
+	}
+
+	if err := s.Loadstring(`x = 1; x = x + 1; return pcall(function() return undeclared end)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Toboolean(-1) {
+		t.Error("expected reading undeclared to fail")
+	}
+	s.Pop(1)
+	expected := []string{"x true false", "x false true", "x true true", "pcall false true", "undeclared false false"}
+	if fmt.Sprint(log) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, log)
+	}
+	s.Getglobal("x")
+	if s.Tointeger(-1) != 2 {
+		t.Errorf("expected 2, got %d", s.Tointeger(-1))
+	}
+	s.Pop(1)
+}
@@ -0,0 +1,11 @@
+//go:build !luajitdebug
+
+package luajit
+
+func nocheck() {}
+
+// Returns a function that checks the stack balance of a helper. Checking
+// is only done when built with the luajitdebug tag; see balance_debug.go.
+func (s *State) balanced(name string, delta int) func() {
+	return nocheck
+}
@@ -0,0 +1,24 @@
+//go:build luajitdebug
+
+package luajit
+
+import "fmt"
+
+// Returns a function that checks the stack balance of a helper. Helpers
+// use it as
+//
+//	defer s.balanced("Getglobal", 1)()
+//
+// where delta is the number of values the helper leaves on the stack (or
+// removes from it, if negative). When built with the luajitdebug tag, the
+// deferred check panics if the helper left any other number of values, to
+// catch binding bugs before they corrupt a State.
+func (s *State) balanced(name string, delta int) func() {
+	top := s.Gettop()
+	return func() {
+		if n := s.Gettop(); n != top+delta {
+			panic(fmt.Sprintf("luajit: %s left the stack unbalanced: expected top %d, found %d",
+				name, top+delta, n))
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <stddef.h>
+#include <string.h>
+
+// Tags of the values and operations in a batch, followed by their
+// operands: ints, a lua_Number, or strings given by a size_t length and
+// the bytes, with a terminating zero.
+enum {
+	Bnil,
+	Bfalse,
+	Btrue,
+	Bnumber,	// number
+	Bstring,	// string
+	Bpushvalue,	// index
+	Bpop,		// n
+	Bgetfield,	// index, key
+	Bsetfield,	// index, key
+	Bgettable,	// index
+	Bsettable,	// index
+	Bcall,		// nargs, nresults
+	Bcreatetable,	// narr, nrec
+
+	Bnostack=	-1
+};
+
+static const char*
+getint(const char *p, int *v)
+{
+	memcpy(v, p, sizeof *v);
+	return p + sizeof *v;
+}
+
+static const char*
+getstring(const char *p, const char **s, size_t *len)
+{
+	memcpy(len, p, sizeof *len);
+	p += sizeof *len;
+	*s = p;
+	return p + *len + 1;
+}
+
+// Runs the batch p of n bytes. Returns 0, the status of a failed call,
+// which leaves its error message on the stack, or Bnostack.
+static int
+runbatch(lua_State *l, const char *p, size_t n)
+{
+	const char *e, *s;
+	lua_Number d;
+	size_t len;
+	int a, b, r;
+
+	for(e = p + n; p < e;){
+		if(!lua_checkstack(l, 1))
+			return Bnostack;
+		switch(*p++){
+		case Bnil:
+			lua_pushnil(l);
+			break;
+		case Bfalse:
+		case Btrue:
+			lua_pushboolean(l, p[-1] == Btrue);
+			break;
+		case Bnumber:
+			memcpy(&d, p, sizeof d);
+			p += sizeof d;
+			lua_pushnumber(l, d);
+			break;
+		case Bstring:
+			p = getstring(p, &s, &len);
+			lua_pushlstring(l, s, len);
+			break;
+		case Bpushvalue:
+			p = getint(p, &a);
+			lua_pushvalue(l, a);
+			break;
+		case Bpop:
+			p = getint(p, &a);
+			lua_settop(l, -a-1);
+			break;
+		case Bgetfield:
+			p = getint(p, &a);
+			p = getstring(p, &s, &len);
+			lua_getfield(l, a, s);
+			break;
+		case Bsetfield:
+			p = getint(p, &a);
+			p = getstring(p, &s, &len);
+			lua_setfield(l, a, s);
+			break;
+		case Bgettable:
+			p = getint(p, &a);
+			lua_gettable(l, a);
+			break;
+		case Bsettable:
+			p = getint(p, &a);
+			lua_settable(l, a);
+			break;
+		case Bcall:
+			p = getint(p, &a);
+			p = getint(p, &b);
+			if((r = lua_pcall(l, a, b, 0)) != 0)
+				return r;
+			break;
+		case Bcreatetable:
+			p = getint(p, &a);
+			p = getint(p, &b);
+			lua_createtable(l, a, b);
+			break;
+		}
+	}
+	return 0;
+}
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Pushes the values vs onto the stack, converted as by Push. Runs of
+// nils, booleans, numbers, strings and byte slices are encoded into a
+// buffer that one call into C decodes, which makes Pushvalues cheaper
+// than pushing values one by one. On error, nothing is pushed.
+func (s *State) Pushvalues(vs ...interface{}) error {
+	return s.pushvalues(vs, "value")
+}
+
+// Pushes vs as Pushvalues does, naming them what in errors.
+func (s *State) pushvalues(vs []interface{}, what string) error {
+	if err := s.grow(len(vs)); err != nil {
+		return err
+	}
+	top := s.Gettop()
+	var buf []byte
+	for i, v := range vs {
+		switch v := v.(type) {
+		case nil:
+			buf = append(buf, C.Bnil)
+		case bool:
+			if v {
+				buf = append(buf, C.Btrue)
+			} else {
+				buf = append(buf, C.Bfalse)
+			}
+		case int:
+			buf = appendnumber(buf, float64(v))
+		case int64:
+			buf = appendnumber(buf, float64(v))
+		case float64:
+			buf = appendnumber(buf, v)
+		case string:
+			buf = appendstring(buf, v)
+		case []byte:
+			if v == nil {
+				buf = append(buf, C.Bnil) // as Push does
+			} else {
+				buf = appendstring(buf, string(v))
+			}
+		default:
+			s.flushbatch(buf)
+			buf = buf[:0]
+			if err := s.Push(v); err != nil {
+				s.Settop(top)
+				return fmt.Errorf("%s %d: %s", what, i+1, err.Error())
+			}
+		}
+	}
+	s.flushbatch(buf)
+	return nil
+}
+
+func appendnumber(buf []byte, f float64) []byte {
+	buf = append(buf, C.Bnumber)
+	return append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&f)), unsafe.Sizeof(f))...)
+}
+
+func appendstring(buf []byte, str string) []byte {
+	return appendbytes(append(buf, C.Bstring), str)
+}
+
+// Appends the operand str.
+func appendbytes(buf []byte, str string) []byte {
+	n := C.size_t(len(str))
+	buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&n)), unsafe.Sizeof(n))...)
+	buf = append(buf, str...)
+	return append(buf, 0)
+}
+
+// Appends the operation op with the int operands args.
+func appendop(buf []byte, op byte, args ...int) []byte {
+	buf = append(buf, op)
+	for _, a := range args {
+		n := C.int(a)
+		buf = append(buf, unsafe.Slice((*byte)(unsafe.Pointer(&n)), unsafe.Sizeof(n))...)
+	}
+	return buf
+}
+
+// Runs the batch encoded in buf, and returns the status of runbatch.
+func (s *State) runbatch(buf []byte) int {
+	if len(buf) == 0 {
+		return 0
+	}
+	return int(C.runbatch(s.live(), (*C.char)(unsafe.Pointer(&buf[0])), C.size_t(len(buf))))
+}
+
+// Pushes the values encoded in buf, for which the stack has room.
+func (s *State) flushbatch(buf []byte) {
+	s.runbatch(buf)
+}
+
+// A Batch queues operations on the stack of a state, to run them all in
+// a single call into C when flushed. For code that repeats the same
+// short sequence of operations, such as calling a Lua update function on
+// every frame of a game, this saves most of the overhead of calling the
+// Lua API from Go:
+//
+//	b := s.Newbatch()
+//	b.Getglobal("update")
+//	b.Pushnumber(dt)
+//	b.Call(1, 0)
+//	err := b.Flush()
+//
+// The operations behave like the State methods of the same names, except
+// that Call is protected, as by Pcall.
+type Batch struct {
+	s   *State
+	buf []byte
+}
+
+// Returns an empty batch of operations on s.
+func (s *State) Newbatch() *Batch {
+	return &Batch{s: s}
+}
+
+func (b *Batch) Pushnil() {
+	b.buf = append(b.buf, C.Bnil)
+}
+
+func (b *Batch) Pushboolean(v bool) {
+	if v {
+		b.buf = append(b.buf, C.Btrue)
+	} else {
+		b.buf = append(b.buf, C.Bfalse)
+	}
+}
+
+func (b *Batch) Pushnumber(n float64) {
+	b.buf = appendnumber(b.buf, n)
+}
+
+func (b *Batch) Pushinteger(n int) {
+	b.buf = appendnumber(b.buf, float64(n))
+}
+
+// Queues pushing str, which may contain zeros.
+func (b *Batch) Pushstring(str string) {
+	b.buf = appendstring(b.buf, str)
+}
+
+func (b *Batch) Pushvalue(index int) {
+	b.buf = appendop(b.buf, C.Bpushvalue, index)
+}
+
+func (b *Batch) Pop(n int) {
+	b.buf = appendop(b.buf, C.Bpop, n)
+}
+
+func (b *Batch) Getfield(index int, k string) {
+	b.buf = appendbytes(appendop(b.buf, C.Bgetfield, index), k)
+}
+
+func (b *Batch) Setfield(index int, k string) {
+	b.buf = appendbytes(appendop(b.buf, C.Bsetfield, index), k)
+}
+
+func (b *Batch) Getglobal(name string) {
+	b.Getfield(Globalsindex, name)
+}
+
+func (b *Batch) Setglobal(name string) {
+	b.Setfield(Globalsindex, name)
+}
+
+func (b *Batch) Createtable(narr, nrec int) {
+	b.buf = appendop(b.buf, C.Bcreatetable, narr, nrec)
+}
+
+func (b *Batch) Newtable() {
+	b.Createtable(0, 0)
+}
+
+func (b *Batch) Gettable(index int) {
+	b.buf = appendop(b.buf, C.Bgettable, index)
+}
+
+func (b *Batch) Settable(index int) {
+	b.buf = appendop(b.buf, C.Bsettable, index)
+}
+
+// Queues a call, in protected mode, of the function below nargs values on
+// the stack, as Pcall does with no error handler.
+func (b *Batch) Call(nargs, nresults int) {
+	b.buf = appendop(b.buf, C.Bcall, nargs, nresults)
+}
+
+// Runs the queued operations and empties the batch. If a call fails,
+// the operations after it are skipped and Flush returns the error with
+// the error message, which is popped. Returns an error as well, leaving
+// the operations before it done, if the stack cannot grow.
+func (b *Batch) Flush() error {
+	buf := b.buf
+	b.buf = b.buf[:0]
+	switch r := b.s.runbatch(buf); r {
+	case 0:
+		return nil
+	case C.Bnostack:
+		return errstack
+	default:
+		err := fmt.Errorf("%w: %s", numtoerror(r), b.s.Tostring(-1))
+		b.s.Pop(1)
+		return err
+	}
+}
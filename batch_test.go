@@ -0,0 +1,104 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPushvalues(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	err := s.Pushvalues(nil, true, false, 1, int64(2), 2.5, "a\x00b", []byte("c"), []int{4}, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Gettop(); n != 10 {
+		t.Fatalf("expected 10 values, got %d", n)
+	}
+	v, err := s.Resultssince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%q", v); got != `[%!q(<nil>) %!q(bool=true) %!q(bool=false) %!q(float64=1) %!q(float64=2) %!q(float64=2.5) "a\x00b" "c" [%!q(float64=4)] "d"]` {
+		t.Errorf("unexpected values %s", got)
+	}
+
+	s.Pushinteger(1)
+	if err := s.Pushvalues("x", make(chan int)); err == nil {
+		t.Error("expected error pushing a channel")
+	}
+	if n := s.Gettop(); n != 1 {
+		t.Errorf("expected 1 value left on the stack, got %d", n)
+	}
+	s.Pop(1)
+
+	// A nil slice is nil, as with Push, and an empty one an empty string.
+	if err := s.Pushvalues([]byte(nil), []byte{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Push([]byte(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Isnil(1) || !s.Isstring(2) || s.Tostring(2) != "" || !s.Isnil(3) {
+		t.Errorf("expected nil, \"\" and nil, got %s, %s and %s",
+			s.Typename(s.Type(1)), s.Typename(s.Type(2)), s.Typename(s.Type(3)))
+	}
+	s.Pop(3)
+}
+
+func TestBatch(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`n = 0; function add(x) n = n + x; return n end`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	b := s.Newbatch()
+	for i := 1; i <= 3; i++ {
+		b.Getglobal("add")
+		b.Pushinteger(i)
+		b.Call(1, 1)
+		b.Pop(1)
+	}
+	b.Newtable()
+	b.Pushstring("k")
+	b.Pushboolean(true)
+	b.Settable(-3)
+	b.Pushvalue(-1)
+	b.Setglobal("t")
+	b.Getfield(-1, "k")
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Gettop() != 2 || !s.Toboolean(-1) {
+		t.Errorf("expected table and true on the stack, got %d values", s.Gettop())
+	}
+	s.Settop(0)
+	s.Getglobal("n")
+	if n := s.Tointeger(-1); n != 6 {
+		t.Errorf("expected 6, got %d", n)
+	}
+	s.Pop(1)
+
+	b.Getglobal("error")
+	b.Pushstring("boom")
+	b.Call(1, 0)
+	b.Pushnil()
+	if err := b.Flush(); err == nil {
+		t.Error("expected error from failed call")
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack after failed call, got %d values", n)
+	}
+}
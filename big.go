@@ -0,0 +1,500 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Registry names of the metatables for big numbers.
+const (
+	bigintmeta = "luajit.bigint"
+	bigratmeta = "luajit.bigrat"
+)
+
+// The largest size in bits of a power, beyond which x ^ n raises an
+// error rather than exhausting memory and time.
+const bigmaxbits = 1 << 20
+
+var (
+	errbigzero = errors.New("division by zero")
+	errbigexp  = fmt.Errorf("exponent too large (result exceeds %d bits)", bigmaxbits)
+)
+
+// Pushes a copy of x onto the stack as a userdata on which Lua code does
+// exact integer arithmetic with the usual operators:
+//
+//	x + y, x - y, x * y	sum, difference and product
+//	x % y			the remainder of the floor division, with the
+//				sign of y as for Lua numbers
+//	x ^ n			x to the power n, rational if n < 0; an
+//				error if the result would exceed 2^20 bits
+//	x / y			the exact quotient, as a rational
+//	-x, x == y, x < y	negation and comparisons, which Lua only
+//				makes between big numbers
+//	tostring(x)		the decimal representation
+//	x:div(y)		the floor division
+//	x:string(base)		the representation in base, 2 to 62
+//	x:tonumber()		the closest number
+//	x:sign()		-1, 0 or 1
+//	x:cmp(y)		-1, 0 or 1 as x < y, x == y or x > y
+//
+// For arithmetic, the other operand may be a big integer or rational, or
+// anything Tobigrat accepts; if it is not an integer, the result is a
+// rational. To compare with plain numbers or strings, use x:cmp(y).
+func (s *State) Pushbigint(x *big.Int) error {
+	return s.pushbig(new(big.Int).Set(x))
+}
+
+// Pushes a copy of x onto the stack as a userdata on which Lua code does
+// exact rational arithmetic, with the operators and methods described for
+// Pushbigint, except div and string, and these:
+//
+//	r:num(), r:denom()	the numerator and denominator, as big integers
+//	r:decimal(prec)		the decimal representation rounded to prec
+//				digits after the point
+func (s *State) Pushbigrat(x *big.Rat) error {
+	return s.pushbig(new(big.Rat).Set(x))
+}
+
+// Pushes v, a *big.Int or *big.Rat that Lua code is then the only one
+// to use.
+func (s *State) pushbig(v interface{}) error {
+	if err := s.grow(6); err != nil {
+		return err
+	}
+	s.pushhandle(v)
+	newint := s.proxymeta(bigintmeta)
+	s.proxymeta(bigratmeta)
+	if newint {
+		// Both metatables are made at once, sharing their metamethods,
+		// as Lua only compares values with the same ones.
+		for event, fn := range bigevents() {
+			s.Pushfunction(fn)
+			s.Pushvalue(-1)
+			s.Setfield(-3, event)
+			s.Setfield(-3, event)
+		}
+		s.setbigmethods(bigratmethods())
+		s.Insert(-2)
+		s.setbigmethods(bigintmethods())
+		s.Insert(-2)
+	}
+	if _, ok := v.(*big.Int); ok {
+		s.Pop(1)
+	} else {
+		s.Remove(-2)
+	}
+	s.Setmetatable(-2)
+	return nil
+}
+
+// Sets the methods as the __index table of the metatable on top of the
+// stack, along with the methods common to both big number types.
+func (s *State) setbigmethods(methods map[string]Gofunction) {
+	common := bigmethods()
+	s.Createtable(0, len(methods)+len(common))
+	for _, m := range []map[string]Gofunction{common, methods} {
+		for name, fn := range m {
+			s.Pushfunction(fn)
+			s.Setfield(-2, name)
+		}
+	}
+	s.Setfield(-2, "__index")
+}
+
+// Returns the value at the given valid index as a *big.Int or *big.Rat
+// that must not be modified.
+func (s *State) tobig(index int) (interface{}, error) {
+	switch s.Type(index) {
+	case Tuserdata:
+		obj, _ := s.toobject(index)
+		switch obj.(type) {
+		case *big.Int, *big.Rat:
+			return obj, nil
+		}
+	case Tnumber:
+		f := s.Tonumber(index)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%v has no exact value", f)
+		}
+		if f == math.Trunc(f) {
+			x, _ := big.NewFloat(f).Int(nil)
+			return x, nil
+		}
+		// The shortest decimal form, so that 0.1 means 1/10.
+		x, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+		return x, nil
+	case Tstring:
+		str := s.Tostring(index)
+		if x, ok := new(big.Int).SetString(str, 0); ok {
+			return x, nil
+		}
+		if x, ok := new(big.Rat).SetString(str); ok {
+			return x, nil
+		}
+		return nil, fmt.Errorf("invalid number %q", str)
+	}
+	return nil, fmt.Errorf("number expected, got %s", s.Typename(s.Type(index)))
+}
+
+// Converts the value at the given valid index to a new big.Int. It
+// accepts big integers, big rationals with an integral value, integral
+// numbers, and strings holding integers, in base 10 or with a prefix such
+// as 0x.
+func (s *State) Tobigint(index int) (*big.Int, error) {
+	v, err := s.tobig(index)
+	if err != nil {
+		return nil, err
+	}
+	switch x := v.(type) {
+	case *big.Int:
+		return new(big.Int).Set(x), nil
+	case *big.Rat:
+		if x.IsInt() {
+			return new(big.Int).Set(x.Num()), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not an integer", v)
+}
+
+// Converts the value at the given valid index to a new big.Rat. It
+// accepts big integers and rationals, numbers, and strings such as "1/3"
+// or "2.50". A number that is not an integer is taken at its shortest
+// decimal representation, so 0.1 is 1/10.
+func (s *State) Tobigrat(index int) (*big.Rat, error) {
+	v, err := s.tobig(index)
+	if err != nil {
+		return nil, err
+	}
+	return torat(v), nil
+}
+
+// Returns the *big.Int or *big.Rat v as a new *big.Rat.
+func torat(v interface{}) *big.Rat {
+	if x, ok := v.(*big.Int); ok {
+		return new(big.Rat).SetInt(x)
+	}
+	return new(big.Rat).Set(v.(*big.Rat))
+}
+
+// Returns the two operands of a binary metamethod or method.
+func (s *State) bigoperands() (x, y interface{}, err error) {
+	if x, err = s.tobig(1); err != nil {
+		return nil, nil, fmt.Errorf("bad argument #1 (%s)", err.Error())
+	}
+	if y, err = s.tobig(2); err != nil {
+		return nil, nil, fmt.Errorf("bad argument #2 (%s)", err.Error())
+	}
+	return x, y, nil
+}
+
+// Returns a metamethod for the arithmetic operator op.
+func bigarith(op byte) Gofunction {
+	return func(s *State) int {
+		x, y, err := s.bigoperands()
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		var r interface{}
+		xi, xint := x.(*big.Int)
+		yi, yint := y.(*big.Int)
+		if xint && yint && op != '/' && !(op == '^' && yi.Sign() < 0) {
+			r, err = intarith(op, xi, yi)
+		} else {
+			r, err = ratarith(op, torat(x), torat(y))
+		}
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		return pushbigresult(s, r)
+	}
+}
+
+func intarith(op byte, x, y *big.Int) (*big.Int, error) {
+	r := new(big.Int)
+	switch op {
+	case '+':
+		r.Add(x, y)
+	case '-':
+		r.Sub(x, y)
+	case '*':
+		r.Mul(x, y)
+	case '%':
+		if y.Sign() == 0 {
+			return nil, errbigzero
+		}
+		r.Rem(x, y)
+		if r.Sign() != 0 && r.Sign() != y.Sign() {
+			r.Add(r, y)
+		}
+	case '^':
+		if bigexptoolarge(x, y) {
+			return nil, errbigexp
+		}
+		r.Exp(x, y, nil)
+	}
+	return r, nil
+}
+
+func ratarith(op byte, x, y *big.Rat) (*big.Rat, error) {
+	r := new(big.Rat)
+	switch op {
+	case '+':
+		r.Add(x, y)
+	case '-':
+		r.Sub(x, y)
+	case '*':
+		r.Mul(x, y)
+	case '/':
+		if y.Sign() == 0 {
+			return nil, errbigzero
+		}
+		r.Quo(x, y)
+	case '%':
+		if y.Sign() == 0 {
+			return nil, errbigzero
+		}
+		q := new(big.Rat).Quo(x, y)
+		fl := new(big.Int).Div(q.Num(), q.Denom()) // Euclidean, so floor
+		r.Sub(x, new(big.Rat).Mul(y, new(big.Rat).SetInt(fl)))
+	case '^':
+		if !y.IsInt() {
+			return nil, errors.New("exponent must be an integer")
+		}
+		e := new(big.Int).Abs(y.Num())
+		if y.Sign() < 0 && x.Sign() == 0 {
+			return nil, errbigzero
+		}
+		if bigexptoolarge(x.Num(), e) || bigexptoolarge(x.Denom(), e) {
+			return nil, errbigexp
+		}
+		num := new(big.Int).Exp(x.Num(), e, nil)
+		den := new(big.Int).Exp(x.Denom(), e, nil)
+		if y.Sign() < 0 {
+			num, den = den, num
+		}
+		r.SetFrac(num, den)
+	}
+	return r, nil
+}
+
+// Reports whether x ^ e, for e >= 0, would have more than bigmaxbits
+// bits.
+func bigexptoolarge(x, e *big.Int) bool {
+	if x.CmpAbs(big.NewInt(1)) <= 0 {
+		return false // 0, 1 and -1 stay small
+	}
+	if !e.IsInt64() || e.Int64() > bigmaxbits {
+		return true
+	}
+	return int64(x.BitLen()-1)*e.Int64() > bigmaxbits
+}
+
+// Compares the *big.Int or *big.Rat values x and y.
+func bigcmp(x, y interface{}) int {
+	xi, xint := x.(*big.Int)
+	yi, yint := y.(*big.Int)
+	if xint && yint {
+		return xi.Cmp(yi)
+	}
+	return torat(x).Cmp(torat(y))
+}
+
+// Pushes the big number r as the result of a Go function.
+func pushbigresult(s *State, r interface{}) int {
+	if err := s.pushbig(r); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return 1
+}
+
+// Returns a metamethod or method pushing the comparison of its two
+// operands as given by result.
+func bigcompare(result func(c int) bool) Gofunction {
+	return func(s *State) int {
+		x, y, err := s.bigoperands()
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		s.Pushboolean(result(bigcmp(x, y)))
+		return 1
+	}
+}
+
+// Returns the metamethods of both big integers and rationals.
+func bigevents() map[string]Gofunction {
+	return map[string]Gofunction{
+		"__add": bigarith('+'),
+		"__sub": bigarith('-'),
+		"__mul": bigarith('*'),
+		"__div": bigarith('/'),
+		"__mod": bigarith('%'),
+		"__pow": bigarith('^'),
+		"__unm": func(s *State) int {
+			x, err := s.tobig(1)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			if xi, ok := x.(*big.Int); ok {
+				return pushbigresult(s, new(big.Int).Neg(xi))
+			}
+			return pushbigresult(s, new(big.Rat).Neg(x.(*big.Rat)))
+		},
+		"__eq": bigcompare(func(c int) bool { return c == 0 }),
+		"__lt": bigcompare(func(c int) bool { return c < 0 }),
+		"__le": bigcompare(func(c int) bool { return c <= 0 }),
+		"__tostring": func(s *State) int {
+			x, err := s.tobig(1)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			if xr, ok := x.(*big.Rat); ok {
+				s.Pushstring(xr.RatString())
+			} else {
+				s.Pushstring(x.(*big.Int).String())
+			}
+			return 1
+		},
+	}
+}
+
+// Returns the methods of both big integers and rationals.
+func bigmethods() map[string]Gofunction {
+	return map[string]Gofunction{
+		"tonumber": func(s *State) int {
+			x, err := s.tobig(1)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			f, _ := torat(x).Float64()
+			s.Pushnumber(f)
+			return 1
+		},
+		"sign": func(s *State) int {
+			x, err := s.tobig(1)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			s.Pushinteger(torat(x).Sign())
+			return 1
+		},
+		"cmp": func(s *State) int {
+			x, y, err := s.bigoperands()
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			s.Pushinteger(bigcmp(x, y))
+			return 1
+		},
+	}
+}
+
+// Returns the methods of big integers only.
+func bigintmethods() map[string]Gofunction {
+	return map[string]Gofunction{
+		"div": func(s *State) int {
+			x, err := s.Tobigint(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			y, err := s.Tobigint(2)
+			if err != nil {
+				return s.Errorf("bad argument #2 (%s)", err.Error())
+			}
+			if y.Sign() == 0 {
+				return s.Errorf("%s", errbigzero.Error())
+			}
+			q, m := new(big.Int).QuoRem(x, y, new(big.Int))
+			if m.Sign() != 0 && m.Sign() != y.Sign() {
+				q.Sub(q, big.NewInt(1))
+			}
+			return pushbigresult(s, q)
+		},
+		"string": func(s *State) int {
+			x, err := s.Tobigint(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			base := 10
+			if !s.Isnoneornil(2) {
+				base = s.Tointeger(2)
+			}
+			if base < 2 || base > 62 {
+				return s.Errorf("bad argument #2 (base out of range)")
+			}
+			s.Pushstring(x.Text(base))
+			return 1
+		},
+	}
+}
+
+// Returns the methods of big rationals only.
+func bigratmethods() map[string]Gofunction {
+	return map[string]Gofunction{
+		"num": func(s *State) int {
+			x, err := s.Tobigrat(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			return pushbigresult(s, x.Num())
+		},
+		"denom": func(s *State) int {
+			x, err := s.Tobigrat(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			return pushbigresult(s, x.Denom())
+		},
+		"decimal": func(s *State) int {
+			x, err := s.Tobigrat(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			prec := s.Tointeger(2)
+			if prec < 0 {
+				return s.Errorf("bad argument #2 (precision must not be negative)")
+			}
+			s.Pushstring(x.FloatString(prec))
+			return 1
+		},
+	}
+}
+
+// Makes the module "big" available to require, for scripts to make big
+// numbers, as described for Pushbigint and Pushbigrat:
+//
+//	big.int(v)		v, which Tobigint accepts, as a big integer
+//	big.rat(v [, d])	v, or v / d, as a big rational
+//
+// The package library must be open.
+func (s *State) Openbig() error {
+	return s.Preloadfuncs("big", map[string]Gofunction{
+		"int": func(s *State) int {
+			x, err := s.Tobigint(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			return pushbigresult(s, x)
+		},
+		"rat": func(s *State) int {
+			x, err := s.Tobigrat(1)
+			if err != nil {
+				return s.Errorf("bad argument #1 (%s)", err.Error())
+			}
+			if !s.Isnoneornil(2) {
+				d, err := s.Tobigrat(2)
+				if err != nil {
+					return s.Errorf("bad argument #2 (%s)", err.Error())
+				}
+				if d.Sign() == 0 {
+					return s.Errorf("%s", errbigzero.Error())
+				}
+				x.Quo(x, d)
+			}
+			return pushbigresult(s, x)
+		},
+	})
+}
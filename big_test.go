@@ -0,0 +1,70 @@
+package luajit
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBig(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Openbig(); err != nil {
+		t.Fatal(err)
+	}
+
+	x, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	err := s.Loadstring(`
+		local big = require("big")
+		local x = ...
+		local y = x * x + 1
+		assert(tostring(big.int("0x10")) == "16")
+		assert(tostring(big.int(-7) % 3) == "2")
+		assert(tostring(big.int(7):div(-2)) == "-4")
+		assert(tostring(big.int(2) ^ 100) == "1267650600228229401496703205376")
+		assert(tostring(big.int(1) / 3) == "1/3")
+		assert(tostring(big.rat("0.10") + 0.2) == "3/10")
+		assert(big.rat(1, 3) + big.rat(2, 3) == big.int(1))
+		assert(big.int(1) < big.rat(3, 2) and big.int(2):cmp(2) == 0)
+		assert(big.rat(7, 2):decimal(2) == "3.50")
+		assert(tostring(big.rat(2, 3) ^ -2) == "9/4")
+		assert(not pcall(function() return big.int(1) / 0 end))
+		assert(not pcall(big.int, "1.5"))
+		assert(not pcall(function() return big.int(10) ^ big.int("1000000000000") end))
+		assert(not pcall(function() return big.rat(1, 3) ^ -1e7 end))
+		assert(tostring(big.int(-1) ^ big.int("1000000000001")) == "-1")
+		return y, big.rat(22, 7)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pushbigint(x); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pcall(1, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	y, err := s.Tobigint(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := new(big.Int).Mul(x, x)
+	want.Add(want, big.NewInt(1))
+	if y.Cmp(want) != 0 {
+		t.Errorf("expected %s, got %s", want, y)
+	}
+	r, err := s.Tobigrat(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Cmp(big.NewRat(22, 7)) != 0 {
+		t.Errorf("expected 22/7, got %s", r)
+	}
+	if _, err := s.Tobigint(2); err == nil {
+		t.Error("expected error converting 22/7 to an integer")
+	}
+	s.Pop(2)
+}
@@ -0,0 +1,330 @@
+package luajit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Tags of the serialization format of LuaJIT's string.buffer.
+const (
+	sertagnil    = 0x00
+	sertagfalse  = 0x01
+	sertagtrue   = 0x02
+	sertagnull   = 0x03
+	sertagint    = 0x06
+	sertagnum    = 0x07
+	sertagtab    = 0x08 // +1 with a hash part, +2 or +4 with an array part
+	sertagdictmt = 0x0e
+	sertagint64  = 0x10
+	sertaguint64 = 0x11
+	sertagstr    = 0x20 // + length
+)
+
+var errbuffereof = errors.New("buffer: unexpected end of data")
+
+// Encodes v in the format of LuaJIT 2.1's string.buffer, so that Lua
+// code gets it back with buffer.decode, much faster than by parsing
+// JSON, for instance. Go values are converted as by Push, except that
+// integers that a number cannot hold exactly become int64_t or uint64_t
+// cdata. Types that do not make plain data, such as functions and
+// channels, are an error.
+func Encodebuffer(v interface{}) ([]byte, error) {
+	return appendbuffer(nil, reflect.ValueOf(v), 0)
+}
+
+func appendbuffer(b []byte, v reflect.Value, depth int) ([]byte, error) {
+	if depth > maxnesting {
+		return nil, errnesting
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return append(b, sertagnil), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, sertagtrue), nil
+		}
+		return append(b, sertagfalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := v.Int(); n < -1<<53 || n > 1<<53 {
+			b = append(b, sertagint64)
+			return binary.LittleEndian.AppendUint64(b, uint64(n)), nil
+		}
+		return appendbuffernum(b, float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := v.Uint(); n > 1<<53 {
+			b = append(b, sertaguint64)
+			return binary.LittleEndian.AppendUint64(b, n), nil
+		}
+		return appendbuffernum(b, float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return appendbuffernum(b, v.Float()), nil
+	case reflect.String:
+		return appendbufferstr(b, v.String()), nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return append(b, sertagnil), nil
+		}
+		return appendbuffer(b, v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(b, sertagnil), nil
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendbufferstr(b, string(v.Bytes())), nil
+		}
+		n := v.Len()
+		if n == 0 {
+			return append(b, sertagtab), nil
+		}
+		// The array part starts at index 0, which is left out.
+		b = appendu124(append(b, sertagtab+4), uint32(n+1))
+		for i := 0; i < n; i++ {
+			var err error
+			if b, err = appendbuffer(b, v.Index(i), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, sertagnil), nil
+		}
+		if v.Len() == 0 {
+			return append(b, sertagtab), nil
+		}
+		b = appendu124(append(b, sertagtab+1), uint32(v.Len()))
+		for it := v.MapRange(); it.Next(); {
+			k := reflect.Indirect(it.Key())
+			if !k.IsValid() || k.Kind() == reflect.Interface && k.IsNil() {
+				return nil, errors.New("table index is nil")
+			}
+			var err error
+			if b, err = appendbuffer(b, k, depth+1); err != nil {
+				return nil, err
+			}
+			if b, err = appendbuffer(b, it.Value(), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Struct:
+		if v.Type() == timetype {
+			t := v.Interface().(time.Time)
+			return appendbuffernum(b, float64(t.UnixNano())/1e9), nil
+		}
+		type kv struct {
+			name string
+			v    reflect.Value
+		}
+		var kvs []kv
+		for _, f := range fields(v.Type()) {
+			fv := fieldbyindex(v, f.index)
+			if !fv.IsValid() || f.omitempty && isempty(fv) {
+				continue
+			}
+			kvs = append(kvs, kv{f.name, fv})
+		}
+		if len(kvs) == 0 {
+			return append(b, sertagtab), nil
+		}
+		b = appendu124(append(b, sertagtab+1), uint32(len(kvs)))
+		for _, f := range kvs {
+			b = appendbufferstr(b, f.name)
+			var err error
+			if b, err = appendbuffer(b, f.v, depth+1); err != nil {
+				return nil, fmt.Errorf("field %s: %s", f.name, err.Error())
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot encode value of type %s", v.Type())
+}
+
+func appendbuffernum(b []byte, f float64) []byte {
+	b = append(b, sertagnum)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(f))
+}
+
+func appendbufferstr(b []byte, str string) []byte {
+	return append(appendu124(b, uint32(sertagstr+len(str))), str...)
+}
+
+// Appends v in the variable-length encoding of the format: one byte below
+// 0xe0, two bytes below 0x1fe0, otherwise 0xff and four bytes.
+func appendu124(b []byte, v uint32) []byte {
+	switch {
+	case v < 0xe0:
+		return append(b, byte(v))
+	case v < 0x1fe0:
+		v -= 0xe0
+		return append(b, byte(0xe0|v>>8), byte(v))
+	}
+	return binary.LittleEndian.AppendUint32(append(b, 0xff), v)
+}
+
+// Decodes a value encoded by LuaJIT 2.1's buffer.encode or Encodebuffer,
+// returning the Go value Tovalue would give for it. 64-bit integer cdata
+// give int64 and uint64 values. Light userdata other than NULL,
+// complex numbers, and values encoded with dictionaries are not
+// supported.
+func Decodebuffer(data []byte) (interface{}, error) {
+	d := bufferdecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.data) > 0 {
+		return nil, errors.New("buffer: extra data after value")
+	}
+	return v, nil
+}
+
+type bufferdecoder struct {
+	data []byte
+}
+
+func (d *bufferdecoder) next(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errbuffereof
+	}
+	p := d.data[:n]
+	d.data = d.data[n:]
+	return p, nil
+}
+
+func (d *bufferdecoder) u124() (uint32, error) {
+	p, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return d.u124rest(uint32(p[0]))
+}
+
+// Finishes reading a u124 whose first byte is v.
+func (d *bufferdecoder) u124rest(v uint32) (uint32, error) {
+	switch {
+	case v < 0xe0:
+		return v, nil
+	case v != 0xff:
+		p, err := d.next(1)
+		if err != nil {
+			return 0, err
+		}
+		return (v&0x1f)<<8 + uint32(p[0]) + 0xe0, nil
+	}
+	p, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(p), nil
+}
+
+func (d *bufferdecoder) value(depth int) (interface{}, error) {
+	if depth > maxnesting {
+		return nil, errnesting
+	}
+	p, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	tag := uint32(p[0])
+	switch {
+	case tag == sertagnil, tag == sertagnull:
+		return nil, nil
+	case tag == sertagfalse:
+		return false, nil
+	case tag == sertagtrue:
+		return true, nil
+	case tag == sertagint:
+		if p, err = d.next(4); err != nil {
+			return nil, err
+		}
+		return float64(int32(binary.LittleEndian.Uint32(p))), nil
+	case tag == sertagnum:
+		if p, err = d.next(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(p)), nil
+	case tag >= sertagtab && tag < sertagdictmt:
+		return d.table(tag-sertagtab, depth)
+	case tag == sertagint64, tag == sertaguint64:
+		if p, err = d.next(8); err != nil {
+			return nil, err
+		}
+		n := binary.LittleEndian.Uint64(p)
+		if tag == sertagint64 {
+			return int64(n), nil
+		}
+		return n, nil
+	case tag >= sertagstr:
+		n, err := d.u124rest(tag)
+		if err != nil {
+			return nil, err
+		}
+		if p, err = d.next(int(n - sertagstr)); err != nil {
+			return nil, err
+		}
+		return string(p), nil
+	}
+	return nil, fmt.Errorf("buffer: unsupported tag 0x%02x", tag)
+}
+
+// Decodes a table of the given kind, the tag minus sertagtab.
+func (d *bufferdecoder) table(kind uint32, depth int) (interface{}, error) {
+	var narray, nhash uint32
+	var err error
+	if kind >= 2 {
+		if narray, err = d.u124(); err != nil {
+			return nil, err
+		}
+	}
+	if kind&1 != 0 {
+		if nhash, err = d.u124(); err != nil {
+			return nil, err
+		}
+	}
+	if int(narray)+int(nhash) > len(d.data) { // each value takes a byte at least
+		return nil, errbuffereof
+	}
+	keys := make([]interface{}, 0, int(narray)+int(nhash))
+	vals := make([]interface{}, 0, cap(keys))
+	i := uint32(0)
+	if kind >= 4 {
+		i = 1 // index 0 is left out
+	}
+	for ; i < narray; i++ {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			keys = append(keys, float64(i))
+			vals = append(vals, v)
+		}
+	}
+	for ; nhash > 0; nhash-- {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k.(type) {
+		case nil:
+			return nil, errors.New("buffer: table index is nil")
+		case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+			return nil, errors.New("buffer: cannot convert table key of type table")
+		}
+		if v != nil {
+			keys = append(keys, k)
+			vals = append(vals, v)
+		}
+	}
+	return tablevalue(keys, vals), nil
+}
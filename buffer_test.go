@@ -0,0 +1,98 @@
+package luajit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	type point struct {
+		X, Y int
+		Tag  string `lua:"tag,omitempty"`
+	}
+	in := map[string]interface{}{
+		"n":      1.5,
+		"big":    int64(1<<62 + 1),
+		"list":   []interface{}{"a", true, nil, 3},
+		"empty":  []int{},
+		"point":  point{1, 2, ""},
+		"nested": map[string]interface{}{"s": []byte("a\x00b")},
+	}
+	b, err := Encodebuffer(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decodebuffer(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"n":      1.5,
+		"big":    int64(1<<62 + 1),
+		"list":   map[interface{}]interface{}{1.0: "a", 2.0: true, 4.0: 3.0},
+		"empty":  map[string]interface{}{},
+		"point":  map[string]interface{}{"X": 1.0, "Y": 2.0},
+		"nested": map[string]interface{}{"s": "a\x00b"},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("expected %v, got %v", want, out)
+	}
+
+	if _, err := Decodebuffer(b[:len(b)-1]); err == nil {
+		t.Error("expected error decoding truncated data")
+	}
+	if _, err := Decodebuffer(append(b, 0)); err == nil {
+		t.Error("expected error decoding extra data")
+	}
+	if _, err := Encodebuffer(make(chan int)); err == nil {
+		t.Error("expected error encoding a channel")
+	}
+	long := make([]int, 300)
+	b, err = Encodebuffer(long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := Decodebuffer(b); err != nil || len(out.([]interface{})) != 300 {
+		t.Errorf("expected 300 elements, got %v", err)
+	}
+}
+
+func TestBufferlua(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`
+		local ok, buffer = pcall(require, "string.buffer")
+		if not ok then return nil end
+		local v = buffer.decode(...)
+		assert(v.name == "x" and v.list[3] == 3 and #v.list == 3)
+		return buffer.encode({v.list[1], k = v.name .. "y"})
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	b, err := Encodebuffer(map[string]interface{}{"name": "x", "list": []int{1, 2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pushbytes(b)
+	if err := s.Pcall(1, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Isnil(-1) {
+		t.Skip("string.buffer not available")
+	}
+	v, err := Decodebuffer(s.Tobytes(-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[interface{}]interface{}{1.0: 1.0, "k": "xy"}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("expected %v, got %v", want, v)
+	}
+	s.Pop(1)
+}
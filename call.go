@@ -0,0 +1,88 @@
+package luajit
+
+import "fmt"
+
+// Calls the global function name with the given arguments, converted as
+// by Push, and returns its results, converted as by Tovalue. The call is
+// protected: if it raises an error, Callglobal returns an error holding
+// the error message. The stack is left as it was.
+func (s *State) Callglobal(name string, args ...interface{}) ([]interface{}, error) {
+	s.Getglobal(name)
+	return s.callvalues(name, args)
+}
+
+// Like Callglobal, but calls the function at the dotted path, such as
+// "handlers.http.get", as looked up by Getpath.
+func (s *State) Callpath(path string, args ...interface{}) ([]interface{}, error) {
+	if err := s.Getpath(path); err != nil {
+		return nil, err
+	}
+	return s.callvalues(path, args)
+}
+
+// Calls the function on top of the stack, named name in errors, with args
+// and returns its converted results, leaving the stack as it was before
+// the function was pushed.
+func (s *State) callvalues(name string, args []interface{}) ([]interface{}, error) {
+	base := s.Gettop() - 1
+	if !s.Isfunction(-1) {
+		err := fmt.Errorf("attempt to call %s (a %s value)", name, s.Typename(s.Type(-1)))
+		s.Settop(base)
+		return nil, err
+	}
+	if err := s.pushargs(args); err != nil {
+		s.Settop(base)
+		return nil, err
+	}
+	return s.Pcallmulti(len(args))
+}
+
+// Calls a function in protected mode as Pcall does with Multret results,
+// and returns all the results, converted as by Tovalue. Both the function
+// and the results are removed from the stack, as is the error message in
+// case of errors, which is included in the returned error.
+func (s *State) Pcallmulti(nargs int) ([]interface{}, error) {
+	base := s.Gettop() - nargs - 1
+	if err := s.Pcall(nargs, Multret, 0); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Settop(base)
+		return nil, err
+	}
+	return s.Resultssince(base)
+}
+
+// Returns the values above index base, that is, those pushed since the
+// top of the stack was at base, converted as by Tovalue, and pops them.
+// The values are popped even if one of them cannot be converted.
+func (s *State) Resultssince(base int) ([]interface{}, error) {
+	defer s.Settop(base)
+	results := make([]interface{}, s.Gettop()-base)
+	for i := range results {
+		v, err := s.Tovalue(base + 1 + i)
+		if err != nil {
+			return nil, fmt.Errorf("result %d: %s", i+1, err.Error())
+		}
+		results[i] = v
+	}
+	return results, nil
+}
+
+// Loads and runs the chunk src with args, and returns its converted
+// results, leaving the stack as it was.
+func (s *State) runstring(src string, args []interface{}) ([]interface{}, error) {
+	if err := s.Loadstring(src); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(1)
+		return nil, err
+	}
+	if err := s.pushargs(args); err != nil {
+		s.Pop(1)
+		return nil, err
+	}
+	return s.Pcallmulti(len(args))
+}
+
+// Pushes the arguments of a call, converted as by Push.
+func (s *State) pushargs(args []interface{}) error {
+	return s.pushvalues(args, "argument")
+}
@@ -0,0 +1,95 @@
+package luajit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCallglobal(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`
+		function divmod(a, b) return math.floor(a / b), a % b end
+		handlers = {greet = function(name) return "hello " .. name end}
+		function fail() error("boom") end
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	r, err := s.Callglobal("divmod", 7, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0] != 3.0 || r[1] != 1.0 {
+		t.Errorf("expected [3 1], got %v", r)
+	}
+	r, err = s.Callpath("handlers.greet", "lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0] != "hello lua" {
+		t.Errorf("expected [hello lua], got %v", r)
+	}
+	if _, err := s.Callglobal("fail"); err == nil || !errors.Is(err, numtoerror(Errrun)) {
+		t.Errorf("expected run time error, got %v", err)
+	}
+	if _, err := s.Callglobal("missing"); err == nil {
+		t.Error("expected error calling nil")
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+}
+
+func TestPcallmulti(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	s.Pushstring("below")
+	if err := s.Loadstring(`return 1, "two", nil, true`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	r, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 4 || r[0] != 1.0 || r[1] != "two" || r[2] != nil || r[3] != true {
+		t.Errorf("expected [1 two <nil> true], got %v", r)
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+
+	if err := s.Loadstring(`return function() end`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if _, err := s.Pcallmulti(0); err == nil {
+		t.Error("expected error converting a Lua function")
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+
+	s.Pushnumber(1)
+	s.Pushnumber(2)
+	r, err = s.Resultssince(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[1] != 2.0 || s.Gettop() != 1 {
+		t.Errorf("expected [1 2] and 1 value on the stack, got %v and %d", r, s.Gettop())
+	}
+	s.Pop(1)
+}
@@ -0,0 +1,421 @@
+package luajit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+var errcboreof = errors.New("cbor: unexpected end of data")
+
+// Major types of CBOR data items, in the top three bits of their first
+// byte.
+const (
+	cboruint = iota << 5
+	cbornegint
+	cborbytes
+	cbortext
+	cborarray
+	cbormap
+	cbortag
+	cborsimple
+)
+
+// Additional information meaning that the length of a string, array, or
+// map is indefinite, and the byte that ends it.
+const (
+	cborindefinite = 31
+	cborbreak      = 0xff
+)
+
+// Makes the module "cbor" available to require:
+//
+//	cbor.encode(value)	returns value encoded in CBOR
+//	cbor.decode(data)	returns the value of the CBOR data item in data
+//	cbor.null		the value of CBOR null, a light userdata
+//
+// Values are encoded and decoded as by Tocbor and Pushcbor. The package
+// library must be open.
+func (s *State) Opencbor() error {
+	return s.Preload("cbor", func(s *State) int {
+		s.Createtable(0, 3)
+		s.Pushfunction(cborencode)
+		s.Setfield(-2, "encode")
+		s.Pushfunction(cbordecode)
+		s.Setfield(-2, "decode")
+		s.Pushlightuserdata(nil)
+		s.Setfield(-2, "null")
+		return 1
+	})
+}
+
+func cborencode(s *State) int {
+	b, err := s.Tocbor(1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Pushbytes(b)
+	return 1
+}
+
+func cbordecode(s *State) int {
+	if !s.Isstring(1) {
+		return s.Errorf("bad argument #1 to 'decode' (string expected, got %s)", s.Typename(s.Type(1)))
+	}
+	if err := s.Pushcbor(s.Tobytes(1)); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return 1
+}
+
+// Encodes the value at the given valid index in CBOR. Numbers with integer
+// values are encoded as integers, in the fewest bytes that hold them, and
+// other numbers as 64-bit floats. Strings that are valid UTF-8 are encoded
+// as text strings and others as byte strings. Tables whose keys are
+// exactly 1 to n, and empty tables, become arrays, and other tables maps,
+// with their keys in the deterministic order of RFC 8949, sorted by their
+// encoding. Nil and a light userdata holding NULL, such as cbor.null,
+// encode as null. Returns an error for values that cannot be encoded, such
+// as functions and tables that refer to themselves.
+func (s *State) Tocbor(index int) ([]byte, error) {
+	return s.appendcbor(nil, s.absindex(index), 0)
+}
+
+// Decodes the CBOR data item in data and pushes its value onto the stack.
+// Integers and floats become numbers, byte and text strings become
+// strings, arrays and maps become tables, and null and undefined become
+// cbor.null, a light userdata holding NULL, so that they can be kept in
+// tables. Tags are skipped, leaving the value of the item they enclose.
+// On error, including extra data after the item, nothing is pushed.
+func (s *State) Pushcbor(data []byte) error {
+	top := s.Gettop()
+	d := &cbordecoder{data: data}
+	if err := s.pushcbor(d, 0); err != nil {
+		s.Settop(top)
+		return err
+	}
+	if len(d.data) > 0 {
+		s.Settop(top)
+		return errors.New("cbor: extra data after value")
+	}
+	return nil
+}
+
+// Appends the head of a data item: its major type and argument n, in the
+// fewest bytes that hold it.
+func appendcborhead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+func (s *State) appendcbor(b []byte, index, depth int) ([]byte, error) {
+	switch tp := s.Type(index); tp {
+	case Tnil:
+		return append(b, cborsimple|22), nil
+	case Tboolean:
+		if s.Toboolean(index) {
+			return append(b, cborsimple|21), nil
+		}
+		return append(b, cborsimple|20), nil
+	case Tnumber:
+		f := s.Tonumber(index)
+		switch {
+		case f != math.Trunc(f) || f <= -math.MaxUint64 || f >= math.MaxUint64:
+			b = append(b, cborsimple|27)
+			return binary.BigEndian.AppendUint64(b, math.Float64bits(f)), nil
+		case f >= 0:
+			return appendcborhead(b, cboruint, uint64(f)), nil
+		}
+		return appendcborhead(b, cbornegint, uint64(-f)-1), nil
+	case Tstring:
+		str := s.Tobytes(index)
+		major := byte(cbortext)
+		if !utf8.Valid(str) {
+			major = cborbytes
+		}
+		return append(appendcborhead(b, major, uint64(len(str))), str...), nil
+	case Tlightuserdata:
+		if s.Touserdata(index) == nil {
+			return append(b, cborsimple|22), nil
+		}
+	case Ttable:
+		if depth >= maxnesting {
+			return nil, errnesting
+		}
+		return s.appendcbortable(b, index, depth)
+	}
+	return nil, fmt.Errorf("cannot encode %s", s.Typename(s.Type(index)))
+}
+
+func (s *State) appendcbortable(b []byte, index, depth int) ([]byte, error) {
+	if err := s.grow(2); err != nil {
+		return nil, err
+	}
+	n := s.Tablecount(index)
+	if s.Arraylen(index) == n {
+		b = appendcborhead(b, cborarray, uint64(n))
+		for i := 1; i <= n; i++ {
+			s.Rawgeti(index, i)
+			var err error
+			b, err = s.appendcbor(b, s.Gettop(), depth+1)
+			s.Pop(1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	type pair struct {
+		key, val []byte
+	}
+	pairs := make([]pair, 0, n)
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		top := s.Gettop()
+		key, err := s.appendcbor(nil, top-1, depth+1)
+		if err == nil {
+			var val []byte
+			if val, err = s.appendcbor(nil, top, depth+1); err == nil {
+				pairs = append(pairs, pair{key, val})
+			}
+		}
+		s.Pop(1)
+		if err != nil {
+			s.Pop(1)
+			return nil, err
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+	b = appendcborhead(b, cbormap, uint64(len(pairs)))
+	for _, p := range pairs {
+		b = append(append(b, p.key...), p.val...)
+	}
+	return b, nil
+}
+
+type cbordecoder struct {
+	data []byte
+}
+
+func (d *cbordecoder) next(n uint64) ([]byte, error) {
+	if uint64(len(d.data)) < n {
+		return nil, errcboreof
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// Reads the head of a data item, returning its major type, additional
+// information, and argument. The argument of an indefinite length is 0.
+func (d *cbordecoder) head() (major, info byte, n uint64, err error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]&0xe0, b[0]&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info <= 27:
+		if b, err = d.next(1 << (info - 24)); err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return major, info, n, nil
+	case info == cborindefinite && major >= cborbytes && major <= cbormap:
+		return major, info, 0, nil
+	case info == cborindefinite && b[0] == cborbreak:
+		return 0, 0, 0, errors.New("cbor: unexpected break")
+	}
+	return 0, 0, 0, fmt.Errorf("cbor: invalid initial byte 0x%02x", b[0])
+}
+
+// Reports whether the next byte ends an item of indefinite length, and
+// skips it if so.
+func (d *cbordecoder) isbreak() (bool, error) {
+	if len(d.data) == 0 {
+		return false, errcboreof
+	}
+	if d.data[0] != cborbreak {
+		return false, nil
+	}
+	d.data = d.data[1:]
+	return true, nil
+}
+
+// Reads the contents of a byte or text string, joining the chunks of an
+// indefinite length string.
+func (d *cbordecoder) string(major, info byte, n uint64) ([]byte, error) {
+	if info != cborindefinite {
+		return d.next(n)
+	}
+	var b []byte
+	for {
+		if end, err := d.isbreak(); end || err != nil {
+			return b, err
+		}
+		m, info, n, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || info == cborindefinite {
+			return nil, errors.New("cbor: invalid chunk in indefinite length string")
+		}
+		chunk, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+}
+
+func (s *State) pushcbor(d *cbordecoder, depth int) error {
+	if depth > maxnesting {
+		return errnesting
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cboruint:
+		s.Pushnumber(float64(n))
+	case cbornegint:
+		s.Pushnumber(-1 - float64(n))
+	case cborbytes, cbortext:
+		b, err := d.string(major, info, n)
+		if err != nil {
+			return err
+		}
+		s.Pushbytes(b)
+	case cborarray:
+		return s.pushcborarray(d, info, n, depth)
+	case cbormap:
+		return s.pushcbormap(d, info, n, depth)
+	case cbortag:
+		return s.pushcbor(d, depth+1)
+	case cborsimple:
+		switch info {
+		case 20, 21:
+			s.Pushboolean(info == 21)
+		case 22, 23:
+			s.Pushlightuserdata(nil)
+		case 25:
+			s.Pushnumber(halftofloat(uint16(n)))
+		case 26:
+			s.Pushnumber(float64(math.Float32frombits(uint32(n))))
+		case 27:
+			s.Pushnumber(math.Float64frombits(n))
+		default:
+			return fmt.Errorf("cbor: unsupported simple value %d", n)
+		}
+	}
+	return nil
+}
+
+func (s *State) pushcborarray(d *cbordecoder, info byte, n uint64, depth int) error {
+	if info == cborindefinite {
+		s.Newtable()
+		for i := 1; ; i++ {
+			if end, err := d.isbreak(); end || err != nil {
+				return err
+			}
+			if err := s.pushcbor(d, depth+1); err != nil {
+				return err
+			}
+			s.Rawseti(-2, i)
+		}
+	}
+	if n > uint64(len(d.data)) {
+		return errcboreof
+	}
+	s.Createtable(int(n), 0)
+	for i := 1; i <= int(n); i++ {
+		if err := s.pushcbor(d, depth+1); err != nil {
+			return err
+		}
+		s.Rawseti(-2, i)
+	}
+	return nil
+}
+
+func (s *State) pushcbormap(d *cbordecoder, info byte, n uint64, depth int) error {
+	if info == cborindefinite {
+		s.Newtable()
+		for {
+			if end, err := d.isbreak(); end || err != nil {
+				return err
+			}
+			if err := s.pushcborpair(d, depth); err != nil {
+				return err
+			}
+		}
+	}
+	if n > uint64(len(d.data)) {
+		return errcboreof
+	}
+	s.Createtable(0, int(n))
+	for i := uint64(0); i < n; i++ {
+		if err := s.pushcborpair(d, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reads a key and value and sets them in the table on top of the stack.
+func (s *State) pushcborpair(d *cbordecoder, depth int) error {
+	if err := s.pushcbor(d, depth+1); err != nil {
+		return err
+	}
+	if err := s.pushcbor(d, depth+1); err != nil {
+		return err
+	}
+	if f := s.Tonumber(-2); s.Isnumber(-2) && f != f {
+		return errors.New("cbor: map key is NaN")
+	}
+	s.Rawset(-3)
+	return nil
+}
+
+// Converts an IEEE 754 half-precision float.
+func halftofloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant != 0 {
+			f = math.NaN()
+		} else {
+			f = math.Inf(1)
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
@@ -0,0 +1,103 @@
+package luajit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestOpencbor(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Opencbor(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Loadstring(`
+		local cbor = require("cbor")
+		local v = cbor.decode(cbor.encode({name = "x", list = {1, -500, 2.5, "\255"}, ok = false}))
+		local cyclic = {} cyclic.self = cyclic
+		return v.name, v.ok, table.concat(v.list, " "), cbor.decode("\246") == cbor.null,
+			(pcall(cbor.encode, cyclic)), (pcall(cbor.decode, "\130\1")), pcall(cbor.encode, print)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[x false 1 -500 2.5 \xff true false false cannot encode function]"
+	if fmt.Sprint(v) != want {
+		t.Errorf("expected %q, got %q", want, fmt.Sprint(v))
+	}
+}
+
+func TestTocbor(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`return {1, "ab", true}, {b = 1, [10] = 0.5}, -500, 2^32, nil`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 5, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for i, want := range [][]byte{
+		{0x83, 0x01, 0x62, 'a', 'b', 0xf5},
+		{0xa2, 0x0a, 0xfb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0, 0x61, 'b', 0x01},
+		{0x39, 0x01, 0xf3},
+		{0x1b, 0, 0, 0, 0x01, 0, 0, 0, 0},
+		{0xf6},
+	} {
+		b, err := s.Tocbor(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("value %d: expected % x, got % x", i+1, want, b)
+		}
+	}
+}
+
+func TestPushcbor(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	// {_ "a": [_ 1, 1.5 as a half float, (_ h'68', h'69')], "t": 1(0)}
+	data := []byte{0xbf, 0x61, 'a', 0x9f, 0x01, 0xf9, 0x3e, 0x00, 0x5f, 0x41, 'h', 0x41, 'i', 0xff, 0xff,
+		0x61, 't', 0xc1, 0x00, 0xff}
+	if err := s.Pushcbor(data); err != nil {
+		t.Fatal(err)
+	}
+	s.Getfield(-1, "a")
+	for i, want := range []string{"1", "1.5", "hi"} {
+		s.Rawgeti(-1, i+1)
+		if s.Tostring(-1) != want {
+			t.Errorf("element %d: expected %s, got %s", i+1, want, s.Tostring(-1))
+		}
+		s.Pop(1)
+	}
+	s.Getfield(-2, "t")
+	if s.Tonumber(-1) != 0 {
+		t.Errorf("expected 0, got %s", s.Tostring(-1))
+	}
+	s.Settop(0)
+	for _, bad := range [][]byte{{0x82, 0x01}, {0x01, 0x02}, {0x63, 'a'}, {0xff}, {0x1c}, {0x9f, 0x01}, {}} {
+		if err := s.Pushcbor(bad); err == nil {
+			t.Errorf("expected an error decoding % x", bad)
+		}
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected an empty stack, got %d values", s.Gettop())
+	}
+}
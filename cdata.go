@@ -0,0 +1,167 @@
+package luajit
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+// Registry field holding the Lua helpers for exchanging cdata.
+const cdatafield = "luajit.cdata"
+
+// The helpers, made from the ffi module given as argument. Values are
+// copied through an array of one element, which works for scalars as
+// well as for structs and arrays.
+const cdatachunk = `
+local ffi = ...
+local tostring = tostring
+return {
+	ctype = function(v)
+		return (tostring(ffi.typeof(v)):match("^ctype<(.*)>$"))
+	end,
+	new = function(ct, data)
+		ct = ffi.typeof(ct)
+		local n = ffi.sizeof(ct)
+		if n ~= #data then
+			error("size of " .. tostring(ct) .. " is " .. tostring(n) .. ", not " .. #data, 0)
+		end
+		local v = ffi.new(ct)
+		if pcall(ffi.copy, v, data, n) then
+			return v
+		end
+		local a = ffi.new(ffi.typeof("$[1]", ct))
+		ffi.copy(a, data, n)
+		return a[0]
+	end,
+	pointer = function(p)
+		return ffi.cast("uint8_t *", p)
+	end,
+	bytes = function(v)
+		local ct = ffi.typeof(v)
+		local n = ffi.sizeof(ct)
+		if not n then
+			error("size of " .. tostring(ct) .. " is unknown", 0)
+		end
+		return ffi.string(ffi.new(ffi.typeof("$[1]", ct), v), n)
+	end,
+}`
+
+// Calls the cdata helper name with the values on top of the stack as
+// arguments, and leaves nresults results in their place.
+func (s *State) callcdata(name string, nargs, nresults int) error {
+	if err := s.ffihelpers(cdatafield, cdatachunk); err != nil {
+		s.Pop(nargs)
+		return err
+	}
+	s.Getfield(-1, name)
+	s.Remove(-2)
+	s.Insert(-(nargs + 1))
+	if err := s.Pcall(nargs, nresults, 0); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(1)
+		return err
+	}
+	return nil
+}
+
+// Returns the C type of the cdata at the given valid index, as the FFI
+// prints it, such as "struct point" or "double [4]".
+func (s *State) Ctype(index int) (string, error) {
+	if s.Type(index) != Tcdata {
+		return "", fmt.Errorf("cdata expected, got %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(3); err != nil {
+		return "", err
+	}
+	s.Pushvalue(index)
+	if err := s.callcdata("ctype", 1, 1); err != nil {
+		return "", err
+	}
+	defer s.Pop(1)
+	return s.Tostring(-1), nil
+}
+
+// Pushes a new cdata of the C type ctype, such as "struct point" for a
+// type declared with ffi.cdef, holding a copy of data, which must have
+// the size of the type. As when Lua code reads a C value, a scalar type
+// that converts to a Lua number, such as "double", gives a number rather
+// than a cdata. The ffi library must be loaded.
+func (s *State) Pushcdata(ctype string, data []byte) error {
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.Pushstring(ctype)
+	s.Pushbytes(data)
+	return s.callcdata("new", 2, 1)
+}
+
+// Returns a copy of the bytes of the cdata at the given valid index,
+// which must be of a type of known size.
+func (s *State) Tocdata(index int) ([]byte, error) {
+	if s.Type(index) != Tcdata {
+		return nil, fmt.Errorf("cdata expected, got %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(3); err != nil {
+		return nil, err
+	}
+	s.Pushvalue(index)
+	if err := s.callcdata("bytes", 1, 1); err != nil {
+		return nil, err
+	}
+	defer s.Pop(1)
+	return s.Tobytes(-1), nil
+}
+
+// Pushes v as a new cdata of the C type ctype, as Pushcdata does with the
+// bytes of v. T must be plain data, made of numbers, booleans, arrays and
+// structs, laid out like ctype, as in
+//
+//	type point struct{ X, Y float64 }	// struct point { double x, y; };
+func Pushcvalue[T any](s *State, ctype string, v T) error {
+	if !plaindata(reflect.TypeOf(v)) {
+		return fmt.Errorf("cannot push %T as cdata", v)
+	}
+	return s.Pushcdata(ctype, unsafe.Slice((*byte)(unsafe.Pointer(&v)), unsafe.Sizeof(v)))
+}
+
+// Returns the value of the cdata at the given valid index as a T, which
+// must be plain data of the same size, as for Pushcvalue.
+func Tocvalue[T any](s *State, index int) (T, error) {
+	var v T
+	if !plaindata(reflect.TypeOf(v)) {
+		return v, fmt.Errorf("cannot convert cdata to %T", v)
+	}
+	b, err := s.Tocdata(index)
+	if err != nil {
+		return v, err
+	}
+	if len(b) != int(unsafe.Sizeof(v)) {
+		return v, fmt.Errorf("cdata of %d bytes does not fit %T of %d", len(b), v, unsafe.Sizeof(v))
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&v)), len(b)), b)
+	return v, nil
+}
+
+// Reports whether values of type t hold no pointers, so that their bytes
+// can be copied to and from C.
+func plaindata(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Array:
+		return plaindata(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !plaindata(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package luajit
+
+import "testing"
+
+func TestCdata(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	type point struct{ X, Y float64 }
+	if err := s.Loadstring(`require("ffi").cdef("struct point { double x, y; };")`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	err := s.Loadstring(`
+		local ffi = require("ffi")
+		local p = ...
+		assert(p.x == 1 and p.y == 2)
+		return ffi.new("struct point", p.x + 2, p.y + 2), ffi.new("int32_t[3]", 7, 8, 9)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := Pushcvalue(s, "struct point", point{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pcall(1, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	if ct, err := s.Ctype(1); err != nil || ct != "struct point" {
+		t.Errorf("expected struct point, got %q, %v", ct, err)
+	}
+	p, err := Tocvalue[point](s, 1)
+	if err != nil || p != (point{3, 4}) {
+		t.Errorf("expected {3 4}, got %v, %v", p, err)
+	}
+	a, err := Tocvalue[[3]int32](s, 2)
+	if err != nil || a != [3]int32{7, 8, 9} {
+		t.Errorf("expected [7 8 9], got %v, %v", a, err)
+	}
+	if _, err := Tocvalue[[2]int32](s, 2); err == nil {
+		t.Error("expected error for a value of the wrong size")
+	}
+	if _, err := Tocvalue[*int](s, 2); err == nil {
+		t.Error("expected error for a pointer type")
+	}
+	s.Pop(2)
+
+	if err := s.Pushcdata("int32_t", []byte{1, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Isnumber(-1) || s.Tointeger(-1) != 1 {
+		t.Errorf("expected number 1, got %s", s.Typename(s.Type(-1)))
+	}
+	s.Pop(1)
+	if err := s.Pushcdata("int32_t", []byte{1}); err == nil {
+		t.Error("expected error for data of the wrong size")
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack, got %d values", n)
+	}
+}
@@ -0,0 +1,202 @@
+package luajit
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Pushes the Go channel ch onto the stack as a userdata through which Lua
+// code exchanges values with goroutines:
+//
+//	ch:send(v)		sends v, converted as by Unmarshal, blocking
+//				until it is received
+//	v, ok = ch:recv()	receives a value, converted as by Push, blocking
+//				until there is one; ok is false, and v nil, if
+//				ch is closed
+//	sent = ch:trysend(v)	sends v if that does not block
+//	v, ok = ch:tryrecv()	receives a value if that does not block;
+//				returns nothing if it would
+//	ch:close()		closes ch
+//	#ch			the number of values buffered in ch
+//
+// Blocking operations block the whole state, and the goroutine running
+// it, as any Go function called from Lua does. See Openchannel for
+// creating channels and waiting on several of them from Lua.
+func (s *State) Pushchannel(ch interface{}) error {
+	t := reflect.TypeOf(ch)
+	if t == nil || t.Kind() != reflect.Chan || reflect.ValueOf(ch).IsNil() {
+		return fmt.Errorf("cannot push %T as a channel", ch)
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.pushhandle(ch)
+	if s.proxymeta("luajit.chan:" + t.String()) {
+		s.Createtable(0, len(chanmethods))
+		for name, fn := range chanmethods {
+			s.Pushfunction(fn)
+			s.Setfield(-2, name)
+		}
+		s.Setfield(-2, "__index")
+		s.Pushfunction(chanlen)
+		s.Setfield(-2, "__len")
+	}
+	s.Setmetatable(-2)
+	return nil
+}
+
+// Returns the channel at the given valid index, or an error naming the
+// argument that should hold it.
+func (s *State) tochan(index int, dir reflect.ChanDir) (reflect.Value, error) {
+	obj, ok := s.toobject(index)
+	v := reflect.ValueOf(obj)
+	if !ok || v.Kind() != reflect.Chan {
+		return reflect.Value{}, fmt.Errorf("bad argument #%d (channel expected, got %s)", index, s.Typename(s.Type(index)))
+	}
+	if v.Type().ChanDir()&dir == 0 {
+		return reflect.Value{}, fmt.Errorf("bad argument #%d (%s does not allow the operation)", index, v.Type())
+	}
+	return v, nil
+}
+
+// Returns the value at index 2 converted to the element type of ch.
+func (s *State) tochanelem(ch reflect.Value) (reflect.Value, error) {
+	e := reflect.New(ch.Type().Elem()).Elem()
+	err := s.unmarshal(2, e, "bad argument #2", 0)
+	return e, err
+}
+
+// Pushes the result of a receive, and returns the number of results.
+func (s *State) pushrecv(v reflect.Value, ok bool) int {
+	if !ok {
+		s.Pushnil()
+	} else if err := s.push(v, 0); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Pushboolean(ok)
+	return 2
+}
+
+var chanmethods = map[string]Gofunction{
+	"send": func(s *State) int {
+		ch, err := s.tochan(1, reflect.SendDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		e, err := s.tochanelem(ch)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		ch.Send(e)
+		return 0
+	},
+	"recv": func(s *State) int {
+		ch, err := s.tochan(1, reflect.RecvDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		return s.pushrecv(ch.Recv())
+	},
+	"trysend": func(s *State) int {
+		ch, err := s.tochan(1, reflect.SendDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		e, err := s.tochanelem(ch)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		s.Pushboolean(ch.TrySend(e))
+		return 1
+	},
+	"tryrecv": func(s *State) int {
+		ch, err := s.tochan(1, reflect.RecvDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		v, ok := ch.TryRecv()
+		if !v.IsValid() {
+			return 0 // it would block
+		}
+		return s.pushrecv(v, ok)
+	},
+	"close": func(s *State) int {
+		ch, err := s.tochan(1, reflect.SendDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		ch.Close()
+		return 0
+	},
+}
+
+var chanlen Gofunction = func(s *State) int {
+	ch, err := s.tochan(1, reflect.BothDir)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Pushinteger(ch.Len())
+	return 1
+}
+
+// Makes the module "channel" available to require, with functions to
+// create channels and to wait on several of them:
+//
+//	channel.new([size])	returns a new channel of Go values, as by
+//				make(chan interface{}, size)
+//	i, v, ok = channel.select(ch1, ch2, ...)
+//				receives from whichever channel is ready first;
+//				i is its position among the arguments, and v and
+//				ok are as for ch:recv()
+//	channel.tryselect(ch1, ch2, ...)
+//				the same, but returns nothing if no channel is
+//				ready
+//
+// Values sent on channels made by channel.new are converted as by
+// Tovalue. The package library must be open.
+func (s *State) Openchannel() error {
+	return s.Preloadfuncs("channel", map[string]Gofunction{
+		"new": func(s *State) int {
+			size := s.Tointeger(1)
+			if size < 0 {
+				return s.Errorf("bad argument #1 (size must not be negative)")
+			}
+			if err := s.Pushchannel(make(chan interface{}, size)); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			return 1
+		},
+		"select": func(s *State) int {
+			return chanselect(s, false)
+		},
+		"tryselect": func(s *State) int {
+			return chanselect(s, true)
+		},
+	})
+}
+
+// Receives from the first ready channel among the arguments, or returns
+// nothing if none is ready and try is true.
+func chanselect(s *State, try bool) int {
+	n := s.Gettop()
+	if n == 0 {
+		return s.Errorf("bad argument #1 (channel expected, got no value)")
+	}
+	cases := make([]reflect.SelectCase, n, n+1)
+	for i := range cases {
+		ch, err := s.tochan(i+1, reflect.RecvDir)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: ch}
+	}
+	if try {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+	i, v, ok := reflect.Select(cases)
+	if i == n {
+		return 0
+	}
+	s.Pushinteger(i + 1)
+	return 1 + s.pushrecv(v, ok)
+}
@@ -0,0 +1,56 @@
+package luajit
+
+import "testing"
+
+func TestChannel(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Openchannel(); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := make(chan int, 2)
+	results := make(chan string)
+	if err := s.Pushchannel((<-chan int)(jobs)); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("jobs")
+	if err := s.Pushchannel(results); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("results")
+	jobs <- 21
+	close(jobs)
+
+	done := make(chan error)
+	go func() {
+		err := s.Loadstring(`
+			local channel = require("channel")
+			assert(#jobs == 1)
+			local n, ok = jobs:recv()
+			results:send(n * 2)
+			assert(jobs:recv() == nil)
+			assert(not pcall(jobs.send, jobs, 1))
+			local ch = channel.new(1)
+			assert(ch:tryrecv() == nil and ch:trysend("x") and not ch:trysend("y"))
+			assert(channel.tryselect(jobs) == 1)
+			local i, v, ok = channel.select(ch)
+			assert(i == 1 and v == "x" and ok)
+			assert(channel.tryselect(ch) == nil)
+		`)
+		if err == nil {
+			err = s.Pcall(0, 0, 0)
+		}
+		done <- err
+	}()
+	if r := <-results; r != "42" {
+		t.Errorf("expected 42, got %s", r)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
@@ -0,0 +1,73 @@
+package luajit
+
+import (
+	"fmt"
+	"math"
+)
+
+// Returns the error of the Check functions for a value of the wrong type.
+func (s *State) checkerror(index int, want string) error {
+	return fmt.Errorf("index %d: %s expected, got %s", index, want, s.Typename(s.Type(index)))
+}
+
+// Returns the string at the given acceptable index, or an error naming the
+// index and the type of the value if it is not a string. Unlike Tostring,
+// Checkstring does not convert numbers, so that results of untrusted
+// scripts are taken only as they were meant.
+func (s *State) Checkstring(index int) (string, error) {
+	if !s.Isstring(index) {
+		return "", s.checkerror(index, "string")
+	}
+	return s.Tostring(index), nil
+}
+
+// Returns the boolean at the given acceptable index, or an error if the
+// value is not a boolean. Unlike Toboolean, Checkboolean does not take nil
+// for false or other values for true.
+func (s *State) Checkboolean(index int) (bool, error) {
+	if !s.Isboolean(index) {
+		return false, s.checkerror(index, "boolean")
+	}
+	return s.Toboolean(index), nil
+}
+
+// Returns the number at the given acceptable index, or an error if the
+// value is not a number. Strings are not converted.
+func (s *State) Checknumber(index int) (float64, error) {
+	if !s.Isnumber(index) {
+		return 0, s.checkerror(index, "number")
+	}
+	return s.Tonumber(index), nil
+}
+
+// Returns the number at the given acceptable index as an int, or an error
+// if the value is not a number, or is a number without a fractional part
+// that fits an int. Unlike Tointeger, Checkinteger never truncates.
+func (s *State) Checkinteger(index int) (int, error) {
+	f, err := s.Checknumber(index)
+	if err != nil {
+		return 0, err
+	}
+	if f != math.Trunc(f) || f < math.MinInt || f >= math.MaxInt {
+		return 0, fmt.Errorf("index %d: number %v has no integer representation", index, f)
+	}
+	return int(f), nil
+}
+
+// Returns an error if the value at the given acceptable index is not a
+// table.
+func (s *State) Checktable(index int) error {
+	if !s.Istable(index) {
+		return s.checkerror(index, "table")
+	}
+	return nil
+}
+
+// Returns an error if the value at the given acceptable index is not a
+// function.
+func (s *State) Checkfunction(index int) error {
+	if !s.Isfunction(index) {
+		return s.checkerror(index, "function")
+	}
+	return nil
+}
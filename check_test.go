@@ -0,0 +1,56 @@
+package luajit
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`return "name", true, 42, 1.5, "7", {}, print`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 7, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if str, err := s.Checkstring(1); str != "name" || err != nil {
+		t.Errorf("unexpected string %q %v", str, err)
+	}
+	if b, err := s.Checkboolean(2); !b || err != nil {
+		t.Errorf("unexpected boolean %v %v", b, err)
+	}
+	if n, err := s.Checkinteger(3); n != 42 || err != nil {
+		t.Errorf("unexpected integer %v %v", n, err)
+	}
+	if f, err := s.Checknumber(4); f != 1.5 || err != nil {
+		t.Errorf("unexpected number %v %v", f, err)
+	}
+	if err := s.Checktable(6); err != nil {
+		t.Error(err)
+	}
+	if err := s.Checkfunction(-1); err != nil {
+		t.Error(err)
+	}
+
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{second(s.Checkstring(3)), "index 3: string expected, got number"},
+		{second(s.Checkboolean(8)), "index 8: boolean expected, got no value"},
+		{second(s.Checknumber(5)), "index 5: number expected, got string"},
+		{second(s.Checkinteger(4)), "index 4: number 1.5 has no integer representation"},
+		{s.Checktable(-1), "index -1: table expected, got function"},
+		{s.Checkfunction(6), "index 6: function expected, got table"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("expected error %s, got %v", test.want, test.err)
+		}
+	}
+}
+
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,88 @@
+package luajit
+
+/*
+#include <luaconf.h>
+*/
+import "C"
+import (
+	"errors"
+	"strings"
+)
+
+// Size of the short_src field of debug information.
+const idsize = C.LUA_IDSIZE
+
+// Returns the chunkname for a chunk read from the file path, "@" followed
+// by the path, which messages show as the path, or as its last characters
+// if it is long.
+func Chunkfile(path string) string {
+	return "@" + path
+}
+
+// Returns the chunkname for a chunk that messages should show as name,
+// such as "template:header" for code generated from a template: "="
+// followed by name, which is shown as is, but cut to fit short_src.
+func Chunkdisplay(name string) string {
+	return "=" + name
+}
+
+// Returns the chunkname for a chunk that messages should show by its
+// source text, such as [string "return x + 1"], as Loadstring does. The
+// text is shown up to its first line break, and cut if long. A text
+// starting with '@' or '=' gets a leading space, lest it be taken for a
+// file or display name.
+func Chunkliteral(text string) string {
+	if strings.HasPrefix(text, "@") || strings.HasPrefix(text, "=") {
+		return " " + text
+	}
+	return text
+}
+
+// Returns the printable version of chunkname that LuaJIT puts in error
+// messages and the field Shortsrc of debug information, following the
+// conventions of Chunkfile, Chunkdisplay, and Chunkliteral.
+func Shortsrc(chunkname string) string {
+	switch {
+	case strings.HasPrefix(chunkname, "="):
+		name := chunkname[1:]
+		if len(name) > idsize-1 {
+			name = name[:idsize-1]
+		}
+		return name
+	case strings.HasPrefix(chunkname, "@"):
+		name := chunkname[1:]
+		if len(name) >= idsize {
+			name = "..." + name[len(name)-(idsize-4):]
+		}
+		return name
+	}
+	n := 0
+	for n < len(chunkname) && n < idsize-12 && chunkname[n] >= ' ' {
+		n++
+	}
+	if n == len(chunkname) {
+		return `[string "` + chunkname + `"]`
+	}
+	if n > idsize-15 {
+		n = idsize - 15
+	}
+	return `[string "` + chunkname[:n] + `..."]`
+}
+
+// Returns the chunkname of the Lua function at the given valid index, and
+// its printable version as in Shortsrc. Go functions have the chunkname
+// "=[C]".
+func (s *State) Chunkname(index int) (chunkname, shortsrc string, err error) {
+	if !s.Isfunction(index) {
+		return "", "", errors.New("not a function")
+	}
+	if err := s.grow(1); err != nil {
+		return "", "", err
+	}
+	s.Pushvalue(index)
+	ar := Newdebug(s)
+	if err := ar.Getinfo(">S"); err != nil {
+		return "", "", err
+	}
+	return ar.Source, ar.Shortsrc, nil
+}
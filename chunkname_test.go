@@ -0,0 +1,59 @@
+package luajit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShortsrc(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 7)
+	for _, test := range []struct {
+		chunkname, want string
+	}{
+		{Chunkfile("scripts/main.lua"), "scripts/main.lua"},
+		{Chunkfile(long), "..." + long[len(long)-56:]},
+		{Chunkdisplay("template:header"), "template:header"},
+		{Chunkdisplay(long), long[:59]},
+		{Chunkliteral("return x + 1"), `[string "return x + 1"]`},
+		{Chunkliteral("local x\nreturn x"), `[string "local x..."]`},
+		{Chunkliteral(long), `[string "` + long[:45] + `..."]`},
+		{Chunkliteral("=x"), `[string " =x"]`},
+	} {
+		if got := Shortsrc(test.chunkname); got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.chunkname, test.want, got)
+		}
+	}
+}
+
+func TestChunkname(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	for _, chunkname := range []string{
+		Chunkfile(strings.Repeat("dir/", 20) + "main.lua"),
+		Chunkdisplay("generated"),
+		Chunkliteral("@literal\nerror('x')"),
+	} {
+		if err := s.Loadbuffer([]byte("error('x')"), chunkname); err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		name, short, err := s.Chunkname(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != chunkname || short != Shortsrc(chunkname) {
+			t.Errorf("expected %s and %s, got %s and %s", chunkname, Shortsrc(chunkname), name, short)
+		}
+		if err := s.Pcall(0, 0, 0); err == nil || s.Tostring(-1) != short+":1: x" {
+			t.Errorf("unexpected error message %s", s.Tostring(-1))
+		}
+		s.Pop(1)
+	}
+	s.Getglobal("print")
+	if _, short, err := s.Chunkname(-1); err != nil || short != "[C]" {
+		t.Errorf("expected [C], got %s %v", short, err)
+	}
+}
@@ -0,0 +1,188 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replaces os.time, os.clock and os.date with functions reading the time
+// from now, such as a fake clock in tests:
+//
+//	os.time([t])		now as seconds since January 1, 1970 UTC, or
+//				the time given by the table t, in the
+//				location of now
+//	os.clock()		seconds elapsed on the clock since Setclock
+//	os.date([fmt [, t]])	now or the time t formatted as by the C
+//				strftime, or as a table for "*t"; a leading
+//				"!" formats in UTC
+//
+// The os library must be open.
+func (s *State) Setclock(now func() time.Time) error {
+	start := now()
+	s.Getglobal("os")
+	defer s.Pop(1)
+	if !s.Istable(-1) {
+		return errors.New("os library not open")
+	}
+	s.Pushfunction(func(s *State) int {
+		if s.Isnoneornil(1) {
+			s.Pushnumber(float64(now().Unix()))
+			return 1
+		}
+		if !s.Istable(1) {
+			return s.Errorf("bad argument #1 to 'time' (table expected, got %s)", s.Typename(s.Type(1)))
+		}
+		field := func(name string, def int) (int, error) {
+			s.Getfield(1, name)
+			defer s.Pop(1)
+			if s.Isnil(-1) {
+				if def < 0 {
+					return 0, fmt.Errorf("field '%s' missing in date table", name)
+				}
+				return def, nil
+			}
+			return s.Tointeger(-1), nil
+		}
+		var f [6]int
+		for i, name := range []string{"year", "month", "day", "hour", "min", "sec"} {
+			def := []int{-1, -1, -1, 12, 0, 0}[i]
+			v, err := field(name, def)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			f[i] = v
+		}
+		t := time.Date(f[0], time.Month(f[1]), f[2], f[3], f[4], f[5], 0, now().Location())
+		s.Pushnumber(float64(t.Unix()))
+		return 1
+	})
+	s.Setfield(-2, "time")
+	s.Pushfunction(func(s *State) int {
+		s.Pushnumber(now().Sub(start).Seconds())
+		return 1
+	})
+	s.Setfield(-2, "clock")
+	s.Pushfunction(func(s *State) int {
+		format := "%c"
+		if s.Isstring(1) {
+			format = s.Tostring(1)
+		}
+		t := now()
+		if s.Isnumber(2) {
+			t = time.Unix(int64(s.Tonumber(2)), 0).In(t.Location())
+		}
+		if strings.HasPrefix(format, "!") {
+			format = format[1:]
+			t = t.UTC()
+		}
+		if strings.HasPrefix(format, "*t") {
+			s.Createtable(0, 9)
+			for _, kv := range []struct {
+				k string
+				v int
+			}{
+				{"year", t.Year()}, {"month", int(t.Month())}, {"day", t.Day()},
+				{"hour", t.Hour()}, {"min", t.Minute()}, {"sec", t.Second()},
+				{"wday", int(t.Weekday()) + 1}, {"yday", t.YearDay()},
+			} {
+				s.Pushinteger(kv.v)
+				s.Setfield(-2, kv.k)
+			}
+			s.Pushboolean(false)
+			s.Setfield(-2, "isdst")
+			return 1
+		}
+		str, err := strftime(t, format)
+		if err != nil {
+			return s.Errorf("bad argument #1 to 'date' (%s)", err.Error())
+		}
+		s.Pushstring(str)
+		return 1
+	})
+	s.Setfield(-2, "date")
+	return nil
+}
+
+// Formats t as the C strftime does in the C locale, for the conversions
+// Lua scripts commonly use.
+func strftime(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		if i++; i == len(format) {
+			return "", errors.New("invalid conversion specifier '%'")
+		}
+		switch format[i] {
+		case 'a':
+			b.WriteString(t.Format("Mon"))
+		case 'A':
+			b.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			b.WriteString(t.Format("Jan"))
+		case 'B':
+			b.WriteString(t.Format("January"))
+		case 'c':
+			b.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'D', 'x':
+			b.WriteString(t.Format("01/02/06"))
+		case 'e':
+			b.WriteString(t.Format("_2"))
+		case 'F':
+			b.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'I':
+			b.WriteString(t.Format("03"))
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'p':
+			b.WriteString(t.Format("PM"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'T', 'X':
+			b.WriteString(t.Format("15:04:05"))
+		case 'w':
+			b.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'y':
+			b.WriteString(t.Format("06"))
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'z':
+			b.WriteString(t.Format("-0700"))
+		case 'Z':
+			b.WriteString(t.Format("MST"))
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("invalid conversion specifier '%%%c'", format[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// Makes the state behave the same on every run, for testing scripts: the
+// os library reads the time from now, as set by Setclock, and math.random
+// draws from a source seeded with seed, as set by Setrandom. The os and
+// math libraries must be open.
+func (s *State) Deterministic(now func() time.Time, seed uint64) error {
+	if err := s.Setclock(now); err != nil {
+		return err
+	}
+	return s.Setrandom(rand.NewPCG(seed, seed))
+}
@@ -0,0 +1,68 @@
+package luajit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { return now }
+	if err := s.Deterministic(clock, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Loadstring(`
+		assert(os.time() == 1704164645)
+		assert(os.time({year = 2024, month = 1, day = 2, hour = 3, min = 4, sec = 5}) == os.time())
+		assert(os.date("%Y-%m-%d %H:%M:%S") == "2024-01-02 03:04:05")
+		assert(os.date("!%c", 0) == "Thu Jan  1 00:00:00 1970")
+		local d = os.date("*t")
+		assert(d.year == 2024 and d.wday == 3 and d.yday == 2)
+		assert(not pcall(os.date, "%Q"))
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	now = now.Add(1500 * time.Millisecond)
+	if err := s.Loadstring(`return os.clock(), math.random(1000000)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v[0] != 1.5 {
+		t.Errorf("expected os.clock() 1.5, got %v", v[0])
+	}
+
+	s2 := Newstate()
+	if s2 == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s2.Close()
+	s2.Openlibs()
+	if err := s2.Deterministic(clock, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.Loadstring(`return math.random(1000000)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s2.Tostring(-1))
+	}
+	w, err := s2.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w[0] != v[1] {
+		t.Errorf("expected the same random value, got %v and %v", v[1], w[0])
+	}
+}
@@ -0,0 +1,349 @@
+package luajit
+
+/*
+#include <lua.h>
+*/
+import "C"
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Creates a new state with the standard libraries open and copies the
+// global variables of s into it, so that a fully initialized template
+// state can be instantiated for each request or tenant. Tables are copied
+// deeply, keeping shared and cyclic references; Lua functions are copied
+// as bytecode with their upvalues and environments; Go functions and Go
+// objects are shared; and the standard library functions refer to those
+// of the new state.
+//
+// Returns an error if a global holds a value that cannot be copied, such
+// as a coroutine, a userdata that does not hold a Go object, or a C
+// function outside the standard libraries. Copied functions no longer
+// share upvalues with each other, and values reachable only through the
+// registry, such as Function references, are not copied.
+func (s *State) Clone() (*State, error) {
+	d := Newstate()
+	if d == nil {
+		return nil, errors.New("cannot create state: not enough memory")
+	}
+	d.Openlibs()
+	top := s.Gettop()
+	defer s.Settop(top)
+	if err := s.grow(3); err != nil {
+		d.Close()
+		return nil, err
+	}
+	d.Newtable()
+	d.Newtable()
+	c := &cloner{src: s, dst: d, memo: d.Gettop() - 1, cfuncs: d.Gettop()}
+
+	d.Pushvalue(Globalsindex)
+	c.setmemo(s.Topointer(Globalsindex))
+	d.Pop(1)
+	paths := append([][]string{nil}, c.pair(Globalsindex, Globalsindex, nil)...)
+	for _, path := range paths {
+		if err := c.fillpath(path); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	d.Settop(0)
+	return d, nil
+}
+
+// Pushes onto the stack of to a copy of the value at the given valid
+// index of from, so that data can be handed between isolated states, such
+// as those of different tenants. Tables are copied deeply with their
+// metatables, keeping shared and cyclic references; Go functions are
+// registered anew in to with copies of their upvalues; and Go objects are
+// shared, as by Clone. Lua and C functions cannot be copied, since they
+// would carry the environment of from along, and neither can coroutines
+// or userdata that do not hold Go objects. On error, nothing is pushed.
+func Copyvalue(from, to *State, index int) error {
+	index = from.absindex(index)
+	if err := to.grow(2); err != nil {
+		return err
+	}
+	top := to.Gettop()
+	to.Newtable()
+	c := &cloner{src: from, dst: to, memo: top + 1, data: true}
+	if err := c.copy(index, 0); err != nil {
+		to.Settop(top)
+		return err
+	}
+	to.Remove(c.memo)
+	return nil
+}
+
+// A cloner copies values from the state src to the state dst.
+type cloner struct {
+	src, dst *State
+	memo     int  // dst index of a table mapping src objects to dst values
+	cfuncs   int  // dst index of a table mapping C functions to dst values
+	data     bool // copying data only, without Lua or C functions
+}
+
+// Pushes onto dst the copy of the src object p, if there is one, and
+// returns whether there is.
+func (c *cloner) getmemo(p unsafe.Pointer) bool {
+	c.dst.Pushlightuserdata(p)
+	c.dst.Rawget(c.memo)
+	if c.dst.Isnil(-1) {
+		c.dst.Pop(1)
+		return false
+	}
+	return true
+}
+
+// Records the value on top of dst as the copy of the src object p.
+func (c *cloner) setmemo(p unsafe.Pointer) {
+	c.dst.Pushlightuserdata(p)
+	c.dst.Pushvalue(-2)
+	c.dst.Rawset(c.memo)
+}
+
+// Pairs the fields of the dst table at dstidx, as created by Openlibs, with
+// the fields of the same names in the src table at srcidx, mapping the
+// standard library tables of src to those of dst, and records the C
+// functions of dst by their C function pointers, which are the same in
+// both states. Returns the paths of the paired tables, whose contents
+// must still be copied.
+func (c *cloner) pair(srcidx, dstidx int, path []string) [][]string {
+	var paths [][]string
+	src, dst := c.src, c.dst
+	if !src.Checkstack(2) || !dst.Checkstack(4) {
+		return nil
+	}
+	dst.Pushnil()
+	for dst.Next(dstidx) != 0 {
+		if f := C.lua_tocfunction(dst.live(), -1); f != nil && !dst.Isgofunction(-1) {
+			dst.Pushlightuserdata(unsafe.Pointer(f))
+			dst.Pushvalue(-2)
+			dst.Rawset(c.cfuncs)
+		}
+		if dst.Type(-2) != Tstring || !dst.Istable(-1) || len(path) == 2 {
+			dst.Pop(1)
+			continue
+		}
+		name := dst.Tostring(-2)
+		src.Pushstring(name)
+		src.Rawget(srcidx)
+		p := src.Topointer(-1)
+		switch {
+		case !src.Istable(-1):
+		case c.getmemo(p):
+			dst.Pop(1)
+		default:
+			c.setmemo(p)
+			sub := append(append([]string(nil), path...), name)
+			paths = append(paths, sub)
+			paths = append(paths, c.pair(src.Gettop(), dst.Gettop(), sub)...)
+		}
+		src.Pop(1)
+		dst.Pop(1)
+	}
+	return paths
+}
+
+// Copies the contents of the src table at path into the dst table at the
+// same path, which pair found in both states.
+func (c *cloner) fillpath(path []string) error {
+	src, dst := c.src, c.dst
+	stop, dtop := src.Gettop(), dst.Gettop()
+	defer src.Settop(stop)
+	defer dst.Settop(dtop)
+	src.Pushvalue(Globalsindex)
+	dst.Pushvalue(Globalsindex)
+	for _, name := range path {
+		src.Getfield(-1, name)
+		dst.Getfield(-1, name)
+	}
+	return c.fill(src.Gettop(), dst.Gettop(), 0)
+}
+
+// Copies the fields of the src table at srcidx into the dst table at
+// dstidx.
+func (c *cloner) fill(srcidx, dstidx, depth int) error {
+	src, dst := c.src, c.dst
+	if err := src.grow(3); err != nil {
+		return err
+	}
+	src.Pushnil()
+	for src.Next(srcidx) != 0 {
+		if err := c.copy(src.Gettop()-1, depth); err != nil {
+			src.Pop(2)
+			return err
+		}
+		if err := c.copy(src.Gettop(), depth); err != nil {
+			src.Pop(2)
+			dst.Pop(1)
+			return err
+		}
+		dst.Rawset(dstidx)
+		src.Pop(1)
+	}
+	return nil
+}
+
+// Pushes onto dst a copy of the value at the valid index idx of src.
+func (c *cloner) copy(idx, depth int) error {
+	src, dst := c.src, c.dst
+	if depth > maxnesting {
+		return errnesting
+	}
+	if err := dst.grow(4); err != nil {
+		return err
+	}
+	if err := src.grow(2); err != nil {
+		return err
+	}
+	switch src.Type(idx) {
+	case Tnil:
+		dst.Pushnil()
+		return nil
+	case Tboolean:
+		dst.Pushboolean(src.Toboolean(idx))
+		return nil
+	case Tnumber:
+		dst.Pushnumber(src.Tonumber(idx))
+		return nil
+	case Tstring:
+		dst.Pushstring(src.Tostring(idx))
+		return nil
+	case Tlightuserdata:
+		dst.Pushlightuserdata(src.Touserdata(idx))
+		return nil
+	}
+
+	p := src.Topointer(idx)
+	if c.getmemo(p) {
+		return nil
+	}
+	switch src.Type(idx) {
+	case Ttable:
+		dst.Newtable()
+		c.setmemo(p)
+		if err := c.fill(idx, dst.Gettop(), depth+1); err != nil {
+			dst.Pop(1)
+			return err
+		}
+		return c.copymeta(idx, depth)
+	case Tfunction:
+		if src.Isgofunction(idx) {
+			return c.copygofunction(idx, depth)
+		}
+		if c.data {
+			return errors.New("cannot copy a Lua or C function as data")
+		}
+		if f := C.lua_tocfunction(src.live(), C.int(idx)); f != nil {
+			dst.Pushlightuserdata(unsafe.Pointer(f))
+			dst.Rawget(c.cfuncs)
+			if dst.Isnil(-1) {
+				dst.Pop(1)
+				return errors.New("cannot copy a C function outside the standard libraries")
+			}
+			return nil
+		}
+		return c.copyfunction(idx, depth)
+	case Tuserdata:
+		obj, ok := src.toobject(idx)
+		if !ok {
+			return errors.New("cannot copy a userdata that does not hold a Go object")
+		}
+		dst.pushhandle(obj)
+		c.setmemo(p)
+		return c.copymeta(idx, depth)
+	}
+	return fmt.Errorf("cannot copy a %s", src.Typename(src.Type(idx)))
+}
+
+// Sets the copy of the metatable of the src value at idx, if any, as the
+// metatable of the value on top of dst.
+func (c *cloner) copymeta(idx, depth int) error {
+	if int(C.lua_getmetatable(c.src.live(), C.int(idx))) == 0 {
+		return nil
+	}
+	defer c.src.Pop(1)
+	if err := c.copy(c.src.Gettop(), depth+1); err != nil {
+		c.dst.Pop(1)
+		return err
+	}
+	c.dst.Setmetatable(-2)
+	return nil
+}
+
+// Pushes onto dst the Go function at idx of src with copies of its
+// upvalues.
+func (c *cloner) copygofunction(idx, depth int) error {
+	src, dst := c.src, c.dst
+	fn, err := src.Togofunction(idx)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for {
+		// Upvalue 1 holds the Go function itself.
+		if _, err := src.Getupvalue(idx, n+2); err != nil {
+			break
+		}
+		err := c.copy(src.Gettop(), depth+1)
+		src.Pop(1)
+		if err != nil {
+			dst.Pop(n)
+			return err
+		}
+		n++
+	}
+	dst.Pushclosure(fn, n)
+	c.setmemo(src.Topointer(idx))
+	return nil
+}
+
+// Pushes onto dst the Lua function at idx of src, loaded from its
+// bytecode, with copies of its upvalues and environment.
+func (c *cloner) copyfunction(idx, depth int) error {
+	src, dst := c.src, c.dst
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	src.Pushvalue(idx)
+	err := src.Dump(w)
+	src.Pop(1)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot dump function: %s", err.Error())
+	}
+	if err := dst.Loadbuffer(buf.Bytes(), "=clone"); err != nil {
+		err = fmt.Errorf("%w: %s", err, dst.Tostring(-1))
+		dst.Pop(1)
+		return err
+	}
+	c.setmemo(src.Topointer(idx))
+
+	for i := 1; ; i++ {
+		if _, err := src.Getupvalue(idx, i); err != nil {
+			break
+		}
+		err := c.copy(src.Gettop(), depth+1)
+		src.Pop(1)
+		if err != nil {
+			dst.Pop(1)
+			return err
+		}
+		dst.Setupvalue(-2, i)
+	}
+	src.Getfenv(idx)
+	err = c.copy(src.Gettop(), depth+1)
+	src.Pop(1)
+	if err != nil {
+		dst.Pop(1)
+		return err
+	}
+	C.lua_setfenv(dst.live(), -2)
+	return nil
+}
@@ -0,0 +1,127 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	s.Register(func(s *State) int {
+		s.Pushnumber(2 * s.Tonumber(1))
+		return 1
+	}, "double")
+	err := s.Loadstring(`
+		config = {name = "template", list = {1, 2, 3}}
+		config.self = config
+		local count = 10
+		function counter() count = count + 1; return count end
+		function shout(x) return string.upper(x) end
+		setmetatable(config, {__index = function(t, k) return k .. "?" end})
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	c, err := s.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	err = c.Loadstring(`
+		assert(config.name == "template" and config.self == config)
+		assert(#config.list == 3 and config.missing == "missing?")
+		assert(counter() == 11 and counter() == 12)
+		assert(shout("x") == "X" and double(4) == 8)
+		config.name = "copy"
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), c.Tostring(-1))
+	}
+	if err := c.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), c.Tostring(-1))
+	}
+
+	if err := s.Loadstring(`return config.name, counter()`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Tostring(1) != "template" || s.Tointeger(2) != 11 {
+		t.Errorf("expected template 11, got %s %s", s.Tostring(1), s.Tostring(2))
+	}
+	s.Pop(2)
+
+	s.Newthread()
+	s.Setglobal("co")
+	if _, err := s.Clone(); err == nil {
+		t.Error("expected error cloning a coroutine")
+	}
+}
+
+func TestCopyvalue(t *testing.T) {
+	from := Newstate()
+	if from == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer from.Close()
+	from.Openlibs()
+	to := Newstate()
+	if to == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer to.Close()
+	to.Openlibs()
+	from.Pushfunction(func(s *State) int {
+		s.Pushstring("hello from Go")
+		return 1
+	})
+	from.Setglobal("greet")
+	err := from.Loadstring(`
+		local shared = {n = 1.5}
+		local t = {name = "tenant", list = {1, 2, 3}, a = shared, b = shared, greet = greet}
+		t.self = t
+		return t, {f = print}, {f = function() end}
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), from.Tostring(-1))
+	}
+	if err := from.Pcall(0, 3, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), from.Tostring(-1))
+	}
+
+	if err := Copyvalue(from, to, 1); err != nil {
+		t.Fatal(err)
+	}
+	to.Setglobal("t")
+	err = to.Loadstring(`return t.name, #t.list, t.a == t.b, t.a.n, t.self == t, t.greet()`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), to.Tostring(-1))
+	}
+	v, err := to.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[tenant 3 true 1.5 true hello from Go]" {
+		t.Errorf("unexpected copy %v", v)
+	}
+
+	for _, index := range []int{2, 3} {
+		if err := Copyvalue(from, to, index); err == nil {
+			t.Errorf("expected an error copying a table holding a function at %d", index)
+		}
+	}
+	if to.Gettop() != 0 || from.Gettop() != 3 {
+		t.Errorf("unbalanced stacks: %d and %d", to.Gettop(), from.Gettop())
+	}
+}
@@ -0,0 +1,218 @@
+// Command goluajit is a LuaJIT interpreter built on package luajit. It
+// mirrors the stand-alone luajit command and is mostly useful for trying
+// out the binding.
+//
+// Usage:
+//
+//	goluajit [options]... [script [args]...]
+//
+// The options are:
+//
+//	-e chunk	execute string chunk
+//	-l name	require library name
+//	-b in out	save the bytecode of script in to file out
+//	-i	enter interactive mode after running script
+//	-v	show version information
+//	--	stop handling options
+//	-	execute stdin and stop handling options
+//
+// The script arguments are available to the script in the global table
+// arg, as in the stand-alone interpreter: arg[0] is the script name,
+// arg[1] the first argument and so on.
+//
+// With no arguments, goluajit runs interactively when standard input is a
+// terminal and executes standard input otherwise.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/serialx/luajit"
+	"github.com/serialx/luajit/repl"
+)
+
+const usage = `usage: goluajit [options]... [script [args]...].
+Available options are:
+  -e chunk  Execute string 'chunk'.
+  -l name   Require library 'name'.
+  -b in out Save bytecode of 'in' to 'out'.
+  -i        Enter interactive mode after executing 'script'.
+  -v        Show version information.
+  --        Stop handling options.
+  -         Execute stdin and stop handling options.
+`
+
+func main() {
+	os.Exit(run(os.Args))
+}
+
+// Runs the interpreter and returns its exit status. Errors are returned
+// rather than exiting, so that the state is closed.
+func run(args []string) int {
+	s := luajit.Newstate()
+	if s == nil {
+		return fail("cannot create state: not enough memory")
+	}
+	defer s.Close()
+	s.Openlibs()
+	return interpret(s, args)
+}
+
+// Prints msg and returns the exit status for errors.
+func fail(msg string) int {
+	fmt.Fprintf(os.Stderr, "goluajit: %s\n", msg)
+	return 1
+}
+
+// Prints the error message on top of the stack and pops it.
+func report(s *luajit.State) int {
+	msg := s.Tostring(-1)
+	if msg == "" {
+		msg = "(error object is not a string)"
+	}
+	fmt.Fprintf(os.Stderr, "goluajit: %s\n", msg)
+	s.Pop(1)
+	return 1
+}
+
+// Calls the function below the nargs arguments on the stack with
+// debug.traceback as message handler.
+func docall(s *luajit.State, nargs int) error {
+	base := s.Gettop() - nargs
+	s.Getglobal("debug")
+	s.Getfield(-1, "traceback")
+	s.Remove(-2)
+	s.Insert(base)
+	err := s.Pcall(nargs, 0, base)
+	s.Remove(base)
+	return err
+}
+
+func interpret(s *luajit.State, args []string) int {
+	interactive := false
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch args[i] {
+		case "-e":
+			i++
+			if i == len(args) {
+				fmt.Fprint(os.Stderr, usage)
+				return 1
+			}
+			if s.Loadstring(args[i]) != nil || docall(s, 0) != nil {
+				return report(s)
+			}
+		case "-l":
+			i++
+			if i == len(args) {
+				fmt.Fprint(os.Stderr, usage)
+				return 1
+			}
+			s.Getglobal("require")
+			s.Pushstring(args[i])
+			if docall(s, 1) != nil {
+				return report(s)
+			}
+		case "-b":
+			if i+2 >= len(args) {
+				fmt.Fprint(os.Stderr, usage)
+				return 1
+			}
+			return compile(s, args[i+1], args[i+2])
+		case "-i":
+			interactive = true
+		case "-v":
+			fmt.Printf("%s -- %s\n", luajit.Version, luajit.Copyright)
+		case "--":
+			i++
+			break options
+		default:
+			if len(args[i]) < 2 || args[i][0] != '-' {
+				break options
+			}
+			fmt.Fprintf(os.Stderr, "goluajit: unrecognized option '%s'\n", args[i])
+			fmt.Fprint(os.Stderr, usage)
+			return 1
+		}
+	}
+
+	if i < len(args) {
+		if r := script(s, args, i); r != 0 {
+			return r
+		}
+	} else if len(args) == 1 {
+		if f, err := os.Stdin.Stat(); err == nil && f.Mode()&os.ModeCharDevice != 0 {
+			interactive = true
+		} else if r := script(s, append(args, "-"), 1); r != 0 {
+			return r
+		}
+	}
+	if interactive {
+		fmt.Printf("%s -- %s\n", luajit.Version, luajit.Copyright)
+		if err := repl.New(s).Run(os.Stdin, os.Stdout); err != nil {
+			return fail(err.Error())
+		}
+	}
+	return 0
+}
+
+// Runs the script named by args[n], passing it the remaining arguments
+// both as varargs and in the global table arg.
+func script(s *luajit.State, args []string, n int) int {
+	s.Createtable(len(args)-n-1, n+1)
+	for i, a := range args {
+		s.Pushstring(a)
+		s.Rawseti(-2, i-n)
+	}
+	s.Setglobal("arg")
+
+	var err error
+	if args[n] == "-" {
+		err = s.Load(bufio.NewReader(os.Stdin), "=stdin")
+	} else {
+		err = s.Loadfile(args[n])
+	}
+	if err != nil {
+		return report(s)
+	}
+	for _, a := range args[n+1:] {
+		s.Pushstring(a)
+	}
+	if docall(s, len(args)-n-1) != nil {
+		return report(s)
+	}
+	return 0
+}
+
+// Compiles the script in to bytecode and writes it to out.
+func compile(s *luajit.State, in, out string) int {
+	var err error
+	if in == "-" {
+		err = s.Load(bufio.NewReader(os.Stdin), "=stdin")
+	} else {
+		err = s.Loadfile(in)
+	}
+	if err != nil {
+		return report(s)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fail(err.Error())
+	}
+	w := bufio.NewWriter(f)
+	err = s.Dump(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fail(err.Error())
+	}
+	s.Pop(1)
+	return 0
+}
@@ -0,0 +1,169 @@
+// Command luajitembed compiles Lua modules to LuaJIT bytecode and writes
+// a Go file embedding them, so that programs using package luajit can
+// ship their Lua code inside the binary and skip parsing it at startup.
+//
+// Usage:
+//
+//	luajitembed [-o file] [-pkg name] [-func name] [-root dir] path...
+//
+// Each path is a .lua file or a directory searched recursively for .lua
+// files. Module names are derived from the file names relative to the
+// root directory as require expects them: dir/mod.lua becomes "dir.mod"
+// and dir/init.lua becomes "dir". The generated file declares a function,
+// by default
+//
+//	func preloadmodules(s *luajit.State) error
+//
+// which registers every module in package.preload with Preloadchunk. It
+// is meant to be run by go generate:
+//
+//	//go:generate luajitembed -pkg main -root lua lua
+//
+// The bytecode depends on the LuaJIT version, so the file must be
+// regenerated when LuaJIT is upgraded.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/serialx/luajit"
+)
+
+var (
+	out  = flag.String("o", "luamodules.go", "output file")
+	pkg  = flag.String("pkg", "main", "package of the output file")
+	fn   = flag.String("func", "preloadmodules", "name of the generated function")
+	root = flag.String("root", ".", "directory module names are relative to")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: luajitembed [flags] path...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "luajitembed: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Embeds the modules found in paths. Errors are returned rather than
+// exiting, so that the state is closed.
+func run(paths []string) error {
+	var files []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(path) == ".lua" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s := luajit.Newstate()
+	if s == nil {
+		return fmt.Errorf("cannot create state: not enough memory")
+	}
+	defer s.Close()
+
+	modules := make(map[string][]byte)
+	for _, f := range files {
+		name, err := modname(f)
+		if err != nil {
+			return err
+		}
+		if _, ok := modules[name]; ok {
+			return fmt.Errorf("%s: duplicate module %s", f, name)
+		}
+		code, err := compile(s, f)
+		if err != nil {
+			return err
+		}
+		modules[name] = code
+	}
+
+	src, err := generate(modules)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*out, src, 0666)
+}
+
+// Returns the module name for the file f.
+func modname(f string) (string, error) {
+	rel, err := filepath.Rel(*root, f)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not under %s", f, *root)
+	}
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), ".lua")
+	if rel == "init" {
+		return "", fmt.Errorf("%s: cannot name a module init.lua at the root", f)
+	}
+	rel = strings.TrimSuffix(rel, "/init")
+	return strings.ReplaceAll(rel, "/", "."), nil
+}
+
+// Returns the bytecode of the Lua file f.
+func compile(s *luajit.State, f string) ([]byte, error) {
+	if err := s.Loadfile(f); err != nil {
+		msg := s.Tostring(-1)
+		s.Pop(1)
+		return nil, fmt.Errorf("%s", msg)
+	}
+	defer s.Pop(1)
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := s.Dump(w); err != nil {
+		return nil, fmt.Errorf("%s: %s", f, err)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the formatted Go source registering modules.
+func generate(modules map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by luajitembed; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", *pkg)
+	fmt.Fprintf(&b, "import \"github.com/serialx/luajit\"\n\n")
+	fmt.Fprintf(&b, "// Registers the embedded Lua modules in package.preload.\n")
+	fmt.Fprintf(&b, "func %s(s *luajit.State) error {\n", *fn)
+	fmt.Fprintf(&b, "for _, m := range []struct{ name, code string }{\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "{%s, %s},\n", strconv.Quote(name), strconv.Quote(string(modules[name])))
+	}
+	fmt.Fprintf(&b, "} {\n")
+	fmt.Fprintf(&b, "if err := s.Preloadchunk(m.name, []byte(m.code)); err != nil {\nreturn err\n}\n")
+	fmt.Fprintf(&b, "}\nreturn nil\n}\n")
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,132 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// Reports whether the running engine accepts the goto statement and
+// labels, which LuaJIT supports from 2.0 on, with or without Lua 5.2
+// compatibility.
+func HasGoto() bool {
+	return engine.gotostmt
+}
+
+// Reports whether pairs and ipairs honor the __pairs and __ipairs
+// metamethods, as they do in engines with Lua 5.2 compatibility. Go code
+// can use Metapairs to honor __pairs either way.
+func HasPairsmeta() bool {
+	return engine.pairsmeta
+}
+
+// Pops n values from the stack and pushes a table holding them at keys 1
+// to n, with field n set to n, as table.pack does in Lua 5.2. Works
+// whether or not the engine has table.pack.
+func (s *State) Tablepack(n int) {
+	s.Createtable(n, 1)
+	s.Insert(-(n + 1))
+	for i := n; i >= 1; i-- {
+		s.Rawseti(-(i + 1), i)
+	}
+	s.Pushinteger(n)
+	s.Setfield(-2, "n")
+}
+
+// Pushes the elements of the table at the given valid index, from 1 to its
+// field n if that is a number, or to its length otherwise, as
+// table.unpack(t, 1, t.n) does in Lua 5.2. Returns the number of values
+// pushed, or an error, pushing nothing, if the stack cannot hold them.
+func (s *State) Tableunpack(index int) (int, error) {
+	index = s.absindex(index)
+	s.Getfield(index, "n")
+	n := s.Objlen(index)
+	if s.Type(-1) == Tnumber {
+		n = s.Tointeger(-1)
+	}
+	s.Pop(1)
+	if n < 0 {
+		n = 0
+	}
+	if err := s.grow(n); err != nil {
+		return 0, err
+	}
+	for i := 1; i <= n; i++ {
+		s.Rawgeti(index, i)
+	}
+	return n, nil
+}
+
+var errpairs = errors.New("__pairs must return an iterator function")
+
+// Returns an iterator over the value at the given valid index as the Lua
+// 5.2 pairs function sees it: if the value has a __pairs metamethod, the
+// iterator calls it and follows the generic for protocol with the results;
+// otherwise it behaves as Pairs. Keys and values are yielded as by Pairs,
+// and the same rules apply to the loop body.
+//
+// If the metamethod or the iterator function raises an error, or the value
+// is neither a table nor has a __pairs metamethod, iteration stops and err,
+// if not nil, is set to the error.
+func (s *State) Metapairs(index int, err *error) iter.Seq2[int, int] {
+	index = s.absindex(index)
+	return func(yield func(int, int) bool) {
+		top := s.Gettop()
+		defer s.Settop(top)
+		fail := func(e error) {
+			if err != nil {
+				*err = e
+			}
+		}
+		if !s.Checkstack(6) {
+			fail(errstack)
+			return
+		}
+		s.Getmetatable(index)
+		if s.Gettop() > top {
+			s.Getfield(-1, "__pairs")
+			s.Remove(-2)
+		}
+		if !s.Isfunction(-1) {
+			s.Settop(top)
+			if !s.Istable(index) {
+				fail(errnotable)
+				return
+			}
+			for k, v := range s.Pairs(index) {
+				if !yield(k, v) {
+					return
+				}
+			}
+			return
+		}
+		// f, state, control at top+1, top+2, top+3
+		s.Pushvalue(index)
+		if e := s.Pcall(1, 3, 0); e != nil {
+			fail(fmt.Errorf("%w: %s", e, s.Tostring(-1)))
+			return
+		}
+		if !s.Isfunction(top + 1) {
+			fail(errpairs)
+			return
+		}
+		for {
+			s.Pushvalue(top + 1)
+			s.Pushvalue(top + 2)
+			s.Pushvalue(top + 3)
+			if e := s.Pcall(2, 2, 0); e != nil {
+				fail(fmt.Errorf("%w: %s", e, s.Tostring(-1)))
+				return
+			}
+			if s.Isnil(top + 4) {
+				return
+			}
+			s.Pushvalue(top + 4)
+			s.Replace(top + 3)
+			if !yield(top+4, top+5) {
+				return
+			}
+			s.Settop(top + 3)
+		}
+	}
+}
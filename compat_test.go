@@ -0,0 +1,95 @@
+package luajit
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestCompatprobes(t *testing.T) {
+	if !HasGoto() {
+		t.Error("expected goto support")
+	}
+	if HasPairsmeta() != Has52Compat() {
+		t.Errorf("expected __pairs support %t to follow 5.2 compatibility %t", HasPairsmeta(), Has52Compat())
+	}
+}
+
+func TestTablepack(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	s.Pushinteger(1)
+	s.Pushnil()
+	s.Pushstring("three")
+	s.Tablepack(3)
+	if s.Gettop() != 1 || !s.Istable(1) {
+		t.Fatalf("expected a single table, got %d values", s.Gettop())
+	}
+	s.Getfield(1, "n")
+	if n := s.Tointeger(-1); n != 3 {
+		t.Errorf("expected n = 3, got %d", n)
+	}
+	s.Pop(1)
+
+	n, err := s.Tableunpack(1)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 values, got %d %v", n, err)
+	}
+	if s.Tointeger(2) != 1 || !s.Isnil(3) || s.Tostring(4) != "three" {
+		t.Errorf("unexpected values %v %v %v", s.Tointeger(2), s.Typename(s.Type(3)), s.Tostring(4))
+	}
+	s.Settop(0)
+}
+
+func TestMetapairs(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`
+		local keys = {"a", "b"}
+		return setmetatable({}, {__pairs = function(t)
+			local i = 0
+			return function()
+				i = i + 1
+				if keys[i] then return keys[i], i end
+			end, t, nil
+		end}), {x = 1, y = 2}, setmetatable({}, {__pairs = function() error("boom") end})
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 3, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	collect := func(index int) ([]string, error) {
+		var seen []string
+		var err error
+		for k, v := range s.Metapairs(index, &err) {
+			seen = append(seen, fmt.Sprintf("%s=%d", s.Tostring(k), s.Tointeger(v)))
+		}
+		sort.Strings(seen)
+		return seen, err
+	}
+	if seen, err := collect(1); err != nil || fmt.Sprint(seen) != "[a=1 b=2]" {
+		t.Errorf("unexpected pairs %v %v", seen, err)
+	}
+	if seen, err := collect(2); err != nil || fmt.Sprint(seen) != "[x=1 y=2]" {
+		t.Errorf("unexpected pairs %v %v", seen, err)
+	}
+	if _, err := collect(3); err == nil {
+		t.Error("expected error from __pairs")
+	}
+	if s.Gettop() != 3 {
+		t.Errorf("expected 3 values on the stack, got %d", s.Gettop())
+	}
+	s.Pop(3)
+}
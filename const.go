@@ -1,5 +1,9 @@
 // Package luajit provides an interface to LuaJIT, a just-in-time compiler
 // and interpreter for the Lua programming language.
+//
+// Building with the luajitdebug tag enables consistency checks in the
+// package's high-level helpers, which then panic when a helper leaves the
+// stack unbalanced instead of silently corrupting the State.
 package luajit
 
 /*
@@ -39,6 +43,13 @@ var errs map[int]error = map[int]error{
 	Errerr:    errors.New("error in error handling"),
 }
 
+// Returned by helpers, and used as the panic value by other methods, when
+// a State is used after Close.
+var ErrClosed = errors.New("use of closed state")
+
+// Returned by helpers when the stack cannot grow to hold their values.
+var errstack = errors.New("stack overflow")
+
 func numtoerror(errnum int) error {
 	if errnum < 1 {
 		return nil
@@ -76,7 +87,7 @@ const (
 // Upvalueindex. The first value associated with a function is at position
 // Upvalueindex(1), and so on.
 func Upvalueindex(n int) int {
-	return (Globalsindex - n) + 1 // Upvalueindex(1) is reserved for Go func pointer
+	return Globalsindex - (n + 1) // upvalue 1 holds the Go function
 }
 
 // Basic types
@@ -91,6 +102,7 @@ const (
 	Tfunction      = C.LUA_TFUNCTION
 	Tuserdata      = C.LUA_TUSERDATA
 	Tthread        = C.LUA_TTHREAD
+	Tcdata         = 10 // LuaJIT FFI data; not in lua.h
 )
 
 // Garbage-collection function and options
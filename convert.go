@@ -0,0 +1,447 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"unsafe"
+)
+
+// Values nested deeper than this are not converted, which also stops
+// conversion of self-referencing Go values.
+const maxnesting = 100
+
+var errnesting = errors.New("value nested too deeply")
+
+// Pushes the Go value v onto the stack, converting it to the closest Lua
+// value:
+//
+//	nil, nil pointers, maps and slices	nil
+//	bool					boolean
+//	ints, uints and floats		number
+//	string and []byte			string
+//	Gofunction, func(*State) int	function
+//	unsafe.Pointer			light userdata
+//	maps				table with the converted keys and values
+//	slices and arrays			table with the elements at 1, 2, ...
+//	structs				table with the fields (see Pushstruct)
+//
+// Pointers are followed and interface values converted according to
+// their dynamic type. On error, such as for an unsupported type or a
+// stack that cannot grow any further, nothing is pushed.
+func (s *State) Push(v interface{}) error {
+	if err := s.grow(1); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		s.Pushnil()
+	case bool:
+		s.Pushboolean(v)
+	case int:
+		s.Pushnumber(float64(v))
+	case int64:
+		s.Pushnumber(float64(v))
+	case float64:
+		s.Pushnumber(v)
+	case string:
+		s.Pushstring(v)
+	case []byte:
+		if v == nil {
+			s.Pushnil()
+		} else {
+			s.Pushbytes(v)
+		}
+	case Gofunction:
+		s.Pushfunction(v)
+	case func(*State) int:
+		s.Pushfunction(v)
+	case unsafe.Pointer:
+		s.Pushlightuserdata(v)
+	default:
+		top := s.Gettop()
+		if err := s.push(reflect.ValueOf(v), 0); err != nil {
+			s.Settop(top)
+			return err
+		}
+	}
+	return nil
+}
+
+// Sets the global variables named by the keys of m to the values,
+// converted as by Push. The globals are set in the order of their names.
+// On error, the globals before the failing one have already been set.
+func (s *State) Setglobals(m map[string]interface{}) error {
+	defer s.balanced("Setglobals", 0)()
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := s.Push(m[name]); err != nil {
+			return fmt.Errorf("global %s: %s", name, err.Error())
+		}
+		s.Setglobal(name)
+	}
+	return nil
+}
+
+func (s *State) push(v reflect.Value, depth int) error {
+	if depth > maxnesting {
+		return errnesting
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		s.Pushnil()
+	case reflect.Bool:
+		s.Pushboolean(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Pushnumber(float64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.Pushnumber(float64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		s.Pushnumber(v.Float())
+	case reflect.String:
+		s.Pushstring(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			s.Pushnil()
+			return nil
+		}
+		return s.push(v.Elem(), depth+1)
+	case reflect.UnsafePointer:
+		s.Pushlightuserdata(unsafe.Pointer(v.Pointer()))
+	case reflect.Func:
+		if v.IsNil() {
+			s.Pushnil()
+			return nil
+		}
+		fn, ok := v.Interface().(Gofunction)
+		if !ok {
+			if v.Type().ConvertibleTo(reflect.TypeOf(fn)) {
+				fn = v.Convert(reflect.TypeOf(fn)).Interface().(Gofunction)
+			} else {
+				return fmt.Errorf("cannot push value of type %s", v.Type())
+			}
+		}
+		s.Pushfunction(fn)
+	case reflect.Slice:
+		if v.IsNil() {
+			s.Pushnil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			s.Pushbytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		n := v.Len()
+		s.Createtable(n, 0)
+		for i := 0; i < n; i++ {
+			if err := s.push(v.Index(i), depth+1); err != nil {
+				return err
+			}
+			s.Rawseti(-2, i+1)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			s.Pushnil()
+			return nil
+		}
+		s.Createtable(0, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			if err := s.push(it.Key(), depth+1); err != nil {
+				return err
+			}
+			if s.Isnil(-1) {
+				return errors.New("table index is nil")
+			}
+			if k := s.Tonumber(-1); s.Isnumber(-1) && k != k {
+				return errors.New("table index is NaN")
+			}
+			if err := s.push(it.Value(), depth+1); err != nil {
+				return err
+			}
+			s.Rawset(-3)
+		}
+	case reflect.Struct:
+		return s.pushstruct(v, depth)
+	default:
+		return fmt.Errorf("cannot push value of type %s", v.Type())
+	}
+	return nil
+}
+
+// Converts an acceptable index into an absolute one, so that it stays
+// valid while values are pushed.
+func (s *State) absindex(index int) int {
+	if index < 0 && index > Registryindex {
+		return s.Gettop() + index + 1
+	}
+	return index
+}
+
+// Converts the Lua value at the given valid index to a Go value:
+//
+//	nil		nil
+//	boolean		bool
+//	number		float64
+//	string		string
+//	table		[]interface{} if its keys are 1..n, otherwise a
+//			map[string]interface{} if all its keys are strings,
+//			otherwise a map[interface{}]interface{}
+//	Go function	Gofunction
+//	userdata		the Go object for userdata made by Pushobject,
+//			otherwise unsafe.Pointer to its block or pointer
+//	thread		*State
+//
+// Tables are converted recursively; Tovalue returns an error for tables
+// that refer to themselves, tables nested too deeply, and values that
+// cannot be converted, such as Lua functions. The stack is left
+// unchanged.
+func (s *State) Tovalue(index int) (interface{}, error) {
+	return s.tovalue(s.absindex(index), make(map[unsafe.Pointer]bool), 0)
+}
+
+func (s *State) tovalue(index int, seen map[unsafe.Pointer]bool, depth int) (interface{}, error) {
+	switch tp := s.Type(index); tp {
+	case Tnil, Tnone:
+		return nil, nil
+	case Tboolean:
+		return s.Toboolean(index), nil
+	case Tnumber:
+		return s.Tonumber(index), nil
+	case Tstring:
+		return s.Tostring(index), nil
+	case Ttable:
+		return s.totable(index, seen, depth)
+	case Tfunction:
+		if s.Isgofunction(index) {
+			return s.Togofunction(index)
+		}
+	case Tuserdata:
+		if obj, ok := s.toobject(index); ok {
+			return obj, nil
+		}
+		return s.Touserdata(index), nil
+	case Tlightuserdata:
+		return s.Touserdata(index), nil
+	case Tthread:
+		return s.Tothread(index), nil
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", s.Typename(s.Type(index)))
+}
+
+func (s *State) totable(index int, seen map[unsafe.Pointer]bool, depth int) (interface{}, error) {
+	if depth > maxnesting {
+		return nil, errnesting
+	}
+	p := s.Topointer(index)
+	if seen[p] {
+		return nil, errors.New("table refers to itself")
+	}
+	seen[p] = true
+	defer delete(seen, p)
+	if err := s.grow(2); err != nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, 0, s.Objlen(index))
+	vals := make([]interface{}, 0, cap(keys))
+	top := s.Gettop()
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		if tp := s.Type(top + 1); tp == Ttable || tp == Tfunction {
+			s.Settop(top)
+			return nil, fmt.Errorf("cannot convert table key of type %s", s.Typename(tp))
+		}
+		k, err := s.tovalue(top+1, seen, depth+1)
+		if err != nil {
+			s.Settop(top)
+			return nil, err
+		}
+		v, err := s.tovalue(top+2, seen, depth+1)
+		if err != nil {
+			s.Settop(top)
+			return nil, err
+		}
+		keys = append(keys, k)
+		vals = append(vals, v)
+		s.Pop(1)
+	}
+	return tablevalue(keys, vals), nil
+}
+
+// Returns the Go value for a table with the given keys and values, as
+// described for Tovalue.
+func tablevalue(keys, vals []interface{}) interface{} {
+	// The table is an array if its keys are exactly 1..n.
+	n := len(keys)
+	if n == 0 {
+		return map[string]interface{}{}
+	}
+	array, strkeys := true, true
+	for _, k := range keys {
+		f, ok := k.(float64)
+		if !ok || f != float64(int(f)) || f < 1 || int(f) > n {
+			array = false
+			break
+		}
+	}
+	for _, k := range keys {
+		if _, ok := k.(string); !ok {
+			strkeys = false
+			break
+		}
+	}
+	switch {
+	case array:
+		a := make([]interface{}, n)
+		for i, k := range keys {
+			a[int(k.(float64))-1] = vals[i]
+		}
+		return a
+	case strkeys:
+		m := make(map[string]interface{}, n)
+		for i, k := range keys {
+			m[k.(string)] = vals[i]
+		}
+		return m
+	}
+	m := make(map[interface{}]interface{}, n)
+	for i, k := range keys {
+		m[k] = vals[i]
+	}
+	return m
+}
+
+// Converts the table at the given valid index to a map. All keys of the
+// table must be strings; values are converted as by Tovalue.
+func (s *State) Tomap(index int) (map[string]interface{}, error) {
+	index = s.absindex(index)
+	if !s.Istable(index) {
+		return nil, fmt.Errorf("expected table, got %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(2); err != nil {
+		return nil, err
+	}
+	seen := map[unsafe.Pointer]bool{s.Topointer(index): true}
+	m := make(map[string]interface{})
+	top := s.Gettop()
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		if !s.Isstring(top + 1) {
+			tp := s.Typename(s.Type(top + 1))
+			s.Settop(top)
+			return nil, fmt.Errorf("table key of type %s is not a string", tp)
+		}
+		v, err := s.tovalue(top+2, seen, 1)
+		if err != nil {
+			s.Settop(top)
+			return nil, err
+		}
+		m[s.Tostring(top+1)] = v
+		s.Pop(1)
+	}
+	return m, nil
+}
+
+// Converts the array part of the table at the given valid index, that is
+// the values at keys 1 to Objlen(index), to a slice. Other keys are
+// ignored; values are converted as by Tovalue.
+func (s *State) Toslice(index int) ([]interface{}, error) {
+	index = s.absindex(index)
+	if !s.Istable(index) {
+		return nil, fmt.Errorf("expected table, got %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(1); err != nil {
+		return nil, err
+	}
+	seen := map[unsafe.Pointer]bool{s.Topointer(index): true}
+	a := make([]interface{}, s.Objlen(index))
+	for i := range a {
+		s.Rawgeti(index, i+1)
+		v, err := s.tovalue(s.Gettop(), seen, 1)
+		s.Pop(1)
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+// Checks that the value at index is a table and returns its array length.
+func (s *State) arraylen(index int) (int, error) {
+	if !s.Istable(index) {
+		return 0, fmt.Errorf("expected table, got %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(1); err != nil {
+		return 0, err
+	}
+	return s.Objlen(index), nil
+}
+
+// Returns an error describing the unexpected element on top of the stack,
+// and pops it.
+func (s *State) elemerror(i int, expected string) error {
+	err := fmt.Errorf("element %d: expected %s, got %s", i, expected, s.Typename(s.Type(-1)))
+	s.Pop(1)
+	return err
+}
+
+// Converts the array part of the table at the given valid index to a
+// slice of strings. Every element must be a string; otherwise, returns an
+// error naming the first offending element.
+func (s *State) Tostringslice(index int) ([]string, error) {
+	index = s.absindex(index)
+	n, err := s.arraylen(index)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]string, n)
+	for i := range a {
+		s.Rawgeti(index, i+1)
+		if !s.Isstring(-1) {
+			return nil, s.elemerror(i+1, "string")
+		}
+		a[i] = s.Tostring(-1)
+		s.Pop(1)
+	}
+	return a, nil
+}
+
+// Converts the array part of the table at the given valid index to a
+// slice of float64. Every element must be a number; otherwise, returns an
+// error naming the first offending element.
+func (s *State) Tofloat64slice(index int) ([]float64, error) {
+	return s.Tonumberarray(index)
+}
+
+// Converts the array part of the table at the given valid index to a
+// slice of int. Every element must be a number with an integral value;
+// otherwise, returns an error naming the first offending element.
+func (s *State) Tointslice(index int) ([]int, error) {
+	index = s.absindex(index)
+	n, err := s.arraylen(index)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]int, n)
+	for i := range a {
+		s.Rawgeti(index, i+1)
+		f := s.Tonumber(-1)
+		if !s.Isnumber(-1) || f != float64(int(f)) {
+			return nil, s.elemerror(i+1, "integer")
+		}
+		a[i] = int(f)
+		s.Pop(1)
+	}
+	return a, nil
+}
@@ -0,0 +1,234 @@
+package luajit
+
+import "testing"
+
+func TestPush(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	vals := []interface{}{
+		nil, true, 42, int8(-3), uint64(7), 2.5, float32(0.5), "str",
+		[]byte("bytes"), []int{1, 2, 3}, [2]string{"a", "b"},
+		map[string]interface{}{"x": 1, "y": []string{"z"}},
+	}
+	types := []int{
+		Tnil, Tboolean, Tnumber, Tnumber, Tnumber, Tnumber, Tnumber, Tstring,
+		Tstring, Ttable, Ttable, Ttable,
+	}
+	for i, v := range vals {
+		if err := s.Push(v); err != nil {
+			t.Fatalf("push %v: %s", v, err.Error())
+		}
+		if tp := s.Type(-1); tp != types[i] {
+			t.Errorf("value %v: expected %s, got %s", v, s.Typename(types[i]), s.Typename(tp))
+		}
+	}
+	if n := s.Gettop(); n != len(vals) {
+		t.Fatalf("expected %d values on stack, found %d", len(vals), n)
+	}
+
+	s.Getfield(-1, "y")
+	s.Rawgeti(-1, 1)
+	if str := s.Tostring(-1); str != "z" {
+		t.Errorf("expected z, got %s", str)
+	}
+	s.Pop(2)
+	s.Rawgeti(-3, 3)
+	if n := s.Tointeger(-1); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	s.Settop(0)
+
+	if err := s.Push(make(chan int)); err == nil {
+		t.Error("expected error pushing a channel")
+	}
+	m := map[string]interface{}{}
+	m["self"] = m
+	if err := s.Push(m); err == nil {
+		t.Error("expected error pushing a self-referencing map")
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack after failed pushes, found %d elems", n)
+	}
+}
+
+func TestPushfunction(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Push(func(s *State) int {
+		s.Pushinteger(s.Tointeger(1) * 2)
+		return 1
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Pushinteger(21)
+	if err := s.Pcall(1, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 42 {
+		t.Errorf("expected 42, got %d", n)
+	}
+}
+
+func TestSetglobals(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	err := s.Setglobals(map[string]interface{}{
+		"name":  "prod",
+		"ports": []int{80, 443},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Loadstring(`return name == "prod" and ports[2] == 443`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if !s.Toboolean(-1) {
+		t.Error("expected the globals to be set")
+	}
+	s.Pop(1)
+	if err := s.Setglobals(map[string]interface{}{"ch": make(chan int)}); err == nil {
+		t.Error("expected error for a channel")
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+}
+
+func TestTovalue(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`return {1, 2, 3}, {a = 1, b = {true, "x"}}, {[1] = 1, [3] = 3}, 4.5`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, Multret, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	v, err := s.Tovalue(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := v.([]interface{}); !ok || len(a) != 3 || a[2] != 3.0 {
+		t.Errorf("expected [1 2 3], got %v", v)
+	}
+	v, err = s.Tovalue(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || m["a"] != 1.0 {
+		t.Fatalf("expected map with a = 1, got %v", v)
+	}
+	if b, ok := m["b"].([]interface{}); !ok || b[0] != true || b[1] != "x" {
+		t.Errorf("expected [true x], got %v", m["b"])
+	}
+	v, err = s.Tovalue(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := v.(map[interface{}]interface{}); !ok || m[3.0] != 3.0 {
+		t.Errorf("expected sparse map, got %v", v)
+	}
+	if v, err := s.Tovalue(-1); err != nil || v != 4.5 {
+		t.Errorf("expected 4.5, got %v (%v)", v, err)
+	}
+	if n := s.Gettop(); n != 4 {
+		t.Errorf("expected 4 values on stack, found %d", n)
+	}
+
+	s.Settop(0)
+	if err := s.Loadstring(`local t = {} t.t = t return t`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if _, err := s.Tovalue(-1); err == nil {
+		t.Error("expected error converting a cyclic table")
+	}
+	if n := s.Gettop(); n != 1 {
+		t.Errorf("expected 1 value on stack, found %d", n)
+	}
+}
+
+func TestTomap(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Loadstring(`return {name = "x", list = {1, 2}, n = 3}, {10, 20, 30, extra = true}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, Multret, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	m, err := s.Tomap(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 3 || m["name"] != "x" || m["n"] != 3.0 {
+		t.Errorf("unexpected map %v", m)
+	}
+	a, err := s.Toslice(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 3 || a[0] != 10.0 || a[2] != 30.0 {
+		t.Errorf("unexpected slice %v", a)
+	}
+	if _, err := s.Tomap(2); err == nil {
+		t.Error("expected error for numeric keys")
+	}
+	if n := s.Gettop(); n != 2 {
+		t.Errorf("expected 2 values on stack, found %d", n)
+	}
+}
+
+func TestTypedslices(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Loadstring(`return {"a", "b"}, {1.5, 2}, {1, 2, "x"}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, Multret, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if a, err := s.Tostringslice(1); err != nil || len(a) != 2 || a[1] != "b" {
+		t.Errorf("expected [a b], got %v (%v)", a, err)
+	}
+	if a, err := s.Tofloat64slice(2); err != nil || len(a) != 2 || a[0] != 1.5 {
+		t.Errorf("expected [1.5 2], got %v (%v)", a, err)
+	}
+	if _, err := s.Tointslice(2); err == nil {
+		t.Error("expected error for non-integral element")
+	}
+	_, err := s.Tointslice(3)
+	if err == nil || err.Error() != "element 3: expected integer, got string" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if n := s.Gettop(); n != 3 {
+		t.Errorf("expected 3 values on stack, found %d", n)
+	}
+}
@@ -0,0 +1,160 @@
+package luajit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// A Coroutine runs a Lua function as a coroutine driven from Go, with
+// arguments and results converted to Go values and errors reported as Go
+// errors.
+type Coroutine struct {
+	t    *State
+	done bool
+	err  error // the error that ended iteration by All or Chan
+}
+
+var errdead = errors.New("cannot resume dead coroutine")
+
+// The status of a thread after it runs: Ok when it has returned, Yield
+// when it is suspended, or the code of the error it raised, such as
+// Errrun.
+type Status int
+
+func (st Status) String() string {
+	switch st {
+	case Ok:
+		return "ok"
+	case Yield:
+		return "yield"
+	}
+	return numtoerror(int(st)).Error()
+}
+
+// Resumes the thread s as Resume does, and returns the values it yielded
+// or returned, converted as by Tovalue, together with the status it
+// stopped in. If the thread raises an error, the returned error includes
+// the error message. Either way, the stack of s is left empty, ready for
+// the arguments of the next call to Resumevalues.
+func (s *State) Resumevalues(narg int) (values []interface{}, status Status, err error) {
+	yield, err := s.Resume(narg)
+	if err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		status = Status(s.Status())
+		s.Settop(0)
+		return nil, status, err
+	}
+	status = Ok
+	if yield {
+		status = Yield
+	}
+	values, err = s.Resultssince(0)
+	return values, status, err
+}
+
+// Creates a coroutine running the function at the given valid index,
+// which is left on the stack.
+func (s *State) Newcoroutine(index int) (*Coroutine, error) {
+	defer s.balanced("Newcoroutine", 0)()
+	if !s.Isfunction(index) {
+		return nil, fmt.Errorf("cannot make a coroutine of a %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(2); err != nil {
+		return nil, err
+	}
+	s.Pushvalue(index)
+	t := s.Newthread()
+	s.Pop(1)
+	t.Xmove(s, 1)
+	return &Coroutine{t: t}, nil
+}
+
+// Starts or continues the coroutine, passing args, converted as by Push,
+// as the arguments of its function or the results of the yield it is
+// suspended in. Returns the values the coroutine yields or, if done is
+// true, returns, converted as by Tovalue. If the coroutine raises an
+// error, Resume returns it with the error message, and the coroutine is
+// dead like one that returned: resuming it again is an error.
+func (c *Coroutine) Resume(args ...interface{}) (values []interface{}, done bool, err error) {
+	if c.done {
+		return nil, true, errdead
+	}
+	t := c.t
+	if err := t.pushargs(args); err != nil {
+		t.Settop(0)
+		return nil, false, err
+	}
+	values, status, err := t.Resumevalues(len(args))
+	if status != Yield {
+		c.finish()
+	}
+	return values, status != Yield, err
+}
+
+// Returns true if the coroutine has returned or failed.
+func (c *Coroutine) Done() bool {
+	return c.done
+}
+
+// Returns the thread running the coroutine, for inspecting it with the
+// debug API, for instance. Its stack is empty between calls to Resume.
+func (c *Coroutine) Thread() *State {
+	return c.t
+}
+
+// Marks the coroutine dead and lets its thread be collected.
+func (c *Coroutine) finish() {
+	c.done = true
+	c.t.Release()
+}
+
+// Returns an iterator over the values yielded by the coroutine, for a Lua
+// generator such as
+//
+//	function() for i = 1, 3 do coroutine.yield(i, i * i) end end
+//
+// Each iteration resumes the coroutine without arguments and receives the
+// values of one yield. Iteration stops when the coroutine returns, with
+// the returned values being ignored, or fails, in which case Err returns
+// the error. Breaking out of the loop leaves the coroutine suspended.
+func (c *Coroutine) All() iter.Seq[[]interface{}] {
+	return func(yield func([]interface{}) bool) {
+		for !c.done {
+			values, done, err := c.Resume()
+			if err != nil {
+				c.err = err
+				return
+			}
+			if done || !yield(values) {
+				return
+			}
+		}
+	}
+}
+
+// Returns a channel receiving the values yielded by the coroutine, as All
+// does, on a new goroutine. The channel is closed when the coroutine
+// returns or fails, or when ctx is done. The state must not be used by
+// other goroutines until then.
+func (c *Coroutine) Chan(ctx context.Context) <-chan []interface{} {
+	ch := make(chan []interface{})
+	go func() {
+		defer close(ch)
+		for values := range c.All() {
+			select {
+			case ch <- values:
+			case <-ctx.Done():
+				c.err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Returns the error that stopped iteration by All or Chan, if any.
+func (c *Coroutine) Err() error {
+	return c.err
+}
@@ -0,0 +1,138 @@
+package luajit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCoroutine(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`return function(a)
+		local b = coroutine.yield(a + 1)
+		local c = coroutine.yield(a + b)
+		return "done", c
+	end`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	co, err := s.Newcoroutine(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var steps []string
+	for _, arg := range []interface{}{1, 10, "x"} {
+		v, done, err := co.Resume(arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, fmt.Sprint(v, done))
+	}
+	if fmt.Sprint(steps) != "[[2] false [11] false [done x] true]" {
+		t.Errorf("unexpected steps %v", steps)
+	}
+	if !co.Done() {
+		t.Error("expected coroutine to be done")
+	}
+	if _, _, err := co.Resume(); err == nil {
+		t.Error("expected error resuming a dead coroutine")
+	}
+
+	if err := s.Loadstring(`error("boom")`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	co, err = s.Newcoroutine(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, done, err := co.Resume(); err == nil || !done {
+		t.Errorf("expected error and done, got %v and %t", err, done)
+	}
+	s.Pop(2)
+}
+
+func TestCoroutineall(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	gen := func(src string) *Coroutine {
+		if err := s.Loadstring(src); err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		co, err := s.Newcoroutine(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Pop(1)
+		return co
+	}
+
+	sum := 0.0
+	co := gen(`for i = 1, 3 do coroutine.yield(i, i * i) end`)
+	for v := range co.All() {
+		sum += v[1].(float64)
+	}
+	if sum != 14 || co.Err() != nil {
+		t.Errorf("expected 14 and no error, got %v and %v", sum, co.Err())
+	}
+
+	co = gen(`coroutine.yield(1); error("boom")`)
+	n := 0
+	for range co.Chan(context.Background()) {
+		n++
+	}
+	if n != 1 || co.Err() == nil {
+		t.Errorf("expected 1 value and an error, got %d and %v", n, co.Err())
+	}
+}
+
+func TestResumevalues(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`
+		local n = coroutine.yield(1, 2)
+		if n then error("bad " .. n) end
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	th := s.Newthread()
+	s.Pushvalue(-2)
+	th.Xmove(s, 1)
+
+	v, status, err := th.Resumevalues(0)
+	if err != nil || status != Yield || fmt.Sprint(v) != "[1 2]" {
+		t.Fatalf("expected [1 2] yield, got %v %v %v", v, status, err)
+	}
+	if th.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", th.Gettop())
+	}
+	th.Pushinteger(7)
+	v, status, err = th.Resumevalues(1)
+	if err == nil || status != Errrun || v != nil {
+		t.Errorf("expected run time error, got %v %v %v", v, status, err)
+	}
+	if th.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", th.Gettop())
+	}
+	s.Pop(2)
+}
@@ -0,0 +1,47 @@
+package luajit
+
+import "runtime/cgo"
+
+// Registry field holding the userdata with the Go data of a state.
+const datafield = "luajit.data"
+
+// Associates value with key in the Go data of the state, so that Go
+// functions called from Lua can reach host context, such as a logger or
+// the current request, without globals. Setting nil removes the key. The
+// data is shared by the state and all its threads, and is released when
+// the state is closed. Keys should be of an unexported type, as for
+// context.Context, to avoid collisions between packages.
+func (s *State) Setdata(key, value interface{}) {
+	defer s.balanced("Setdata", 0)()
+	m := s.data(value != nil)
+	if value == nil {
+		delete(m, key)
+	} else {
+		m[key] = value
+	}
+}
+
+// Returns the value associated with key by Setdata, or nil.
+func (s *State) Data(key interface{}) interface{} {
+	defer s.balanced("Data", 0)()
+	return s.data(false)[key]
+}
+
+// Returns the Go data of the state, creating it if create is true;
+// otherwise, the result may be nil.
+func (s *State) data(create bool) map[interface{}]interface{} {
+	s.Getfield(Registryindex, datafield)
+	defer s.Pop(1)
+	if p := s.Touserdata(-1); p != nil {
+		return (*cgo.Handle)(p).Value().(map[interface{}]interface{})
+	}
+	if !create {
+		return nil
+	}
+	m := make(map[interface{}]interface{})
+	s.pushhandle(m)
+	s.proxymeta(datafield)
+	s.Setmetatable(-2)
+	s.Setfield(Registryindex, datafield)
+	return m
+}
@@ -0,0 +1,38 @@
+package luajit
+
+import "testing"
+
+type testkey struct{}
+
+func TestData(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if v := s.Data(testkey{}); v != nil {
+		t.Errorf("expected nil, got %v", v)
+	}
+	s.Setdata(testkey{}, "request-1")
+	s.Register(func(s *State) int {
+		s.Pushstring(s.Data(testkey{}).(string))
+		return 1
+	}, "request")
+	if err := s.Loadstring(`return coroutine.wrap(function() return request() end)()`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Tostring(-1) != "request-1" {
+		t.Errorf("expected request-1, got %s", s.Tostring(-1))
+	}
+	s.Pop(1)
+
+	s.Setdata(testkey{}, nil)
+	if v := s.Data(testkey{}); v != nil {
+		t.Errorf("expected nil, got %v", v)
+	}
+}
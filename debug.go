@@ -1,18 +1,18 @@
 package luajit
 
 /*
-#cgo LDFLAGS: -lluajit
-#cgo linux LDFLAGS: -lm -ldl
-
 #include <lua.h>
 #include <stddef.h>
+#include <stdint.h>
 #include <stdlib.h>
 
 extern void	sethook(lua_State*, int, int);
+extern void	pushgohandle(lua_State*, uintptr_t);
 */
 import "C"
 import (
 	"errors"
+	"runtime/cgo"
 	"unsafe"
 )
 
@@ -77,9 +77,12 @@ type Debug struct {
 // a chunk, this execution occurs without any calls to hooks.
 type Hook func(s *State, ar *Debug)
 
+// Creates a new, empty Debug for use with s. Fill it with Getstack before
+// calling Getinfo or Getlocal on it.
 func Newdebug(s *State) *Debug {
 	d := Debug{}
 	d.l = s.l
+	d.d = new(C.lua_Debug)
 	return &d
 }
 
@@ -188,26 +191,31 @@ func (d *Debug) Getstack(level int) error {
 
 //export hookevent
 func hookevent(cs unsafe.Pointer, car unsafe.Pointer) {
-	s := State{(*C.lua_State)(cs)}
-	ar := Debug{d: (*C.lua_Debug)(car)}
+	s := State{l: (*C.lua_State)(cs)}
+	ar := Debug{l: s.l, d: (*C.lua_Debug)(car)}
 	ar.update()
 
-	s.Getglobal(namehooks)
+	var name string
 	switch ar.Event {
 	case Hookcall:
-		s.Getfield(-1, namecall)
+		name = namecall
 	case Hookret:
-		s.Getfield(-1, nameret)
+		name = nameret
 	case Hookline:
-		s.Getfield(-1, nameline)
+		name = nameline
 	case Hookcount:
-		s.Getfield(-1, namecount)
+		name = namecount
 	default:
 		return
 	}
-	fp := unsafe.Pointer(s.Touserdata(-1))
-	s.Pop(1) // pop hook table
-	fn := *(*func(*State, *Debug))(fp)
+	s.Getglobal(namehooks)
+	s.Getfield(-1, name)
+	fp := s.Touserdata(-1)
+	s.Pop(2) // pop hook and hook table
+	if fp == nil || *(*cgo.Handle)(fp) == 0 {
+		return
+	}
+	fn := (*(*cgo.Handle)(fp)).Value().(Hook)
 	fn(&s, &ar) // call the real hook
 }
 
@@ -219,31 +227,28 @@ func hookevent(cs unsafe.Pointer, car unsafe.Pointer) {
 // when the mask includes Maskcount. The hook is called for each event type
 // present in mask.
 //
-// A hook is disabled by setting mask to 0.
+// A hook is disabled by setting mask to 0. Returns an error if there is no
+// room on the stack to install the hook.
 func (s *State) Sethook(fn Hook, mask, count int) error {
-	s.Getglobal(namehooks)
-	if mask&Maskcall == Maskcall {
-		s.Pushstring(namecall)
-		s.Pushlightuserdata(unsafe.Pointer(&fn))
-		s.Settable(-3)
-	}
-	if mask&Maskret == Maskret {
-		s.Pushstring(nameret)
-		s.Pushlightuserdata(unsafe.Pointer(&fn))
-		s.Settable(-3)
-	}
-	if mask&Maskline == Maskline {
-		s.Pushstring(nameline)
-		s.Pushlightuserdata(unsafe.Pointer(&fn))
-		s.Settable(-3)
+	defer s.balanced("Sethook", 0)()
+	if err := s.grow(4); err != nil {
+		return err
 	}
-	if mask&Maskcount == Maskcount {
-		s.Pushstring(namecount)
-		s.Pushlightuserdata(unsafe.Pointer(&fn))
-		s.Settable(-3)
+	s.Getglobal(namehooks)
+	// The hook is kept through a handle, which the __gc of its userdata
+	// deletes once no event refers to it.
+	C.pushgohandle(s.live(), C.uintptr_t(cgo.NewHandle(fn)))
+	for _, ev := range []struct {
+		mask int
+		name string
+	}{{Maskcall, namecall}, {Maskret, nameret}, {Maskline, nameline}, {Maskcount, namecount}} {
+		if mask&ev.mask == ev.mask {
+			s.Pushvalue(-1)
+			s.Setfield(-3, ev.name)
+		}
 	}
-	s.Pop(1) // pop hook table
-	C.sethook(s.l, C.int(mask), C.int(count))
+	s.Pop(2) // pop hook and hook table
+	C.sethook(s.live(), C.int(mask), C.int(count))
 	return nil
 }
 
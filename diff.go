@@ -0,0 +1,179 @@
+package luajit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
+// Kinds of differences between tables.
+const (
+	Diffmissing = iota // key expected but absent
+	Diffextra          // key present but not expected
+	Diffchanged        // key present with a different value
+)
+
+// A Difference is a way in which a table differs from the one expected,
+// as found by Difftables.
+type Difference struct {
+	Kind int
+	Path string // the key, as a Lua expression such as limits.max or list[2]
+	Got  string // the value found, formatted, or "" if missing
+	Want string // the value expected, formatted, or "" if extra
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case Diffmissing:
+		return fmt.Sprintf("%s: missing, want %s", d.Path, d.Want)
+	case Diffextra:
+		return fmt.Sprintf("%s: extra %s", d.Path, d.Got)
+	}
+	return fmt.Sprintf("%s: got %s, want %s", d.Path, d.Got, d.Want)
+}
+
+// Compares the table at index got with the table at index want, both
+// valid indices, and returns their differences sorted by path, or nil if
+// they are equal. Nested tables are compared field by field, recursively;
+// other values are compared with Rawequal, so functions and userdata must
+// be the same objects. Keys that are tables are compared by identity too.
+// Metatables are ignored and no metamethods are invoked. If got or want
+// is not a table, the values themselves are compared, with the path "".
+// Difftables panics if the stack cannot grow to compare tables nested
+// too deeply, rather than report them equal.
+//
+// Difftables is meant for assertions on the results of scripts in tests:
+//
+//	if diffs := s.Difftables(-1, -2); diffs != nil {
+//		t.Errorf("unexpected result:\n%s", luajit.Formatdiff(diffs))
+//	}
+func (s *State) Difftables(got, want int) []Difference {
+	d := &differ{s: s, seen: make(map[[2]unsafe.Pointer]bool)}
+	d.diff(s.absindex(got), s.absindex(want), "")
+	sort.Slice(d.diffs, func(i, j int) bool { return d.diffs[i].Path < d.diffs[j].Path })
+	return d.diffs
+}
+
+// Compares the table at the given valid index with v, converted as by
+// Push, as Difftables does. Returns an error if v cannot be converted.
+func (s *State) Diffvalue(index int, v interface{}) ([]Difference, error) {
+	index = s.absindex(index)
+	if err := s.Push(v); err != nil {
+		return nil, err
+	}
+	defer s.Pop(1)
+	return s.Difftables(index, -1), nil
+}
+
+// Returns the differences one per line, for test failures.
+func Formatdiff(diffs []Difference) string {
+	lines := make([]string, len(diffs))
+	for i, d := range diffs {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+type differ struct {
+	s     *State
+	seen  map[[2]unsafe.Pointer]bool // pairs of tables being compared
+	diffs []Difference
+}
+
+func (d *differ) add(kind int, path string, got, want int) {
+	diff := Difference{Kind: kind, Path: path}
+	if kind != Diffmissing {
+		diff.Got = d.format(got)
+	}
+	if kind != Diffextra {
+		diff.Want = d.format(want)
+	}
+	d.diffs = append(d.diffs, diff)
+}
+
+// Formats the value at index for a Difference.
+func (d *differ) format(index int) string {
+	if d.s.Type(index) == Tstring {
+		return fmt.Sprintf("%q", d.s.Tostring(index))
+	}
+	return d.s.Keystring(index)
+}
+
+func (d *differ) diff(got, want int, path string) {
+	s := d.s
+	if !s.Istable(got) || !s.Istable(want) {
+		if !s.Rawequal(got, want) {
+			d.add(Diffchanged, path, got, want)
+		}
+		return
+	}
+	pair := [2]unsafe.Pointer{s.Topointer(got), s.Topointer(want)}
+	if d.seen[pair] {
+		return
+	}
+	if !s.Checkstack(4) {
+		panic(errstack)
+	}
+	d.seen[pair] = true
+	defer delete(d.seen, pair)
+
+	s.Pushnil()
+	for s.Next(got) != 0 {
+		top := s.Gettop()
+		sub := d.path(path, top-1)
+		s.Pushvalue(top - 1)
+		s.Rawget(want)
+		if s.Isnil(-1) {
+			d.add(Diffextra, sub, top, 0)
+		} else {
+			d.diff(top, top+1, sub)
+		}
+		s.Pop(2)
+	}
+	s.Pushnil()
+	for s.Next(want) != 0 {
+		top := s.Gettop()
+		s.Pushvalue(top - 1)
+		s.Rawget(got)
+		if s.Isnil(-1) {
+			d.add(Diffmissing, d.path(path, top-1), 0, top)
+		}
+		s.Pop(2)
+	}
+}
+
+// Returns the path of the field with the key at index in the table at
+// path.
+func (d *differ) path(path string, index int) string {
+	s := d.s
+	if s.Type(index) == Tstring && isname(s.Tostring(index)) {
+		if path == "" {
+			return s.Tostring(index)
+		}
+		return path + "." + s.Tostring(index)
+	}
+	return path + "[" + d.format(index) + "]"
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true,
+	"or": true, "repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
+
+// Reports whether str is a valid Lua identifier.
+func isname(str string) bool {
+	if str == "" || '0' <= str[0] && str[0] <= '9' || keywords[str] {
+		return false
+	}
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package luajit
+
+import "testing"
+
+func TestDifftables(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`
+		local got = {name = "a", list = {1, 2, 4}, extra = true, nested = {deep = {x = 1}}, ["not a name"] = 1}
+		got.self = got
+		local want = {name = "b", list = {1, 2, 3, 4}, nested = {deep = {x = 1}}, ["not a name"] = 1}
+		want.self = want
+		return got, want
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	want := `extra: extra true
+list[3]: got 4, want 3
+list[4]: missing, want 4
+name: got "a", want "b"`
+	if got := Formatdiff(s.Difftables(1, 2)); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	if diffs := s.Difftables(2, 2); diffs != nil {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+
+	diffs, err := s.Diffvalue(1, map[string]interface{}{
+		"name":       "a",
+		"list":       []int{1, 2, 4},
+		"extra":      true,
+		"nested":     map[string]interface{}{"deep": map[string]int{"x": 2}},
+		"not a name": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].String() != "nested.deep.x: got 1, want 2" ||
+		diffs[1].Path != "self" || diffs[1].Kind != Diffextra {
+		t.Errorf("unexpected differences\n%s", Formatdiff(diffs))
+	}
+	if s.Gettop() != 2 {
+		t.Errorf("expected 2 values on the stack, got %d", s.Gettop())
+	}
+}
+
+func TestDifftablestoodeep(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	err := s.Loadstring(`
+		local function chain(n)
+			local t = {}
+			for i = 1, n do t = {t} end
+			return t
+		end
+		return chain(10000), chain(10000)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	defer func() {
+		if r := recover(); r != errstack {
+			t.Errorf("expected panic with %v, got %v", errstack, r)
+		}
+	}()
+	s.Difftables(1, 2)
+}
@@ -0,0 +1,72 @@
+package luajit
+
+// What the LuaJIT library linked at run time provides, which may differ
+// from the headers the package was built with (see Version): a shared
+// library may be upgraded, or come from a fork such as OpenResty's.
+var engine struct {
+	version    string
+	versionnum int
+	ffi        bool
+	compat52   bool
+	profiler   bool
+	gotostmt   bool
+	pairsmeta  bool
+}
+
+// Probes the engine in a scratch State. Features that LuaJIT builds in
+// optionally show up as preloaded modules or as library functions.
+const enginechunk = `
+local preload = package.preload
+local metapairs = false
+pairs(setmetatable({}, {__pairs = function(t) metapairs = true return next, t end}))
+return jit and jit.version or "", jit and jit.version_num or 0,
+	preload.ffi ~= nil or package.loaded.ffi ~= nil,
+	table.pack ~= nil,
+	preload["jit.profile"] ~= nil or package.loaded["jit.profile"] ~= nil,
+	loadstring("goto l ::l::") ~= nil,
+	metapairs`
+
+func init() {
+	s := Newstate()
+	if s == nil {
+		return
+	}
+	defer s.Close()
+	s.Openlibs()
+	if s.Loadstring(enginechunk) != nil || s.Pcall(0, 7, 0) != nil {
+		return
+	}
+	engine.version = s.Tostring(-7)
+	engine.versionnum = s.Tointeger(-6)
+	engine.ffi = s.Toboolean(-5)
+	engine.compat52 = s.Toboolean(-4)
+	engine.profiler = s.Toboolean(-3)
+	engine.gotostmt = s.Toboolean(-2)
+	engine.pairsmeta = s.Toboolean(-1)
+}
+
+// Returns the version of the running LuaJIT engine, such as "LuaJIT
+// 2.1.0-beta3", and its number, such as 20100, as given by jit.version and
+// jit.version_num.
+func EngineVersion() (string, int) {
+	return engine.version, engine.versionnum
+}
+
+// Reports whether the running engine has the ffi library.
+func HasFFI() bool {
+	return engine.ffi
+}
+
+// Reports whether the running engine was built with
+// LUAJIT_ENABLE_LUA52COMPAT, which adds features of Lua 5.2 such as
+// table.pack and table.unpack and the __pairs and __ipairs metamethods;
+// see also HasPairsmeta, Tablepack, and Metapairs.
+func Has52Compat() bool {
+	return engine.compat52
+}
+
+// Reports whether the running engine has the jit.profile module of the
+// sampling profiler, new in LuaJIT 2.1.
+func HasProfiler() bool {
+	return engine.profiler
+}
@@ -0,0 +1,31 @@
+package luajit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEngineversion(t *testing.T) {
+	v, n := EngineVersion()
+	if !strings.HasPrefix(v, "LuaJIT ") || n < 20000 {
+		t.Errorf("unexpected engine version %q %d", v, n)
+	}
+
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`return pcall(require, "ffi"), table.pack ~= nil`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Toboolean(-2) != HasFFI() || s.Toboolean(-1) != Has52Compat() {
+		t.Errorf("probes disagree: ffi %t/%t, 5.2 compat %t/%t",
+			s.Toboolean(-2), HasFFI(), s.Toboolean(-1), Has52Compat())
+	}
+	s.Pop(2)
+}
@@ -0,0 +1,142 @@
+package luajit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+var errexecclosed = errors.New("executor closed")
+
+// An Executor runs Lua code on states it owns, each on its own goroutine
+// locked to an OS thread, so that callers can submit work from any
+// goroutine without ever sharing a State. Jobs are run in the order they
+// are submitted, by whichever state is free first.
+type Executor struct {
+	jobs chan execjob
+	wg   sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type execjob struct {
+	ctx  context.Context
+	fn   func(s *State) error
+	done chan error
+}
+
+// Creates an executor with n states, each initialized by a call to setup
+// on its own goroutine. Returns the first error from setup, if any.
+func Newexecutor(n int, setup func(s *State) error) (*Executor, error) {
+	if n < 1 {
+		return nil, errors.New("executor needs at least one state")
+	}
+	e := &Executor{jobs: make(chan execjob)}
+	ready := make(chan error, n)
+	for i := 0; i < n; i++ {
+		e.wg.Add(1)
+		go e.work(setup, ready)
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		if r := <-ready; r != nil && err == nil {
+			err = r
+		}
+	}
+	if err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Runs jobs on a new state until the executor is closed.
+func (e *Executor) work(setup func(s *State) error, ready chan<- error) {
+	defer e.wg.Done()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	s := Newstate()
+	if s == nil {
+		ready <- errors.New("cannot create state: not enough memory")
+		return
+	}
+	defer s.Close()
+	if setup != nil {
+		if err := setup(s); err != nil {
+			ready <- err
+			return
+		}
+	}
+	ready <- nil
+	for j := range e.jobs {
+		if err := j.ctx.Err(); err != nil {
+			j.done <- err
+			continue
+		}
+		j.done <- runjob(s, j.fn)
+	}
+}
+
+// Calls fn on s, turning a panic into an error and leaving the stack
+// empty for the next job.
+func runjob(s *State, fn func(s *State) error) (err error) {
+	defer s.Settop(0)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(s)
+}
+
+// Runs fn on one of the executor's states and returns its error. fn must
+// not keep the state after it returns. If ctx is done before a state is
+// free, Do returns ctx.Err() without running fn; once fn runs, it is not
+// interrupted.
+func (e *Executor) Do(ctx context.Context, fn func(s *State) error) error {
+	e.mu.RLock()
+	if e.closed {
+		e.mu.RUnlock()
+		return errexecclosed
+	}
+	j := execjob{ctx, fn, make(chan error, 1)}
+	select {
+	case e.jobs <- j:
+		e.mu.RUnlock()
+	case <-ctx.Done():
+		e.mu.RUnlock()
+		return ctx.Err()
+	}
+	return <-j.done
+}
+
+// Runs the Lua chunk src with the given arguments, converted as by Push,
+// on one of the executor's states, and returns its results, converted as
+// by Tovalue. Errors are reported as for Do and Callglobal.
+func (e *Executor) Submit(ctx context.Context, src string, args ...interface{}) ([]interface{}, error) {
+	var results []interface{}
+	err := e.Do(ctx, func(s *State) error {
+		var err error
+		results, err = s.runstring(src, args)
+		return err
+	})
+	return results, err
+}
+
+// Stops the executor once the jobs already submitted are done, and closes
+// its states. Do and Submit fail from then on.
+func (e *Executor) Close() {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return
+	}
+	e.closed = true
+	close(e.jobs)
+	e.mu.Unlock()
+	e.wg.Wait()
+}
@@ -0,0 +1,57 @@
+package luajit
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestExecutor(t *testing.T) {
+	e, err := Newexecutor(2, func(s *State) error {
+		s.Openlibs()
+		if err := s.Loadstring(`function square(x) return x * x end`); err != nil {
+			return err
+		}
+		return s.Pcall(0, 0, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := e.Submit(ctx, `return square(...)`, i)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(r) != 1 || r[0] != float64(i*i) {
+				t.Errorf("expected [%d], got %v", i*i, r)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := e.Submit(ctx, `error("boom")`); err == nil {
+		t.Error("expected error from the script")
+	}
+	err = e.Do(ctx, func(s *State) error {
+		panic("oops")
+	})
+	if err == nil {
+		t.Error("expected error from a panic")
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := e.Do(canceled, func(s *State) error { return nil }); err == nil {
+		t.Error("expected error from a canceled context")
+	}
+	e.Close()
+	if _, err := e.Submit(ctx, `return 1`); err == nil {
+		t.Error("expected error from a closed executor")
+	}
+}
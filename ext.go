@@ -0,0 +1,97 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <luajit.h>
+
+#if LUAJIT_VERSION_NUM >= 20100
+enum { Hasext = 1 };
+
+static int
+isyieldable(lua_State *l)
+{
+	return lua_isyieldable(l);
+}
+
+static double
+luaversion(lua_State *l)
+{
+	return *lua_version(l);
+}
+#else
+enum { Hasext = 0 };
+
+static int
+isyieldable(lua_State *l)
+{
+	return -1;
+}
+
+static double
+luaversion(lua_State *l)
+{
+	return LUA_VERSION_NUM;
+}
+#endif
+*/
+import "C"
+import "errors"
+
+// Whether the LuaJIT the package is built with provides the 2.1
+// extensions of the C API borrowed from later Lua versions, such as
+// lua_isyieldable.
+const Hasextensions = C.Hasext == 1
+
+var errnoext = errors.New("not supported before LuaJIT 2.1")
+
+// Reports whether the running coroutine of s can yield, which it cannot
+// in the main thread or inside a non-yieldable Go or C function. Returns
+// an error if Hasextensions is false.
+func (s *State) Isyieldable() (bool, error) {
+	r := int(C.isyieldable(s.live()))
+	if r < 0 {
+		return false, errnoext
+	}
+	return r != 0, nil
+}
+
+// Returns the version number of the Lua API implemented by the core of
+// s, such as 501 for Lua 5.1.
+func (s *State) Luaversion() float64 {
+	return float64(C.luaversion(s.live()))
+}
+
+// Registers the functions in funcs into the table on top of the stack,
+// below nup upvalues, as luaL_setfuncs does: each function is made a
+// closure sharing copies of the upvalues, which are popped. A nil
+// function registers false, as a placeholder.
+//
+// Setfuncs and Newlib follow the Lua 5.2 registration helpers and work
+// with any LuaJIT version.
+func (s *State) Setfuncs(funcs map[string]Gofunction, nup int) error {
+	if err := s.grow(nup + 1); err != nil {
+		return err
+	}
+	for name, fn := range funcs {
+		if fn == nil {
+			s.Pushboolean(false)
+		} else {
+			for i := 0; i < nup; i++ {
+				s.Pushvalue(-nup)
+			}
+			s.Pushclosure(fn, nup)
+		}
+		s.Setfield(-(nup + 2), name)
+	}
+	s.Pop(nup)
+	return nil
+}
+
+// Pushes a new table holding the functions in funcs, as luaL_newlib does.
+func (s *State) Newlib(funcs map[string]Gofunction) error {
+	if err := s.grow(1); err != nil {
+		return err
+	}
+	s.Createtable(0, len(funcs))
+	return s.Setfuncs(funcs, 0)
+}
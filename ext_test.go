@@ -0,0 +1,64 @@
+package luajit
+
+import "testing"
+
+func TestExtensions(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if v := s.Luaversion(); v != 501 {
+		t.Errorf("expected Lua API version 501, got %v", v)
+	}
+	y, err := s.Isyieldable()
+	if Hasextensions {
+		if err != nil || y {
+			t.Errorf("expected main thread not yieldable, got %t, %v", y, err)
+		}
+	} else if err == nil {
+		t.Error("expected error without extensions")
+	}
+}
+
+func TestSetfuncs(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	counter := func(s *State) int {
+		n := s.Tointeger(Upvalueindex(1)) + 1
+		s.Pushinteger(n)
+		s.Replace(Upvalueindex(1))
+		s.Pushinteger(n)
+		return 1
+	}
+	if err := s.Newlib(map[string]Gofunction{"placeholder": nil}); err != nil {
+		t.Fatal(err)
+	}
+	s.Pushinteger(10)
+	if err := s.Setfuncs(map[string]Gofunction{"a": counter, "b": counter}, 1); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("lib")
+
+	err := s.Loadstring(`
+		assert(lib.placeholder == false)
+		assert(lib.a() == 11 and lib.a() == 12)
+		assert(lib.b() == 11, "upvalues are copied")
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+}
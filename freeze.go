@@ -0,0 +1,67 @@
+package luajit
+
+import "fmt"
+
+// Replaces the table at the given valid index with a read-only proxy for
+// it. Reading a field of the proxy reads the table, while assigning to one
+// raises an error, and the proxy's metatable is protected so that scripts
+// cannot reach the table through getmetatable or change the metatable
+// with setmetatable. pairs, ipairs and # see the table through the proxy
+// only when LuaJIT is built with LUAJIT_ENABLE_LUA52COMPAT.
+//
+// Freezing is shallow: tables stored in the table stay writable unless
+// they are frozen too. Scripts that can call rawset can still add fields
+// to the proxy itself, so sandboxes that rely on Freeze should not expose
+// it.
+func (s *State) Freeze(index int) error {
+	defer s.balanced("Freeze", 0)()
+	if !s.Istable(index) {
+		return fmt.Errorf("cannot freeze a %s", s.Typename(s.Type(index)))
+	}
+	if err := s.grow(4); err != nil {
+		return err
+	}
+	index = s.absindex(index)
+	s.Newtable()
+	s.Createtable(0, 6)
+	s.Pushvalue(index)
+	s.Setfield(-2, "__index")
+	s.Pushfunction(frozennewindex)
+	s.Setfield(-2, "__newindex")
+	s.Pushboolean(false)
+	s.Setfield(-2, "__metatable")
+	s.Pushvalue(index)
+	s.Pushclosure(frozenlen, 1)
+	s.Setfield(-2, "__len")
+	for _, name := range []string{"pairs", "ipairs"} {
+		s.Getglobal(name)
+		s.Pushvalue(index)
+		s.Pushclosure(frozeniter, 2)
+		s.Setfield(-2, "__"+name)
+	}
+	s.Setmetatable(-2)
+	s.Replace(index)
+	return nil
+}
+
+var frozennewindex Gofunction = func(s *State) int {
+	return s.Errorf("attempt to modify a frozen table")
+}
+
+// The __len metamethod of a frozen table: returns the length of the table
+// in upvalue 1.
+var frozenlen Gofunction = func(s *State) int {
+	s.Pushinteger(s.Objlen(Upvalueindex(1)))
+	return 1
+}
+
+// The __pairs and __ipairs metamethods of a frozen table: calls pairs or
+// ipairs, in upvalue 1, on the table in upvalue 2.
+var frozeniter Gofunction = func(s *State) int {
+	s.Pushvalue(Upvalueindex(1))
+	s.Pushvalue(Upvalueindex(2))
+	if s.Pcall(1, 3, 0) != nil {
+		return errorreturn // raise the message on top
+	}
+	return 3
+}
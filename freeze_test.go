@@ -0,0 +1,81 @@
+package luajit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFreeze(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if err := s.Loadstring(`return {name = "prod", ports = {80, 443}}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Freeze(-1); err != nil {
+		t.Fatal(err)
+	}
+	if s.Gettop() != 1 {
+		t.Fatalf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+	s.Setglobal("config")
+
+	err := s.Loadstring(`
+		assert(config.name == "prod" and config.ports[2] == 443)
+		assert(not pcall(function() config.name = "dev" end))
+		assert(getmetatable(config) == false)
+		assert(not pcall(setmetatable, config, {}))
+		assert(getmetatable(config) == false and config.name == "prod")
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	s.Pushnumber(1)
+	if err := s.Freeze(-1); err == nil {
+		t.Error("expected error for a number")
+	}
+	s.Pop(1)
+}
+
+func TestFreezeiterror(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`pairs = function() error("no pairs") end`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	s.Newtable()
+	if err := s.Freeze(-1); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Getmetafield(1, "__pairs") {
+		t.Fatal("expected a __pairs metamethod")
+	}
+	s.Pushvalue(1)
+	err = s.Pcall(1, 3, 0)
+	if err == nil {
+		t.Fatal("expected an error from __pairs")
+	}
+	if msg := s.Tostring(-1); !strings.Contains(msg, "no pairs") {
+		t.Errorf("expected the error of pairs, got %q", msg)
+	}
+}
@@ -0,0 +1,568 @@
+package luajit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Writablefs is an fs.FS that can also open files for writing, as the
+// write modes of io.open need under Openfsio.
+type Writablefs interface {
+	fs.FS
+	OpenFile(name string, flag int, perm fs.FileMode) (Writablefile, error)
+}
+
+// A file opened for writing by a Writablefs, as *os.File is.
+type Writablefile interface {
+	fs.File
+	io.Writer
+	io.Seeker
+}
+
+type rootfs struct {
+	root *os.Root
+}
+
+func (r rootfs) Open(name string) (fs.File, error) {
+	return r.root.Open(name)
+}
+
+func (r rootfs) OpenFile(name string, flag int, perm fs.FileMode) (Writablefile, error) {
+	return r.root.OpenFile(name, flag, perm)
+}
+
+// Returns a Writablefs for the directory tree of root, from which names
+// cannot escape, not even through symbolic links.
+func Rootfs(root *os.Root) Writablefs {
+	return rootfs{root}
+}
+
+// The Go object behind a file opened by io.open under Openfsio, or a
+// stream given to Setstdio.
+type fsfile struct {
+	f      interface{}   // an fs.File, or an io.Reader or io.Writer
+	r      *bufio.Reader // reads through a buffer, made on the first read
+	closed bool
+	std    bool // a standard stream, which scripts cannot close
+}
+
+var errclosedfile = errors.New("attempt to use a closed file")
+
+func (f *fsfile) reader() (*bufio.Reader, error) {
+	if f.r == nil {
+		rd, ok := f.f.(io.Reader)
+		if !ok {
+			return nil, errors.New("file not open for reading")
+		}
+		f.r = bufio.NewReader(rd)
+	}
+	return f.r, nil
+}
+
+func (f *fsfile) close() error {
+	f.closed = true
+	if c, ok := f.f.(io.Closer); ok && !f.std {
+		return c.Close()
+	}
+	return nil
+}
+
+// Drops the read buffer, moving the file position back to the first byte
+// not yet read, so that writes and seeks happen where Lua expects.
+func (f *fsfile) unread() error {
+	if f.r == nil {
+		return nil
+	}
+	n := f.r.Buffered()
+	f.r = nil
+	if n == 0 {
+		return nil
+	}
+	sk, ok := f.f.(io.Seeker)
+	if !ok {
+		return errors.New("file is not seekable")
+	}
+	_, err := sk.Seek(-int64(n), io.SeekCurrent)
+	return err
+}
+
+// Modes of io.open and the flags they open files with.
+var fsmodes = map[string]int{
+	"r":  os.O_RDONLY,
+	"w":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"a":  os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+	"r+": os.O_RDWR,
+	"w+": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+	"a+": os.O_RDWR | os.O_CREATE | os.O_APPEND,
+}
+
+// Turns a Lua file name into a name for fsys: slashes only, relative to
+// its root, and without .. elements that would leave it.
+func fsname(name string) (string, error) {
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	if clean == "" {
+		clean = "."
+	}
+	if !fs.ValidPath(clean) || strings.Contains(name, "\x00") {
+		return "", fs.ErrInvalid
+	}
+	return clean, nil
+}
+
+// Replaces the functions of the io library that open files by name, so
+// that scripts open files in fsys instead of the file system of the
+// process: io.open and io.lines work on names within fsys, with "/" and
+// "\" as separators and .. elements unable to leave its root, and
+// io.close and io.type also handle the files they return. io.popen,
+// io.input, io.output, and io.tmpfile, which open files and processes of
+// their own, are removed. If the io library is not open, Openfsio creates
+// the io table with the functions above only.
+//
+// Files open for reading in any fs.FS. The write modes of io.open need
+// fsys to be a Writablefs, such as the one Rootfs gives for a directory;
+// otherwise they fail with fs.ErrPermission. Files support the read,
+// lines, write, seek, flush, setvbuf, and close methods of Lua files;
+// seek needs a file implementing io.Seeker.
+func (s *State) Openfsio(fsys fs.FS) error {
+	defer s.balanced("Openfsio", 0)()
+	if err := s.grow(4); err != nil {
+		return err
+	}
+	s.iotable()
+	s.Pushfunction(func(s *State) int {
+		return fsopen(s, fsys)
+	})
+	s.Setfield(-2, "open")
+	s.Pushfunction(func(s *State) int {
+		if s.Isnoneornil(1) {
+			return s.Errorf("bad argument #1 to 'lines' (file name expected)")
+		}
+		s.Settop(1)
+		if fsopen(s, fsys) != 1 {
+			return s.Errorf("%s", s.Tostring(-1))
+		}
+		s.Pushclosure(fslines(true), 1)
+		return 1
+	})
+	s.Setfield(-2, "lines")
+	s.Getfield(-1, "close")
+	s.Pushclosure(fsfallback(fsclose), 1)
+	s.Setfield(-2, "close")
+	s.Getfield(-1, "type")
+	s.Pushclosure(fsfallback(fstype), 1)
+	s.Setfield(-2, "type")
+	for _, name := range []string{"popen", "input", "output", "tmpfile"} {
+		s.Pushnil()
+		s.Setfield(-2, name)
+	}
+	s.Pop(1)
+	return nil
+}
+
+// Pushes the io table, creating it if the io library is not open. Needs
+// three free stack slots.
+func (s *State) iotable() {
+	s.Getglobal(IOlibname)
+	if s.Istable(-1) {
+		return
+	}
+	s.Pop(1)
+	s.Newtable()
+	s.Pushvalue(-1)
+	s.Setglobal(IOlibname)
+	s.Getfield(Registryindex, "_LOADED")
+	if s.Istable(-1) {
+		s.Pushvalue(-2)
+		s.Setfield(-2, IOlibname)
+	}
+	s.Pop(1)
+}
+
+// io.open(name [, mode]) in fsys: pushes the file, or nil and a message.
+func fsopen(s *State, fsys fs.FS) int {
+	if !s.Isstring(1) {
+		return s.Errorf("bad argument #1 to 'open' (string expected, got %s)", s.Typename(s.Type(1)))
+	}
+	name := s.Tostring(1)
+	mode := "r"
+	if !s.Isnoneornil(2) {
+		mode = s.Tostring(2)
+	}
+	flag, ok := fsmodes[strings.Replace(mode, "b", "", 1)]
+	if !ok {
+		return s.Errorf("bad argument #2 to 'open' (invalid mode '%s')", mode)
+	}
+	f, err := openfs(fsys, name, flag)
+	if err != nil {
+		s.Pushnil()
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err
+		}
+		s.Pushstring(fmt.Sprintf("%s: %v", name, err))
+		return 2
+	}
+	s.pushfsfile(&fsfile{f: f})
+	return 1
+}
+
+// Pushes f as a Lua file.
+func (s *State) pushfsfile(f *fsfile) {
+	s.pushhandle(f)
+	if s.proxymeta("luajit.fsfile") {
+		s.Createtable(0, 7)
+		for name, fn := range fsmethods() {
+			s.Pushfunction(fn)
+			s.Setfield(-2, name)
+		}
+		s.Setfield(-2, "__index")
+		s.Pushfunction(fstostring)
+		s.Setfield(-2, "__tostring")
+		s.Pushfunction(fsgc)
+		s.Setfield(-2, "__gc")
+	}
+	s.Setmetatable(-2)
+}
+
+func openfs(fsys fs.FS, name string, flag int) (fs.File, error) {
+	clean, err := fsname(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if flag == os.O_RDONLY {
+		return fsys.Open(clean)
+	}
+	wfs, ok := fsys.(Writablefs)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return wfs.OpenFile(clean, flag, 0666)
+}
+
+func fsmethods() map[string]Gofunction {
+	return map[string]Gofunction{
+		"read":    fsread,
+		"lines":   fsfilelines,
+		"write":   fswrite,
+		"seek":    fsseek,
+		"flush":   fsflush,
+		"setvbuf": fsflush,
+		"close":   fsclose,
+	}
+}
+
+// Returns the open file at the given index of the stack of a Go function.
+func tofsfile(s *State, index int) (*fsfile, error) {
+	obj, _ := s.toobject(index)
+	f, ok := obj.(*fsfile)
+	if !ok {
+		return nil, fmt.Errorf("bad argument #%d (file expected, got %s)", index, s.Typename(s.Type(index)))
+	}
+	if f.closed {
+		return nil, errclosedfile
+	}
+	return f, nil
+}
+
+// Pushes nil and the message of err, as Lua file functions fail.
+func fsfail(s *State, err error) int {
+	s.Pushnil()
+	s.Pushstring(err.Error())
+	return 2
+}
+
+var fsread Gofunction = func(s *State) int {
+	f, err := tofsfile(s, 1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return readformats(s, f, 2)
+}
+
+// Reads with the formats from stack index first on, pushing a value for
+// each up to the first that fails, for which it pushes nil. Without
+// formats, reads a line.
+func readformats(s *State, f *fsfile, first int) int {
+	r, err := f.reader()
+	if err != nil {
+		return fsfail(s, err)
+	}
+	top := s.Gettop()
+	if top < first {
+		s.Pushstring("*l")
+		top = first
+	}
+	if err := s.grow(top - first + 1); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	n := 0
+	for i := first; i <= top; i++ {
+		n++
+		if s.Type(i) == Tnumber {
+			if !readbytes(s, r, s.Tointeger(i)) {
+				break
+			}
+			continue
+		}
+		format := strings.TrimPrefix(s.Tostring(i), "*")
+		if format == "" {
+			return s.Errorf("bad argument #%d to 'read' (invalid format)", i)
+		}
+		var ok bool
+		switch format[0] {
+		case 'n':
+			ok = readnumber(s, r)
+		case 'a':
+			b, _ := io.ReadAll(r)
+			s.Pushbytes(b)
+			ok = true
+		case 'l', 'L':
+			ok = readline(s, r, format[0] == 'L')
+		default:
+			return s.Errorf("bad argument #%d to 'read' (invalid format)", i)
+		}
+		if !ok {
+			break
+		}
+	}
+	return n
+}
+
+// Pushes up to n bytes, or nil at the end of the file. With n 0, pushes
+// "" unless at the end of the file.
+func readbytes(s *State, r *bufio.Reader, n int) bool {
+	if n <= 0 {
+		if _, err := r.Peek(1); err != nil {
+			s.Pushnil()
+			return false
+		}
+		s.Pushstring("")
+		return true
+	}
+	// n comes from the script, so the buffer only grows with the data
+	// actually read.
+	b, _ := io.ReadAll(io.LimitReader(r, int64(n)))
+	if len(b) == 0 {
+		s.Pushnil()
+		return false
+	}
+	s.Pushbytes(b)
+	return true
+}
+
+// Pushes the next line, with its newline if keep is true, or nil at the
+// end of the file.
+func readline(s *State, r *bufio.Reader, keep bool) bool {
+	line, err := r.ReadString('\n')
+	if err != nil && line == "" {
+		s.Pushnil()
+		return false
+	}
+	if !keep {
+		line = strings.TrimSuffix(line, "\n")
+	}
+	s.Pushstring(line)
+	return true
+}
+
+// Pushes the number that follows any white space, or nil if there is none.
+func readnumber(s *State, r *bufio.Reader) bool {
+	var b strings.Builder
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			break
+		}
+		if b.Len() == 0 && unicode.IsSpace(c) {
+			continue
+		}
+		if !strings.ContainsRune("0123456789+-.eEpPxXabcdefABCDEF", c) {
+			r.UnreadRune()
+			break
+		}
+		b.WriteRune(c)
+	}
+	if v, err := strconv.ParseFloat(b.String(), 64); err == nil {
+		s.Pushnumber(v)
+		return true
+	}
+	if v, err := strconv.ParseInt(b.String(), 0, 64); err == nil {
+		s.Pushnumber(float64(v))
+		return true
+	}
+	s.Pushnil()
+	return false
+}
+
+var fsfilelines Gofunction = func(s *State) int {
+	if _, err := tofsfile(s, 1); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Settop(1)
+	s.Pushclosure(fslines(false), 1)
+	return 1
+}
+
+// Returns the iterator of lines of the file in upvalue 1, which closes the
+// file at its end if close is true, as io.lines does.
+func fslines(close bool) Gofunction {
+	return func(s *State) int {
+		f, err := tofsfile(s, Upvalueindex(1))
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		r, err := f.reader()
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		if readline(s, r, false) {
+			return 1
+		}
+		if close {
+			f.close()
+		}
+		return 1
+	}
+}
+
+var fswrite Gofunction = func(s *State) int {
+	f, err := tofsfile(s, 1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	w, ok := f.f.(io.Writer)
+	if !ok {
+		return fsfail(s, errors.New("file not open for writing"))
+	}
+	if err := f.unread(); err != nil {
+		return fsfail(s, err)
+	}
+	for i := 2; i <= s.Gettop(); i++ {
+		if !s.Isstring(i) {
+			return s.Errorf("bad argument #%d to 'write' (string expected, got %s)", i, s.Typename(s.Type(i)))
+		}
+		if _, err := w.Write(s.Tobytes(i)); err != nil {
+			return fsfail(s, err)
+		}
+	}
+	s.Settop(1)
+	return 1
+}
+
+var fsseek Gofunction = func(s *State) int {
+	f, err := tofsfile(s, 1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	whence := io.SeekCurrent
+	if !s.Isnoneornil(2) {
+		switch s.Tostring(2) {
+		case "set":
+			whence = io.SeekStart
+		case "cur":
+		case "end":
+			whence = io.SeekEnd
+		default:
+			return s.Errorf("bad argument #2 to 'seek' (invalid option '%s')", s.Tostring(2))
+		}
+	}
+	offset := int64(s.Tointeger(3))
+	sk, ok := f.f.(io.Seeker)
+	if !ok {
+		return fsfail(s, errors.New("file is not seekable"))
+	}
+	if err := f.unread(); err != nil {
+		return fsfail(s, err)
+	}
+	pos, err := sk.Seek(offset, whence)
+	if err != nil {
+		return fsfail(s, err)
+	}
+	s.Pushnumber(float64(pos))
+	return 1
+}
+
+// Writes are not buffered, so there is nothing to flush or configure.
+var fsflush Gofunction = func(s *State) int {
+	if _, err := tofsfile(s, 1); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Pushboolean(true)
+	return 1
+}
+
+var fsclose Gofunction = func(s *State) int {
+	f, err := tofsfile(s, 1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	if f.std {
+		return fsfail(s, errors.New("cannot close standard file"))
+	}
+	if err := f.close(); err != nil {
+		return fsfail(s, err)
+	}
+	s.Pushboolean(true)
+	return 1
+}
+
+var fstostring Gofunction = func(s *State) int {
+	obj, _ := s.toobject(1)
+	if f, ok := obj.(*fsfile); ok && f.closed {
+		s.Pushstring("file (closed)")
+	} else {
+		s.Pushstring(fmt.Sprintf("file (%p)", s.Topointer(1)))
+	}
+	return 1
+}
+
+// Closes a file that is collected while still open.
+var fsgc Gofunction = func(s *State) int {
+	obj, _ := s.toobject(1)
+	if f, ok := obj.(*fsfile); ok && !f.closed {
+		f.close()
+	}
+	return gcobject(s)
+}
+
+var fstype Gofunction = func(s *State) int {
+	obj, _ := s.toobject(1)
+	if obj.(*fsfile).closed {
+		s.Pushstring("closed file")
+	} else {
+		s.Pushstring("file")
+	}
+	return 1
+}
+
+// Returns an io library function that calls fn for the files of Openfsio,
+// and leaves other values to the original function in upvalue 1, if any.
+// Without the original function, values other than files give nil, as
+// io.type does.
+func fsfallback(fn Gofunction) Gofunction {
+	return func(s *State) int {
+		if obj, _ := s.toobject(1); obj != nil {
+			if _, ok := obj.(*fsfile); ok {
+				return fn(s)
+			}
+		}
+		if !s.Isfunction(Upvalueindex(1)) {
+			s.Pushnil()
+			return 1
+		}
+		s.Pushvalue(Upvalueindex(1))
+		s.Insert(1)
+		if err := s.Pcall(s.Gettop()-1, Multret, 0); err != nil {
+			return errorreturn
+		}
+		return s.Gettop()
+	}
+}
@@ -0,0 +1,92 @@
+package luajit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOpenfsio(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	fsys := fstest.MapFS{
+		"data/nums.txt": {Data: []byte("12 0x10 -1.5e1\nrest of line\nlast")},
+	}
+	if err := s.Openfsio(fsys); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Loadstring(`
+		local f = assert(io.open("/data/../data/nums.txt"))
+		local a, b, c = f:read("*n", "*n", "*n")
+		local l1, l2 = f:read("*l", "*l")
+		local rest = f:read("*a")
+		local eof = f:read("*l")
+		f:close()
+		local n = 0
+		for line in io.lines("data/nums.txt") do n = n + 1 end
+		local _, escape = io.open("../etc/passwd")
+		local _, write = io.open("data/new.txt", "w")
+		return a, b, c, l1, l2, rest, eof, io.type(f), n, escape, write, io.popen
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[12 16 -15  rest of line last <nil> closed file 3 ../etc/passwd: file does not exist data/new.txt: permission denied <nil>]"
+	if fmt.Sprint(v) != want {
+		t.Errorf("expected %s, got %v", want, v)
+	}
+}
+
+func TestRootfs(t *testing.T) {
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Openfsio(Rootfs(root)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Loadstring(`
+		local f = assert(io.open("out.txt", "w+"))
+		f:write("hello ", 42, "\n")
+		local size = f:seek("end")
+		f:seek("set", 6)
+		local word = f:read(2)
+		local rest = f:read(2^40) -- sized by the data, not the count
+		f:close()
+		return size, word, rest, io.type(io.stdout)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[9 42 \n file]" {
+		t.Errorf("unexpected results %v", v)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil || string(b) != "hello 42\n" {
+		t.Errorf("unexpected file contents %q %v", b, err)
+	}
+}
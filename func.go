@@ -0,0 +1,119 @@
+package luajit
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var (
+	errortype = reflect.TypeOf((*error)(nil)).Elem()
+	statetype = reflect.TypeOf((*State)(nil))
+)
+
+// Pushes onto the stack a Lua function that calls the Go function fn,
+// which may have any signature, converting its arguments and results.
+//
+// When called from Lua, the arguments are converted to the types of the
+// parameters of fn as by Unmarshal; missing arguments and nil become zero
+// values, and the extra arguments of a variadic function are collected
+// into its final parameter. If the first parameter of fn has type *State,
+// it receives the calling state instead of an argument. The results of fn
+// are converted as by Push and returned to Lua. If the last result has
+// type error, it is not returned; instead, a non-nil error is raised as a
+// Lua error. For example,
+//
+//	s.Pushfunc(func(path string, mode int) (string, error) {
+//		...
+//	})
+//
+// gives a function that is called from Lua as f("/tmp/x", 420) and that
+// either returns a string or raises an error.
+func (s *State) Pushfunc(fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("cannot push %T as a function", fn)
+	}
+	s.Pushfunction(wrap(v, nil))
+	return nil
+}
+
+// Returns a Gofunction calling fn as described for Pushfunc. If recv is
+// not nil, fn is a method expression: its first parameter, of type recv,
+// receives the Go object passed as the first Lua argument (see
+// Pushobject), and the other parameters are taken from the arguments that
+// follow it.
+func wrap(fn reflect.Value, recv reflect.Type) Gofunction {
+	t := fn.Type()
+	in := make([]reflect.Type, t.NumIn())
+	for i := range in {
+		in[i] = t.In(i)
+	}
+	first := 1 // stack index of the first converted argument
+	if recv != nil {
+		in = in[1:]
+		first = 2
+	}
+	withstate := len(in) > 0 && in[0] == statetype
+	if withstate {
+		in = in[1:]
+	}
+	variadic := t.IsVariadic()
+	nout := t.NumOut()
+	witherr := nout > 0 && t.Out(nout-1) == errortype
+	if witherr {
+		nout--
+	}
+
+	return func(s *State) int {
+		nargs := s.Gettop()
+		args := make([]reflect.Value, 0, len(in)+2)
+		if recv != nil {
+			obj, ok := s.toobject(1)
+			if !ok || reflect.TypeOf(obj) != recv {
+				return s.Errorf("bad self: expected %s, got %s", recv, s.Typename(s.Type(1)))
+			}
+			args = append(args, reflect.ValueOf(obj))
+		}
+		if withstate {
+			args = append(args, reflect.ValueOf(s))
+		}
+		for i, at := range in {
+			idx := first + i
+			if variadic && i == len(in)-1 {
+				for ; idx <= nargs; idx++ {
+					a := reflect.New(at.Elem()).Elem()
+					if err := s.unmarshal(idx, a, fmt.Sprintf("bad argument #%d", idx), 0); err != nil {
+						return s.Errorf("%s", err.Error())
+					}
+					args = append(args, a)
+				}
+				break
+			}
+			a := reflect.New(at).Elem()
+			if err := s.unmarshal(idx, a, fmt.Sprintf("bad argument #%d", idx), 0); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			args = append(args, a)
+		}
+
+		out := fn.Call(args)
+		if witherr {
+			if err, _ := out[nout].Interface().(error); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+		}
+		for _, r := range out[:nout] {
+			var err error
+			isnil := r.Kind() == reflect.Ptr && r.IsNil()
+			if recv != nil && !isnil && (r.Type() == recv || reflect.PtrTo(r.Type()) == recv) {
+				err = s.Pushobject(r.Interface())
+			} else {
+				err = s.push(r, 0)
+			}
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+		}
+		return nout
+	}
+}
@@ -0,0 +1,128 @@
+package luajit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPushfunc(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if err := s.Pushfunc(func(a, b int) (int, int) {
+		return a + b, a * b
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("addmul")
+	if err := s.Pushfunc(func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("join")
+	if err := s.Pushfunc(func(s *State, n float64) (float64, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n / 2, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("half")
+
+	if err := s.Loadstring(`
+		local a, m = addmul(3, 4)
+		assert(a == 7 and m == 12)
+		assert(join("-", "a", "b", "c") == "a-b-c")
+		assert(join(",") == "")
+		assert(half(5) == 2.5)
+		local ok, err = pcall(half, -1)
+		assert(not ok and err:find("negative"))
+		ok, err = pcall(addmul, "x", 1)
+		assert(not ok and err:find("bad argument #1"))
+	`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pushfunc(42); err == nil {
+		t.Error("expected error pushing a non-function")
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Pushfunction(func(s *State) int {
+		return s.Errorf("bad value %d", 42)
+	})
+	if err := s.Pcall(0, 0, 0); err == nil {
+		t.Fatal("expected error")
+	}
+	if msg := s.Tostring(-1); !strings.Contains(msg, "bad value 42") {
+		t.Errorf("unexpected message %q", msg)
+	}
+	s.Pop(1)
+	s.Pushfunction(func(s *State) int {
+		panic("oops")
+	})
+	if err := s.Pcall(0, 0, 0); err == nil {
+		t.Fatal("expected error from panic")
+	}
+	if msg := s.Tostring(-1); !strings.Contains(msg, "oops") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+// Errors raised by Go functions must unwind through Lua frames, nested
+// protected calls, and coroutines alike, which exercises LuaJIT's unwinder
+// on every platform (on Windows, structured exception handling).
+func TestErrorunwind(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	s.Register(func(s *State) int {
+		return s.Errorf("fail %s", s.Tostring(1))
+	}, "fail")
+	s.Register(func(s *State) int {
+		s.Pushvalue(1)
+		if err := s.Pcall(0, 1, 0); err == nil {
+			return s.Errorf("expected error")
+		}
+		return 1
+	}, "catch")
+
+	err := s.Loadstring(`
+		local a = catch(function() fail("a") end)
+		local co = coroutine.wrap(function() catch(function() fail("b") end) coroutine.yield(1) fail("c") end)
+		co()
+		local ok, c = pcall(co)
+		return a, ok, c
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 3, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if a := s.Tostring(-3); !strings.Contains(a, "fail a") {
+		t.Errorf("unexpected first message %q", a)
+	}
+	if s.Toboolean(-2) || !strings.Contains(s.Tostring(-1), "fail c") {
+		t.Errorf("expected failure c, got %t %q", s.Toboolean(-2), s.Tostring(-1))
+	}
+	s.Pop(3)
+}
@@ -0,0 +1,86 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+)
+
+// A Function is a reference to a Lua function, kept in the registry so
+// that it can be called repeatedly from Go without looking it up, as a
+// handler or callback. A Function must be used with the State it came
+// from, and keeps the Lua function alive until it is released.
+type Function struct {
+	s   *State
+	ref int
+}
+
+var errreleased = errors.New("function already released")
+
+// Returns a Function referring to the function at the given valid index.
+// Returns an error if the value is not a function.
+func (s *State) Tofunction(index int) (*Function, error) {
+	defer s.balanced("Tofunction", 0)()
+	if !s.Isfunction(index) {
+		return nil, fmt.Errorf("cannot convert %s to a function", s.Typename(s.Type(index)))
+	}
+	s.Pushvalue(index)
+	return &Function{s, int(C.luaL_ref(s.live(), C.LUA_REGISTRYINDEX))}, nil
+}
+
+// Pushes the function onto the stack.
+func (f *Function) Push() error {
+	if f.ref == C.LUA_NOREF {
+		return errreleased
+	}
+	f.s.Rawgeti(Registryindex, f.ref)
+	return nil
+}
+
+// Calls the function in protected mode with the given arguments,
+// converted as by Push, and returns its results, converted as by
+// Tovalue. Errors are reported as for Callglobal.
+func (f *Function) Call(args ...interface{}) ([]interface{}, error) {
+	if err := f.Push(); err != nil {
+		return nil, err
+	}
+	return f.s.callvalues("function", args)
+}
+
+// Releases the reference to the Lua function, which may then be
+// collected. The Function cannot be used afterwards. Releasing a Function
+// whose State is closed does nothing.
+func (f *Function) Release() {
+	if f.ref != C.LUA_NOREF && !f.s.Closed() {
+		C.luaL_unref(f.s.live(), C.LUA_REGISTRYINDEX, C.int(f.ref))
+		f.ref = C.LUA_NOREF
+	}
+}
+
+// Calls f as Call does, and stores its first result in a T, converted as
+// by Unmarshal. For example,
+//
+//	n, err := luajit.Callresult[int](f, "x")
+//
+// Returns an error if the call fails or the result does not convert.
+func Callresult[T any](f *Function, args ...interface{}) (T, error) {
+	var r T
+	if err := f.Push(); err != nil {
+		return r, err
+	}
+	s := f.s
+	base := s.Gettop() - 1
+	defer s.Settop(base)
+	if err := s.pushargs(args); err != nil {
+		return r, err
+	}
+	if err := s.Pcall(len(args), 1, 0); err != nil {
+		return r, fmt.Errorf("%w: %s", err, s.Tostring(-1))
+	}
+	err := s.Unmarshal(-1, &r)
+	return r, err
+}
@@ -0,0 +1,54 @@
+package luajit
+
+import "testing"
+
+func TestFunction(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	if err := s.Loadstring(`return function(a, b) return a + b, "sum" end`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	f, err := s.Tofunction(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pop(1)
+
+	r, err := f.Call(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0] != 3.0 || r[1] != "sum" {
+		t.Errorf("expected [3 sum], got %v", r)
+	}
+	n, err := Callresult[int](f, 20, 22)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("expected 42, got %d", n)
+	}
+	if _, err := Callresult[bool](f, 1, 2); err == nil {
+		t.Error("expected error converting a number to bool")
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+
+	f.Release()
+	if _, err := f.Call(); err == nil {
+		t.Error("expected error calling a released function")
+	}
+	s.Pushnumber(1)
+	if _, err := s.Tofunction(-1); err == nil {
+		t.Error("expected error for a number")
+	}
+	s.Pop(1)
+}
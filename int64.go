@@ -0,0 +1,201 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Registry field holding the Lua helpers for 64-bit integer cdata.
+const int64field = "luajit.int64"
+
+var errnoffi = errors.New("ffi library not loaded")
+
+// The helpers, made from the ffi module given as argument. Values cross
+// as two 32-bit halves, which doubles hold exactly; cdata arithmetic
+// wraps around, so the same sum rebuilds signed and unsigned values.
+const int64chunk = `
+local ffi = ...
+local tonumber = tonumber
+local int64, uint64 = ffi.typeof("int64_t"), ffi.typeof("uint64_t")
+return {
+	new = function(unsigned, hi, lo)
+		return (unsigned and uint64 or int64)(hi) * 4294967296 + lo
+	end,
+	split = function(v)
+		local signed = ffi.istype(int64, v)
+		if not signed and not ffi.istype(uint64, v) then
+			return nil
+		end
+		local u = ffi.cast(uint64, v)
+		return signed, tonumber(u / 4294967296), tonumber(u % 4294967296)
+	end,
+}`
+
+// Pushes the table of helpers for 64-bit integers, creating it if needed.
+// Returns errnoffi, and pushes nothing, if the ffi library is not loaded.
+func (s *State) int64helpers() error {
+	return s.ffihelpers(int64field, int64chunk)
+}
+
+// Pushes the table of helpers kept in the registry field, creating it by
+// running chunk with the ffi module as argument if needed. Returns
+// errnoffi, and pushes nothing, if the ffi library is not loaded.
+func (s *State) ffihelpers(field, chunk string) error {
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.Getfield(Registryindex, field)
+	if s.Istable(-1) {
+		return nil
+	}
+	s.Pop(1)
+	s.Getfield(Registryindex, "_LOADED")
+	if s.Istable(-1) {
+		s.Getfield(-1, "ffi")
+		s.Remove(-2)
+	}
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errnoffi
+	}
+	if err := s.Loadstring(chunk); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(2)
+		return err
+	}
+	s.Insert(-2)
+	if err := s.Pcall(1, 1, 0); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(1)
+		return err
+	}
+	s.Pushvalue(-1)
+	s.Setfield(Registryindex, field)
+	return nil
+}
+
+// Pushes a 64-bit integer cdata with the value hi<<32 + lo.
+func (s *State) pushcdata64(unsigned bool, hi, lo float64) error {
+	if err := s.int64helpers(); err != nil {
+		return err
+	}
+	s.Getfield(-1, "new")
+	s.Remove(-2)
+	s.Pushboolean(unsigned)
+	s.Pushnumber(hi)
+	s.Pushnumber(lo)
+	if err := s.Pcall(3, 1, 0); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(1)
+		return err
+	}
+	return nil
+}
+
+// Pushes v onto the stack as an int64_t cdata, which holds it exactly
+// and works with Lua arithmetic and comparisons. If the ffi library is
+// not loaded, v is pushed as a number instead, provided that is exact.
+func (s *State) Pushint64(v int64) error {
+	err := s.pushcdata64(false, float64(v>>32), float64(uint32(v)))
+	if err == errnoffi && v >= -1<<53 && v <= 1<<53 {
+		s.Pushnumber(float64(v))
+		return nil
+	}
+	return err
+}
+
+// Pushes v onto the stack as a uint64_t cdata, or as a number as
+// described for Pushint64.
+func (s *State) Pushuint64(v uint64) error {
+	err := s.pushcdata64(true, float64(v>>32), float64(uint32(v)))
+	if err == errnoffi && v <= 1<<53 {
+		s.Pushnumber(float64(v))
+		return nil
+	}
+	return err
+}
+
+// Returns the value of the 64-bit integer cdata at the given valid index,
+// as an unsigned bit pattern, and whether its type is signed. Returns an
+// error if the value is some other cdata.
+func (s *State) tocdata64(index int) (uint64, bool, error) {
+	index = s.absindex(index)
+	if err := s.int64helpers(); err != nil {
+		return 0, false, err
+	}
+	s.Getfield(-1, "split")
+	s.Remove(-2)
+	s.Pushvalue(index)
+	if err := s.Pcall(1, 3, 0); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(1)
+		return 0, false, err
+	}
+	defer s.Pop(3)
+	if s.Isnil(-3) {
+		return 0, false, errors.New("cdata is not a 64-bit integer")
+	}
+	return uint64(s.Tonumber(-2))<<32 | uint64(s.Tonumber(-1)), s.Toboolean(-3), nil
+}
+
+// Converts the value at the given valid index to an int64. It accepts
+// int64_t and uint64_t cdata, integral numbers, and decimal strings such
+// as "-42" or "-42LL", the form in which LuaJIT prints int64_t values.
+// Returns an error for other values and values out of range.
+func (s *State) Toint64(index int) (int64, error) {
+	switch s.Type(index) {
+	case Tnumber:
+		f := s.Tonumber(index)
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("number %v has no int64 representation", f)
+		}
+		return int64(f), nil
+	case Tstring:
+		return strconv.ParseInt(strings.TrimSuffix(s.Tostring(index), "LL"), 10, 64)
+	case Tcdata:
+		u, signed, err := s.tocdata64(index)
+		if err != nil {
+			return 0, err
+		}
+		if !signed && u > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", u)
+		}
+		return int64(u), nil
+	}
+	return 0, fmt.Errorf("int64 expected, got %s", s.Typename(s.Type(index)))
+}
+
+// Converts the value at the given valid index to a uint64, as Toint64
+// does. It also accepts strings such as "42ULL", the form in which LuaJIT
+// prints uint64_t values. Negative values are out of range.
+func (s *State) Touint64(index int) (uint64, error) {
+	switch s.Type(index) {
+	case Tnumber:
+		f := s.Tonumber(index)
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("number %v has no uint64 representation", f)
+		}
+		return uint64(f), nil
+	case Tstring:
+		str := s.Tostring(index)
+		if t := strings.TrimSuffix(str, "ULL"); t != str {
+			str = t
+		} else {
+			str = strings.TrimSuffix(str, "LL")
+		}
+		return strconv.ParseUint(str, 10, 64)
+	case Tcdata:
+		u, signed, err := s.tocdata64(index)
+		if err != nil {
+			return 0, err
+		}
+		if signed && int64(u) < 0 {
+			return 0, fmt.Errorf("%d overflows uint64", int64(u))
+		}
+		return u, nil
+	}
+	return 0, fmt.Errorf("uint64 expected, got %s", s.Typename(s.Type(index)))
+}
@@ -0,0 +1,84 @@
+package luajit
+
+import (
+	"math"
+	"testing"
+)
+
+func TestInt64(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	for _, v := range []int64{0, -1, 1<<53 + 1, math.MaxInt64, math.MinInt64} {
+		if err := s.Pushint64(v); err != nil {
+			t.Fatal(err)
+		}
+		if s.Type(-1) != Tcdata {
+			t.Errorf("expected cdata for %d, got %s", v, s.Typename(s.Type(-1)))
+		}
+		got, err := s.Toint64(-1)
+		if err != nil || got != v {
+			t.Errorf("expected %d, got %d, %v", v, got, err)
+		}
+		s.Pop(1)
+	}
+	for _, v := range []uint64{0, 1<<53 + 1, math.MaxUint64} {
+		if err := s.Pushuint64(v); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.Touint64(-1)
+		if err != nil || got != v {
+			t.Errorf("expected %d, got %d, %v", v, got, err)
+		}
+		s.Pop(1)
+	}
+
+	err := s.Loadstring(`local id = ...; return id + 1, tostring(id + 1), 2^40, "-7LL", -1ULL`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pushint64(1<<62 + 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pcall(1, 5, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for i, want := range []int64{1<<62 + 2, 1<<62 + 2, 1 << 40, -7} {
+		if got, err := s.Toint64(i + 1); err != nil || got != want {
+			t.Errorf("value %d: expected %d, got %d, %v", i+1, want, got, err)
+		}
+	}
+	if _, err := s.Toint64(5); err == nil {
+		t.Error("expected error converting 2^64-1 to int64")
+	}
+	if got, err := s.Touint64(5); err != nil || got != math.MaxUint64 {
+		t.Errorf("expected %d, got %d, %v", uint64(math.MaxUint64), got, err)
+	}
+	s.Settop(0)
+
+	s.Pushnumber(1.5)
+	if _, err := s.Toint64(-1); err == nil {
+		t.Error("expected error converting 1.5")
+	}
+	s.Pop(1)
+}
+
+func TestInt64noffi(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	if err := s.Pushint64(42); err != nil || !s.Isnumber(-1) {
+		t.Errorf("expected number without ffi, got %s, %v", s.Typename(s.Type(-1)), err)
+	}
+	s.Pop(1)
+	if err := s.Pushint64(math.MaxInt64); err != errnoffi {
+		t.Errorf("expected %v, got %v", errnoffi, err)
+	}
+}
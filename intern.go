@@ -0,0 +1,44 @@
+package luajit
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Limits on the strings that cstring interns: field names and the like
+// are short and few, while longer or more varied strings would only fill
+// the cache.
+const (
+	maxinternlen = 64
+	maxinterned  = 4096
+)
+
+var (
+	interned  sync.Map // string -> *C.char, never freed
+	ninterned atomic.Int32
+)
+
+// Returns a C copy of str for a call to the Lua API, and whether the
+// caller must free it. Short strings are interned, so that code reading
+// the same fields over and over does not allocate a C string for each
+// access.
+func cstring(str string) (cs *C.char, mustfree bool) {
+	if p, ok := interned.Load(str); ok {
+		return p.(*C.char), false
+	}
+	cs = C.CString(str)
+	if len(str) > maxinternlen || ninterned.Load() >= maxinterned {
+		return cs, true
+	}
+	if p, loaded := interned.LoadOrStore(str, cs); loaded {
+		C.free(unsafe.Pointer(cs))
+		return p.(*C.char), false
+	}
+	ninterned.Add(1)
+	return cs, false
+}
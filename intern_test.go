@@ -0,0 +1,35 @@
+package luajit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCstring(t *testing.T) {
+	a, free := cstring("intern_test_key")
+	if free {
+		t.Fatal("expected short key to be interned")
+	}
+	if b, _ := cstring("intern_test_key"); a != b {
+		t.Error("expected the same C string for the same key")
+	}
+	if _, free := cstring(strings.Repeat("x", maxinternlen+1)); !free {
+		t.Error("expected long key not to be interned")
+	}
+
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Newtable()
+	for i := 0; i < 3; i++ {
+		s.Pushinteger(i)
+		s.Setfield(-2, "intern_test_key")
+	}
+	s.Getfield(-1, "intern_test_key")
+	if n := s.Tointeger(-1); n != 2 {
+		t.Errorf("expected 2, got %d", n)
+	}
+	s.Pop(2)
+}
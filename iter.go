@@ -0,0 +1,75 @@
+package luajit
+
+import (
+	"errors"
+	"iter"
+)
+
+// The panic value of Pairs and Ipairs over a value that is not a table.
+var errnotable = errors.New("iteration over a value that is not a table")
+
+// Returns an iterator over the key-value pairs of the table at the given
+// valid index, in the order of Next. The iterator yields the stack indices
+// of a copy of the key and of the value, both valid only until the next
+// iteration:
+//
+//	for k, v := range s.Pairs(t) {
+//		fmt.Printf("%s - %s\n", s.Tostring(k), s.Typename(s.Type(v)))
+//	}
+//
+// Since the key is a copy, it is safe to convert it with Tostring, which
+// would confuse Next if done on the key itself; Keystring is safe on
+// either. The loop body must leave the stack as it found it, and must not
+// assign to fields not already in the table. When the loop ends, the stack
+// is restored.
+//
+// Ranging over the iterator panics if the value is not a table, or if the
+// stack cannot grow to hold the key and value.
+func (s *State) Pairs(index int) iter.Seq2[int, int] {
+	index = s.absindex(index)
+	return func(yield func(int, int) bool) {
+		if !s.Istable(index) {
+			panic(errnotable)
+		}
+		if !s.Checkstack(3) {
+			panic(errstack)
+		}
+		top := s.Gettop()
+		defer s.Settop(top)
+		s.Pushnil()
+		for s.Next(index) != 0 {
+			s.Pushvalue(-2)
+			if !yield(top+3, top+2) {
+				return
+			}
+			s.Pop(2)
+		}
+	}
+}
+
+// Returns an iterator over the array part of the table at the given
+// valid index, yielding the pairs (1, t[1]), (2, t[2]), ... up to the
+// first nil value, as ipairs does. The iterator yields the key and the
+// stack index of the value, which is valid only until the next iteration.
+// The loop body must leave the stack as it found it. Ranging over the
+// iterator panics as for Pairs.
+func (s *State) Ipairs(index int) iter.Seq2[int, int] {
+	index = s.absindex(index)
+	return func(yield func(int, int) bool) {
+		if !s.Istable(index) {
+			panic(errnotable)
+		}
+		if !s.Checkstack(1) {
+			panic(errstack)
+		}
+		top := s.Gettop()
+		defer s.Settop(top)
+		for i := 1; ; i++ {
+			s.Rawgeti(index, i)
+			if s.Isnil(-1) || !yield(i, top+1) {
+				return
+			}
+			s.Pop(1)
+		}
+	}
+}
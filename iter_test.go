@@ -0,0 +1,72 @@
+package luajit
+
+import (
+	"iter"
+	"testing"
+)
+
+func TestPairs(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	if err := s.Loadstring(`return {10, 20, 30, x = 1, [4.5] = 2}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	keys := make(map[string]float64)
+	for k, v := range s.Pairs(-1) {
+		keys[s.Tostring(k)] = s.Tonumber(v)
+	}
+	if len(keys) != 5 || keys["x"] != 1 || keys["4.5"] != 2 || keys["3"] != 30 {
+		t.Errorf("unexpected pairs %v", keys)
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+
+	sum := 0
+	for i, v := range s.Ipairs(-1) {
+		sum += i * s.Tointeger(v)
+		if i == 2 {
+			break
+		}
+	}
+	if sum != 50 {
+		t.Errorf("expected 50, got %d", sum)
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+	s.Pop(1)
+}
+
+func TestPairsnotable(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	s.Pushinteger(1)
+	for _, seq := range []func(int) iter.Seq2[int, int]{s.Pairs, s.Ipairs} {
+		func() {
+			defer func() {
+				if r := recover(); r != errnotable {
+					t.Errorf("expected panic with %v, got %v", errnotable, r)
+				}
+			}()
+			for range seq(-1) {
+				t.Error("expected no pairs")
+			}
+		}()
+	}
+	if n := s.Gettop(); n != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", n)
+	}
+}
@@ -0,0 +1,264 @@
+package luajit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Arrays with more than this many elements may be sparse, as in lua-cjson:
+// their largest index may exceed twice their number of elements.
+const jsonsafearray = 10
+
+// Makes the module "json" available to require, with the functions of
+// lua-cjson, which is also preloaded under the name "cjson":
+//
+//	json.encode(value)	returns value encoded as JSON
+//	json.decode(text)	returns the value of the JSON text
+//	json.null		the value of JSON null, a light userdata
+//
+// Values are encoded and decoded as by Tojson and Pushjson. The package
+// library must be open.
+func (s *State) Openjson() error {
+	loader := func(s *State) int {
+		s.Createtable(0, 3)
+		s.Pushfunction(jsonencode)
+		s.Setfield(-2, "encode")
+		s.Pushfunction(jsondecode)
+		s.Setfield(-2, "decode")
+		s.Pushlightuserdata(nil)
+		s.Setfield(-2, "null")
+		return 1
+	}
+	if err := s.Preload("json", loader); err != nil {
+		return err
+	}
+	return s.Preload("cjson", loader)
+}
+
+func jsonencode(s *State) int {
+	b, err := s.Tojson(1)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.Pushbytes(b)
+	return 1
+}
+
+func jsondecode(s *State) int {
+	if !s.Isstring(1) {
+		return s.Errorf("bad argument #1 to 'decode' (string expected, got %s)", s.Typename(s.Type(1)))
+	}
+	if err := s.Pushjson(s.Tobytes(1)); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return 1
+}
+
+// Decodes the JSON text data and pushes its value onto the stack. Objects
+// and arrays become tables, null becomes json.null, a light userdata
+// holding NULL, so that it can be kept in tables, and numbers become Lua
+// numbers. On error, nothing is pushed.
+func (s *State) Pushjson(data []byte) error {
+	top := s.Gettop()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := s.pushjson(dec, 0); err != nil {
+		s.Settop(top)
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		s.Settop(top)
+		return errors.New("json: extra data after value")
+	}
+	return nil
+}
+
+func (s *State) pushjson(dec *json.Decoder, depth int) error {
+	if depth > maxnesting {
+		return errnesting
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case nil:
+		s.Pushlightuserdata(nil)
+	case bool:
+		s.Pushboolean(tok)
+	case float64:
+		s.Pushnumber(tok)
+	case string:
+		s.Pushstring(tok)
+	case json.Delim:
+		s.Newtable()
+		for i := 1; dec.More(); i++ {
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				s.Pushstring(key.(string))
+			}
+			if err := s.pushjson(dec, depth+1); err != nil {
+				return err
+			}
+			if tok == '{' {
+				s.Rawset(-3)
+			} else {
+				s.Rawseti(-2, i)
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encodes the value at the given valid index as JSON, as lua-cjson does.
+// Tables whose keys are all positive integers become arrays, with null
+// for missing elements, unless they are too sparse; other tables become
+// objects, whose keys must be strings or numbers and are sorted. Empty
+// tables become {}. Strings should hold UTF-8 text. Returns an error for
+// values that JSON cannot represent, such as functions, NaN, and tables
+// that refer to themselves.
+func (s *State) Tojson(index int) ([]byte, error) {
+	var b bytes.Buffer
+	if err := s.appendjson(&b, s.absindex(index), 0); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (s *State) appendjson(b *bytes.Buffer, index, depth int) error {
+	switch tp := s.Type(index); tp {
+	case Tnil:
+		b.WriteString("null")
+	case Tboolean:
+		fmt.Fprint(b, s.Toboolean(index))
+	case Tnumber:
+		f := s.Tonumber(index)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return errors.New("cannot serialise number: must not be NaN or Inf")
+		}
+		fmt.Fprintf(b, "%.14g", f)
+	case Tstring:
+		appendjsonstring(b, s.Tostring(index))
+	case Tlightuserdata:
+		if s.Touserdata(index) != nil {
+			return errors.New("cannot serialise lightuserdata: type not supported")
+		}
+		b.WriteString("null")
+	case Ttable:
+		if depth >= maxnesting {
+			return fmt.Errorf("cannot serialise, excessive nesting (%d)", depth+1)
+		}
+		return s.appendjsontable(b, index, depth)
+	default:
+		return fmt.Errorf("cannot serialise %s: type not supported", s.Typename(tp))
+	}
+	return nil
+}
+
+func appendjsonstring(b *bytes.Buffer, str string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(str)
+	b.Truncate(b.Len() - 1) // the newline added by Encode
+}
+
+func (s *State) appendjsontable(b *bytes.Buffer, index, depth int) error {
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	n, max, array := 0, 0, true
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		s.Pop(1)
+		n++
+		if !array {
+			continue
+		}
+		f := s.Tonumber(-1)
+		if s.Type(-1) != Tnumber || f != math.Trunc(f) || f < 1 || f > math.MaxInt32 {
+			array = false
+		} else if int(f) > max {
+			max = int(f)
+		}
+	}
+	if n == 0 {
+		b.WriteString("{}")
+		return nil
+	}
+	if array {
+		if max > 2*n && max > jsonsafearray {
+			return errors.New("cannot serialise table: excessively sparse array")
+		}
+		b.WriteByte('[')
+		for i := 1; i <= max; i++ {
+			if i > 1 {
+				b.WriteByte(',')
+			}
+			s.Rawgeti(index, i)
+			err := s.appendjson(b, s.Gettop(), depth+1)
+			s.Pop(1)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+		return nil
+	}
+
+	type member struct {
+		name string
+		key  float64 // for number keys, whose name is formatted
+		num  bool
+	}
+	var members []member
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		s.Pop(1)
+		switch s.Type(-1) {
+		case Tstring:
+			members = append(members, member{name: s.Tostring(-1)})
+		case Tnumber:
+			members = append(members, member{s.Keystring(-1), s.Tonumber(-1), true})
+		default:
+			s.Pop(1)
+			return errors.New("cannot serialise table: table key must be a number or string")
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].name < members[j].name })
+	b.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		appendjsonstring(b, m.name)
+		b.WriteByte(':')
+		if m.num {
+			s.Pushnumber(m.key)
+		} else {
+			s.Pushstring(m.name)
+		}
+		s.Rawget(index)
+		err := s.appendjson(b, s.Gettop(), depth+1)
+		s.Pop(1)
+		if err != nil {
+			return err
+		}
+	}
+	b.WriteByte('}')
+	return nil
+}
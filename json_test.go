@@ -0,0 +1,66 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOpenjson(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Openjson(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Loadstring(`
+		local json = require("json")
+		local v = json.decode('{"name": "x", "list": [1, null, 2.5], "ok": true, "nested": {"a": "<b>"}}')
+		assert(v.list[2] == json.null and require("cjson").null == json.null)
+		local sparse = pcall(json.encode, {[1] = 1, [100] = 2})
+		local cyclic = {} cyclic.self = cyclic
+		return json.encode(v), json.encode({}), json.encode({[1] = "a", [3] = "c"}),
+			json.encode({[1] = "a", x = 1, [2.5] = true}), sparse,
+			(pcall(json.encode, cyclic)), (pcall(json.decode, '{"a": 1} x')), pcall(json.encode, print)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"list":[1,null,2.5],"name":"x","nested":{"a":"<b>"},"ok":true} {} ["a",null,"c"] ` +
+		`{"1":"a","2.5":true,"x":1} false false false false cannot serialise function: type not supported]`
+	if fmt.Sprint(v) != want {
+		t.Errorf("expected %s, got %v", want, v)
+	}
+}
+
+func TestPushjson(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Pushjson([]byte(`{"a": [1, 2, {"b": "é"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.Tojson(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"a":[1,2,{"b":"é"}]}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+	for _, bad := range []string{`{"a": }`, `[1, 2`, `1 2`, ``} {
+		if err := s.Pushjson([]byte(bad)); err == nil {
+			t.Errorf("expected an error decoding %q", bad)
+		}
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+}
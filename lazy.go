@@ -0,0 +1,42 @@
+package luajit
+
+// A Fetchfunc computes the value of a missing field of a lazy table; see
+// Newlazytable. The key is converted as by Tovalue and the value as by
+// Push. A nil value leaves the field missing, and an error is raised in
+// Lua.
+type Fetchfunc func(key interface{}) (interface{}, error)
+
+// Creates a new empty table whose fields are computed by fetch on first
+// access, and pushes it onto the stack. This exposes large or expensive
+// data, such as database rows or configuration trees, without converting
+// it up front. If cache is true, fetched values are stored in the table,
+// so that fetch is called at most once for each key that has a value;
+// otherwise, fetch is called on every read of a field that was not
+// assigned by Lua.
+func (s *State) Newlazytable(fetch Fetchfunc, cache bool) {
+	defer s.balanced("Newlazytable", 1)()
+	s.Newtable()
+	s.Createtable(0, 1)
+	s.Pushfunction(func(s *State) int {
+		key, err := s.Tovalue(2)
+		if err != nil {
+			s.Pushnil()
+			return 1
+		}
+		v, err := fetch(key)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		if err := s.Push(v); err != nil {
+			return s.Errorf("field %s: %s", s.Tostring(2), err.Error())
+		}
+		if cache && !s.Isnil(-1) {
+			s.Pushvalue(2)
+			s.Pushvalue(-2)
+			s.Rawset(1)
+		}
+		return 1
+	})
+	s.Setfield(-2, "__index")
+	s.Setmetatable(-2)
+}
@@ -0,0 +1,47 @@
+package luajit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewlazytable(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	calls := 0
+	fetch := func(key interface{}) (interface{}, error) {
+		calls++
+		switch key {
+		case "answer":
+			return 42, nil
+		case "bad":
+			return nil, errors.New("cannot fetch bad")
+		}
+		return nil, nil
+	}
+	s.Newlazytable(fetch, true)
+	s.Setglobal("cached")
+	s.Newlazytable(fetch, false)
+	s.Setglobal("uncached")
+
+	err := s.Loadstring(`
+		assert(cached.answer == 42 and cached.answer == 42)
+		assert(uncached.answer == 42 and uncached.answer == 42)
+		assert(cached.missing == nil)
+		assert(not pcall(function() return cached.bad end))
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if calls != 5 {
+		t.Errorf("expected 5 calls, got %d", calls)
+	}
+}
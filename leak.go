@@ -0,0 +1,77 @@
+package luajit
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// Leak tracking; see Trackleaks.
+var leaks struct {
+	sync.Mutex
+	onleak func(stack string)
+	open   map[unsafe.Pointer]string // creation stacks of open states
+}
+
+// Turns on leak tracking for the states created from then on: Newstate
+// records the stack of its caller, and when a state is garbage collected
+// without having been closed, onleak is called with that stack on the
+// finalizer goroutine. Leakreport lists the states still open at any
+// time. Calling Trackleaks with nil turns tracking off.
+//
+// Tracking costs a stack trace per Newstate, so it is meant for tests and
+// for hunting leaks in long-running programs.
+func Trackleaks(onleak func(stack string)) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	leaks.onleak = onleak
+	if onleak == nil {
+		leaks.open = nil
+	} else if leaks.open == nil {
+		leaks.open = make(map[unsafe.Pointer]string)
+	}
+}
+
+// Returns the creation stacks of the tracked states that have not been
+// closed, whether or not they are still reachable, sorted as strings so
+// that reports can be compared. Returns nil when tracking is off.
+func Leakreport() []string {
+	leaks.Lock()
+	defer leaks.Unlock()
+	var stacks []string
+	for _, stack := range leaks.open {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	return stacks
+}
+
+// Records s as open if tracking is on.
+func track(s *State) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	if leaks.onleak == nil {
+		return
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	leaks.open[unsafe.Pointer(s.l)] = string(buf)
+	runtime.SetFinalizer(s, func(s *State) {
+		leaks.Lock()
+		stack, ok := leaks.open[unsafe.Pointer(s.l)]
+		delete(leaks.open, unsafe.Pointer(s.l))
+		onleak := leaks.onleak
+		leaks.Unlock()
+		if ok && onleak != nil {
+			onleak(stack)
+		}
+	})
+}
+
+// Records s as closed.
+func untrack(s *State) {
+	leaks.Lock()
+	defer leaks.Unlock()
+	delete(leaks.open, unsafe.Pointer(s.l))
+}
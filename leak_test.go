@@ -0,0 +1,44 @@
+package luajit
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrackleaks(t *testing.T) {
+	leaked := make(chan string, 1)
+	Trackleaks(func(stack string) {
+		leaked <- stack
+	})
+	defer Trackleaks(nil)
+
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	if r := Leakreport(); len(r) != 1 || !strings.Contains(r[0], "TestTrackleaks") {
+		t.Errorf("expected one open state created by TestTrackleaks, got %v", r)
+	}
+	s.Close()
+	if r := Leakreport(); len(r) != 0 {
+		t.Errorf("expected no open states, got %v", r)
+	}
+
+	func() {
+		Newstate()
+	}()
+	for i := 0; i < 10; i++ {
+		runtime.GC()
+		select {
+		case stack := <-leaked:
+			if !strings.Contains(stack, "TestTrackleaks") {
+				t.Errorf("expected stack from TestTrackleaks, got %s", stack)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Error("expected the unclosed state to be reported")
+}
@@ -0,0 +1,19 @@
+//go:build !luajit_51 && !luajit_plain
+
+package luajit
+
+// Links against the LuaJIT shared library installed on the system, found
+// through pkg-config, which gives the right header directory and library
+// name on Debian, Fedora, Alpine, and Homebrew alike. Where pkg-config is
+// not available, build with one of these tags instead:
+//
+//	luajit_51      links -lluajit-5.1, the name LuaJIT installs itself as
+//	luajit_plain   links -lluajit, for custom installations
+//
+// On Windows the library is lua51 regardless.
+
+/*
+#cgo !windows pkg-config: luajit
+#cgo windows LDFLAGS: -llua51
+*/
+import "C"
@@ -0,0 +1,17 @@
+//go:build luajit_51
+
+package luajit
+
+// Links -lluajit-5.1 without pkg-config (see link.go), looking for the
+// headers where LuaJIT and the package managers install them; set
+// CGO_CFLAGS and CGO_LDFLAGS for other prefixes.
+
+/*
+#cgo CFLAGS: -I/usr/local/include/luajit-2.1 -I/usr/include/luajit-2.1
+#cgo darwin CFLAGS: -I/opt/homebrew/include/luajit-2.1
+#cgo darwin LDFLAGS: -L/opt/homebrew/lib
+#cgo !windows LDFLAGS: -L/usr/local/lib -lluajit-5.1
+#cgo linux LDFLAGS: -lm -ldl
+#cgo windows LDFLAGS: -llua51
+*/
+import "C"
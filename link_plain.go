@@ -0,0 +1,14 @@
+//go:build luajit_plain && !luajit_51
+
+package luajit
+
+// Links -lluajit without pkg-config (see link.go). The headers and library
+// must be on the default search paths, or given by CGO_CFLAGS and
+// CGO_LDFLAGS.
+
+/*
+#cgo !windows LDFLAGS: -lluajit
+#cgo linux LDFLAGS: -lm -ldl
+#cgo windows LDFLAGS: -llua51
+*/
+import "C"
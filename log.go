@@ -0,0 +1,106 @@
+package luajit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// Makes the module "log" available to require, for scripts to log through
+// logger, or slog.Default() if logger is nil:
+//
+//	log.debug(msg, key, value, ...)
+//	log.info(msg, key, value, ...)
+//	log.warn(msg, key, value, ...)
+//	log.error(msg, key, value, ...)
+//
+// The key-value pairs become attributes of the record, with values
+// converted as by Tovalue, or by tostring if they have no Go equivalent.
+// Instead of pairs, the message may be followed by a single table of
+// fields, which are added in the order of their keys. Each record also
+// gets the attributes "chunk" and "line", which tell where in the script
+// it was logged. The package library must be open.
+func (s *State) Openlog(logger *slog.Logger) error {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return s.Preloadfuncs("log", map[string]Gofunction{
+		"debug": logfunc(logger, slog.LevelDebug),
+		"info":  logfunc(logger, slog.LevelInfo),
+		"warn":  logfunc(logger, slog.LevelWarn),
+		"error": logfunc(logger, slog.LevelError),
+	})
+}
+
+func logfunc(logger *slog.Logger, level slog.Level) Gofunction {
+	return func(s *State) int {
+		ctx := context.Background()
+		if !logger.Enabled(ctx, level) {
+			return 0
+		}
+		if !s.Isstring(1) {
+			return s.Errorf("bad argument #1 (string expected, got %s)", s.Typename(s.Type(1)))
+		}
+		msg := s.Tostring(1)
+		var args []interface{}
+		if s.Gettop() == 2 && s.Istable(2) {
+			type field struct {
+				key   string
+				value interface{}
+			}
+			var fields []field
+			for k, v := range s.Pairs(2) {
+				fields = append(fields, field{logkey(s, k), logvalue(s, v)})
+			}
+			sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+			for _, f := range fields {
+				args = append(args, f.key, f.value)
+			}
+		} else {
+			for i := 2; i <= s.Gettop(); i++ {
+				if i%2 == 0 {
+					args = append(args, logkey(s, i))
+				} else {
+					args = append(args, logvalue(s, i))
+				}
+			}
+		}
+		ar := Newdebug(s)
+		if ar.Getstack(1) == nil && ar.Getinfo("Sl") == nil {
+			args = append(args, slog.String("chunk", ar.Shortsrc), slog.Int("line", ar.Currentline))
+		}
+		logger.Log(ctx, level, msg, args...)
+		return 0
+	}
+}
+
+// Returns the value at the given valid index as the key of a log
+// attribute: strings and numbers as Lua formats them, and other values as
+// logvalue gives them. Converting a number in place is safe on the keys
+// yielded by Pairs, which are copies.
+func logkey(s *State, index int) string {
+	switch s.Type(index) {
+	case Tstring, Tnumber:
+		return s.Tostring(index)
+	}
+	return fmt.Sprint(logvalue(s, index))
+}
+
+// Returns the value at the given valid index for a log attribute.
+func logvalue(s *State, index int) interface{} {
+	if v, err := s.Tovalue(index); err == nil {
+		return v
+	}
+	if err := s.grow(2); err != nil {
+		return s.Typename(s.Type(index))
+	}
+	s.Getglobal("tostring")
+	s.Pushvalue(index)
+	if s.Pcall(1, 1, 0) != nil || !s.Isstring(-1) {
+		s.Pop(1)
+		return s.Typename(s.Type(index))
+	}
+	defer s.Pop(1)
+	return s.Tostring(-1)
+}
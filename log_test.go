@@ -0,0 +1,56 @@
+package luajit
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestOpenlog(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	var buf strings.Builder
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	if err := s.Openlog(logger); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Loadstring(`local log = require("log")
+log.debug("hidden")
+log.info("started", "n", 3, "name", "x")
+log.warn("fields", {b = true, a = {1, 2}, [false] = 0})
+log.error("odd", "f", print)`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 records, got %q", buf.String())
+	}
+	for i, want := range []string{
+		`level=INFO msg=started n=3 name=x chunk="[string `,
+		`level=WARN msg=fields a="[1 2]" b=true false=0`,
+		`level=ERROR msg=odd f="function: `,
+	} {
+		if !strings.HasPrefix(lines[i], want) {
+			t.Errorf("expected record starting with %s, got %s", want, lines[i])
+		}
+	}
+	if !strings.HasSuffix(lines[0], "line=3") || !strings.HasSuffix(lines[2], "line=5") {
+		t.Errorf("expected lines 3 and 5, got %s and %s", lines[0], lines[2])
+	}
+}
@@ -0,0 +1,155 @@
+package luajit
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var errmanagerclosed = errors.New("manager closed")
+
+// A Manager owns a set of named states, such as one per tenant or plugin,
+// creating each on first use. The states are Safestates, so they can be
+// used from any goroutine.
+type Manager struct {
+	setup func(name string, s *State) error
+
+	mu     sync.Mutex
+	hooks  map[string]func(s *State) error
+	states map[string]*managed
+	closed bool
+}
+
+// A managed state, created at most once.
+type managed struct {
+	once sync.Once
+	ss   *Safestate
+	err  error
+}
+
+// Creates a manager whose states are initialized by setup, which receives
+// the name of the state, unless a hook for the name was given with Setup.
+// setup may be nil.
+func Newmanager(setup func(name string, s *State) error) *Manager {
+	return &Manager{
+		setup:  setup,
+		hooks:  make(map[string]func(s *State) error),
+		states: make(map[string]*managed),
+	}
+}
+
+// Sets the function initializing the state named name when it is created,
+// instead of the manager's setup function. It has no effect on a state
+// that already exists.
+func (m *Manager) Setup(name string, fn func(s *State) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks[name] = fn
+}
+
+// Returns the state named name, creating and initializing it if needed.
+// If initialization fails, the error is returned and the next call tries
+// again.
+func (m *Manager) Get(name string) (*Safestate, error) {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errmanagerclosed
+	}
+	e, ok := m.states[name]
+	if !ok {
+		e = new(managed)
+		m.states[name] = e
+	}
+	hook := m.hooks[name]
+	m.mu.Unlock()
+
+	e.once.Do(func() {
+		e.ss = Newsafestate()
+		if e.ss == nil {
+			e.err = errors.New("cannot create state: not enough memory")
+			return
+		}
+		e.err = e.ss.Do(func(s *State) error {
+			switch {
+			case hook != nil:
+				return hook(s)
+			case m.setup != nil:
+				return m.setup(name, s)
+			}
+			return nil
+		})
+		if e.err != nil {
+			e.ss.Close()
+		}
+	})
+	if e.err != nil {
+		m.mu.Lock()
+		if m.states[name] == e {
+			delete(m.states, name)
+		}
+		m.mu.Unlock()
+		return nil, e.err
+	}
+	return e.ss, nil
+}
+
+// Returns the state named name if it has been created, without creating
+// it.
+func (m *Manager) Lookup(name string) (*Safestate, bool) {
+	m.mu.Lock()
+	e, ok := m.states[name]
+	m.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	// Wait for a concurrent Get to finish creating it.
+	e.once.Do(func() { e.err = errors.New("state not created") })
+	if e.err != nil {
+		return nil, false
+	}
+	return e.ss, true
+}
+
+// Returns the names of the states, in increasing order.
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.states))
+	for name := range m.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Closes and forgets the state named name, if there is one. A later Get
+// creates it anew.
+func (m *Manager) Remove(name string) {
+	m.mu.Lock()
+	e, ok := m.states[name]
+	delete(m.states, name)
+	m.mu.Unlock()
+	if ok {
+		e.close()
+	}
+}
+
+// Closes all the states. Get fails from then on.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	states := m.states
+	m.states = make(map[string]*managed)
+	m.closed = true
+	m.mu.Unlock()
+	for _, e := range states {
+		e.close()
+	}
+}
+
+func (e *managed) close() {
+	e.once.Do(func() { e.err = errors.New("state removed") })
+	if e.err == nil {
+		e.ss.Close()
+	}
+}
@@ -0,0 +1,50 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	m := Newmanager(func(name string, s *State) error {
+		return s.Setglobals(map[string]interface{}{"tenant": name})
+	})
+	m.Setup("broken", func(s *State) error {
+		return errors.New("setup failed")
+	})
+
+	a, err := m.Get("tenant-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.Get("tenant-a"); again != a {
+		t.Error("expected Get to return the same state")
+	}
+	v, err := a.Getvalue("tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "tenant-a" {
+		t.Errorf("expected tenant-a, got %v", v)
+	}
+	if _, err := m.Get("broken"); err == nil {
+		t.Error("expected setup error")
+	}
+	if _, ok := m.Lookup("tenant-b"); ok {
+		t.Error("expected Lookup not to create tenant-b")
+	}
+	m.Get("tenant-b")
+	if names := m.Names(); fmt.Sprint(names) != "[tenant-a tenant-b]" {
+		t.Errorf("expected [tenant-a tenant-b], got %v", names)
+	}
+
+	m.Remove("tenant-a")
+	if _, err := a.Dostring(`return 1`); err == nil {
+		t.Error("expected removed state to be closed")
+	}
+	m.Close()
+	if _, err := m.Get("tenant-b"); err == nil {
+		t.Error("expected error from a closed manager")
+	}
+}
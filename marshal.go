@@ -0,0 +1,488 @@
+package luajit
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A field describes how a struct field maps to a table key.
+type field struct {
+	name      string
+	index     []int
+	omitempty bool
+}
+
+var fieldcache sync.Map // reflect.Type -> []field
+
+var (
+	timetype      = reflect.TypeOf(time.Time{})
+	timevaluetype = reflect.TypeOf((*timevalue)(nil)) // see Pushtime
+)
+
+// Returns the fields of struct type t that are converted to and from Lua.
+//
+// Exported fields are used, under the name given in their lua tag, or
+// their own name otherwise. The tag may add the option omitempty, as in
+// `lua:"name,omitempty"`, to leave out fields holding zero values; a tag
+// of "-" excludes the field. The fields of embedded structs without a tag
+// are treated as fields of the outer struct.
+func fields(t reflect.Type) []field {
+	if f, ok := fieldcache.Load(t); ok {
+		return f.([]field)
+	}
+	// As with encoding/json, the struct is walked breadth-first, so that
+	// shallower fields hide deeper ones; of fields at the same depth, a
+	// tagged one hides the others, and otherwise the name is ambiguous
+	// and left out.
+	type candidate struct {
+		field
+		tagged bool
+	}
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+	var cands []candidate
+	visited := make(map[reflect.Type]bool)
+	for level := []embedded{{t, nil}}; len(level) > 0; {
+		var next []embedded
+		for _, e := range level {
+			if visited[e.t] {
+				continue
+			}
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				tag := sf.Tag.Get("lua")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				ft := sf.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				idx := append(append([]int(nil), e.index...), i)
+				if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timetype {
+					next = append(next, embedded{ft, idx})
+					continue
+				}
+				if !sf.IsExported() {
+					continue
+				}
+				tagged := name != ""
+				if !tagged {
+					name = sf.Name
+				}
+				cands = append(cands, candidate{field{name, idx, opts == "omitempty"}, tagged})
+			}
+		}
+		// Marked after the whole level, so that a struct embedded twice at
+		// the same depth makes its fields ambiguous.
+		for _, e := range level {
+			visited[e.t] = true
+		}
+		level = next
+	}
+
+	sort.SliceStable(cands, func(i, j int) bool {
+		a, b := cands[i], cands[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+	var fs []field
+	for i := 0; i < len(cands); {
+		j := i + 1
+		for j < len(cands) && cands[j].name == cands[i].name {
+			j++
+		}
+		first := cands[i]
+		ambiguous := j-i > 1 && len(cands[i+1].index) == len(first.index) && cands[i+1].tagged == first.tagged
+		if !ambiguous {
+			fs = append(fs, first.field)
+		}
+		i = j
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		a, b := fs[i].index, fs[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	fieldcache.Store(t, fs)
+	return fs
+}
+
+// Returns the field of v described by index, following embedded pointers.
+// Returns an invalid Value if one of them is nil.
+func fieldbyindex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func isempty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Func:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timetype {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
+
+// Pushes the struct v, or the struct v points to, as a new table holding
+// its fields, converted as by Push. Nested structs, pointers, slices and
+// maps are converted recursively, and a time.Time is converted to the
+// number of seconds since January 1, 1970 UTC.
+//
+// The fields used and their keys in the table are controlled with lua
+// struct tags:
+//
+//	type Config struct {
+//		Name    string        `lua:"name"`
+//		Retries int           `lua:"retries,omitempty"`
+//		Secret  string        `lua:"-"`
+//	}
+//
+// On error, nothing is pushed.
+func (s *State) Pushstruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot push %s as a struct", rv.Type())
+	}
+	top := s.Gettop()
+	if err := s.push(rv, 0); err != nil {
+		s.Settop(top)
+		return err
+	}
+	return nil
+}
+
+func (s *State) pushstruct(v reflect.Value, depth int) error {
+	if v.Type() == timetype {
+		t := v.Interface().(time.Time)
+		s.Pushnumber(float64(t.UnixNano()) / 1e9)
+		return nil
+	}
+	fs := fields(v.Type())
+	s.Createtable(0, len(fs))
+	for _, f := range fs {
+		fv := fieldbyindex(v, f.index)
+		if !fv.IsValid() || f.omitempty && isempty(fv) {
+			continue
+		}
+		if err := s.push(fv, depth+1); err != nil {
+			return fmt.Errorf("field %s: %s", f.name, err.Error())
+		}
+		s.Setfield(-2, f.name)
+	}
+	return nil
+}
+
+// Stores the Lua value at the given valid index in the Go value out
+// points to, which is the inverse of Pushstruct and Push:
+//
+//	bool			from a boolean
+//	ints, uints and floats	from a number or a string holding a number;
+//				integers must have an integral value that fits
+//	string			from a string or a number
+//	[]byte			from a string
+//	slices and arrays		from the array part of a table
+//	maps			from a table, converting each key and value
+//	structs			from a table, by the field names given in lua
+//				struct tags or the Go field names
+//	time.Time		from a number of seconds since January 1, 1970
+//				UTC, an RFC 3339 string, or a userdata made by
+//				Pushtime
+//	pointers		from any value the element type accepts; a new
+//				value is allocated if needed
+//	interface{}		from any value, converted as by Tovalue
+//
+// A userdata made by Pushobject is stored as the Go object it holds, or
+// the value it points to, if that can be assigned to the Go value.
+//
+// Nil values leave the corresponding Go value unchanged. On a mismatch,
+// the returned error gives the path of the offending value, as in
+// "value.servers[2].port: expected integer, got boolean".
+func (s *State) Unmarshal(index int, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot unmarshal into non-pointer %T", out)
+	}
+	return s.unmarshal(s.absindex(index), v.Elem(), "value", 0)
+}
+
+func (s *State) mismatch(index int, path, expected string) error {
+	return fmt.Errorf("%s: expected %s, got %s", path, expected, s.Typename(s.Type(index)))
+}
+
+// Returns the number at index, also accepting strings convertible to
+// numbers as Lua itself does.
+func (s *State) tonumber(index int) (float64, bool) {
+	switch s.Type(index) {
+	case Tnumber:
+		return s.Tonumber(index), true
+	case Tstring:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s.Tostring(index)), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func (s *State) unmarshal(index int, v reflect.Value, path string, depth int) error {
+	if depth > maxnesting {
+		return fmt.Errorf("%s: %s", path, errnesting.Error())
+	}
+	if s.Isnoneornil(index) {
+		return nil
+	}
+	if obj, ok := s.toobject(index); ok {
+		ov := reflect.ValueOf(obj)
+		switch {
+		case ov.Type().AssignableTo(v.Type()):
+			v.Set(ov)
+			return nil
+		case ov.Kind() == reflect.Ptr && ov.Elem().Type().AssignableTo(v.Type()):
+			v.Set(ov.Elem())
+			return nil
+		case v.Type() == timetype && ov.Type() == timevaluetype:
+			v.Set(reflect.ValueOf(obj.(*timevalue).t))
+			return nil
+		}
+		return s.mismatch(index, path, v.Type().String())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if !s.Isboolean(index) {
+			return s.mismatch(index, path, "boolean")
+		}
+		v.SetBool(s.Toboolean(index))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := s.tonumber(index)
+		if !ok || f != float64(int64(f)) || v.OverflowInt(int64(f)) {
+			return s.mismatch(index, path, "integer")
+		}
+		v.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := s.tonumber(index)
+		if !ok || f < 0 || f != float64(uint64(f)) || v.OverflowUint(uint64(f)) {
+			return s.mismatch(index, path, "unsigned integer")
+		}
+		v.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		f, ok := s.tonumber(index)
+		if !ok {
+			return s.mismatch(index, path, "number")
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if !s.Isstring(index) && !s.Isnumber(index) {
+			return s.mismatch(index, path, "string")
+		}
+		if s.Isnumber(index) {
+			// Format a copy; Tostring would change the value in place.
+			v.SetString(strconv.FormatFloat(s.Tonumber(index), 'g', 14, 64))
+		} else {
+			v.SetString(s.Tostring(index))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return s.unmarshal(index, v.Elem(), path, depth+1)
+	case reflect.Interface:
+		x, err := s.Tovalue(index)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		if x == nil {
+			return nil
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(v.Type()) {
+			return s.mismatch(index, path, v.Type().String())
+		}
+		v.Set(xv)
+	case reflect.Func:
+		if v.Type() != reflect.TypeOf(Gofunction(nil)) || !s.Isgofunction(index) {
+			return s.mismatch(index, path, "Go function")
+		}
+		fn, err := s.Togofunction(index)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		v.Set(reflect.ValueOf(fn))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && s.Isstring(index) {
+			v.SetBytes(s.Tobytes(index))
+			return nil
+		}
+		if !s.Istable(index) {
+			return s.mismatch(index, path, "table")
+		}
+		n := s.Objlen(index)
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+		return s.unmarshalarray(index, v, path, depth)
+	case reflect.Array:
+		if !s.Istable(index) {
+			return s.mismatch(index, path, "table")
+		}
+		if n := s.Objlen(index); n > v.Len() {
+			return fmt.Errorf("%s: %d elements do not fit in %s", path, n, v.Type())
+		}
+		return s.unmarshalarray(index, v, path, depth)
+	case reflect.Map:
+		if !s.Istable(index) {
+			return s.mismatch(index, path, "table")
+		}
+		return s.unmarshalmap(index, v, path, depth)
+	case reflect.Struct:
+		if v.Type() == timetype {
+			return s.unmarshaltime(index, v, path)
+		}
+		if !s.Istable(index) {
+			return s.mismatch(index, path, "table")
+		}
+		return s.unmarshalstruct(index, v, path, depth)
+	default:
+		return fmt.Errorf("%s: cannot unmarshal into %s", path, v.Type())
+	}
+	return nil
+}
+
+func (s *State) unmarshalarray(index int, v reflect.Value, path string, depth int) error {
+	if err := s.grow(1); err != nil {
+		return err
+	}
+	n := s.Objlen(index)
+	for i := 0; i < n && i < v.Len(); i++ {
+		s.Rawgeti(index, i+1)
+		err := s.unmarshal(s.Gettop(), v.Index(i), fmt.Sprintf("%s[%d]", path, i+1), depth+1)
+		s.Pop(1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *State) unmarshalmap(index int, v reflect.Value, path string, depth int) error {
+	if err := s.grow(2); err != nil {
+		return err
+	}
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	top := s.Gettop()
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		k := reflect.New(t.Key()).Elem()
+		if err := s.unmarshal(top+1, k, path+" key", depth+1); err != nil {
+			s.Settop(top)
+			return err
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := s.unmarshal(top+2, e, fmt.Sprintf("%s[%v]", path, k), depth+1); err != nil {
+			s.Settop(top)
+			return err
+		}
+		v.SetMapIndex(k, e)
+		s.Pop(1)
+	}
+	return nil
+}
+
+func (s *State) unmarshalstruct(index int, v reflect.Value, path string, depth int) error {
+	if err := s.grow(1); err != nil {
+		return err
+	}
+	for _, f := range fields(v.Type()) {
+		s.Getfield(index, f.name)
+		if s.Isnil(-1) {
+			s.Pop(1)
+			continue
+		}
+		fv, err := allocfield(v, f.index)
+		if err == nil {
+			err = s.unmarshal(s.Gettop(), fv, path+"."+f.name, depth+1)
+		}
+		s.Pop(1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the field of v described by index, allocating the embedded
+// structs it goes through as needed.
+func allocfield(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func (s *State) unmarshaltime(index int, v reflect.Value, path string) error {
+	switch s.Type(index) {
+	case Tnumber:
+		f := s.Tonumber(index)
+		sec := math.Floor(f)
+		v.Set(reflect.ValueOf(time.Unix(int64(sec), int64((f-sec)*1e9))))
+	case Tstring:
+		t, err := time.Parse(time.RFC3339Nano, s.Tostring(index))
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err.Error())
+		}
+		v.Set(reflect.ValueOf(t))
+	default:
+		return s.mismatch(index, path, "time")
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package luajit
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testinner struct {
+	Host string `lua:"host"`
+	Port int    `lua:"port,omitempty"`
+}
+
+type testbase struct {
+	ID int `lua:"id"`
+}
+
+type testconfig struct {
+	testbase
+	Name    string            `lua:"name"`
+	Retries int               `lua:"retries,omitempty"`
+	Secret  string            `lua:"-"`
+	Servers []testinner       `lua:"servers"`
+	Primary *testinner        `lua:"primary"`
+	Labels  map[string]string `lua:"labels"`
+	Started time.Time         `lua:"started"`
+	Plain   bool
+	hidden  int
+}
+
+func TestPushstruct(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	c := testconfig{
+		testbase: testbase{ID: 7},
+		Name:     "x",
+		Secret:   "hush",
+		Servers:  []testinner{{"a", 1}, {"b", 0}},
+		Labels:   map[string]string{"env": "test"},
+		Started:  time.Unix(1000, 0),
+		Plain:    true,
+	}
+	if err := s.Pushstruct(&c); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("config")
+	if err := s.Loadstring(`
+		assert(config.id == 7)
+		assert(config.name == "x")
+		assert(config.retries == nil)
+		assert(config.Secret == nil and config.secret == nil)
+		assert(#config.servers == 2)
+		assert(config.servers[1].port == 1)
+		assert(config.servers[2].port == nil)
+		assert(config.primary == nil)
+		assert(config.labels.env == "test")
+		assert(config.started == 1000)
+		assert(config.Plain == true)
+		assert(config.hidden == nil)
+	`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pushstruct(42); err == nil {
+		t.Error("expected error pushing a non-struct")
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack, found %d elems", n)
+	}
+}
+
+type testshadow struct {
+	testinner
+	testbase
+	Host string `lua:"host"`
+	ID   int    `lua:"ident"`
+}
+
+type testambiguous struct {
+	A struct{ X int }
+	testinner
+	testnamed
+}
+
+type testnamed struct {
+	Host string `lua:"host"`
+	Name string
+}
+
+func TestFields(t *testing.T) {
+	for _, tc := range []struct {
+		v    interface{}
+		want string
+	}{
+		{testshadow{}, "[{port [0 1] true} {id [1 0] false} {host [2] false} {ident [3] false}]"},
+		{testambiguous{}, "[{A [0] false} {port [1 1] true} {Name [2 1] false}]"},
+	} {
+		if got := fmt.Sprint(fields(reflect.TypeOf(tc.v))); got != tc.want {
+			t.Errorf("%T: expected %s, got %s", tc.v, tc.want, got)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Loadstring(`return {
+		id = 7, name = "x", retries = "3", Plain = true,
+		servers = {{host = "a", port = 1}, {host = "b"}},
+		primary = {host = "p", port = 2},
+		labels = {env = "test"},
+		started = 1000,
+	}, {servers = {{port = true}}}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, Multret, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	var c testconfig
+	if err := s.Unmarshal(1, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != 7 || c.Name != "x" || c.Retries != 3 || !c.Plain {
+		t.Errorf("unexpected scalar fields %+v", c)
+	}
+	if len(c.Servers) != 2 || c.Servers[0].Port != 1 || c.Servers[1].Host != "b" {
+		t.Errorf("unexpected servers %+v", c.Servers)
+	}
+	if c.Primary == nil || c.Primary.Host != "p" {
+		t.Errorf("unexpected primary %+v", c.Primary)
+	}
+	if c.Labels["env"] != "test" {
+		t.Errorf("unexpected labels %v", c.Labels)
+	}
+	if !c.Started.Equal(time.Unix(1000, 0)) {
+		t.Errorf("expected time 1000, got %v", c.Started)
+	}
+
+	err := s.Unmarshal(2, &c)
+	if err == nil || err.Error() != "value.servers[1].port: expected integer, got boolean" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := s.Unmarshal(1, c); err == nil {
+		t.Error("expected error unmarshaling into a non-pointer")
+	}
+	if n := s.Gettop(); n != 2 {
+		t.Errorf("expected 2 values on stack, found %d", n)
+	}
+}
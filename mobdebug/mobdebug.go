@@ -0,0 +1,466 @@
+// Package mobdebug implements the debuggee side of the MobDebug remote
+// debugging protocol on top of the luajit hook interface, so that IDEs
+// such as ZeroBrane Studio can debug Lua code running inside a Go program.
+//
+// A MobDebug controller (the IDE) listens on a TCP port, by default 8172,
+// and the program being debugged connects to it:
+//
+//	s := luajit.Newstate()
+//	s.Openlibs()
+//	d, err := mobdebug.Start(s, "localhost:8172")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer d.Close()
+//	// load and run Lua code as usual; execution pauses at the
+//	// first line and is then driven by the IDE
+//
+// The supported commands are SETB, DELB, EXEC, LOAD, STACK, RUN, STEP,
+// OVER, OUT, SUSPEND, BASEDIR and EXIT. Expressions given to EXEC are
+// evaluated in the global environment; locals and upvalues of the paused
+// function are reported by STACK but are not visible to EXEC.
+package mobdebug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/serialx/luajit"
+)
+
+// Default address of a MobDebug controller.
+const Defaultaddr = "localhost:8172"
+
+// Execution modes of a debugged state.
+const (
+	moderun = iota
+	modestep
+	modeover
+	modeout
+)
+
+// Maximum nesting of tables rendered by EXEC and STACK.
+const maxdepth = 3
+
+// A command as read from the controller. Only LOAD carries a payload.
+type command struct {
+	verb    string
+	args    []string
+	line    string
+	payload []byte
+}
+
+// A Session is a live connection between a State and a MobDebug controller.
+type Session struct {
+	conn    net.Conn
+	cmds    chan command
+	basedir string
+	breaks  map[string]map[int]bool
+	mode    int
+	depth   int
+	closed  bool
+}
+
+// Connects s to the MobDebug controller listening at addr and installs
+// the debug hook. Execution pauses at the next line run by s, waiting for
+// commands from the controller.
+func Start(s *luajit.State, addr string) (*Session, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	d := &Session{
+		conn:   conn,
+		cmds:   make(chan command),
+		breaks: make(map[string]map[int]bool),
+		mode:   modestep,
+	}
+	go d.read()
+	s.Sethook(d.hook, luajit.Maskline, 0)
+	return d, nil
+}
+
+// Closes the connection to the controller. The hook is removed the next
+// time s runs a line of Lua code, after which s runs undisturbed.
+func (d *Session) Close() error {
+	return d.conn.Close()
+}
+
+// Reads commands from the controller and hands them to the hook.
+func (d *Session) read() {
+	defer close(d.cmds)
+	r := bufio.NewReader(d.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		c := command{verb: strings.ToUpper(f[0]), args: f[1:], line: line}
+		if c.verb == "LOAD" && len(c.args) > 0 {
+			n, err := strconv.Atoi(c.args[0])
+			if err != nil || n < 0 {
+				n = 0
+			}
+			c.payload = make([]byte, n)
+			if _, err := io.ReadFull(r, c.payload); err != nil {
+				return
+			}
+		}
+		d.cmds <- c
+	}
+}
+
+func (d *Session) reply(format string, v ...interface{}) {
+	fmt.Fprintf(d.conn, format+"\n", v...)
+}
+
+// Sends a reply carrying a body of data, as used by EXEC and LOAD.
+func (d *Session) replydata(status string, data string) {
+	fmt.Fprintf(d.conn, "%s %d\n%s", status, len(data), data)
+}
+
+// Removes the hook and forgets about the controller.
+func (d *Session) detach(s *luajit.State) {
+	if d.closed {
+		return
+	}
+	d.closed = true
+	d.conn.Close()
+	s.Sethook(nil, 0, 0)
+}
+
+// Returns the file name used in the protocol for the function described
+// by ar. Chunks not loaded from a file are named by their short source.
+func (d *Session) filename(ar *luajit.Debug) string {
+	if !strings.HasPrefix(ar.Source, "@") {
+		return ar.Shortsrc
+	}
+	return d.relpath(ar.Source[1:])
+}
+
+// Makes file relative to the base directory set by the controller.
+func (d *Session) relpath(file string) string {
+	file = filepath.ToSlash(file)
+	if d.basedir != "" && strings.HasPrefix(file, d.basedir) {
+		file = file[len(d.basedir):]
+	}
+	return file
+}
+
+// The debug hook; called for every line run by the state.
+func (d *Session) hook(s *luajit.State, ar *luajit.Debug) {
+	if d.closed {
+		return
+	}
+	if err := ar.Getinfo("Sl"); err != nil {
+		return
+	}
+	file := d.filename(ar)
+	line := ar.Currentline
+	depth := stackdepth(s)
+
+	var pause bool
+	switch d.mode {
+	case modestep:
+		pause = true
+	case modeover:
+		pause = depth <= d.depth
+	case modeout:
+		pause = depth < d.depth
+	}
+	if !pause {
+		pause = d.breaks[file][line]
+	}
+	// While running, handle whatever the controller sent in the meantime
+	// without blocking.
+	for !pause {
+		select {
+		case c, ok := <-d.cmds:
+			if !ok {
+				d.detach(s)
+				return
+			}
+			switch c.verb {
+			case "SETB", "DELB":
+				d.setbreak(c)
+			case "SUSPEND":
+				pause = true
+			default:
+				d.reply("400 Bad Request")
+			}
+			if d.breaks[file][line] {
+				pause = true
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if !pause {
+		return
+	}
+	d.reply("202 Paused %s %d", file, line)
+	d.paused(s, depth)
+}
+
+// Serves commands from the controller until execution is resumed.
+func (d *Session) paused(s *luajit.State, depth int) {
+	for c := range d.cmds {
+		switch c.verb {
+		case "SETB", "DELB":
+			d.setbreak(c)
+		case "EXEC":
+			d.exec(s, strings.TrimSpace(c.line[len("EXEC"):]))
+		case "LOAD":
+			// Reloading the debugged program is not supported; the
+			// chunk is acknowledged and ignored.
+			d.replydata("200 OK", "")
+		case "STACK":
+			d.reply("200 OK %s", stack(s))
+		case "BASEDIR":
+			if len(c.args) > 0 {
+				d.basedir = filepath.ToSlash(c.args[0])
+			}
+			d.reply("200 OK")
+		case "SUSPEND":
+			d.reply("200 OK")
+		case "RUN":
+			d.mode = moderun
+			d.reply("200 OK")
+			return
+		case "STEP":
+			d.mode = modestep
+			d.reply("200 OK")
+			return
+		case "OVER":
+			d.mode, d.depth = modeover, depth
+			d.reply("200 OK")
+			return
+		case "OUT":
+			d.mode, d.depth = modeout, depth
+			d.reply("200 OK")
+			return
+		case "EXIT":
+			d.reply("200 OK")
+			d.detach(s)
+			return
+		default:
+			d.reply("400 Bad Request")
+		}
+	}
+	d.detach(s)
+}
+
+// Handles SETB and DELB. "DELB * 0" removes all breakpoints.
+func (d *Session) setbreak(c command) {
+	if len(c.args) < 2 {
+		d.reply("400 Bad Request")
+		return
+	}
+	file := d.relpath(c.args[0])
+	line, err := strconv.Atoi(c.args[1])
+	if err != nil {
+		d.reply("400 Bad Request")
+		return
+	}
+	switch {
+	case c.verb == "SETB":
+		if d.breaks[file] == nil {
+			d.breaks[file] = make(map[int]bool)
+		}
+		d.breaks[file][line] = true
+	case c.args[0] == "*":
+		d.breaks = make(map[string]map[int]bool)
+	default:
+		delete(d.breaks[file], line)
+	}
+	d.reply("200 OK")
+}
+
+// Evaluates chunk and sends back its results. The chunk is first tried as
+// an expression, then as a statement.
+func (d *Session) exec(s *luajit.State, chunk string) {
+	top := s.Gettop()
+	if err := s.Loadstring("return " + chunk); err != nil {
+		s.Pop(1)
+		if err := s.Loadstring(chunk); err != nil {
+			d.replydata("401 Error in Expression", s.Tostring(-1))
+			s.Settop(top)
+			return
+		}
+	}
+	if err := s.Pcall(0, luajit.Multret, 0); err != nil {
+		d.replydata("401 Error in Execution", s.Tostring(-1))
+		s.Settop(top)
+		return
+	}
+	vals := make([]string, 0, s.Gettop()-top)
+	for i := top + 1; i <= s.Gettop(); i++ {
+		vals = append(vals, quote(literal(s, i, maxdepth)))
+	}
+	s.Settop(top)
+	d.replydata("200 OK", "do local _={"+strings.Join(vals, ",")+"};return _;end")
+}
+
+// Returns the number of active functions on the stack of s.
+func stackdepth(s *luajit.State) int {
+	ar := luajit.Newdebug(s)
+	n := 0
+	for ar.Getstack(n) == nil {
+		n++
+	}
+	return n
+}
+
+// Renders the call stack in the form expected by the STACK command: a
+// chunk returning a list of frames, each holding the function
+// information, its locals and its upvalues.
+func stack(s *luajit.State) string {
+	var frames []string
+	ar := luajit.Newdebug(s)
+	// Level 0 is the hook's caller, which is the paused function.
+	for level := 0; ar.Getstack(level) == nil; level++ {
+		if err := ar.Getinfo("nSlf"); err != nil {
+			break
+		}
+		if ar.What == "C" { // Go functions, as LuaJIT reports them
+			s.Pop(1) // pop function
+			continue
+		}
+		info := fmt.Sprintf("{%s,%s,%d,%d,%s,%s,%s}",
+			quote(ar.Name), quote(ar.Source), ar.Linedefined,
+			ar.Currentline, quote(ar.What), quote(ar.Namewhat),
+			quote(ar.Shortsrc))
+
+		var locals []string
+		for i := 1; ; i++ {
+			name := ar.Getlocal(i)
+			if name == "" {
+				break
+			}
+			if !strings.HasPrefix(name, "(") {
+				locals = append(locals, variable(s, name))
+			}
+			s.Pop(1)
+		}
+
+		var upvalues []string
+		for i := 1; ; i++ {
+			name, err := s.Getupvalue(-1, i)
+			if err != nil {
+				break
+			}
+			upvalues = append(upvalues, variable(s, name))
+			s.Pop(1)
+		}
+		s.Pop(1) // pop function
+
+		frames = append(frames, fmt.Sprintf("{%s,{%s},{%s}}", info,
+			strings.Join(locals, ","), strings.Join(upvalues, ",")))
+	}
+	return "do local _={" + strings.Join(frames, ",") + "};return _;end"
+}
+
+// Renders the value on top of the stack as a named variable entry.
+func variable(s *luajit.State, name string) string {
+	return fmt.Sprintf("[%s]={%s,%s}", quote(name),
+		literal(s, -1, maxdepth), quote(describe(s, -1)))
+}
+
+// Returns a short human-readable description of the value at index.
+func describe(s *luajit.State, index int) string {
+	switch s.Type(index) {
+	case luajit.Tnil:
+		return "nil"
+	case luajit.Tboolean:
+		return strconv.FormatBool(s.Toboolean(index))
+	case luajit.Tnumber:
+		return strconv.FormatFloat(s.Tonumber(index), 'g', -1, 64)
+	case luajit.Tstring:
+		return s.Tostring(index)
+	}
+	return fmt.Sprintf("%s: %p", s.Typename(s.Type(index)), s.Topointer(index))
+}
+
+// Renders the value at index as a Lua expression. Tables are expanded
+// down to depth levels; values that have no literal form are rendered as
+// strings describing them.
+func literal(s *luajit.State, index, depth int) string {
+	if index < 0 && index > luajit.Registryindex {
+		index = s.Gettop() + index + 1
+	}
+	switch s.Type(index) {
+	case luajit.Tnil, luajit.Tnone:
+		return "nil"
+	case luajit.Tboolean:
+		return strconv.FormatBool(s.Toboolean(index))
+	case luajit.Tnumber:
+		return number(s.Tonumber(index))
+	case luajit.Tstring:
+		return quote(s.Tostring(index))
+	case luajit.Ttable:
+		if depth == 0 {
+			return quote(describe(s, index))
+		}
+		if !s.Checkstack(2) {
+			return quote(describe(s, index))
+		}
+		var fields []string
+		s.Pushnil()
+		for s.Next(index) != 0 {
+			k := literal(s, -2, 0)
+			v := literal(s, -1, depth-1)
+			fields = append(fields, "["+k+"]="+v)
+			s.Pop(1)
+		}
+		return "{" + strings.Join(fields, ",") + "}"
+	}
+	return quote(describe(s, index))
+}
+
+// Formats a number so that Lua reads back the same value.
+func number(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return "0/0"
+	case math.IsInf(n, 1):
+		return "math.huge"
+	case math.IsInf(n, -1):
+		return "-math.huge"
+	}
+	return strconv.FormatFloat(n, 'g', 17, 64)
+}
+
+// Quotes str as a Lua string literal.
+func quote(str string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString("\\n")
+		case c == '\r':
+			b.WriteString("\\r")
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
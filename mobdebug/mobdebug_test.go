@@ -0,0 +1,157 @@
+package mobdebug
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/serialx/luajit"
+)
+
+func expect(t *testing.T, r *bufio.Reader, prefix string) string {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading reply: %s", err.Error())
+	}
+	if !strings.HasPrefix(line, prefix) {
+		t.Fatalf("expected reply %q, got %q", prefix, line)
+	}
+	return strings.TrimRight(line, "\n")
+}
+
+func TestSession(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	d, err := Start(s, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	done := make(chan error)
+	go func() {
+		if err := s.Loadstring("testx = 20\ntesty = testx + 1\n"); err != nil {
+			done <- err
+			return
+		}
+		done <- s.Pcall(0, 0, 0)
+	}()
+
+	r := bufio.NewReader(conn)
+	expect(t, r, "202 Paused ")
+	io.WriteString(conn, "STEP\n")
+	expect(t, r, "200 OK")
+	if line := expect(t, r, "202 Paused "); !strings.HasSuffix(line, " 2") {
+		t.Errorf("expected pause on line 2, got %q", line)
+	}
+
+	io.WriteString(conn, "EXEC testx\n")
+	line := expect(t, r, "200 OK ")
+	n, err := strconv.Atoi(strings.TrimPrefix(line, "200 OK "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), `"20"`) {
+		t.Errorf("expected 20 in EXEC result, got %q", body)
+	}
+
+	io.WriteString(conn, "RUN\n")
+	expect(t, r, "200 OK")
+	if err := <-done; err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	s.Getglobal("testy")
+	if n := s.Tointeger(-1); n != 21 {
+		t.Errorf("expected 21, got %d", n)
+	}
+}
+
+func TestStackskipsgofunctions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	s.Register(func(s *luajit.State) int {
+		s.Pushvalue(1)
+		if err := s.Pcall(0, 1, 0); err != nil {
+			return s.Errorf("%s", s.Tostring(-1))
+		}
+		return 1
+	}, "gocall")
+	d, err := Start(s, l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	done := make(chan error)
+	go func() {
+		if err := s.Loadstring("local function inner()\nreturn 1\nend\nreturn gocall(inner)\n"); err != nil {
+			done <- err
+			return
+		}
+		done <- s.Pcall(0, 0, 0)
+	}()
+
+	// Step into inner through the Go function.
+	r := bufio.NewReader(conn)
+	line := expect(t, r, "202 Paused ")
+	for i := 0; !strings.HasSuffix(line, " 2"); i++ {
+		if i == 5 {
+			t.Fatalf("expected to step into line 2, got %q", line)
+		}
+		io.WriteString(conn, "STEP\n")
+		expect(t, r, "200 OK")
+		line = expect(t, r, "202 Paused ")
+	}
+
+	io.WriteString(conn, "STACK\n")
+	line = expect(t, r, "200 OK ")
+	if strings.Contains(line, `"C"`) {
+		t.Errorf("expected no Go function in the stack, got %q", line)
+	}
+	if !strings.Contains(line, `"Lua"`) || !strings.Contains(line, `"main"`) {
+		t.Errorf("expected inner and the main chunk in the stack, got %q", line)
+	}
+
+	io.WriteString(conn, "RUN\n")
+	expect(t, r, "200 OK")
+	if err := <-done; err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
@@ -0,0 +1,179 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Registers loader in package.preload under name, so that require(name)
+// calls it to load the module the first time it is required. As with any
+// loader, loader receives the module name as its argument, and its result
+// becomes the value of the module. The package library must be open.
+func (s *State) Preload(name string, loader Gofunction) error {
+	defer s.balanced("Preload", 0)()
+	if err := s.getpreload(); err != nil {
+		return err
+	}
+	s.Pushfunction(loader)
+	s.Setfield(-2, name)
+	s.Pop(1)
+	return nil
+}
+
+// Registers in package.preload a loader for a module named name whose
+// value is a table holding the functions in fns. The table is created
+// when the module is first required.
+func (s *State) Preloadfuncs(name string, fns map[string]Gofunction) error {
+	return s.Preload(name, func(s *State) int {
+		s.Createtable(0, len(fns))
+		for k, fn := range fns {
+			s.Pushfunction(fn)
+			s.Setfield(-2, k)
+		}
+		return 1
+	})
+}
+
+// Loads chunk, which may hold source or bytecode, and registers it in
+// package.preload as the loader for the module name, so that require(name)
+// runs it. Unlike Preload, the chunk is parsed right away, and syntax
+// errors are returned.
+func (s *State) Preloadchunk(name string, chunk []byte) error {
+	defer s.balanced("Preloadchunk", 0)()
+	if err := s.getpreload(); err != nil {
+		return err
+	}
+	if err := s.Loadbuffer(chunk, "="+name); err != nil {
+		err = fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		s.Pop(2)
+		return err
+	}
+	s.Setfield(-2, name)
+	s.Pop(1)
+	return nil
+}
+
+// Pushes package.preload, or returns an error and pushes nothing if the
+// package library is not open.
+func (s *State) getpreload() error {
+	if err := s.grow(2); err != nil {
+		return err
+	}
+	s.Getglobal("package")
+	if s.Istable(-1) {
+		s.Getfield(-1, "preload")
+		s.Remove(-2)
+		if s.Istable(-1) {
+			return nil
+		}
+	}
+	s.Pop(1)
+	return errors.New("package library not open")
+}
+
+// Adds to package.loaders a searcher that makes require find Lua modules
+// in fsys, such as an embed.FS, so that they can be shipped inside the Go
+// binary. path is a list of templates separated by semicolons, like
+// package.path, in which each question mark is replaced by the module
+// name with dots replaced by slashes; if empty, it defaults to
+// "?.lua;?/init.lua". Files may hold source or bytecode.
+//
+// The searcher goes right after the one for package.preload, so that
+// modules in fsys take precedence over those on disk. The package library
+// must be open.
+func (s *State) Addsearcher(fsys fs.FS, path string) error {
+	defer s.balanced("Addsearcher", 0)()
+	if path == "" {
+		path = "?.lua;?/init.lua"
+	}
+	templates := strings.Split(path, ";")
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.Getglobal("package")
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errors.New("package library not open")
+	}
+	s.Getfield(-1, "loaders")
+	s.Remove(-2)
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errors.New("package.loaders is not a table")
+	}
+	for i := s.Objlen(-1); i >= 2; i-- {
+		s.Rawgeti(-1, i)
+		s.Rawseti(-2, i+1)
+	}
+	s.Pushfunction(func(s *State) int {
+		name := strings.ReplaceAll(s.Tostring(1), ".", "/")
+		var tried strings.Builder
+		for _, t := range templates {
+			filename := strings.ReplaceAll(t, "?", name)
+			data, err := fs.ReadFile(fsys, filename)
+			if err != nil {
+				fmt.Fprintf(&tried, "\n\tno file '%s' in embedded files", filename)
+				continue
+			}
+			if err := s.Loadbuffer(data, "@"+filename); err != nil {
+				return s.Errorf("error loading module '%s' from file '%s':\n\t%s",
+					s.Tostring(1), filename, s.Tostring(-1))
+			}
+			return 1
+		}
+		s.Pushstring(tried.String())
+		return 1
+	})
+	s.Rawseti(-2, 2)
+	s.Pop(1)
+	return nil
+}
+
+// Stops scripts from loading native code: removes package.loadlib, empties
+// package.cpath, and removes from package.loaders the searchers for C
+// modules, which are the C functions after the first two, the searchers
+// for package.preload and for Lua files, in the order the package library
+// installs them. Openpreset does this for every preset but Presetfull.
+// The package library must be open.
+func (s *State) Disablecmodules() error {
+	defer s.balanced("Disablecmodules", 0)()
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.Getglobal("package")
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errors.New("package library not open")
+	}
+	s.Pushnil()
+	s.Setfield(-2, "loadlib")
+	s.Pushstring("")
+	s.Setfield(-2, "cpath")
+	s.Getfield(-1, "loaders")
+	s.Remove(-2)
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errors.New("package.loaders is not a table")
+	}
+	n, j, cfuncs := s.Objlen(-1), 1, 0
+	for i := 1; i <= n; i++ {
+		s.Rawgeti(-1, i)
+		if s.Iscfunction(-1) && !s.Isgofunction(-1) {
+			cfuncs++
+			if cfuncs > 2 {
+				s.Pop(1)
+				continue
+			}
+		}
+		s.Rawseti(-2, j)
+		j++
+	}
+	for ; j <= n; j++ {
+		s.Pushnil()
+		s.Rawseti(-2, j)
+	}
+	s.Pop(1)
+	return nil
+}
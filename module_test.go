@@ -0,0 +1,159 @@
+package luajit
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPreload(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Preload("x", func(s *State) int { return 0 }); err == nil {
+		t.Error("expected error without the package library")
+	}
+	s.Openlibs()
+
+	loads := 0
+	err := s.Preload("answer", func(s *State) int {
+		loads++
+		s.Pushnumber(42)
+		return 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Preloadfuncs("util", map[string]Gofunction{
+		"double": func(s *State) int {
+			s.Pushnumber(2 * s.Tonumber(1))
+			return 1
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loads != 0 {
+		t.Errorf("expected no loads before require, got %d", loads)
+	}
+
+	err = s.Loadstring(`return require("answer") + require("answer") + require("util").double(4)`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 92 {
+		t.Errorf("expected 92, got %d", n)
+	}
+	s.Pop(1)
+	if loads != 1 {
+		t.Errorf("expected 1 load, got %d", loads)
+	}
+}
+
+func TestAddsearcher(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	fsys := fstest.MapFS{
+		"lib/greet.lua":    {Data: []byte(`return {hello = function(n) return "hello " .. n end}`)},
+		"lib/pkg/init.lua": {Data: []byte(`return 7`)},
+		"lib/broken.lua":   {Data: []byte(`return (`)},
+	}
+	if err := s.Addsearcher(fsys, "lib/?.lua;lib/?/init.lua"); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Loadstring(`
+		assert(require("greet").hello("fs") == "hello fs")
+		assert(require("pkg") == 7)
+		local ok, err = pcall(require, "broken")
+		assert(not ok and err:find("error loading module 'broken'", 1, true))
+		ok, err = pcall(require, "missing")
+		assert(not ok and err:find("no file 'lib/missing.lua' in embedded files", 1, true))
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
+
+func TestDisablecmodules(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	fsys := fstest.MapFS{"greet.lua": {Data: []byte(`return "hi"`)}}
+	if err := s.Addsearcher(fsys, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Disablecmodules(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Loadstring(`
+		assert(package.loadlib == nil and package.cpath == "")
+		assert(#package.loaders == 3, #package.loaders)
+		assert(require("greet") == "hi")
+		local ok, err = pcall(require, "missing")
+		assert(not ok and err:find("missing.lua", 1, true) and not err:find(".so", 1, true))
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
+
+func TestPreloadchunk(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if err := s.Loadstring(`return {name = ...}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := s.Dump(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	s.Pop(1)
+
+	if err := s.Preloadchunk("compiled", buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Preloadchunk("broken", []byte("return (")); err == nil {
+		t.Error("expected syntax error")
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+	if err := s.Loadstring(`return require("compiled").name`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Tostring(-1) != "compiled" {
+		t.Errorf("expected compiled, got %s", s.Tostring(-1))
+	}
+	s.Pop(1)
+}
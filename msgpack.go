@@ -0,0 +1,359 @@
+package luajit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var errmsgpackeof = errors.New("msgpack: unexpected end of data")
+
+// Makes the module "msgpack" available to require, with the functions of
+// lua-cmsgpack:
+//
+//	msgpack.pack(...)	returns its arguments encoded one after another
+//	msgpack.unpack(data)	returns all the values encoded in data
+//
+// Values are encoded and decoded as by Tomsgpack and Pushmsgpack. The
+// package library must be open.
+func (s *State) Openmsgpack() error {
+	return s.Preloadfuncs("msgpack", map[string]Gofunction{
+		"pack":   msgpackpack,
+		"unpack": msgpackunpack,
+	})
+}
+
+func msgpackpack(s *State) int {
+	var b []byte
+	for i := 1; i <= s.Gettop(); i++ {
+		var err error
+		if b, err = s.appendmsgpack(b, i, 0); err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+	}
+	s.Pushbytes(b)
+	return 1
+}
+
+func msgpackunpack(s *State) int {
+	if !s.Isstring(1) {
+		return s.Errorf("bad argument #1 to 'unpack' (string expected, got %s)", s.Typename(s.Type(1)))
+	}
+	d := &msgpackdecoder{data: s.Tobytes(1)}
+	n := 0
+	for len(d.data) > 0 {
+		if err := s.pushmsgpack(d, 0); err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		n++
+	}
+	return n
+}
+
+// Encodes the value at the given valid index in MessagePack. Numbers with
+// integer values are encoded as the smallest integer that holds them, and
+// other numbers as 64-bit floats; strings are encoded as str, whatever
+// their contents. Tables whose keys are exactly 1 to n, and empty tables,
+// become arrays, and other tables maps, with their pairs sorted by the
+// encoding of their keys so that the result is reproducible. A light
+// userdata holding NULL, such as json.null, encodes as nil. Returns an
+// error for values that cannot be encoded, such as functions and tables
+// that refer to themselves.
+func (s *State) Tomsgpack(index int) ([]byte, error) {
+	return s.appendmsgpack(nil, s.absindex(index), 0)
+}
+
+// Decodes the MessagePack value in data and pushes it onto the stack.
+// Integers and floats become numbers, str and bin become strings, arrays
+// and maps become tables, and nil becomes nil, leaving a hole in arrays
+// and no field in maps. Extension types are not supported. On error,
+// including extra data after the value, nothing is pushed.
+func (s *State) Pushmsgpack(data []byte) error {
+	top := s.Gettop()
+	d := &msgpackdecoder{data: data}
+	if err := s.pushmsgpack(d, 0); err != nil {
+		s.Settop(top)
+		return err
+	}
+	if len(d.data) > 0 {
+		s.Settop(top)
+		return errors.New("msgpack: extra data after value")
+	}
+	return nil
+}
+
+func (s *State) appendmsgpack(b []byte, index, depth int) ([]byte, error) {
+	switch tp := s.Type(index); tp {
+	case Tnil:
+		return append(b, 0xc0), nil
+	case Tboolean:
+		if s.Toboolean(index) {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case Tnumber:
+		return appendmsgpacknumber(b, s.Tonumber(index)), nil
+	case Tstring:
+		str := s.Tostring(index)
+		b = appendmsgpacklen(b, len(str), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		return append(b, str...), nil
+	case Tlightuserdata:
+		if s.Touserdata(index) == nil {
+			return append(b, 0xc0), nil
+		}
+	case Ttable:
+		if depth >= maxnesting {
+			return nil, errnesting
+		}
+		return s.appendmsgpacktable(b, index, depth)
+	}
+	return nil, fmt.Errorf("cannot pack %s", s.Typename(s.Type(index)))
+}
+
+func appendmsgpacknumber(b []byte, f float64) []byte {
+	switch {
+	case f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxUint64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+	case f >= 0 && f < 128:
+		return append(b, byte(f))
+	case f >= -32 && f < 0:
+		return append(b, byte(int8(f)))
+	case f >= 0 && f <= math.MaxUint8:
+		return append(b, 0xcc, byte(f))
+	case f >= 0 && f <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(f))
+	case f >= 0 && f <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(f))
+	case f >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(f))
+	case f >= math.MinInt8:
+		return append(b, 0xd0, byte(int8(f)))
+	case f >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(int16(f)))
+	case f >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(int32(f)))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(int64(f)))
+}
+
+// Appends the header of a str, array, or map of n elements: fix | n if n
+// is below fixmax, otherwise the byte for a length of 8, 16, or 32 bits
+// followed by n. A zero byte8 means there is no 8-bit form.
+func appendmsgpacklen(b []byte, n int, fix byte, fixmax int, byte8, byte16, byte32 byte) []byte {
+	switch {
+	case n < fixmax:
+		return append(b, fix|byte(n))
+	case byte8 != 0 && n <= math.MaxUint8:
+		return append(b, byte8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, byte16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, byte32), uint32(n))
+}
+
+func (s *State) appendmsgpacktable(b []byte, index, depth int) ([]byte, error) {
+	if err := s.grow(2); err != nil {
+		return nil, err
+	}
+	n := s.Tablecount(index)
+	if s.Arraylen(index) == n {
+		b = appendmsgpacklen(b, n, 0x90, 16, 0, 0xdc, 0xdd)
+		for i := 1; i <= n; i++ {
+			s.Rawgeti(index, i)
+			var err error
+			b, err = s.appendmsgpack(b, s.Gettop(), depth+1)
+			s.Pop(1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+
+	type pair struct {
+		key, val []byte
+	}
+	pairs := make([]pair, 0, n)
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		top := s.Gettop()
+		key, err := s.appendmsgpack(nil, top-1, depth+1)
+		if err == nil {
+			var val []byte
+			if val, err = s.appendmsgpack(nil, top, depth+1); err == nil {
+				pairs = append(pairs, pair{key, val})
+			}
+		}
+		s.Pop(1)
+		if err != nil {
+			s.Pop(1)
+			return nil, err
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+	b = appendmsgpacklen(b, len(pairs), 0x80, 16, 0, 0xde, 0xdf)
+	for _, p := range pairs {
+		b = append(append(b, p.key...), p.val...)
+	}
+	return b, nil
+}
+
+type msgpackdecoder struct {
+	data []byte
+}
+
+func (d *msgpackdecoder) next(n int) ([]byte, error) {
+	if len(d.data) < n {
+		return nil, errmsgpackeof
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b, nil
+}
+
+// Reads an unsigned integer of n bytes.
+func (d *msgpackdecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// Reads an int of n bytes, sign-extended.
+func (d *msgpackdecoder) int(n int) (int64, error) {
+	u, err := d.uint(n)
+	shift := 64 - 8*n
+	return int64(u<<shift) >> shift, err
+}
+
+func (s *State) pushmsgpack(d *msgpackdecoder, depth int) error {
+	if depth > maxnesting {
+		return errnesting
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return err
+	}
+	c := b[0]
+	switch {
+	case c < 0x80:
+		s.Pushnumber(float64(c))
+	case c >= 0xe0:
+		s.Pushnumber(float64(int8(c)))
+	case c >= 0x80 && c < 0x90:
+		return s.pushmsgpackmap(d, int(c&0x0f), depth)
+	case c >= 0x90 && c < 0xa0:
+		return s.pushmsgpackarray(d, int(c&0x0f), depth)
+	case c >= 0xa0 && c < 0xc0:
+		return s.pushmsgpackstring(d, int(c&0x1f))
+	case c == 0xc0:
+		s.Pushnil()
+	case c == 0xc2 || c == 0xc3:
+		s.Pushboolean(c == 0xc3)
+	case c == 0xc4 || c == 0xd9:
+		return s.pushmsgpacksized(d, 1, s.pushmsgpackstring)
+	case c == 0xc5 || c == 0xda:
+		return s.pushmsgpacksized(d, 2, s.pushmsgpackstring)
+	case c == 0xc6 || c == 0xdb:
+		return s.pushmsgpacksized(d, 4, s.pushmsgpackstring)
+	case c == 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return err
+		}
+		s.Pushnumber(float64(math.Float32frombits(uint32(u))))
+	case c == 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return err
+		}
+		s.Pushnumber(math.Float64frombits(u))
+	case c >= 0xcc && c <= 0xcf:
+		u, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return err
+		}
+		s.Pushnumber(float64(u))
+	case c >= 0xd0 && c <= 0xd3:
+		n, err := d.int(1 << (c - 0xd0))
+		if err != nil {
+			return err
+		}
+		s.Pushnumber(float64(n))
+	case c == 0xdc || c == 0xdd:
+		return s.pushmsgpacksized(d, 2<<(c-0xdc), func(d *msgpackdecoder, n int) error {
+			return s.pushmsgpackarray(d, n, depth)
+		})
+	case c == 0xde || c == 0xdf:
+		return s.pushmsgpacksized(d, 2<<(c-0xde), func(d *msgpackdecoder, n int) error {
+			return s.pushmsgpackmap(d, n, depth)
+		})
+	default:
+		return fmt.Errorf("msgpack: unsupported type 0x%02x", c)
+	}
+	return nil
+}
+
+// Reads a length of size bytes and calls push with it.
+func (s *State) pushmsgpacksized(d *msgpackdecoder, size int, push func(*msgpackdecoder, int) error) error {
+	n, err := d.uint(size)
+	if err != nil {
+		return err
+	}
+	if n > uint64(len(d.data)) {
+		return errmsgpackeof
+	}
+	return push(d, int(n))
+}
+
+func (s *State) pushmsgpackstring(d *msgpackdecoder, n int) error {
+	b, err := d.next(n)
+	if err != nil {
+		return err
+	}
+	s.Pushbytes(b)
+	return nil
+}
+
+func (s *State) pushmsgpackarray(d *msgpackdecoder, n, depth int) error {
+	s.Createtable(n, 0)
+	for i := 1; i <= n; i++ {
+		if err := s.pushmsgpack(d, depth+1); err != nil {
+			return err
+		}
+		s.Rawseti(-2, i)
+	}
+	return nil
+}
+
+func (s *State) pushmsgpackmap(d *msgpackdecoder, n, depth int) error {
+	s.Createtable(0, n)
+	for i := 0; i < n; i++ {
+		if err := s.pushmsgpack(d, depth+1); err != nil {
+			return err
+		}
+		if err := s.pushmsgpack(d, depth+1); err != nil {
+			return err
+		}
+		if s.Isnil(-2) {
+			return errors.New("msgpack: map key is nil")
+		}
+		if f := s.Tonumber(-2); s.Isnumber(-2) && f != f {
+			return errors.New("msgpack: map key is NaN")
+		}
+		s.Rawset(-3)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package luajit
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestOpenmsgpack(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Openmsgpack(); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Loadstring(`
+		local msgpack = require("msgpack")
+		local v = {name = "x", list = {1, -2, 2.5, 300, -70000, 2^40}, ok = false, [1.5] = "f"}
+		local a, b, c = msgpack.unpack(msgpack.pack(v, "s", 7))
+		local cyclic = {} cyclic.self = cyclic
+		return a.name, a.ok, a[1.5], table.concat(a.list, " "), b, c, #msgpack.pack({}),
+			(pcall(msgpack.pack, cyclic)), (pcall(msgpack.unpack, "\220\0\2\1")), pcall(msgpack.pack, print)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[x false f 1 -2 2.5 300 -70000 1099511627776 s 7 1 false false false cannot pack function]`
+	if fmt.Sprint(v) != want {
+		t.Errorf("expected %s, got %v", want, v)
+	}
+}
+
+func TestTomsgpack(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`return {1, "ab", true}, {b = 1, a = 0.5}, -33, 2^32`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 4, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for i, want := range [][]byte{
+		{0x93, 0x01, 0xa2, 'a', 'b', 0xc3},
+		{0x82, 0xa1, 'a', 0xcb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0, 0xa1, 'b', 0x01},
+		{0xd0, 0xdf},
+		{0xcf, 0, 0, 0, 0x01, 0, 0, 0, 0},
+	} {
+		b, err := s.Tomsgpack(i + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("value %d: expected % x, got % x", i+1, want, b)
+		}
+	}
+}
+
+func TestPushmsgpack(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	data := []byte{0x81, 0xa1, 'a', 0x93, 0x01, 0xc0, 0xc4, 0x02, 'h', 'i'}
+	if err := s.Pushmsgpack(data); err != nil {
+		t.Fatal(err)
+	}
+	s.Getfield(-1, "a")
+	if s.Objlen(-1) != 3 {
+		t.Errorf("expected an array of length 3, got %d", s.Objlen(-1))
+	}
+	s.Rawgeti(-1, 3)
+	if s.Tostring(-1) != "hi" {
+		t.Errorf("expected hi, got %s", s.Tostring(-1))
+	}
+	s.Settop(0)
+	for _, bad := range [][]byte{{0x92, 0x01}, {0x01, 0x02}, {0xd9, 0x05, 'a'}, {0xc1}, {0x81, 0xc0, 0x01}, {}} {
+		if err := s.Pushmsgpack(bad); err == nil {
+			t.Errorf("expected an error decoding % x", bad)
+		}
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected an empty stack, got %d values", s.Gettop())
+	}
+}
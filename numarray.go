@@ -0,0 +1,152 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <stdint.h>
+
+// Element types of the arrays moved by pusharray and toarray.
+enum {
+	Afloat64,
+	Aint32,
+	Auint8
+};
+
+static void
+pusharray(lua_State *l, int kind, const void *p, int n)
+{
+	int i;
+
+	lua_createtable(l, n, 0);
+	for(i = 0; i < n; i++){
+		switch(kind){
+		case Afloat64:
+			lua_pushnumber(l, ((const double*)p)[i]);
+			break;
+		case Aint32:
+			lua_pushnumber(l, ((const int32_t*)p)[i]);
+			break;
+		case Auint8:
+			lua_pushnumber(l, ((const uint8_t*)p)[i]);
+			break;
+		}
+		lua_rawseti(l, -2, i + 1);
+	}
+}
+
+// Stores the n first elements of the table at idx, an absolute index,
+// into p. Returns 0, or the index of the first element that is not a
+// number of the kind, which is left on the stack.
+static int
+toarray(lua_State *l, int idx, int kind, void *p, int n)
+{
+	int i;
+	lua_Number d;
+
+	for(i = 0; i < n; i++){
+		lua_rawgeti(l, idx, i + 1);
+		if(lua_type(l, -1) != LUA_TNUMBER)
+			return i + 1;
+		d = lua_tonumber(l, -1);
+		switch(kind){
+		case Afloat64:
+			((double*)p)[i] = d;
+			break;
+		case Aint32:
+			if(!(d >= INT32_MIN && d <= INT32_MAX) || d != (int32_t)d)
+				return i + 1;
+			((int32_t*)p)[i] = d;
+			break;
+		case Auint8:
+			if(!(d >= 0 && d <= UINT8_MAX) || d != (uint8_t)d)
+				return i + 1;
+			((uint8_t*)p)[i] = d;
+			break;
+		}
+		lua_pop(l, 1);
+	}
+	return 0;
+}
+*/
+import "C"
+import "unsafe"
+
+// Pushes a new table holding the elements of a, as Push would, but
+// filled in a single call into C rather than one per element. This makes
+// a difference for the large arrays of numerical code.
+func (s *State) Pushnumberarray(a []float64) error {
+	return s.pusharray(C.Afloat64, unsafe.Pointer(unsafe.SliceData(a)), len(a))
+}
+
+// Pushes a new table holding the elements of a, as Pushnumberarray does.
+func (s *State) Pushint32array(a []int32) error {
+	return s.pusharray(C.Aint32, unsafe.Pointer(unsafe.SliceData(a)), len(a))
+}
+
+// Pushes a new table holding the elements of a as numbers, as
+// Pushnumberarray does. To push bytes as a string, use Pushbytes.
+func (s *State) Pushbytearray(a []byte) error {
+	return s.pusharray(C.Auint8, unsafe.Pointer(unsafe.SliceData(a)), len(a))
+}
+
+func (s *State) pusharray(kind C.int, p unsafe.Pointer, n int) error {
+	if err := s.grow(2); err != nil {
+		return err
+	}
+	C.pusharray(s.live(), kind, p, C.int(n))
+	return nil
+}
+
+// Converts the array part of the table at the given valid index to a
+// slice of float64, as Tofloat64slice does, but in a single call into C.
+func (s *State) Tonumberarray(index int) ([]float64, error) {
+	index = s.absindex(index)
+	n, err := s.arraylen(index)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]float64, n)
+	if err := s.toarray(index, C.Afloat64, unsafe.Pointer(unsafe.SliceData(a)), n, "number"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Converts the array part of the table at the given valid index to a
+// slice of int32, as Tonumberarray does. Every element must be a number
+// with an integral value in the range of int32.
+func (s *State) Toint32array(index int) ([]int32, error) {
+	index = s.absindex(index)
+	n, err := s.arraylen(index)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]int32, n)
+	if err := s.toarray(index, C.Aint32, unsafe.Pointer(unsafe.SliceData(a)), n, "int32"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Converts the array part of the table at the given valid index to a
+// byte slice, as Tonumberarray does. Every element must be a number with
+// an integral value from 0 to 255. To get the bytes of a string, use
+// Tobytes.
+func (s *State) Tobytearray(index int) ([]byte, error) {
+	index = s.absindex(index)
+	n, err := s.arraylen(index)
+	if err != nil {
+		return nil, err
+	}
+	a := make([]byte, n)
+	if err := s.toarray(index, C.Auint8, unsafe.Pointer(unsafe.SliceData(a)), n, "byte"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (s *State) toarray(index int, kind C.int, p unsafe.Pointer, n int, expected string) error {
+	if i := int(C.toarray(s.live(), C.int(index), kind, p, C.int(n))); i != 0 {
+		return s.elemerror(i, expected)
+	}
+	return nil
+}
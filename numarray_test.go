@@ -0,0 +1,54 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNumberarray(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	if err := s.Pushnumberarray([]float64{1.5, -2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pushint32array([]int32{-1 << 31, 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pushbytearray([]byte{0, 255}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pushnumberarray(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Tonumberarray(1)
+	if err != nil || fmt.Sprint(f) != "[1.5 -2 3]" {
+		t.Errorf("expected [1.5 -2 3], got %v, %v", f, err)
+	}
+	i, err := s.Toint32array(2)
+	if err != nil || fmt.Sprint(i) != "[-2147483648 7]" {
+		t.Errorf("expected [-2147483648 7], got %v, %v", i, err)
+	}
+	b, err := s.Tobytearray(3)
+	if err != nil || fmt.Sprint(b) != "[0 255]" {
+		t.Errorf("expected [0 255], got %v, %v", b, err)
+	}
+	if f, err := s.Tonumberarray(4); err != nil || len(f) != 0 {
+		t.Errorf("expected empty slice, got %v, %v", f, err)
+	}
+
+	if _, err := s.Toint32array(1); err == nil || err.Error() != "element 1: expected int32, got number" {
+		t.Errorf("expected error for 1.5, got %v", err)
+	}
+	if _, err := s.Tobytearray(2); err == nil {
+		t.Error("expected error for negative byte")
+	}
+	if n := s.Gettop(); n != 4 {
+		t.Errorf("expected 4 values on the stack, got %d", n)
+	}
+	s.Pop(4)
+}
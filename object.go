@@ -0,0 +1,277 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"errors"
+	"reflect"
+	"runtime/cgo"
+	"sync"
+	"unsafe"
+)
+
+// Metatable field marking userdata that hold Go objects.
+const objectfield = "__goobject"
+
+// A binding holds what Lua needs to access the values of one Go type.
+type binding struct {
+	name     string
+	methods  map[string]Gofunction
+	fields   map[string]field
+	index    Gofunction // takes the table of methods as upvalue 1
+	newindex Gofunction
+	meta     map[string]Gofunction // other metamethods
+}
+
+// Methods that are also installed as metamethods, with the number of
+// parameters and the result kind they must have to qualify.
+var metamethods = []struct {
+	method, event string
+	nin           int
+	out           reflect.Kind
+}{
+	{"String", "__tostring", 0, reflect.String},
+	{"Len", "__len", 0, reflect.Int},
+	{"Equal", "__eq", 1, reflect.Bool},
+	{"Less", "__lt", 1, reflect.Bool},
+	{"Add", "__add", 1, reflect.Invalid},
+	{"Sub", "__sub", 1, reflect.Invalid},
+	{"Mul", "__mul", 1, reflect.Invalid},
+	{"Div", "__div", 1, reflect.Invalid},
+	{"Mod", "__mod", 1, reflect.Invalid},
+	{"Pow", "__pow", 1, reflect.Invalid},
+	{"Neg", "__unm", 0, reflect.Invalid},
+	{"Concat", "__concat", 1, reflect.Invalid},
+}
+
+var bindings sync.Map // reflect.Type -> *binding
+
+// Pushes the Go value v onto the stack as a userdata through which Lua
+// code can use v's exported methods and fields:
+//
+//	obj:Method(args)	calls v.Method, converting arguments and
+//				results as Pushfunc does
+//	obj.field		reads a struct field, converted as by Push
+//	obj.field = x		sets a struct field, converted as by Unmarshal
+//
+// Some methods also make operators work on the userdata:
+//
+//	String() string		tostring(obj), print(obj)
+//	Len() int		#obj
+//	Equal(T) bool		obj == other
+//	Less(T) bool		obj < other
+//	Add(T) T		obj + other, and likewise Sub (-), Mul (*),
+//				Div (/), Mod (%), Pow (^) and Concat (..)
+//	Neg() T			-obj
+//
+// Binary operators only work with the object as the left operand, and
+// results of the object's own type are pushed as objects as well. Note
+// that Lua only calls Equal to compare two objects of the same type.
+//
+// Field names follow the lua struct tags as described for Pushstruct.
+// Methods take precedence over fields of the same name. A struct value is
+// copied and used through a pointer, so that methods with pointer
+// receivers are available and fields can be set; to share a struct with
+// Lua, push a pointer to it.
+//
+// The metatable for each type is built once per State and kept in the
+// registry. The userdata keeps v alive until it is collected by Lua.
+func (s *State) Pushobject(v interface{}) error {
+	if v == nil {
+		return errors.New("cannot push nil as an object")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Struct {
+		p := reflect.New(rv.Type())
+		p.Elem().Set(rv)
+		rv = p
+	}
+	return s.pushobject(rv)
+}
+
+func (s *State) pushobject(rv reflect.Value) error {
+	if err := s.grow(4); err != nil {
+		return err
+	}
+	s.pushhandle(rv.Interface())
+	s.objectmeta(rv.Type())
+	s.Setmetatable(-2)
+	return nil
+}
+
+// Pushes a userdata holding a handle to v. The userdata has no metatable
+// yet; the caller must set one that releases the handle (see gcobject).
+func (s *State) pushhandle(v interface{}) {
+	p := s.Newuserdata(int(unsafe.Sizeof(cgo.Handle(0))))
+	*(*cgo.Handle)(p) = cgo.NewHandle(v)
+}
+
+// Returns the Go object held by the userdata at index, and whether there
+// is one.
+func (s *State) toobject(index int) (interface{}, bool) {
+	if s.Type(index) != Tuserdata || int(C.lua_getmetatable(s.live(), C.int(index))) == 0 {
+		return nil, false
+	}
+	s.Getfield(-1, objectfield)
+	ok := s.Toboolean(-1)
+	s.Pop(2)
+	if !ok {
+		return nil, false
+	}
+	h := *(*cgo.Handle)(s.Touserdata(index))
+	if h == 0 {
+		return nil, false
+	}
+	return h.Value(), true
+}
+
+// The __gc metamethod of userdata holding Go objects: releases the handle.
+var gcobject Gofunction = func(s *State) int {
+	if p := s.Touserdata(1); p != nil {
+		h := (*cgo.Handle)(p)
+		if *h != 0 {
+			h.Delete()
+			*h = 0
+		}
+	}
+	return 0
+}
+
+// Returns the registry name of the metatable for objects of type t.
+func typename(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr && t.Elem().Name() != "" {
+		return "luajit.object:*" + t.Elem().PkgPath() + "." + t.Elem().Name()
+	}
+	if t.Name() != "" {
+		return "luajit.object:" + t.PkgPath() + "." + t.Name()
+	}
+	return "luajit.object:" + t.String()
+}
+
+// Pushes the metatable for objects of type t, creating it in the registry
+// if needed.
+func (s *State) objectmeta(t reflect.Type) {
+	b := bind(t)
+	cs, mustfree := cstring(b.name)
+	if mustfree {
+		defer C.free(unsafe.Pointer(cs))
+	}
+	if int(C.luaL_newmetatable(s.live(), cs)) == 0 {
+		return // already created
+	}
+	s.Pushboolean(true)
+	s.Setfield(-2, objectfield)
+	s.Pushfunction(gcobject)
+	s.Setfield(-2, "__gc")
+	// The methods are made into functions once, in a table kept as the
+	// upvalue of __index, rather than on every lookup.
+	s.Createtable(0, len(b.methods))
+	for name, fn := range b.methods {
+		s.Pushfunction(fn)
+		s.Setfield(-2, name)
+	}
+	s.Pushclosure(b.index, 1)
+	s.Setfield(-2, "__index")
+	s.Pushfunction(b.newindex)
+	s.Setfield(-2, "__newindex")
+	for event, fn := range b.meta {
+		s.Pushfunction(fn)
+		s.Setfield(-2, event)
+	}
+}
+
+// Returns the binding for type t, building it on first use.
+func bind(t reflect.Type) *binding {
+	if b, ok := bindings.Load(t); ok {
+		return b.(*binding)
+	}
+	b := &binding{
+		name:    typename(t),
+		methods: make(map[string]Gofunction),
+		fields:  make(map[string]field),
+		meta:    make(map[string]Gofunction),
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		b.methods[m.Name] = wrap(m.Func, t)
+	}
+	for _, mm := range metamethods {
+		m, ok := t.MethodByName(mm.method)
+		// Func includes the receiver among the parameters.
+		if !ok || m.Type.NumIn() != mm.nin+1 || m.Type.NumOut() != 1 {
+			continue
+		}
+		if mm.out != reflect.Invalid && m.Type.Out(0).Kind() != mm.out {
+			continue
+		}
+		b.meta[mm.event] = b.methods[mm.method]
+	}
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	if st.Kind() == reflect.Struct {
+		for _, f := range fields(st) {
+			b.fields[f.name] = f
+		}
+	}
+
+	b.index = func(s *State) int {
+		if !s.Isstring(2) {
+			s.Pushnil()
+			return 1
+		}
+		key := s.Tostring(2)
+		s.Getfield(Upvalueindex(1), key)
+		if !s.Isnil(-1) {
+			return 1 // a method
+		}
+		s.Pop(1)
+		f, ok := b.fields[key]
+		obj, isobj := s.toobject(1)
+		if !ok || !isobj {
+			s.Pushnil()
+			return 1
+		}
+		fv := fieldbyindex(reflect.Indirect(reflect.ValueOf(obj)), f.index)
+		if !fv.IsValid() {
+			s.Pushnil()
+			return 1
+		}
+		if err := s.push(fv, 0); err != nil {
+			return s.Errorf("field %s: %s", key, err.Error())
+		}
+		return 1
+	}
+
+	b.newindex = func(s *State) int {
+		if !s.Isstring(2) {
+			return s.Errorf("cannot set %s key of %s", s.Typename(s.Type(2)), t)
+		}
+		key := s.Tostring(2)
+		f, ok := b.fields[key]
+		obj, isobj := s.toobject(1)
+		if !ok || !isobj || reflect.TypeOf(obj).Kind() != reflect.Ptr {
+			return s.Errorf("cannot set field %s of %s", key, t)
+		}
+		fv, err := allocfield(reflect.ValueOf(obj).Elem(), f.index)
+		if err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		// Assign through a fresh value so that a failed conversion leaves
+		// the field untouched, and nil sets the zero value.
+		nv := reflect.New(fv.Type()).Elem()
+		if err := s.unmarshal(3, nv, "field "+key, 0); err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		fv.Set(nv)
+		return 0
+	}
+
+	actual, _ := bindings.LoadOrStore(t, b)
+	return actual.(*binding)
+}
@@ -0,0 +1,120 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+type testcounter struct {
+	Name  string `lua:"name"`
+	Count int    `lua:"count"`
+}
+
+func (c *testcounter) Add(n int) int {
+	c.Count += n
+	return c.Count
+}
+
+func (c testcounter) Describe(prefix string) string {
+	return fmt.Sprintf("%s%s=%d", prefix, c.Name, c.Count)
+}
+
+func TestPushobject(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	c := &testcounter{Name: "hits"}
+	if err := s.Pushobject(c); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("counter")
+	if err := s.Loadstring(`
+		assert(counter:Add(2) == 2)
+		assert(counter:Add(3) == 5)
+		assert(counter.count == 5)
+		assert(counter.name == "hits")
+		assert(counter:Describe("> ") == "> hits=5")
+		counter.name = "misses"
+		assert(not pcall(function() counter.nosuch = 1 end))
+		assert(not pcall(function() counter.count = "x" end))
+		assert(counter.nosuch == nil)
+		assert(counter.Add == counter.Add)
+		return counter
+	`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if c.Count != 5 || c.Name != "misses" {
+		t.Errorf("unexpected counter %+v", *c)
+	}
+	v, err := s.Tovalue(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != c {
+		t.Errorf("expected the pushed object back, got %v", v)
+	}
+	s.Pop(1)
+
+	if err := s.Pushobject(testcounter{Name: "copy"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("copy")
+	if err := s.Loadstring(`assert(copy:Add(1) == 1)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
+
+type testvec struct{ X, Y float64 }
+
+func (v testvec) String() string            { return fmt.Sprintf("(%g, %g)", v.X, v.Y) }
+func (v testvec) Len() int                  { return 2 }
+func (v testvec) Equal(o testvec) bool      { return v == o }
+func (v testvec) Add(o testvec) testvec     { return testvec{v.X + o.X, v.Y + o.Y} }
+func (v testvec) Mul(k float64) testvec     { return testvec{v.X * k, v.Y * k} }
+func (v testvec) Neg() testvec              { return testvec{-v.X, -v.Y} }
+func (v testvec) Less(o testvec) bool       { return v.X < o.X }
+func (v *testvec) Scale(k float64) *testvec { v.X *= k; v.Y *= k; return v }
+
+func TestMetamethods(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Pushobject(testvec{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("a")
+	if err := s.Pushobject(testvec{3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("b")
+	if err := s.Loadstring(`
+		assert(tostring(a) == "(1, 2)")
+		assert(#a == 2)
+		local c = a + b
+		assert(tostring(c) == "(4, 6)")
+		assert(c == b + a)
+		assert(c ~= a)
+		assert(tostring(a * 2) == "(2, 4)")
+		assert(tostring(-a) == "(-1, -2)")
+		assert(a < b)
+		assert(tostring(a:Scale(10)) == "(10, 20)")
+	`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+}
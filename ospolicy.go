@@ -0,0 +1,98 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// An Osop is an operation of the os library subject to an Ospolicy.
+type Osop struct {
+	Name string   // "execute", "remove", "rename", or "getenv"
+	Args []string // the command, the file name, the old and new names, or the variable name
+}
+
+// An Ospolicy decides on an os library operation before it runs. It allows
+// the operation by returning nil, after rewriting op.Args if it wants to,
+// such as to confine file names to a directory; it denies the operation
+// by returning an error, whose message the Lua function returns after nil.
+type Ospolicy func(op *Osop) error
+
+var errdenied = errors.New("permission denied")
+
+// Denies every operation. This is the policy of Setospolicy(nil).
+func Denyall(op *Osop) error {
+	return errdenied
+}
+
+// The number of string arguments of each operation under a policy.
+var osopargs = map[string]int{
+	"execute": 1,
+	"remove":  1,
+	"rename":  2,
+	"getenv":  1,
+}
+
+// Routes os.execute, os.remove, os.rename, and os.getenv through policy,
+// or through Denyall if policy is nil, and runs the original functions
+// with the arguments the policy allows. The os library must be open. A
+// call without its arguments, such as os.execute() asking whether a shell
+// is available, is seen by the policy with empty Args.
+//
+// Setting another policy wraps the functions again, so that an operation
+// must pass both policies, the newest first.
+func (s *State) Setospolicy(policy Ospolicy) error {
+	defer s.balanced("Setospolicy", 0)()
+	if policy == nil {
+		policy = Denyall
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.Getglobal(OSlibname)
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return errors.New("os library not open")
+	}
+	for name, nargs := range osopargs {
+		s.Getfield(-1, name)
+		if !s.Isfunction(-1) {
+			s.Pop(1)
+			continue
+		}
+		s.Pushclosure(policed(name, nargs, policy), 1)
+		s.Setfield(-2, name)
+	}
+	s.Pop(1)
+	return nil
+}
+
+// Returns the replacement for the os function name, which is upvalue 1.
+func policed(name string, nargs int, policy Ospolicy) Gofunction {
+	return func(s *State) int {
+		op := &Osop{Name: name}
+		for i := 1; i <= nargs && !s.Isnoneornil(i); i++ {
+			if !s.Isstring(i) {
+				return s.Errorf("bad argument #%d to '%s' (string expected, got %s)", i, name, s.Typename(s.Type(i)))
+			}
+			op.Args = append(op.Args, s.Tostring(i))
+		}
+		if err := policy(op); err != nil {
+			s.Pushnil()
+			if len(op.Args) > 0 {
+				s.Pushstring(fmt.Sprintf("%s: %v", op.Args[0], err))
+			} else {
+				s.Pushstring(err.Error())
+			}
+			return 2
+		}
+		s.Settop(0)
+		s.Pushvalue(Upvalueindex(1))
+		for _, arg := range op.Args {
+			s.Pushstring(arg)
+		}
+		if err := s.Pcall(len(op.Args), Multret, 0); err != nil {
+			return errorreturn // raise the message on top
+		}
+		return s.Gettop()
+	}
+}
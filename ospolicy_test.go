@@ -0,0 +1,56 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSetospolicy(t *testing.T) {
+	t.Setenv("LUAJIT_POLICY_TEST", "rewritten")
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	var seen []string
+	err := s.Setospolicy(func(op *Osop) error {
+		seen = append(seen, fmt.Sprint(op.Name, op.Args))
+		switch op.Name {
+		case "getenv":
+			op.Args[0] = "LUAJIT_POLICY_TEST"
+			return nil
+		case "remove":
+			return errors.New("read-only")
+		}
+		return errdenied
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Loadstring(`return os.getenv("HOME"), select(2, os.remove("/etc/passwd")), os.execute("true")`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[rewritten /etc/passwd: read-only <nil> true: permission denied]" {
+		t.Errorf("unexpected results %v", v)
+	}
+	if fmt.Sprint(seen) != "[getenv [HOME] remove [/etc/passwd] execute [true]]" {
+		t.Errorf("unexpected operations %v", seen)
+	}
+
+	if err := s.Setospolicy(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Loadstring(`return os.getenv("LUAJIT_POLICY_TEST")`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if v, err := s.Pcallmulti(0); err != nil || v[0] != nil {
+		t.Errorf("expected getenv to be denied, got %v %v", v, err)
+	}
+}
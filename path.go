@@ -0,0 +1,96 @@
+package luajit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pushes onto the stack the value of the global variable or field named
+// by the dotted path, such as "config.server.port" for
+// config.server.port. Equivalent to Getfieldpath(Globalsindex, path).
+func (s *State) Getpath(path string) error {
+	return s.Getfieldpath(Globalsindex, path)
+}
+
+// Pops a value from the stack and assigns it to the global variable or
+// field named by the dotted path, creating missing tables along the way.
+// Equivalent to Setfieldpath(Globalsindex, path).
+func (s *State) Setpath(path string) error {
+	return s.Setfieldpath(Globalsindex, path)
+}
+
+// Pushes onto the stack the value t.a.b.c for the path "a.b.c", where t is
+// the value at the given valid index, which may be a pseudo-index. If a
+// table along the path is missing, pushes nil. Returns an error, and
+// pushes nothing, if a value along the path is neither nil nor a table.
+// As in Lua, the lookups may trigger metamethods for the "index" event.
+func (s *State) Getfieldpath(index int, path string) error {
+	// Only a lookup that succeeds pushes its result.
+	pushed, failed := s.balanced("Getfieldpath", 1), s.balanced("Getfieldpath", 0)
+	if err := s.grow(2); err != nil {
+		failed()
+		return err
+	}
+	s.Pushvalue(index)
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		if s.Isnil(-1) {
+			break
+		}
+		if !s.Istable(-1) {
+			err := s.notable(names[:i])
+			s.Pop(1)
+			failed()
+			return err
+		}
+		s.Getfield(-1, name)
+		s.Remove(-2)
+	}
+	pushed()
+	return nil
+}
+
+// Pops a value from the stack and assigns it to t.a.b.c for the path
+// "a.b.c", where t is the value at the given valid index, which may be a
+// pseudo-index. Missing tables along the path are created. Returns an
+// error, and still pops the value, if a value along the path is neither
+// nil nor a table. As in Lua, the lookups and the assignment may trigger
+// metamethods.
+func (s *State) Setfieldpath(index int, path string) error {
+	defer s.balanced("Setfieldpath", -1)()
+	index = s.absindex(index)
+	if err := s.grow(3); err != nil {
+		s.Pop(1)
+		return err
+	}
+	s.Pushvalue(index)
+	names := strings.Split(path, ".")
+	last := len(names) - 1
+	for i, name := range names[:last] {
+		s.Getfield(-1, name)
+		if s.Isnil(-1) {
+			s.Pop(1)
+			s.Newtable()
+			s.Pushvalue(-1)
+			s.Setfield(-3, name)
+		} else if !s.Istable(-1) {
+			err := s.notable(names[:i+1])
+			s.Pop(3)
+			return err
+		}
+		s.Remove(-2)
+	}
+	s.Insert(-2)
+	s.Setfield(-2, names[last])
+	s.Pop(1)
+	return nil
+}
+
+// Returns the error for the value on top of the stack, found at the given
+// path, not being a table.
+func (s *State) notable(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("cannot index a %s value", s.Typename(s.Type(-1)))
+	}
+	return fmt.Errorf("%s is a %s, not a table", strings.Join(names, "."), s.Typename(s.Type(-1)))
+}
@@ -0,0 +1,54 @@
+package luajit
+
+import "testing"
+
+func TestPath(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	s.Pushnumber(8080)
+	if err := s.Setpath("config.server.port"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Getpath("config.server.port"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tointeger(-1) != 8080 {
+		t.Errorf("expected 8080, got %s", s.Tostring(-1))
+	}
+	s.Pop(1)
+	if err := s.Getpath("config.client.port"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Isnil(-1) {
+		t.Errorf("expected nil, got %s", s.Typename(s.Type(-1)))
+	}
+	s.Pop(1)
+
+	if err := s.Getpath("config.server.port.x"); err == nil {
+		t.Error("expected error for indexing a number")
+	}
+	s.Pushboolean(true)
+	if err := s.Setpath("config.server.port.x"); err == nil {
+		t.Error("expected error for indexing a number")
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+
+	s.Newtable()
+	s.Pushstring("v")
+	if err := s.Setfieldpath(-2, "a.b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Getfieldpath(-1, "a.b"); err != nil {
+		t.Fatal(err)
+	}
+	if s.Tostring(-1) != "v" {
+		t.Errorf("expected v, got %s", s.Tostring(-1))
+	}
+	s.Pop(2)
+}
@@ -0,0 +1,352 @@
+// Package pb converts protobuf messages to and from Lua tables, using the
+// reflection interface of google.golang.org/protobuf, so that scripts can
+// inspect and construct payloads of any message type known only by its
+// descriptor, as in gRPC middleware:
+//
+//	if err := pb.Push(s, req.ProtoReflect()); err != nil {
+//		return err
+//	}
+//	// call a Lua function with the table, which returns a new one
+//	m, err := pb.To(s, -1, req.ProtoReflect().Descriptor())
+//
+// Fields are keyed by their names in the proto file. Scalars become
+// numbers, strings, and booleans, with 64-bit integers exact only up to
+// 2^53; bytes become strings, enums the names of their values, messages
+// tables, repeated fields arrays, and map fields tables.
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/serialx/luajit"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Maximum nesting of tables converted by To, which also stops tables that
+// refer to themselves.
+const maxnesting = 100
+
+var errnesting = errors.New("tables nested too deeply")
+
+// Makes the module "pb" available to require, with message types looked up
+// by their full names in files, or protoregistry.GlobalFiles if files is
+// nil:
+//
+//	pb.decode(name, data)	returns the message in the wire format data as a table
+//	pb.encode(name, t)	returns the table t as a message in the wire format
+//
+// The package library must be open.
+func Open(s *luajit.State, files *protoregistry.Files) error {
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+	find := func(s *luajit.State) (protoreflect.MessageDescriptor, error) {
+		if !s.Isstring(1) {
+			return nil, fmt.Errorf("bad argument #1 (string expected, got %s)", s.Typename(s.Type(1)))
+		}
+		d, err := files.FindDescriptorByName(protoreflect.FullName(s.Tostring(1)))
+		if err != nil {
+			return nil, err
+		}
+		md, ok := d.(protoreflect.MessageDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a message", d.FullName())
+		}
+		return md, nil
+	}
+	return s.Preloadfuncs("pb", map[string]luajit.Gofunction{
+		"decode": func(s *luajit.State) int {
+			md, err := find(s)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			if !s.Isstring(2) {
+				return s.Errorf("bad argument #2 to 'decode' (string expected, got %s)", s.Typename(s.Type(2)))
+			}
+			m := dynamicpb.NewMessage(md)
+			if err := proto.Unmarshal(s.Tobytes(2), m); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			if err := Push(s, m); err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			return 1
+		},
+		"encode": func(s *luajit.State) int {
+			md, err := find(s)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			m, err := To(s, 2, md)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			b, err := proto.Marshal(m)
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			s.Pushbytes(b)
+			return 1
+		},
+	})
+}
+
+// Pushes a table holding the populated fields of m onto the stack. On
+// error, nothing is pushed.
+func Push(s *luajit.State, m protoreflect.Message) error {
+	top := s.Gettop()
+	if err := pushmessage(s, m); err != nil {
+		s.Settop(top)
+		return err
+	}
+	return nil
+}
+
+func pushmessage(s *luajit.State, m protoreflect.Message) error {
+	if !s.Checkstack(4) {
+		return errors.New("stack overflow")
+	}
+	s.Createtable(0, 0)
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			l := v.List()
+			s.Createtable(l.Len(), 0)
+			for i := 0; i < l.Len() && err == nil; i++ {
+				if err = pushvalue(s, fd, l.Get(i)); err == nil {
+					s.Rawseti(-2, i+1)
+				}
+			}
+		case fd.IsMap():
+			s.Createtable(0, v.Map().Len())
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				if err = pushvalue(s, fd.MapKey(), k.Value()); err == nil {
+					if err = pushvalue(s, fd.MapValue(), v); err == nil {
+						s.Rawset(-3)
+					}
+				}
+				return err == nil
+			})
+		default:
+			err = pushvalue(s, fd, v)
+		}
+		if err == nil {
+			s.Setfield(-2, string(fd.Name()))
+		}
+		return err == nil
+	})
+	return err
+}
+
+// Pushes a single value of the kind of fd, an element if fd is repeated.
+func pushvalue(s *luajit.State, fd protoreflect.FieldDescriptor, v protoreflect.Value) error {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		s.Pushboolean(v.Bool())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		s.Pushnumber(float64(v.Int()))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		s.Pushnumber(float64(v.Uint()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		s.Pushnumber(v.Float())
+	case protoreflect.StringKind:
+		s.Pushstring(v.String())
+	case protoreflect.BytesKind:
+		s.Pushbytes(v.Bytes())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			s.Pushstring(string(ev.Name()))
+		} else {
+			s.Pushnumber(float64(v.Enum()))
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return pushmessage(s, v.Message())
+	default:
+		return fmt.Errorf("field %s: unsupported kind %s", fd.FullName(), fd.Kind())
+	}
+	return nil
+}
+
+// Converts the table at the given valid index to a message of the type
+// described by md. Fields may be keyed by their names in the proto file or
+// in JSON; enums may be given by the names or the numbers of their values,
+// and nil fields are left unset. Returns an error for unknown fields and
+// values of the wrong type or out of range, naming the field.
+func To(s *luajit.State, index int, md protoreflect.MessageDescriptor) (*dynamicpb.Message, error) {
+	m := dynamicpb.NewMessage(md)
+	if err := tomessage(s, index, m, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func tomessage(s *luajit.State, index int, m protoreflect.Message, depth int) error {
+	if !s.Istable(index) {
+		return fmt.Errorf("table expected, got %s", s.Typename(s.Type(index)))
+	}
+	if depth >= maxnesting {
+		return errnesting
+	}
+	md := m.Descriptor()
+	for k, v := range s.Pairs(index) {
+		if s.Type(k) != luajit.Tstring {
+			return fmt.Errorf("%s: field name expected, got %s", md.FullName(), s.Typename(s.Type(k)))
+		}
+		name := s.Tostring(k)
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return fmt.Errorf("%s: unknown field %q", md.FullName(), name)
+		}
+		if err := tofield(s, v, m, fd, depth); err != nil {
+			return fmt.Errorf("field %s: %w", fd.FullName(), err)
+		}
+	}
+	return nil
+}
+
+func tofield(s *luajit.State, index int, m protoreflect.Message, fd protoreflect.FieldDescriptor, depth int) error {
+	switch {
+	case s.Isnil(index):
+		return nil
+	case fd.IsList():
+		if !s.Istable(index) {
+			return fmt.Errorf("table expected, got %s", s.Typename(s.Type(index)))
+		}
+		l := m.NewField(fd).List()
+		n := s.Tablecount(index)
+		if s.Arraylen(index) != n {
+			return errors.New("array expected")
+		}
+		for i := 1; i <= n; i++ {
+			s.Rawgeti(index, i)
+			var elem protoreflect.Value
+			if fd.Message() != nil {
+				elem = l.NewElement()
+			}
+			elem, err := tovalue(s, s.Gettop(), fd, elem, depth)
+			s.Pop(1)
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+			l.Append(elem)
+		}
+		m.Set(fd, protoreflect.ValueOfList(l))
+	case fd.IsMap():
+		if !s.Istable(index) {
+			return fmt.Errorf("table expected, got %s", s.Typename(s.Type(index)))
+		}
+		mp := m.NewField(fd).Map()
+		for k, v := range s.Pairs(index) {
+			key, err := tovalue(s, k, fd.MapKey(), protoreflect.Value{}, depth)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", s.Keystring(k), err)
+			}
+			var val protoreflect.Value
+			if fd.MapValue().Message() != nil {
+				val = mp.NewValue()
+			}
+			if val, err = tovalue(s, v, fd.MapValue(), val, depth); err != nil {
+				return fmt.Errorf("key %s: %w", s.Keystring(k), err)
+			}
+			mp.Set(key.MapKey(), val)
+		}
+		m.Set(fd, protoreflect.ValueOfMap(mp))
+	default:
+		var v protoreflect.Value
+		if fd.Message() != nil {
+			v = m.NewField(fd)
+		}
+		v, err := tovalue(s, index, fd, v, depth)
+		if err != nil {
+			return err
+		}
+		m.Set(fd, v)
+	}
+	return nil
+}
+
+// Converts the value at the given valid index to a single value of the
+// kind of fd. For messages, v must hold a new message to fill in.
+func tovalue(s *luajit.State, index int, fd protoreflect.FieldDescriptor, v protoreflect.Value, depth int) (protoreflect.Value, error) {
+	tp := s.Type(index)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if tp == luajit.Tboolean {
+			return protoreflect.ValueOfBool(s.Toboolean(index)), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if tp == luajit.Tnumber {
+			n, err := tointeger(s.Tonumber(index), math.MinInt32, 1<<31)
+			return protoreflect.ValueOfInt32(int32(n)), err
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if tp == luajit.Tnumber {
+			n, err := tointeger(s.Tonumber(index), math.MinInt64, 1<<63)
+			return protoreflect.ValueOfInt64(int64(n)), err
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if tp == luajit.Tnumber {
+			n, err := tointeger(s.Tonumber(index), 0, 1<<32)
+			return protoreflect.ValueOfUint32(uint32(n)), err
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if tp == luajit.Tnumber {
+			n, err := tointeger(s.Tonumber(index), 0, 1<<64)
+			return protoreflect.ValueOfUint64(uint64(n)), err
+		}
+	case protoreflect.FloatKind:
+		if tp == luajit.Tnumber {
+			return protoreflect.ValueOfFloat32(float32(s.Tonumber(index))), nil
+		}
+	case protoreflect.DoubleKind:
+		if tp == luajit.Tnumber {
+			return protoreflect.ValueOfFloat64(s.Tonumber(index)), nil
+		}
+	case protoreflect.StringKind:
+		if tp == luajit.Tstring {
+			return protoreflect.ValueOfString(s.Tostring(index)), nil
+		}
+	case protoreflect.BytesKind:
+		if tp == luajit.Tstring {
+			return protoreflect.ValueOfBytes(append([]byte(nil), s.Tobytes(index)...)), nil
+		}
+	case protoreflect.EnumKind:
+		switch tp {
+		case luajit.Tstring:
+			ev := fd.Enum().Values().ByName(protoreflect.Name(s.Tostring(index)))
+			if ev == nil {
+				return protoreflect.Value{}, fmt.Errorf("unknown value %q of %s", s.Tostring(index), fd.Enum().FullName())
+			}
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		case luajit.Tnumber:
+			n, err := tointeger(s.Tonumber(index), math.MinInt32, 1<<31)
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v, tomessage(s, index, v.Message(), depth+1)
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+	}
+	return protoreflect.Value{}, fmt.Errorf("%s expected, got %s", fd.Kind(), s.Typename(tp))
+}
+
+// Returns f if it is an integer at least min and below limit.
+func tointeger(f, min, limit float64) (float64, error) {
+	if f != math.Trunc(f) {
+		return 0, fmt.Errorf("number has no integer representation: %g", f)
+	}
+	if f < min || f >= limit {
+		return 0, fmt.Errorf("number out of range: %g", f)
+	}
+	return f, nil
+}
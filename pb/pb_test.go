@@ -0,0 +1,159 @@
+package pb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/serialx/luajit"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestPush(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	f := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("a.proto"),
+		Dependency: []string{"b.proto", "c.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("M"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("n"),
+				Number: proto.Int32(1),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+			}},
+		}},
+	}
+	if err := Push(s, f.ProtoReflect()); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("f")
+	err := s.Loadstring(`local m = f.message_type[1]
+		return f.name, table.concat(f.dependency, " "), m.name, m.field[1].type, m.field[1].number, f.package`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[a.proto b.proto c.proto M TYPE_INT64 1 <nil>]" {
+		t.Errorf("unexpected values %v", v)
+	}
+}
+
+func TestTo(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`return {
+		name = "a.proto",
+		dependency = {"b.proto"},
+		messageType = {{name = "M", field = {{name = "n", number = 1, type = "TYPE_INT64"}}}},
+	}`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	m, err := To(s, -1, (&descriptorpb.FileDescriptorProto{}).ProtoReflect().Descriptor())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f descriptorpb.FileDescriptorProto
+	b, err := proto.Marshal(m)
+	if err == nil {
+		err = proto.Unmarshal(b, &f)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("a.proto"),
+		Dependency: []string{"b.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("M"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:   proto.String("n"),
+				Number: proto.Int32(1),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+			}},
+		}},
+	}
+	if !proto.Equal(&f, want) {
+		t.Errorf("expected %v, got %v", want, &f)
+	}
+
+	md := want.ProtoReflect().Descriptor()
+	for _, bad := range []string{
+		`return {nam = "x"}`,
+		`return {name = 1}`,
+		`return {message_type = {{field = {{number = 1.5}}}}}`,
+		`return {message_type = {{field = {{type = "TYPE_NONE"}}}}}`,
+		`return {dependency = {[2] = "x"}}`,
+	} {
+		if err := s.Loadstring(bad); err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		if err := s.Pcall(0, 1, 0); err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		if _, err := To(s, -1, md); err == nil {
+			t.Errorf("expected an error converting %s", bad)
+		}
+		s.Pop(1)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := Open(s, nil); err != nil {
+		t.Fatal(err)
+	}
+	st, err := structpb.NewStruct(map[string]interface{}{"a": 1.5, "b": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Pushbytes(b)
+	s.Setglobal("data")
+	err = s.Loadstring(`local pb = require("pb")
+		local st = pb.decode("google.protobuf.Struct", data)
+		st.fields.c = {bool_value = true}
+		return pb.encode("google.protobuf.Struct", st), st.fields.a.number_value, st.fields.b.string_value,
+			(pcall(pb.decode, "google.protobuf.Nothing", data))`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v[1:]) != "[1.5 x false]" {
+		t.Errorf("unexpected values %v", v)
+	}
+	var got structpb.Struct
+	if err := proto.Unmarshal([]byte(fmt.Sprint(v[0])), &got); err != nil {
+		t.Fatal(err)
+	}
+	if m := got.AsMap(); len(m) != 3 || m["c"] != true {
+		t.Errorf("unexpected struct %v", m)
+	}
+}
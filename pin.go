@@ -0,0 +1,53 @@
+package luajit
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// A Bufferpin keeps a byte slice passed to Lua by Pushpinned in place, so
+// that the pointer Lua holds stays valid until Unpin is called.
+type Bufferpin struct {
+	pinner runtime.Pinner
+}
+
+// Pushes a cdata of type "uint8_t *" pointing to the first byte of b, for
+// Lua code to read and write b in place through the FFI, as in
+//
+//	local p, n = ...
+//	for i = 0, n - 1 do p[i] = 255 - p[i] end
+//
+// Lua code sees the changes Go makes to b and the other way around, with
+// nothing copied. The Go runtime keeps b where it is until Unpin is called
+// on the returned pin; after that, Lua code must not use the pointer, so
+// the usual way is to unpin once the script using b has returned:
+//
+//	pin, err := s.Pushpinned(frame)
+//	...
+//	defer pin.Unpin()
+//
+// Indexing the pointer is not bounds-checked; the script must keep within
+// len(b), which Pushpinned does not push. The ffi library must be loaded.
+func (s *State) Pushpinned(b []byte) (*Bufferpin, error) {
+	if len(b) == 0 {
+		return nil, errors.New("cannot pin an empty buffer")
+	}
+	if err := s.grow(3); err != nil {
+		return nil, err
+	}
+	pin := &Bufferpin{}
+	pin.pinner.Pin(&b[0])
+	s.Pushlightuserdata(unsafe.Pointer(&b[0]))
+	if err := s.callcdata("pointer", 1, 1); err != nil {
+		pin.Unpin()
+		return nil, err
+	}
+	return pin, nil
+}
+
+// Releases the buffer, which the garbage collector may then move or free.
+// Calling Unpin again has no effect.
+func (p *Bufferpin) Unpin() {
+	p.pinner.Unpin()
+}
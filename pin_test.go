@@ -0,0 +1,46 @@
+package luajit
+
+import "testing"
+
+func TestPushpinned(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	err := s.Loadstring(`
+		local p, n = ...
+		local sum = 0
+		for i = 0, n - 1 do
+			sum = sum + p[i]
+			p[i] = 255 - p[i]
+		end
+		return sum
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	b := []byte{0, 1, 2, 3}
+	pin, err := s.Pushpinned(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pin.Unpin()
+	s.Pushinteger(len(b))
+	if err := s.Pcall(2, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 6 {
+		t.Errorf("expected sum 6, got %d", n)
+	}
+	s.Pop(1)
+	if string(b) != "\xff\xfe\xfd\xfc" {
+		t.Errorf("expected bytes changed in place, got %v", b)
+	}
+
+	if _, err := s.Pushpinned(nil); err == nil {
+		t.Error("expected error pinning an empty buffer")
+	}
+}
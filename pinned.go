@@ -0,0 +1,56 @@
+package luajit
+
+import "context"
+
+// A Pinnedstate is a state that runs all its work on a single goroutine
+// locked to an OS thread, whichever goroutine the work comes from. LuaJIT
+// can be sensitive to switching OS threads under a running state, for
+// instance with C modules that keep thread-local data, and Go may move a
+// goroutine between threads at any time; a Pinnedstate rules that out.
+//
+// The methods of a Pinnedstate hand the work to the state's goroutine
+// and wait for it, so calls from several goroutines are serialized as
+// well. A function run by Do must not call methods of the same
+// Pinnedstate, which would deadlock.
+type Pinnedstate struct {
+	e *Executor
+}
+
+// Creates a new state on its own locked goroutine. If setup is not nil,
+// it is run on the new state first, and its error returned.
+func Newpinnedstate(setup func(s *State) error) (*Pinnedstate, error) {
+	e, err := Newexecutor(1, setup)
+	if err != nil {
+		return nil, err
+	}
+	return &Pinnedstate{e}, nil
+}
+
+// Calls fn with the state on the state's goroutine. fn must not keep the
+// state after it returns. The stack is emptied after fn returns.
+func (ps *Pinnedstate) Do(fn func(s *State) error) error {
+	return ps.e.Do(context.Background(), fn)
+}
+
+// Runs the Lua chunk src with args on the state's goroutine, and returns
+// its results. Arguments, results and errors are as for Executor.Submit.
+func (ps *Pinnedstate) Dostring(src string, args ...interface{}) ([]interface{}, error) {
+	return ps.e.Submit(context.Background(), src, args...)
+}
+
+// Calls Callglobal on the state's goroutine.
+func (ps *Pinnedstate) Callglobal(name string, args ...interface{}) ([]interface{}, error) {
+	var results []interface{}
+	err := ps.Do(func(s *State) error {
+		var err error
+		results, err = s.Callglobal(name, args...)
+		return err
+	})
+	return results, err
+}
+
+// Closes the state once the work already handed to it is done. Later
+// calls return an error.
+func (ps *Pinnedstate) Close() {
+	ps.e.Close()
+}
@@ -0,0 +1,47 @@
+package luajit
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestPinnedstate(t *testing.T) {
+	ps, err := Newpinnedstate(func(s *State) error {
+		s.Openlibs()
+		return s.Setglobals(map[string]interface{}{"n": 0})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ps.Dostring(`n = n + 1`); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	r, err := ps.Callglobal("tostring", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0] != "1" {
+		t.Errorf("expected [1], got %v", r)
+	}
+	r, err = ps.Dostring(`return n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0] != 20.0 {
+		t.Errorf("expected [20], got %v", r)
+	}
+
+	ps.Close()
+	if _, err := ps.Dostring(`return 1`); err == nil {
+		t.Error("expected error from a closed state")
+	}
+}
@@ -0,0 +1,189 @@
+package luajit
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Registry field holding the globals of a pooled state as they were after
+// setup.
+const poolglobals = "luajit.pool.globals"
+
+var errpoolclosed = errors.New("pool closed")
+
+// A Pool holds a fixed number of states initialized the same way, for
+// servers that run scripts on behalf of concurrent requests. Each state is
+// used by one goroutine at a time: Get hands it out and Put returns it,
+// after restoring its global variables to what they were after setup.
+//
+// The restore is shallow: globals added by a script are removed and
+// reassigned globals get their values back, but changes made inside
+// tables, such as string.foo = nil, persist. Scripts that may do that
+// should get frozen tables (see Freeze) or a Check function that detects
+// it.
+type Pool struct {
+	setup func(s *State) error
+	idle  chan *State
+
+	// If not nil, Check is called by Put on each state returned to the
+	// pool. A state for which it returns false is closed and replaced by
+	// a new one.
+	Check func(s *State) bool
+
+	mu        sync.Mutex
+	closed    bool
+	created   int
+	discarded int
+}
+
+// Statistics about a Pool, as returned by its Stats method.
+type Poolstats struct {
+	Size      int // number of states, whether idle or in use
+	Idle      int // number of states waiting in the pool
+	Created   int // states created since the pool was
+	Discarded int // states closed because they were unhealthy
+}
+
+// Creates a pool of size states, each initialized by a call to setup on a
+// new state, such as one that opens the libraries and loads the
+// application's scripts; setup may be nil. Returns the first error from
+// setup, if any.
+func Newpool(size int, setup func(s *State) error) (*Pool, error) {
+	if size < 1 {
+		return nil, errors.New("pool size must be positive")
+	}
+	p := &Pool{setup: setup, idle: make(chan *State, size)}
+	for i := 0; i < size; i++ {
+		s, err := p.newstate()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle <- s
+	}
+	return p, nil
+}
+
+// Returns a new state initialized by setup, with a snapshot of its
+// globals.
+func (p *Pool) newstate() (*State, error) {
+	s := Newstate()
+	if s == nil {
+		return nil, errors.New("cannot create state: not enough memory")
+	}
+	if p.setup != nil {
+		if err := p.setup(s); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	s.Settop(0)
+	s.Newtable()
+	s.Pushnil()
+	for s.Next(Globalsindex) != 0 {
+		s.Pushvalue(-2)
+		s.Insert(-2)
+		s.Rawset(-4)
+	}
+	s.Setfield(Registryindex, poolglobals)
+	p.mu.Lock()
+	p.created++
+	p.mu.Unlock()
+	return s, nil
+}
+
+// Takes a state from the pool, waiting until one is available, the pool
+// is closed, or ctx is done. The state must be returned with Put.
+func (p *Pool) Get(ctx context.Context) (*State, error) {
+	select {
+	case s, ok := <-p.idle:
+		if !ok {
+			return nil, errpoolclosed
+		}
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Returns a state taken with Get to the pool, after clearing its stack
+// and restoring its globals. If the state fails Check, it is replaced by
+// a new one. If the pool is closed, the state is closed instead.
+func (p *Pool) Put(s *State) {
+	s.Settop(0)
+	healthy := p.Check == nil || p.Check(s)
+	if healthy {
+		healthy = reset(s)
+	}
+	if !healthy {
+		s.Close()
+		p.mu.Lock()
+		p.discarded++
+		p.mu.Unlock()
+		var err error
+		if s, err = p.newstate(); err != nil {
+			// Setup worked before, so this is unlikely; the pool shrinks.
+			return
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		s.Close()
+		return
+	}
+	p.idle <- s
+}
+
+// Restores the globals of a pooled state from the snapshot taken after
+// setup, and reports whether it could.
+func reset(s *State) bool {
+	s.Getfield(Registryindex, poolglobals)
+	if !s.Istable(-1) {
+		s.Pop(1)
+		return false
+	}
+	s.Pushnil()
+	for s.Next(Globalsindex) != 0 {
+		s.Pop(1)
+		s.Pushvalue(-1)
+		s.Pushnil()
+		s.Rawset(Globalsindex)
+	}
+	s.Pushnil()
+	for s.Next(-2) != 0 {
+		s.Pushvalue(-2)
+		s.Insert(-2)
+		s.Rawset(Globalsindex)
+	}
+	s.Pop(1)
+	return true
+}
+
+// Returns statistics about the pool.
+func (p *Pool) Stats() Poolstats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Poolstats{
+		Size:      p.created - p.discarded,
+		Idle:      len(p.idle),
+		Created:   p.created,
+		Discarded: p.discarded,
+	}
+}
+
+// Closes the idle states and makes Get fail from then on. States in use
+// are closed when they are returned with Put.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.idle)
+	for s := range p.idle {
+		s.Close()
+	}
+}
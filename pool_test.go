@@ -0,0 +1,86 @@
+package luajit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p, err := Newpool(2, func(s *State) error {
+		s.Openlibs()
+		if err := s.Loadstring(`greeting = "hello"`); err != nil {
+			return err
+		}
+		return s.Pcall(0, 0, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Check = func(s *State) bool {
+		s.Getglobal("poison")
+		defer s.Pop(1)
+		return s.Isnil(-1)
+	}
+	ctx := context.Background()
+
+	s, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Loadstring(`greeting = "changed"; extra = 1`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	s2, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(timeout); err == nil {
+		t.Error("expected Get to time out on an empty pool")
+	}
+	p.Put(s)
+	s2.Pushboolean(true)
+	s2.Setglobal("poison")
+	p.Put(s2)
+
+	for i := 0; i < 2; i++ {
+		s, err := p.Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Getglobal("greeting")
+		s.Getglobal("extra")
+		if s.Tostring(1) != "hello" || !s.Isnil(2) {
+			t.Errorf("expected hello nil, got %s %s", s.Tostring(1), s.Typename(s.Type(2)))
+		}
+		defer p.Put(s)
+	}
+	if st := p.Stats(); st.Size != 2 || st.Created != 3 || st.Discarded != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+	p.Close()
+	if _, err := p.Get(ctx); err == nil {
+		t.Error("expected error from a closed pool")
+	}
+}
+
+func TestPoolnosetup(t *testing.T) {
+	p, err := Newpool(1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Gettop() != 0 {
+		t.Errorf("expected an empty stack, got %d values", s.Gettop())
+	}
+	p.Put(s)
+}
@@ -0,0 +1,57 @@
+package luajit
+
+// A Preprocessor rewrites the source of a chunk before it is compiled, as
+// set by Setpreprocessor. The name is the chunkname given to the load
+// function, such as "@script.lua" for Loadfile.
+type Preprocessor func(name string, src []byte) ([]byte, error)
+
+// Key of the preprocessor in the Go data of a state.
+type preprocessorkey struct{}
+
+// Sets a preprocessor run on the source of every chunk loaded by Load,
+// Loadstring, Loadbuffer, and Loadfile, and so by the helpers built on
+// them such as Preloadchunk and the searcher of Addsearcher, allowing for
+// includes, templates, or languages compiled to Lua. Binary chunks are
+// compiled as they are. A nil p removes the preprocessor. Chunks loaded by
+// scripts themselves, with loadstring or require, are not preprocessed.
+//
+// Lua reports errors and debug information with the lines of the
+// preprocessed source, so a preprocessor should keep each line of its
+// input on the same line of its output, for instance by putting an
+// included file on a single line or by replacing removed lines with empty
+// ones. If the preprocessor fails, loading fails with a syntax error
+// whose message, left on the stack, is that of its error.
+func (s *State) Setpreprocessor(p Preprocessor) {
+	if p == nil {
+		s.Setdata(preprocessorkey{}, nil)
+	} else {
+		s.Setdata(preprocessorkey{}, p)
+	}
+}
+
+// Reports whether loads go through hookedload, to be preprocessed or to
+// have their sources kept.
+func (s *State) loadhooked() bool {
+	m := s.data(false)
+	return m[preprocessorkey{}] != nil || m[sourceskey{}] != nil
+}
+
+// Loads src, preprocessed unless it is a binary chunk, keeping its source
+// if Keepsources is on.
+func (s *State) hookedload(src []byte, chunkname string) error {
+	if len(src) > 0 && src[0] == 0x1b {
+		return s.loadbuffer(src, chunkname)
+	}
+	s.keepsource(src, chunkname)
+	if p, ok := s.Data(preprocessorkey{}).(Preprocessor); ok {
+		var err error
+		if src, err = p(chunkname, src); err != nil {
+			if err := s.grow(1); err != nil {
+				return err
+			}
+			s.Pushstring(err.Error())
+			return errs[Errsyntax]
+		}
+	}
+	return s.loadbuffer(src, chunkname)
+}
@@ -0,0 +1,72 @@
+package luajit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSetpreprocessor(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	includes := map[string]string{"consts": "local answer = 42 local name = 'x'"}
+	var names []string
+	s.Setpreprocessor(func(name string, src []byte) ([]byte, error) {
+		names = append(names, name)
+		var out bytes.Buffer
+		for i, line := range strings.Split(string(src), "\n") {
+			if i > 0 {
+				out.WriteByte('\n')
+			}
+			if inc, ok := strings.CutPrefix(line, "#include "); ok {
+				text, ok := includes[inc]
+				if !ok {
+					return nil, fmt.Errorf("%s:%d: cannot include '%s'", name, i+1, inc)
+				}
+				line = text
+			}
+			out.WriteString(line)
+		}
+		return out.Bytes(), nil
+	})
+
+	if err := s.Loadbuffer([]byte("#include consts\nreturn answer, name"), "=main"); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[42 x]" {
+		t.Errorf("unexpected results %v", v)
+	}
+
+	err = s.Loadstring("#include consts\n\nerror('here')")
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err == nil || !strings.HasSuffix(s.Tostring(-1), ":3: here") {
+		t.Errorf("expected error on line 3, got %s", s.Tostring(-1))
+	}
+	s.Pop(1)
+
+	err = s.Loadbuffer([]byte("x = 1\n#include missing"), "=main")
+	if !errors.Is(err, errs[Errsyntax]) || s.Tostring(-1) != "=main:2: cannot include 'missing'" {
+		t.Errorf("unexpected error %v: %s", err, s.Tostring(-1))
+	}
+	s.Pop(1)
+
+	s.Setpreprocessor(nil)
+	if err := s.Loadstring("#include consts"); err == nil {
+		t.Error("expected a syntax error without the preprocessor")
+	}
+	if len(names) != 3 || names[0] != "=main" {
+		t.Errorf("unexpected chunk names %q", names)
+	}
+}
@@ -0,0 +1,133 @@
+package luajit
+
+import "fmt"
+
+// A Preset is a curated selection of the standard library, for running
+// code that is not fully trusted without researching which Lua functions
+// are dangerous.
+type Preset int
+
+const (
+	// Everything Openlibs opens.
+	Presetfull Preset = iota
+	// Functions that only compute: the pure parts of the base library,
+	// and the string (except string.dump), table, math, bit, and
+	// coroutine libraries. Scripts cannot load code, touch files, the
+	// process, or the environment, or see anything outside their State.
+	Presetcompute
+	// Presetcompute plus print and the harmless os functions clock, date,
+	// difftime, and time.
+	Presetsafe
+)
+
+func (p Preset) String() string {
+	switch p {
+	case Presetfull:
+		return "full"
+	case Presetcompute:
+		return "compute"
+	case Presetsafe:
+		return "safe"
+	}
+	return fmt.Sprintf("Preset(%d)", int(p))
+}
+
+// The functions kept by Presetcompute, by library; the base library is
+// under "".
+func computelibs() map[string][]string {
+	return map[string][]string{
+		"": {"assert", "error", "getmetatable", "ipairs", "next", "pairs",
+			"pcall", "rawequal", "rawget", "rawset", "select", "setmetatable",
+			"tonumber", "tostring", "type", "unpack", "xpcall", "_G", "_VERSION",
+			namehooks},
+		Strlibname: {"byte", "char", "find", "format", "gmatch", "gsub", "len",
+			"lower", "match", "rep", "reverse", "sub", "upper"},
+		Tablibname: {"concat", "insert", "maxn", "remove", "sort", "pack", "unpack"},
+		Mathlibname: {"abs", "acos", "asin", "atan", "atan2", "ceil", "cos", "cosh",
+			"deg", "exp", "floor", "fmod", "frexp", "huge", "ldexp", "log", "log10",
+			"max", "min", "modf", "pi", "pow", "rad", "random", "randomseed", "sin",
+			"sinh", "sqrt", "tan", "tanh"},
+		"bit": {"arshift", "band", "bnot", "bor", "bswap", "bxor", "lshift",
+			"rol", "ror", "rshift", "tobit", "tohex"},
+		Colibname: {"create", "resume", "running", "status", "wrap", "yield",
+			"isyieldable"},
+	}
+}
+
+// The functions Presetsafe adds to Presetcompute.
+func safelibs() map[string][]string {
+	return map[string][]string{
+		"":        {"print"},
+		OSlibname: {"clock", "date", "difftime", "time"},
+	}
+}
+
+// Opens the standard libraries selected by the preset. The libraries are
+// opened as by Openlibs and then pruned in place, so everything else is
+// removed from the globals and from the library tables, including the
+// string table that strings use for their methods. The searchers for C
+// modules are disabled as well (see Disablecmodules), in case a script
+// is later given require.
+func (s *State) Openpreset(p Preset) error {
+	var keep map[string][]string
+	switch p {
+	case Presetfull:
+		s.Openlibs()
+		return nil
+	case Presetcompute:
+		keep = computelibs()
+	case Presetsafe:
+		keep = computelibs()
+		for lib, names := range safelibs() {
+			keep[lib] = append(keep[lib], names...)
+		}
+	default:
+		return fmt.Errorf("unknown preset %d", int(p))
+	}
+	defer s.balanced("Openpreset", 0)()
+	if err := s.grow(4); err != nil {
+		return err
+	}
+	s.Openlibs()
+	if err := s.Disablecmodules(); err != nil {
+		return err
+	}
+	for lib, names := range keep {
+		if lib == "" {
+			continue
+		}
+		s.Getfield(Globalsindex, lib)
+		if s.Istable(-1) {
+			s.prune(-1, names)
+		}
+		s.Pop(1)
+	}
+	base := keep[""]
+	for lib := range keep {
+		if lib != "" {
+			base = append(base, lib)
+		}
+	}
+	s.prune(Globalsindex, base)
+	return nil
+}
+
+// Removes the string keys of the table at the given valid index that are
+// not in names.
+func (s *State) prune(index int, names []string) {
+	index = s.absindex(index)
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	var drop []string
+	for k := range s.Pairs(index) {
+		if s.Type(k) == Tstring && !allowed[s.Tostring(k)] {
+			drop = append(drop, s.Tostring(k))
+		}
+	}
+	for _, k := range drop {
+		s.Pushnil()
+		s.Setfield(index, k)
+	}
+}
@@ -0,0 +1,48 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestOpenpreset(t *testing.T) {
+	probe := `return type(string.format), type(string.dump), type(("x").rep),
+		type(loadstring), type(require), type(io), type(os and os.time), type(os and os.execute),
+		type(print), type(coroutine.wrap), type(debug), type(jit)`
+	for _, tc := range []struct {
+		preset Preset
+		want   string
+	}{
+		{Presetcompute, "[function nil function nil nil nil nil nil nil function nil nil]"},
+		{Presetsafe, "[function nil function nil nil nil function nil function function nil nil]"},
+		{Presetfull, "[function function function function function table function function function function table table]"},
+	} {
+		s := Newstate()
+		if s == nil {
+			t.Fatal("Newstate failed")
+		}
+		if err := s.Openpreset(tc.preset); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Loadstring(probe); err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		v, err := s.Pcallmulti(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(v) != tc.want {
+			t.Errorf("%v: expected %s, got %v", tc.preset, tc.want, v)
+		}
+		s.Close()
+	}
+
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	if err := s.Openpreset(Preset(42)); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
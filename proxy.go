@@ -0,0 +1,313 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+#include <stdlib.h>
+*/
+import "C"
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// Pushes a userdata through which Lua code reads and writes the elements
+// of the Go slice v in place, without copying them into a table. v must be
+// a slice or a pointer to a slice:
+//
+//	p[i]		reads element i-1, converted as by Push; nil when i is
+//			out of range
+//	p[i] = x	sets element i-1, converted as by Unmarshal
+//	#p		the length of the slice
+//	ipairs(p)	iterates over the elements
+//
+// Indices are 1-based as for Lua arrays. When v is a pointer, assigning to
+// p[#p+1] appends to the slice the pointer refers to; otherwise, assigning
+// outside the slice is an error. Note that ipairs only uses __ipairs when
+// LuaJIT is built with LUAJIT_ENABLE_LUA52COMPAT.
+//
+// As for Pushobject, the userdata keeps v alive until it is collected by
+// Lua, and the slice can be retrieved with Checkuserdata.
+func (s *State) Pushslice(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || (t.Kind() != reflect.Slice && (t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice)) {
+		return fmt.Errorf("cannot push %T as a slice", v)
+	}
+	if t.Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return fmt.Errorf("cannot push nil %T as a slice", v)
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.pushhandle(v)
+	if s.proxymeta("luajit.slice:" + t.String()) {
+		s.setslicemeta()
+	}
+	s.Setmetatable(-2)
+	return nil
+}
+
+// Pushes the metatable with the given registry name, and returns true if
+// it was just created, in which case the caller must fill in its
+// metamethods other than __gc. Proxy metatables are marked like those of
+// objects, so that toobject returns the proxied value.
+func (s *State) proxymeta(name string) bool {
+	cs, mustfree := cstring(name)
+	if mustfree {
+		defer C.free(unsafe.Pointer(cs))
+	}
+	if int(C.luaL_newmetatable(s.live(), cs)) == 0 {
+		return false
+	}
+	s.Pushboolean(true)
+	s.Setfield(-2, objectfield)
+	s.Pushfunction(gcobject)
+	s.Setfield(-2, "__gc")
+	return true
+}
+
+// Returns the value at index as a 1-based array index, and whether it is
+// one.
+func (s *State) toarrayindex(index int) (int, bool) {
+	if s.Type(index) != Tnumber {
+		return 0, false
+	}
+	n := s.Tonumber(index)
+	if n != math.Trunc(n) || n < 1 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// Returns the slice held by the proxy at index 1.
+func (s *State) toslice() (reflect.Value, bool) {
+	obj, ok := s.toobject(1)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Slice
+}
+
+func (s *State) setslicemeta() {
+	s.Pushfunction(sliceindex)
+	s.Setfield(-2, "__index")
+	s.Pushfunction(slicenewindex)
+	s.Setfield(-2, "__newindex")
+	s.Pushfunction(slicelen)
+	s.Setfield(-2, "__len")
+	s.Pushfunction(sliceipairs)
+	s.Setfield(-2, "__ipairs")
+}
+
+var sliceindex Gofunction = func(s *State) int {
+	v, ok := s.toslice()
+	i, isindex := s.toarrayindex(2)
+	if !ok || !isindex || i > v.Len() {
+		s.Pushnil()
+		return 1
+	}
+	if err := s.push(v.Index(i-1), 0); err != nil {
+		return s.Errorf("element %d: %s", i, err.Error())
+	}
+	return 1
+}
+
+var slicenewindex Gofunction = func(s *State) int {
+	obj, _ := s.toobject(1)
+	v, ok := s.toslice()
+	if !ok {
+		return s.Errorf("bad self: expected slice, got %s", s.Typename(s.Type(1)))
+	}
+	i, isindex := s.toarrayindex(2)
+	appendable := reflect.TypeOf(obj).Kind() == reflect.Ptr && i == v.Len()+1
+	if !isindex || (i > v.Len() && !appendable) {
+		return s.Errorf("index %s out of range [1, %d]", s.Tostring(2), v.Len())
+	}
+	e := reflect.New(v.Type().Elem()).Elem()
+	if err := s.unmarshal(3, e, fmt.Sprintf("element %d", i), 0); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	if i > v.Len() {
+		v.Set(reflect.Append(v, e))
+	} else {
+		v.Index(i - 1).Set(e)
+	}
+	return 0
+}
+
+var slicelen Gofunction = func(s *State) int {
+	v, ok := s.toslice()
+	if !ok {
+		return s.Errorf("bad self: expected slice, got %s", s.Typename(s.Type(1)))
+	}
+	s.Pushinteger(v.Len())
+	return 1
+}
+
+var sliceipairs Gofunction = func(s *State) int {
+	s.Pushfunction(slicenext)
+	s.Pushvalue(1)
+	s.Pushinteger(0)
+	return 3
+}
+
+// The iterator returned by __ipairs: returns i+1 and its element, or
+// nothing at the end of the slice.
+var slicenext Gofunction = func(s *State) int {
+	v, ok := s.toslice()
+	if !ok {
+		return 0
+	}
+	i := s.Tointeger(2) + 1
+	if i > v.Len() {
+		return 0
+	}
+	s.Pushinteger(i)
+	if err := s.push(v.Index(i-1), 0); err != nil {
+		return s.Errorf("element %d: %s", i, err.Error())
+	}
+	return 2
+}
+
+// Pushes a userdata through which Lua code reads and writes the Go map v
+// in place, so that the map remains the only copy of the data:
+//
+//	p[k]		reads the element with key k, converted as by Push;
+//			nil if there is none or k does not convert to the key
+//			type
+//	p[k] = x	sets the element with key k, or deletes it if x is nil;
+//			k and x are converted as by Unmarshal
+//	#p		the number of elements
+//	pairs(p)	iterates over the elements in unspecified order
+//
+// Note that pairs only uses __pairs when LuaJIT is built with
+// LUAJIT_ENABLE_LUA52COMPAT; otherwise, getmetatable(p).__pairs(p) gives
+// the same iterator.
+//
+// As for Pushobject, the userdata keeps v alive until it is collected by
+// Lua, and the map can be retrieved with Checkuserdata.
+func (s *State) Pushmap(v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Map {
+		return fmt.Errorf("cannot push %T as a map", v)
+	}
+	if reflect.ValueOf(v).IsNil() {
+		return fmt.Errorf("cannot push nil %T as a map", v)
+	}
+	if err := s.grow(3); err != nil {
+		return err
+	}
+	s.pushhandle(v)
+	if s.proxymeta("luajit.map:" + t.String()) {
+		s.setmapmeta()
+	}
+	s.Setmetatable(-2)
+	return nil
+}
+
+// Returns the map held by the proxy at index 1.
+func (s *State) tomap() (reflect.Value, bool) {
+	obj, ok := s.toobject(1)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	v := reflect.ValueOf(obj)
+	return v, v.Kind() == reflect.Map
+}
+
+func (s *State) setmapmeta() {
+	s.Pushfunction(mapindex)
+	s.Setfield(-2, "__index")
+	s.Pushfunction(mapnewindex)
+	s.Setfield(-2, "__newindex")
+	s.Pushfunction(maplen)
+	s.Setfield(-2, "__len")
+	s.Pushfunction(mappairs)
+	s.Setfield(-2, "__pairs")
+}
+
+var mapindex Gofunction = func(s *State) int {
+	v, ok := s.tomap()
+	if !ok {
+		s.Pushnil()
+		return 1
+	}
+	k := reflect.New(v.Type().Key()).Elem()
+	if s.Isnil(2) || s.unmarshal(2, k, "key", 0) != nil {
+		s.Pushnil()
+		return 1
+	}
+	e := v.MapIndex(k)
+	if !e.IsValid() {
+		s.Pushnil()
+		return 1
+	}
+	if err := s.push(e, 0); err != nil {
+		return s.Errorf("element %s: %s", s.Tostring(2), err.Error())
+	}
+	return 1
+}
+
+var mapnewindex Gofunction = func(s *State) int {
+	v, ok := s.tomap()
+	if !ok {
+		return s.Errorf("bad self: expected map, got %s", s.Typename(s.Type(1)))
+	}
+	if s.Isnil(2) {
+		return s.Errorf("cannot set nil key")
+	}
+	k := reflect.New(v.Type().Key()).Elem()
+	if err := s.unmarshal(2, k, "key", 0); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	if s.Isnil(3) {
+		v.SetMapIndex(k, reflect.Value{})
+		return 0
+	}
+	e := reflect.New(v.Type().Elem()).Elem()
+	if err := s.unmarshal(3, e, "element "+s.Tostring(2), 0); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	v.SetMapIndex(k, e)
+	return 0
+}
+
+var maplen Gofunction = func(s *State) int {
+	v, ok := s.tomap()
+	if !ok {
+		return s.Errorf("bad self: expected map, got %s", s.Typename(s.Type(1)))
+	}
+	s.Pushinteger(v.Len())
+	return 1
+}
+
+// Returns an iterator over the map held by the proxy at index 1, which
+// keeps its position in Go rather than taking the previous key.
+var mappairs Gofunction = func(s *State) int {
+	v, ok := s.tomap()
+	if !ok {
+		return s.Errorf("bad self: expected map, got %s", s.Typename(s.Type(1)))
+	}
+	it := v.MapRange()
+	s.Pushfunction(func(s *State) int {
+		if !it.Next() {
+			return 0
+		}
+		if err := s.push(it.Key(), 0); err != nil {
+			return s.Errorf("key: %s", err.Error())
+		}
+		if err := s.push(it.Value(), 0); err != nil {
+			return s.Errorf("element: %s", err.Error())
+		}
+		return 2
+	})
+	s.Pushvalue(1)
+	s.Pushnil()
+	return 3
+}
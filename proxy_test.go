@@ -0,0 +1,94 @@
+package luajit
+
+import "testing"
+
+func TestPushslice(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	fixed := []int{1, 2, 3}
+	if err := s.Pushslice(fixed); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("fixed")
+	grow := []string{"a"}
+	if err := s.Pushslice(&grow); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("grow")
+
+	err := s.Loadstring(`
+		assert(#fixed == 3 and fixed[2] == 2 and fixed[4] == nil)
+		fixed[1] = 10
+		assert(not pcall(function() fixed[4] = 4 end))
+		assert(not pcall(function() fixed[1] = "x" end))
+		grow[2] = "b"
+		local n = 0
+		for i, v in getmetatable(grow).__ipairs(grow) do n = n + i end
+		return n
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	s.Pop(1)
+	if fixed[0] != 10 {
+		t.Errorf("expected 10, got %d", fixed[0])
+	}
+	if len(grow) != 2 || grow[1] != "b" {
+		t.Errorf("expected [a b], got %v", grow)
+	}
+	if err := s.Pushslice(42); err == nil {
+		t.Error("expected error for a number")
+	}
+}
+
+func TestPushmap(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	m := map[string]int{"a": 1, "b": 2}
+	if err := s.Pushmap(m); err != nil {
+		t.Fatal(err)
+	}
+	s.Setglobal("m")
+
+	err := s.Loadstring(`
+		assert(m.a == 1 and m.z == nil and #m == 2)
+		m.c = 3
+		m.a = nil
+		assert(not pcall(function() m.d = "x" end))
+		local sum = 0
+		for k, v in getmetatable(m).__pairs(m) do sum = sum + v end
+		return sum
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 5 {
+		t.Errorf("expected 5, got %d", n)
+	}
+	s.Pop(1)
+	if len(m) != 2 || m["c"] != 3 {
+		t.Errorf("expected map[b:2 c:3], got %v", m)
+	}
+	if err := s.Pushmap([]int{}); err == nil {
+		t.Error("expected error for a slice")
+	}
+}
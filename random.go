@@ -0,0 +1,64 @@
+package luajit
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+)
+
+// A rand.Source reading from crypto/rand.
+type cryptosource struct{}
+
+func (cryptosource) Uint64() uint64 {
+	var b [8]byte
+	crand.Read(b[:])
+	return binary.LittleEndian.Uint64(b[:])
+}
+
+// Replaces math.random and math.randomseed with functions drawing from
+// src, for reproducible tests with a seeded source such as
+// rand.NewPCG(1, 2), or from crypto/rand if src is nil. math.random keeps
+// its usual behaviour:
+//
+//	math.random()		a float in [0, 1)
+//	math.random(m)		an integer in [1, m]
+//	math.random(m, n)	an integer in [m, n]
+//
+// math.randomseed does nothing, so that scripts cannot make the sequence
+// predictable or change it under the host. The math library must be
+// open.
+func (s *State) Setrandom(src rand.Source) error {
+	if src == nil {
+		src = cryptosource{}
+	}
+	r := rand.New(src)
+	s.Getglobal("math")
+	defer s.Pop(1)
+	if !s.Istable(-1) {
+		return errors.New("math library not open")
+	}
+	s.Pushfunction(func(s *State) int {
+		var lo, hi int64
+		switch s.Gettop() {
+		case 0:
+			s.Pushnumber(r.Float64())
+			return 1
+		case 1:
+			lo, hi = 1, int64(s.Tonumber(1))
+		case 2:
+			lo, hi = int64(s.Tonumber(1)), int64(s.Tonumber(2))
+		default:
+			return s.Errorf("wrong number of arguments")
+		}
+		if lo > hi {
+			return s.Errorf("bad argument #%d to 'random' (interval is empty)", s.Gettop())
+		}
+		s.Pushnumber(float64(lo + r.Int64N(hi-lo+1)))
+		return 1
+	})
+	s.Setfield(-2, "random")
+	s.Pushfunction(func(s *State) int { return 0 })
+	s.Setfield(-2, "randomseed")
+	return nil
+}
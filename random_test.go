@@ -0,0 +1,48 @@
+package luajit
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestSetrandom(t *testing.T) {
+	draw := func(src rand.Source) []float64 {
+		s := Newstate()
+		if s == nil {
+			t.Fatal("Newstate failed")
+		}
+		defer s.Close()
+		s.Openlibs()
+		if err := s.Setrandom(src); err != nil {
+			t.Fatal(err)
+		}
+		err := s.Loadstring(`
+			math.randomseed(os.time())
+			local x, y = math.random(), math.random(6)
+			assert(x >= 0 and x < 1 and y >= 1 and y <= 6)
+			assert(math.random(3, 3) == 3)
+			assert(not pcall(math.random, 2, 1))
+			return x, y, math.random(-5, 5)
+		`)
+		if err != nil {
+			t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+		}
+		v, err := s.Pcallmulti(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]float64, len(v))
+		for i := range v {
+			out[i] = v[i].(float64)
+		}
+		return out
+	}
+
+	a, b := draw(rand.NewPCG(1, 2)), draw(rand.NewPCG(1, 2))
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("expected the same values from the same seed, got %v and %v", a, b)
+		}
+	}
+	draw(nil)
+}
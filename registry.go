@@ -0,0 +1,50 @@
+package luajit
+
+import "fmt"
+
+// A Registrykey names a field of the registry. Go packages that share a
+// State should make their keys with Newregistrykey, so that independent
+// bindings do not overwrite each other's values.
+type Registrykey string
+
+// Returns the registry key for name in the package with import path pkg,
+// such as Newregistrykey("example.com/db", "connections"). This package
+// uses the same scheme, with "luajit" as pkg.
+func Newregistrykey(pkg, name string) Registrykey {
+	return Registrykey(pkg + "." + name)
+}
+
+// Pushes onto the stack the value of the registry field key.
+func (s *State) Getregistry(key Registrykey) {
+	s.Getfield(Registryindex, string(key))
+}
+
+// Pops a value from the stack and sets it as the value of the registry
+// field key.
+func (s *State) Setregistry(key Registrykey) {
+	s.Setfield(Registryindex, string(key))
+}
+
+// Sets the registry field key to v, converted as by Push.
+func Storeregistry(s *State, key Registrykey, v interface{}) error {
+	if err := s.Push(v); err != nil {
+		return fmt.Errorf("%s: %s", key, err.Error())
+	}
+	s.Setregistry(key)
+	return nil
+}
+
+// Returns the value of the registry field key converted to a T as by
+// Unmarshal.
+func Loadregistry[T any](s *State, key Registrykey) (T, error) {
+	var v T
+	if err := s.grow(1); err != nil {
+		return v, err
+	}
+	s.Getregistry(key)
+	defer s.Pop(1)
+	if err := s.Unmarshal(-1, &v); err != nil {
+		return v, fmt.Errorf("%s: %s", key, err.Error())
+	}
+	return v, nil
+}
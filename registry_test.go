@@ -0,0 +1,41 @@
+package luajit
+
+import "testing"
+
+func TestRegistrykey(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	a := Newregistrykey("example.com/a", "config")
+	b := Newregistrykey("example.com/b", "config")
+	if a == b {
+		t.Fatal("expected distinct keys")
+	}
+	if err := Storeregistry(s, a, map[string]int{"port": 80}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Storeregistry(s, b, []string{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Loadregistry[map[string]int](s, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["port"] != 80 {
+		t.Errorf("expected 80, got %d", m["port"])
+	}
+	if _, err := Loadregistry[int](s, b); err == nil {
+		t.Error("expected error converting a table to int")
+	}
+	s.Getregistry(b)
+	if !s.Istable(-1) {
+		t.Errorf("expected table, got %s", s.Typename(s.Type(-1)))
+	}
+	s.Pop(1)
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+}
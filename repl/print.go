@@ -0,0 +1,108 @@
+package repl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/serialx/luajit"
+)
+
+// Tables nested deeper than this are abbreviated when printed.
+const maxdepth = 4
+
+// Tables with more fields than this are truncated when printed.
+const maxfields = 64
+
+// Formats the value at the given absolute index for display. Tables are
+// shown as constructors; seen records the tables already being printed so
+// that cycles are shown rather than followed.
+func format(s *luajit.State, index int, seen map[uintptr]bool, depth int) string {
+	switch s.Type(index) {
+	case luajit.Tnil, luajit.Tnone:
+		return "nil"
+	case luajit.Tboolean:
+		return strconv.FormatBool(s.Toboolean(index))
+	case luajit.Tnumber:
+		return strconv.FormatFloat(s.Tonumber(index), 'g', 14, 64)
+	case luajit.Tstring:
+		if depth == 0 {
+			return s.Tostring(index)
+		}
+		return strconv.Quote(s.Tostring(index))
+	case luajit.Ttable:
+		return formattable(s, index, seen, depth)
+	}
+	return tostring(s, index)
+}
+
+func formattable(s *luajit.State, index int, seen map[uintptr]bool, depth int) string {
+	p := uintptr(s.Topointer(index))
+	if seen[p] || depth >= maxdepth || !s.Checkstack(3) {
+		return tostring(s, index)
+	}
+	seen[p] = true
+	defer delete(seen, p)
+
+	// The array part is printed first, in order, then the remaining
+	// fields sorted by key.
+	n := s.Objlen(index)
+	var items, fields []string
+	for i := 1; i <= n && i <= maxfields; i++ {
+		s.Rawgeti(index, i)
+		items = append(items, format(s, s.Gettop(), seen, depth+1))
+		s.Pop(1)
+	}
+	truncated := n > maxfields
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		if s.Isnumber(-2) {
+			k := s.Tonumber(-2)
+			if k == float64(int(k)) && k >= 1 && int(k) <= n {
+				s.Pop(1)
+				continue
+			}
+		}
+		if len(items)+len(fields) >= maxfields {
+			truncated = true
+			s.Pop(2)
+			break
+		}
+		top := s.Gettop()
+		var key string
+		if s.Isstring(top-1) && isname(s.Tostring(top-1)) {
+			key = s.Tostring(top - 1)
+		} else {
+			key = "[" + format(s, top-1, seen, depth+1) + "]"
+		}
+		fields = append(fields, key+" = "+format(s, top, seen, depth+1))
+		s.Pop(1)
+	}
+	sort.Strings(fields)
+	items = append(items, fields...)
+	if truncated {
+		items = append(items, "...")
+	}
+	if len(items) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+// Converts the value at index with the global tostring function, so that
+// __tostring metamethods are honored.
+func tostring(s *luajit.State, index int) string {
+	s.Getglobal("tostring")
+	if !s.Isfunction(-1) {
+		s.Pop(1)
+		return s.Typename(s.Type(index))
+	}
+	s.Pushvalue(index)
+	if err := s.Pcall(1, 1, 0); err != nil {
+		s.Pop(1)
+		return s.Typename(s.Type(index))
+	}
+	str := s.Tostring(-1)
+	s.Pop(1)
+	return str
+}
@@ -0,0 +1,253 @@
+// Package repl implements an interactive read-eval-print loop for a
+// luajit State, suitable for embedding an administration console into an
+// application.
+//
+// The loop behaves like the stand-alone lua and luajit interpreters:
+// incomplete statements are continued on the following lines, a line
+// starting with '=' prints the value of an expression, and the values of
+// expressions typed on their own are printed as well. When reading from a
+// terminal, lines can be edited, previous lines are available as history
+// and the Tab key completes names of globals and table fields.
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/serialx/luajit"
+)
+
+// A Repl reads Lua statements, runs them in a State and prints results.
+type Repl struct {
+	// Prompt is shown when reading a new statement, Prompt2 when
+	// continuing an incomplete one.
+	Prompt  string
+	Prompt2 string
+
+	s   *luajit.State
+	buf []string
+}
+
+// Returns a new Repl running statements in s.
+func New(s *luajit.State) *Repl {
+	return &Repl{Prompt: "> ", Prompt2: ">> ", s: s}
+}
+
+// Runs the loop, reading from in and writing results and error messages to
+// out, until in reaches end of file. If in is a terminal, line editing,
+// history and tab completion are enabled.
+func (r *Repl) Run(in io.Reader, out io.Writer) error {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return r.runterm(f, out)
+	}
+	br := bufio.NewReader(in)
+	for {
+		io.WriteString(out, r.prompt())
+		line, err := br.ReadString('\n')
+		if line != "" {
+			io.WriteString(out, r.Eval(strings.TrimRight(line, "\r\n")))
+		}
+		if err == io.EOF {
+			io.WriteString(out, "\n")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Repl) runterm(f *os.File, out io.Writer) error {
+	old, err := term.MakeRaw(int(f.Fd()))
+	if err != nil {
+		return err
+	}
+	defer term.Restore(int(f.Fd()), old)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{f, out}, r.prompt())
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return r.complete(t, line, pos)
+	}
+	for {
+		t.SetPrompt(r.prompt())
+		line, err := t.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		io.WriteString(t, r.Eval(line))
+	}
+}
+
+func (r *Repl) prompt() string {
+	if len(r.buf) > 0 {
+		return r.Prompt2
+	}
+	return r.Prompt
+}
+
+// Feeds one line of input to the loop and returns the text to show for
+// it: the printed results, an error message, or nothing when the
+// statement is incomplete and more lines are needed.
+func (r *Repl) Eval(line string) string {
+	if len(r.buf) == 0 && strings.HasPrefix(line, "=") {
+		line = "return " + line[1:]
+	}
+	r.buf = append(r.buf, line)
+	chunk := strings.Join(r.buf, "\n")
+
+	s := r.s
+	top := s.Gettop()
+	// Try the input as an expression first so that its value is printed.
+	if err := s.Loadstring("return " + chunk); err != nil {
+		s.Settop(top)
+		if err := s.Loadstring(chunk); err != nil {
+			msg := s.Tostring(-1)
+			s.Settop(top)
+			if strings.HasSuffix(msg, "'<eof>'") {
+				return "" // incomplete; wait for more
+			}
+			r.buf = nil
+			return msg + "\n"
+		}
+	}
+	r.buf = nil
+	if err := s.Pcall(0, luajit.Multret, 0); err != nil {
+		msg := s.Tostring(-1)
+		s.Settop(top)
+		return msg + "\n"
+	}
+	n := s.Gettop() - top
+	if n == 0 {
+		return ""
+	}
+	vals := make([]string, n)
+	for i := range vals {
+		vals[i] = format(s, top+i+1, make(map[uintptr]bool), 0)
+	}
+	s.Settop(top)
+	return strings.Join(vals, "\t") + "\n"
+}
+
+// Returns the names of globals or table fields that complete the dotted
+// name prefix, such as "str", "string.fo" or "io.stdout:wr". The returned
+// names include the table part of prefix.
+func (r *Repl) Complete(prefix string) []string {
+	s := r.s
+	top := s.Gettop()
+	defer s.Settop(top)
+
+	sep := strings.LastIndexAny(prefix, ".:")
+	path, partial := "", prefix
+	if sep >= 0 {
+		path, partial = prefix[:sep], prefix[sep+1:]
+	}
+	s.Pushvalue(luajit.Globalsindex)
+	if path != "" {
+		for _, name := range strings.FieldsFunc(path, func(c rune) bool {
+			return c == '.' || c == ':'
+		}) {
+			if !s.Istable(-1) {
+				return nil
+			}
+			s.Getfield(-1, name)
+			s.Remove(-2)
+		}
+	}
+	method := sep >= 0 && prefix[sep] == ':'
+	if !s.Istable(-1) {
+		// Methods are found through the __index table of the value's
+		// metatable, as for strings and file handles.
+		if !method || !s.Checkstack(2) {
+			return nil
+		}
+		before := s.Gettop()
+		s.Getmetatable(-1)
+		if s.Gettop() == before {
+			return nil
+		}
+		s.Getfield(-1, "__index")
+		if !s.Istable(-1) {
+			return nil
+		}
+	}
+
+	var names []string
+	t := s.Gettop()
+	s.Pushnil()
+	for s.Next(t) != 0 {
+		if s.Isstring(-2) {
+			k := s.Tostring(-2)
+			if strings.HasPrefix(k, partial) && isname(k) &&
+				(!method || s.Isfunction(-1)) {
+				names = append(names, prefix[:sep+1]+k)
+			}
+		}
+		s.Pop(1)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The terminal's completion callback: completes the name ending at pos,
+// listing the candidates when there is more than one.
+func (r *Repl) complete(t *term.Terminal, line string, pos int) (string, int, bool) {
+	start := pos
+	for start > 0 && (isnamebyte(line[start-1]) || line[start-1] == '.' || line[start-1] == ':') {
+		start--
+	}
+	prefix := line[start:pos]
+	names := r.Complete(prefix)
+	if len(names) == 0 {
+		return "", 0, false
+	}
+	common := names[0]
+	for _, n := range names[1:] {
+		for !strings.HasPrefix(n, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(names) > 1 && common == prefix {
+		fmt.Fprintln(t, strings.Join(names, "  "))
+	}
+	return line[:start] + common + line[pos:], start + len(common), true
+}
+
+func isnamebyte(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// Reports whether str is a valid Lua identifier.
+func isname(str string) bool {
+	if str == "" || '0' <= str[0] && str[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(str); i++ {
+		if !isnamebyte(str[i]) {
+			return false
+		}
+	}
+	return !keywords[str]
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "if": true,
+	"in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
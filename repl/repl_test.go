@@ -0,0 +1,84 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/serialx/luajit"
+)
+
+func TestEval(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	r := New(s)
+
+	if out := r.Eval("1 + 2"); out != "3\n" {
+		t.Errorf("expected %q, got %q", "3\n", out)
+	}
+	if out := r.Eval("function f(x)"); out != "" {
+		t.Errorf("expected continuation, got %q", out)
+	}
+	if p := r.prompt(); p != r.Prompt2 {
+		t.Errorf("expected continuation prompt, got %q", p)
+	}
+	r.Eval("return x * 2")
+	if out := r.Eval("end"); out != "" {
+		t.Errorf("expected no output, got %q", out)
+	}
+	if out := r.Eval("=f(21)"); out != "42\n" {
+		t.Errorf("expected %q, got %q", "42\n", out)
+	}
+	if out := r.Eval("{1, 2, a = 'x'}"); out != "{ 1, 2, a = \"x\" }\n" {
+		t.Errorf("unexpected table output %q", out)
+	}
+	if out := r.Eval("error('boom')"); !strings.Contains(out, "boom") {
+		t.Errorf("expected error message, got %q", out)
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack, found %d elems", n)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	r := New(s)
+
+	names := r.Complete("string.up")
+	if len(names) != 1 || names[0] != "string.upper" {
+		t.Errorf("expected [string.upper], got %v", names)
+	}
+	names = r.Complete("coroutine.")
+	if len(names) < 5 {
+		t.Errorf("expected coroutine functions, got %v", names)
+	}
+	if n := s.Gettop(); n != 0 {
+		t.Errorf("expected empty stack, found %d elems", n)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := luajit.Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Openlibs()
+	var out bytes.Buffer
+	in := strings.NewReader("x = 6\n=x * 7\n")
+	if err := New(s).Run(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "42\n") {
+		t.Errorf("expected 42 in output, got %q", out.String())
+	}
+}
@@ -0,0 +1,93 @@
+package luajit
+
+import "sync"
+
+// A Safestate is a State guarded by a mutex, for applications that
+// occasionally use a state from several goroutines, such as an admin
+// endpoint inspecting a running script host. Its methods each hold the
+// lock for the whole operation, so that a sequence of stack operations
+// cannot interleave with another goroutine's; a lock around each
+// individual State method would not prevent that.
+type Safestate struct {
+	mu sync.Mutex
+	s  *State
+}
+
+// Creates a new state guarded by a mutex. Returns nil if the state cannot
+// be created, as Newstate does.
+func Newsafestate() *Safestate {
+	s := Newstate()
+	if s == nil {
+		return nil
+	}
+	return &Safestate{s: s}
+}
+
+// Calls fn with the state while holding the lock. fn must not keep the
+// state after it returns. The stack is emptied after fn returns, so that
+// each call starts afresh.
+func (ss *Safestate) Do(fn func(s *State) error) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.s == nil {
+		return ErrClosed
+	}
+	defer ss.s.Settop(0)
+	return fn(ss.s)
+}
+
+// Runs the Lua chunk src with args while holding the lock, and returns
+// its results. Arguments, results and errors are as for Executor.Submit.
+func (ss *Safestate) Dostring(src string, args ...interface{}) ([]interface{}, error) {
+	var results []interface{}
+	err := ss.Do(func(s *State) error {
+		var err error
+		results, err = s.runstring(src, args)
+		return err
+	})
+	return results, err
+}
+
+// Calls Callglobal while holding the lock.
+func (ss *Safestate) Callglobal(name string, args ...interface{}) ([]interface{}, error) {
+	var results []interface{}
+	err := ss.Do(func(s *State) error {
+		var err error
+		results, err = s.Callglobal(name, args...)
+		return err
+	})
+	return results, err
+}
+
+// Returns the value at the dotted path, as looked up by Getpath and
+// converted by Tovalue, while holding the lock.
+func (ss *Safestate) Getvalue(path string) (interface{}, error) {
+	var v interface{}
+	err := ss.Do(func(s *State) error {
+		if err := s.Getpath(path); err != nil {
+			return err
+		}
+		var err error
+		v, err = s.Tovalue(-1)
+		return err
+	})
+	return v, err
+}
+
+// Calls Setglobals while holding the lock.
+func (ss *Safestate) Setglobals(m map[string]interface{}) error {
+	return ss.Do(func(s *State) error {
+		return s.Setglobals(m)
+	})
+}
+
+// Closes the state, waiting for the current holder of the lock. Later
+// calls return an error.
+func (ss *Safestate) Close() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.s != nil {
+		ss.s.Close()
+		ss.s = nil
+	}
+}
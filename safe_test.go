@@ -0,0 +1,40 @@
+package luajit
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSafestate(t *testing.T) {
+	ss := Newsafestate()
+	if ss == nil {
+		t.Fatal("Newsafestate failed")
+	}
+	if err := ss.Setglobals(map[string]interface{}{"n": 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ss.Dostring(`n = n + 1`); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	v, err := ss.Getvalue("n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 20.0 {
+		t.Errorf("expected 20, got %v", v)
+	}
+
+	ss.Close()
+	if _, err := ss.Dostring(`return 1`); err == nil {
+		t.Error("expected error from a closed state")
+	}
+}
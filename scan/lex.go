@@ -0,0 +1,297 @@
+package scan
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Kinds of tokens. Keywords and punctuation are symbols, told apart by
+// their text.
+const (
+	tokeof = iota
+	tokname
+	tokstring
+	toknumber
+	toksym
+)
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true,
+	"or": true, "repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
+
+// Punctuation of more than one character, longest first.
+var symbols = []string{"...", "..", "==", "~=", "<=", ">=", "::"}
+
+type token struct {
+	kind int
+	text string // the source text, or the symbol
+	line int
+}
+
+// Text of the token for error messages, as Lua shows it after "near".
+func (t token) near() string {
+	if t.kind == tokeof {
+		return "<eof>"
+	}
+	return t.text
+}
+
+// A lexer splits Lua 5.1 source, with the extensions of LuaJIT, into
+// tokens.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+// A lexer error, which the parser turns into a syntax error.
+type lexerror struct {
+	line int
+	msg  string
+}
+
+func (e *lexerror) Error() string {
+	return e.msg
+}
+
+func newlexer(src string) *lexer {
+	l := &lexer{src: src, line: 1}
+	if strings.HasPrefix(src, "#") {
+		for l.pos < len(src) && src[l.pos] != '\n' && src[l.pos] != '\r' {
+			l.pos++
+		}
+	}
+	return l
+}
+
+func (l *lexer) fail(line int, msg string, near string) error {
+	if near != "" {
+		msg += " near '" + near + "'"
+	}
+	return &lexerror{line, msg}
+}
+
+func (l *lexer) peekbyte(off int) byte {
+	if l.pos+off < len(l.src) {
+		return l.src[l.pos+off]
+	}
+	return 0
+}
+
+// Skips a newline sequence at the current position, counting it once.
+func (l *lexer) newline() {
+	c := l.src[l.pos]
+	l.pos++
+	if l.pos < len(l.src) && (l.src[l.pos] == '\n' || l.src[l.pos] == '\r') && l.src[l.pos] != c {
+		l.pos++
+	}
+	l.line++
+}
+
+func isnewline(c byte) bool {
+	return c == '\n' || c == '\r'
+}
+
+func isdigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isident(c byte) bool {
+	return c == '_' || isdigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// Returns the level of a long bracket at the current position, the number
+// of '=' between its brackets, or -1 if there is none.
+func (l *lexer) longbracket() int {
+	open := l.src[l.pos]
+	n := 0
+	for l.peekbyte(1+n) == '=' {
+		n++
+	}
+	if l.peekbyte(1+n) != open {
+		return -1
+	}
+	return n
+}
+
+// Skips a long string or comment of the given level, starting at its
+// opening bracket.
+func (l *lexer) longstring(level int, what string) error {
+	l.pos += level + 2
+	if l.pos < len(l.src) && isnewline(l.src[l.pos]) {
+		l.newline()
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isnewline(c):
+			l.newline()
+		case c == ']' && l.longbracket() == level:
+			l.pos += level + 2
+			return nil
+		default:
+			l.pos++
+		}
+	}
+	return l.fail(l.line, "unfinished long "+what, "<eof>")
+}
+
+// Skips whitespace and comments.
+func (l *lexer) skip() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case isnewline(c):
+			l.newline()
+		case c == ' ' || c == '\t' || c == '\v' || c == '\f':
+			l.pos++
+		case c == '-' && l.peekbyte(1) == '-':
+			l.pos += 2
+			if l.peekbyte(0) == '[' {
+				if level := l.longbracket(); level >= 0 {
+					if err := l.longstring(level, "comment"); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			for l.pos < len(l.src) && !isnewline(l.src[l.pos]) {
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// Returns the next token.
+func (l *lexer) next() (token, error) {
+	if err := l.skip(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokeof, line: l.line}, nil
+	}
+	start, line := l.pos, l.line
+	c := l.src[l.pos]
+	switch {
+	case isdigit(c) || c == '.' && isdigit(l.peekbyte(1)):
+		return l.number()
+	case isident(c):
+		for l.pos < len(l.src) && isident(l.src[l.pos]) {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		if keywords[text] {
+			return token{toksym, text, line}, nil
+		}
+		return token{tokname, text, line}, nil
+	case c == '"' || c == '\'':
+		return l.quoted(c)
+	case c == '[':
+		if level := l.longbracket(); level >= 0 {
+			if err := l.longstring(level, "string"); err != nil {
+				return token{}, err
+			}
+			return token{tokstring, l.src[start:l.pos], line}, nil
+		} else if l.peekbyte(1) == '=' {
+			return token{}, l.fail(line, "invalid long string delimiter", "[=")
+		}
+	}
+	for _, sym := range symbols {
+		if strings.HasPrefix(l.src[l.pos:], sym) {
+			l.pos += len(sym)
+			return token{toksym, sym, line}, nil
+		}
+	}
+	if strings.IndexByte("+-*/%^#<>=(){}[];:,.", c) < 0 {
+		return token{}, l.fail(line, "unexpected symbol", l.src[start:start+1])
+	}
+	l.pos++
+	return token{toksym, l.src[start:l.pos], line}, nil
+}
+
+// Reads a quoted string. Escape sequences are skipped rather than
+// decoded, as only the extent of the string matters.
+func (l *lexer) quoted(quote byte) (token, error) {
+	start, line := l.pos, l.line
+	l.pos++
+	for {
+		if l.pos >= len(l.src) {
+			return token{}, l.fail(l.line, "unfinished string", "<eof>")
+		}
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			return token{tokstring, l.src[start:l.pos], line}, nil
+		case isnewline(c):
+			return token{}, l.fail(l.line, "unfinished string", l.src[start:l.pos])
+		case c == '\\':
+			l.pos++
+			switch {
+			case l.pos >= len(l.src):
+			case isnewline(l.src[l.pos]):
+				l.newline()
+			case l.src[l.pos] == 'z':
+				l.pos++
+				for l.pos < len(l.src) && strings.IndexByte(" \t\v\f\r\n", l.src[l.pos]) >= 0 {
+					if isnewline(l.src[l.pos]) {
+						l.newline()
+					} else {
+						l.pos++
+					}
+				}
+			default:
+				l.pos++
+			}
+		default:
+			l.pos++
+		}
+	}
+}
+
+// Reads a number: decimal or hexadecimal, possibly with a fraction and
+// exponent, and the suffixes LL, ULL, and i of LuaJIT.
+func (l *lexer) number() (token, error) {
+	start, line := l.pos, l.line
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if (c == '+' || c == '-') && strings.IndexByte("eEpP", l.src[l.pos-1]) >= 0 {
+			l.pos++
+		} else if isident(c) || c == '.' {
+			l.pos++
+		} else {
+			break
+		}
+	}
+	text := l.src[start:l.pos]
+	if !validnumber(text) {
+		return token{}, l.fail(line, "malformed number", text)
+	}
+	return token{toknumber, text, line}, nil
+}
+
+func validnumber(text string) bool {
+	s := strings.ToLower(text)
+	for _, suffix := range []string{"ull", "ll", "i"} {
+		if strings.HasSuffix(s, suffix) && len(s) > len(suffix) {
+			s = s[:len(s)-len(suffix)]
+			break
+		}
+	}
+	if strings.ContainsRune(s, '_') {
+		return false
+	}
+	if strings.HasPrefix(s, "0x") && !strings.ContainsRune(s, 'p') {
+		s += "p0"
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil || errors.Is(err, strconv.ErrRange)
+}
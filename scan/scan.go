@@ -0,0 +1,587 @@
+// Package scan finds the global variables used by a Lua chunk without
+// running it, so that a host can vet a script before handing it to a
+// luajit State:
+//
+//	if err := scan.Check("script.lua", src, "os", "io", "load", "debug"); err != nil {
+//		return err
+//	}
+//
+// The package has a lexer and parser of its own, written in Go, for Lua
+// 5.1 with the extensions of LuaJIT (goto and labels, the number
+// suffixes LL, ULL and i, and the escapes of Lua 5.2). It resolves names
+// through the scopes of local variables as Lua does, so a local os
+// shadows the global os.
+//
+// Only direct uses of global variables are found. A script that may call
+// getfenv, setfenv, rawget, or load, or that can reach _G or the table of
+// another function's environment, can get at globals by a computed name,
+// so these should be forbidden as well when vetting untrusted code.
+package scan
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Ref is a use of a global variable.
+type Ref struct {
+	Name  string
+	Line  int
+	Write bool // assigned to, rather than read
+}
+
+// An Error is a syntax error in a chunk, as reported by Globals and
+// Check.
+type Error struct {
+	Chunk string
+	Line  int
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Chunk, e.Line, e.Msg)
+}
+
+// Wrapped by the errors of Check for uses of forbidden globals.
+var ErrForbidden = errors.New("forbidden global")
+
+// Returns the uses of global variables in the Lua source src, in the
+// order they appear in the source. Errors are of type *Error and name the
+// chunk as chunkname.
+func Globals(chunkname string, src []byte) ([]Ref, error) {
+	if len(src) > 0 && src[0] == 0x1b {
+		return nil, &Error{chunkname, 1, "cannot scan a binary chunk"}
+	}
+	p := &parser{l: newlexer(string(src)), chunk: chunkname, vararg: true}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.refs, nil
+}
+
+// Returns an error for the first use in src of one of the forbidden
+// globals, wrapping ErrForbidden, or for a syntax error. Reading and
+// assigning to them are both forbidden.
+func Check(chunkname string, src []byte, forbidden ...string) error {
+	refs, err := Globals(chunkname, src)
+	if err != nil {
+		return err
+	}
+	for _, r := range refs {
+		for _, name := range forbidden {
+			if r.Name == name {
+				return fmt.Errorf("%s:%d: %w '%s'", chunkname, r.Line, ErrForbidden, name)
+			}
+		}
+	}
+	return nil
+}
+
+// The deepest nesting of blocks and expressions accepted, as with
+// LJ_MAX_XLEVEL in LuaJIT. It also bounds the recursion of the parser.
+const maxlevel = 200
+
+// Raised to unwind the parser on the first error.
+type bailout struct {
+	err error
+}
+
+type parser struct {
+	l      *lexer
+	chunk  string
+	tok    token
+	ahead  *token
+	locals []string // in scope, innermost last
+	vararg bool     // whether the current function takes ...
+	level  int      // nesting of blocks and expressions
+	refs   []Ref
+}
+
+func (p *parser) parse() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			b, ok := r.(bailout)
+			if !ok {
+				panic(r)
+			}
+			err = b.err
+		}
+	}()
+	p.next()
+	p.block()
+	if p.tok.kind != tokeof {
+		p.fail("'<eof>' expected")
+	}
+	return nil
+}
+
+func (p *parser) fail(msg string) {
+	p.failat(p.tok.line, fmt.Sprintf("%s near '%s'", msg, p.tok.near()))
+}
+
+func (p *parser) failat(line int, msg string) {
+	panic(bailout{&Error{p.chunk, line, msg}})
+}
+
+// Enters a nested block or expression, failing past maxlevel.
+func (p *parser) enter() {
+	p.level++
+	if p.level > maxlevel {
+		p.failat(p.tok.line, "chunk has too many syntax levels")
+	}
+}
+
+func (p *parser) leave() {
+	p.level--
+}
+
+func (p *parser) lex() token {
+	t, err := p.l.next()
+	if err != nil {
+		e := err.(*lexerror)
+		p.failat(e.line, e.msg)
+	}
+	return t
+}
+
+func (p *parser) next() {
+	if p.ahead != nil {
+		p.tok, p.ahead = *p.ahead, nil
+		return
+	}
+	p.tok = p.lex()
+}
+
+func (p *parser) peek() token {
+	if p.ahead == nil {
+		t := p.lex()
+		p.ahead = &t
+	}
+	return *p.ahead
+}
+
+// Reports whether the current token is the symbol or keyword sym.
+func (p *parser) is(sym string) bool {
+	return p.tok.kind == toksym && p.tok.text == sym
+}
+
+// Skips the current token if it is sym, and reports whether it was.
+func (p *parser) accept(sym string) bool {
+	if p.is(sym) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(sym string) {
+	if !p.accept(sym) {
+		p.fail(fmt.Sprintf("'%s' expected", sym))
+	}
+}
+
+// Expects the symbol closing what opened at the given line, as 'end'
+// closes 'function'.
+func (p *parser) expectmatch(sym, open string, line int) {
+	if p.accept(sym) {
+		return
+	}
+	if line == p.tok.line {
+		p.expect(sym)
+	}
+	p.fail(fmt.Sprintf("'%s' expected (to close '%s' at line %d)", sym, open, line))
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokname {
+		p.fail("<name> expected")
+	}
+	name := p.tok.text
+	p.next()
+	return name
+}
+
+func (p *parser) islocal(name string) bool {
+	for i := len(p.locals) - 1; i >= 0; i-- {
+		if p.locals[i] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Records a use of the variable name if it is global.
+func (p *parser) use(name string, line int, write bool) {
+	if !p.islocal(name) {
+		p.refs = append(p.refs, Ref{name, line, write})
+	}
+}
+
+func (p *parser) blockfollow() bool {
+	if p.tok.kind == tokeof {
+		return true
+	}
+	if p.tok.kind != toksym {
+		return false
+	}
+	switch p.tok.text {
+	case "else", "elseif", "end", "until":
+		return true
+	}
+	return false
+}
+
+// Parses statements up to the end of a block, leaving the locals they
+// declare in scope for the caller to drop.
+func (p *parser) statements() {
+	p.enter()
+	defer p.leave()
+	for !p.blockfollow() {
+		if p.is("return") {
+			p.next()
+			if !p.blockfollow() && !p.is(";") {
+				p.exprlist()
+			}
+			p.accept(";")
+			if !p.blockfollow() {
+				p.fail("'<eof>' expected")
+			}
+			return
+		}
+		p.statement()
+	}
+}
+
+// Parses a block in a scope of its own.
+func (p *parser) block() {
+	n := len(p.locals)
+	p.statements()
+	p.locals = p.locals[:n]
+}
+
+func (p *parser) statement() {
+	line := p.tok.line
+	if p.tok.kind != toksym {
+		p.exprstat()
+		return
+	}
+	switch p.tok.text {
+	case ";":
+		p.next()
+	case "if":
+		p.next()
+		p.expr()
+		p.expect("then")
+		p.block()
+		for p.is("elseif") {
+			p.next()
+			p.expr()
+			p.expect("then")
+			p.block()
+		}
+		if p.accept("else") {
+			p.block()
+		}
+		p.expectmatch("end", "if", line)
+	case "while":
+		p.next()
+		p.expr()
+		p.expect("do")
+		p.block()
+		p.expectmatch("end", "while", line)
+	case "do":
+		p.next()
+		p.block()
+		p.expectmatch("end", "do", line)
+	case "for":
+		p.forstat(line)
+	case "repeat":
+		p.next()
+		n := len(p.locals)
+		p.statements()
+		p.expectmatch("until", "repeat", line)
+		p.expr()
+		p.locals = p.locals[:n]
+	case "function":
+		p.next()
+		nameline := p.tok.line
+		name := p.name()
+		method := false
+		if p.is(".") || p.is(":") {
+			p.use(name, nameline, false)
+			for p.accept(".") {
+				p.name()
+			}
+			if p.accept(":") {
+				p.name()
+				method = true
+			}
+		} else {
+			p.use(name, nameline, true)
+		}
+		p.body(method, line)
+	case "local":
+		p.next()
+		if p.accept("function") {
+			p.locals = append(p.locals, p.name())
+			p.body(false, line)
+			return
+		}
+		var names []string
+		for {
+			names = append(names, p.name())
+			if !p.accept(",") {
+				break
+			}
+		}
+		if p.accept("=") {
+			p.exprlist()
+		}
+		p.locals = append(p.locals, names...)
+	case "break":
+		p.next()
+	case "goto":
+		p.next()
+		p.name()
+	case "::":
+		p.next()
+		p.name()
+		p.expect("::")
+	default:
+		p.exprstat()
+	}
+}
+
+func (p *parser) forstat(line int) {
+	p.next()
+	n := len(p.locals)
+	names := []string{p.name()}
+	if p.accept("=") {
+		p.expr()
+		p.expect(",")
+		p.expr()
+		if p.accept(",") {
+			p.expr()
+		}
+	} else if p.is(",") || p.is("in") {
+		for p.accept(",") {
+			names = append(names, p.name())
+		}
+		p.expect("in")
+		p.exprlist()
+	} else {
+		p.fail("'=' or 'in' expected")
+	}
+	p.expect("do")
+	p.locals = append(p.locals, names...)
+	p.block()
+	p.locals = p.locals[:n]
+	p.expectmatch("end", "for", line)
+}
+
+// Parses the parameters and body of a function, after its name.
+func (p *parser) body(method bool, line int) {
+	n, vararg := len(p.locals), p.vararg
+	p.vararg = false
+	if method {
+		p.locals = append(p.locals, "self")
+	}
+	p.expect("(")
+	if !p.is(")") {
+		for {
+			if p.accept("...") {
+				p.vararg = true
+				break
+			}
+			p.locals = append(p.locals, p.name())
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	p.expect(")")
+	p.block()
+	p.expectmatch("end", "function", line)
+	p.locals, p.vararg = p.locals[:n], vararg
+}
+
+// Kinds of suffixed expressions, which tell what may be assigned to or
+// called.
+const (
+	expglobal = iota // a name not resolved yet
+	expvar           // a local, or an indexed value
+	expcall
+	expother
+)
+
+// Parses an expression statement: a call, or an assignment.
+func (p *parser) exprstat() {
+	kind, name, line := p.suffixedexp()
+	if !p.is("=") && !p.is(",") {
+		if kind != expcall {
+			p.fail("syntax error")
+		}
+		return
+	}
+	for {
+		if kind != expglobal && kind != expvar {
+			p.fail("syntax error")
+		}
+		if kind == expglobal {
+			p.use(name, line, true)
+		}
+		if !p.accept(",") {
+			break
+		}
+		kind, name, line = p.suffixedexp()
+	}
+	p.expect("=")
+	p.exprlist()
+}
+
+// Parses a primary expression followed by fields, indexes, and calls. A
+// name on its own is returned unresolved, as it may be assigned to;
+// otherwise it is recorded as read.
+func (p *parser) suffixedexp() (kind int, name string, line int) {
+	line = p.tok.line
+	switch {
+	case p.tok.kind == tokname:
+		name = p.tok.text
+		p.next()
+		kind = expglobal
+	case p.is("("):
+		p.next()
+		p.expr()
+		p.expectmatch(")", "(", line)
+		kind = expother
+	default:
+		p.fail("unexpected symbol")
+	}
+	for {
+		switch {
+		case p.is("."), p.is(":"), p.is("["), p.is("("), p.is("{"), p.tok.kind == tokstring:
+		default:
+			return kind, name, line
+		}
+		if kind == expglobal {
+			p.use(name, line, false)
+		}
+		switch {
+		case p.accept("."):
+			p.name()
+			kind = expvar
+		case p.accept("["):
+			p.expr()
+			p.expect("]")
+			kind = expvar
+		case p.accept(":"):
+			p.name()
+			p.args()
+			kind = expcall
+		default:
+			p.args()
+			kind = expcall
+		}
+	}
+}
+
+func (p *parser) args() {
+	line := p.tok.line
+	switch {
+	case p.tok.kind == tokstring:
+		p.next()
+	case p.is("{"):
+		p.table()
+	case p.accept("("):
+		if !p.is(")") {
+			p.exprlist()
+		}
+		p.expectmatch(")", "(", line)
+	default:
+		p.fail("function arguments expected")
+	}
+}
+
+func (p *parser) table() {
+	line := p.tok.line
+	p.expect("{")
+	for !p.is("}") {
+		switch {
+		case p.accept("["):
+			p.expr()
+			p.expect("]")
+			p.expect("=")
+			p.expr()
+		case p.tok.kind == tokname && p.peek().kind == toksym && p.peek().text == "=":
+			p.next()
+			p.next()
+			p.expr()
+		default:
+			p.expr()
+		}
+		if !p.accept(",") && !p.accept(";") {
+			break
+		}
+	}
+	p.expectmatch("}", "{", line)
+}
+
+func (p *parser) exprlist() {
+	p.expr()
+	for p.accept(",") {
+		p.expr()
+	}
+}
+
+func isbinary(t token) bool {
+	if t.kind != toksym {
+		return false
+	}
+	switch t.text {
+	case "+", "-", "*", "/", "%", "^", "..", "==", "~=", "<", "<=", ">", ">=", "and", "or":
+		return true
+	}
+	return false
+}
+
+// Parses an expression. Precedence does not matter for finding names, so
+// operators are simply chained.
+func (p *parser) expr() {
+	p.enter()
+	defer p.leave()
+	for {
+		for p.is("not") || p.is("-") || p.is("#") {
+			p.next()
+		}
+		p.simpleexp()
+		if !isbinary(p.tok) {
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *parser) simpleexp() {
+	switch {
+	case p.tok.kind == tokstring, p.tok.kind == toknumber:
+		p.next()
+	case p.is("nil"), p.is("true"), p.is("false"):
+		p.next()
+	case p.is("..."):
+		if !p.vararg {
+			p.fail("cannot use '...' outside a vararg function")
+		}
+		p.next()
+	case p.is("{"):
+		p.table()
+	case p.is("function"):
+		line := p.tok.line
+		p.next()
+		p.body(false, line)
+	default:
+		kind, name, line := p.suffixedexp()
+		if kind == expglobal {
+			p.use(name, line, false)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGlobals(t *testing.T) {
+	src := `#!/usr/bin/env luajit
+local print, t = print, {}
+x, t.y = 1, os.time()
+function helper(a, ...)
+	local n = select("#", ...) + #a
+	for i, v in ipairs(a) do n = n + v end
+	for i = 1, 0x10ULL do goto skip ::skip:: end
+	return n, [==[ long ]] string ]==], "\z
+		escaped \"quote\""
+end
+function string.trim(s) return (s:gsub("^%s+", "")) end
+function t:m() return self, undefinedvar end
+local function rec(n) return n > 0 and rec(n - 1) end
+repeat local done = true until done
+--[[ os.exit() ]] -- io.write()
+print(helper{1, 2, [k] = v, f = 1.5e3})
+`
+	refs, err := Globals("test.lua", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[{print 2 false} {x 3 true} {os 3 false} {helper 4 true} {select 5 false} " +
+		"{ipairs 6 false} {string 11 false} {undefinedvar 12 false} {helper 16 false} " +
+		"{k 16 false} {v 16 false}]"
+	if fmt.Sprint(refs) != want {
+		t.Errorf("expected %s, got %v", want, refs)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range []struct {
+		src, err string
+	}{
+		{`local os = {} os.exit()`, ""},
+		{`local f = function() return os.getenv("HOME") end`, "chunk:1: forbidden global 'os'"},
+		{`debug = nil`, "chunk:1: forbidden global 'debug'"},
+		{"x = 1\ny = (", "chunk:2: unexpected symbol near '<eof>'"},
+		{"x", "chunk:1: syntax error near '<eof>'"},
+		{"if x then\nx()\n", "chunk:3: 'end' expected (to close 'if' at line 1) near '<eof>'"},
+		{"s = \"abc\nx = 1", "chunk:1: unfinished string near '\"abc'"},
+		{`n = 3x`, "chunk:1: malformed number near '3x'"},
+		{`function f() return ... end`, "chunk:1: cannot use '...' outside a vararg function near '...'"},
+		{"return 1\nx = 2", "chunk:2: '<eof>' expected near 'x'"},
+	} {
+		err := Check("chunk", []byte(test.src), "os", "debug")
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %s", test.src, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: expected error %s, got %v", test.src, test.err, err)
+		}
+	}
+	if err := Check("chunk", []byte("os.exit()"), "os"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+}
+
+func TestNesting(t *testing.T) {
+	src := "x = " + strings.Repeat("(", 150) + "y" + strings.Repeat(")", 150)
+	if refs, err := Globals("chunk", []byte(src)); err != nil || len(refs) != 2 {
+		t.Errorf("expected x and y, got %v and %v", refs, err)
+	}
+	for _, src := range []string{
+		"x = " + strings.Repeat("(", 5000000),
+		strings.Repeat("do ", 5000000),
+		"x = " + strings.Repeat("{", 5000000),
+	} {
+		_, err := Globals("chunk", []byte(src))
+		var serr *Error
+		if !errors.As(err, &serr) || serr.Msg != "chunk has too many syntax levels" {
+			t.Errorf("%.10s...: expected too many syntax levels, got %v", src, err)
+		}
+	}
+}
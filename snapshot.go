@@ -0,0 +1,163 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+*/
+import "C"
+import "errors"
+
+// How deep Snapshotglobals looks for tables to capture: the globals
+// table, the tables in it such as the standard libraries, and the tables
+// in those such as package.loaded.
+const snapshotdepth = 2
+
+var errsnapshot = errors.New("snapshot released or from another state")
+
+// A Snapshot holds the contents of the global tables of a state at some
+// point, as taken by Snapshotglobals, for Restoreglobals to return to. It
+// is kept in the registry, and keeps the values it holds alive until it
+// is released.
+type Snapshot struct {
+	s   *State
+	ref int
+}
+
+// Takes a snapshot of the globals of s, so that a state can be reused for
+// one untrusted script after another, with Restoreglobals wiping out what
+// each left behind. The snapshot holds the fields and metatables of the
+// globals table, of the tables found in it and in those tables, such as
+// the standard libraries and package.loaded, and of the metatable of
+// strings. Deeper tables, and values such as the upvalues of functions,
+// are not captured, so scripts must not be able to modify the tables of
+// the host beyond those levels in ways that matter.
+func (s *State) Snapshotglobals() (*Snapshot, error) {
+	defer s.balanced("Snapshotglobals", 0)()
+	if err := s.grow(8); err != nil {
+		return nil, err
+	}
+	s.Createtable(0, 2)
+	snap := s.Gettop()
+	s.Newtable()
+	s.Setfield(snap, "fields")
+	s.Newtable()
+	s.Setfield(snap, "metas")
+	s.capture(snap, Globalsindex, snapshotdepth)
+	s.Pushstring("")
+	if int(C.lua_getmetatable(s.live(), -1)) != 0 {
+		s.capture(snap, s.Gettop(), 0)
+		s.Setfield(snap, "stringmeta")
+	}
+	s.Pop(1)
+	return &Snapshot{s, int(C.luaL_ref(s.live(), C.LUA_REGISTRYINDEX))}, nil
+}
+
+// Records in the snapshot at snap a copy of the fields of the table at t
+// and its metatable, and then of the tables in it down to depth.
+func (s *State) capture(snap, t, depth int) {
+	t = s.absindex(t)
+	s.Getfield(snap, "fields")
+	s.Pushvalue(t)
+	s.Rawget(-2)
+	if !s.Isnil(-1) {
+		s.Pop(2)
+		return
+	}
+	s.Pop(1)
+	s.Pushvalue(t)
+	s.Newtable()
+	saved := s.Gettop()
+	s.Pushnil()
+	for s.Next(t) != 0 {
+		s.Pushvalue(-2)
+		s.Pushvalue(-2)
+		s.Rawset(saved)
+		s.Pop(1)
+	}
+	s.Rawset(-3)
+	s.Pop(1)
+
+	s.Getfield(snap, "metas")
+	s.Pushvalue(t)
+	if int(C.lua_getmetatable(s.live(), C.int(t))) == 0 {
+		s.Pushboolean(false)
+	}
+	s.Rawset(-3)
+	s.Pop(1)
+
+	if depth == 0 {
+		return
+	}
+	s.Pushnil()
+	for s.Next(t) != 0 {
+		if s.Istable(-1) {
+			s.capture(snap, -1, depth-1)
+		}
+		s.Pop(1)
+	}
+}
+
+// Restores the globals of s to the snapshot sn: fields added to the
+// captured tables since are removed, changed and removed fields get their
+// old values back, and metatables, including that of strings, are reset,
+// all without invoking metamethods. Tables that scripts replaced are not reused, as the
+// captured tables themselves are put back in place.
+func (s *State) Restoreglobals(sn *Snapshot) error {
+	defer s.balanced("Restoreglobals", 0)()
+	if sn == nil || sn.s.l != s.l || sn.ref == C.LUA_NOREF {
+		return errsnapshot
+	}
+	if err := s.grow(8); err != nil {
+		return err
+	}
+	s.Rawgeti(Registryindex, sn.ref)
+	s.Getfield(-1, "metas")
+	s.Getfield(-2, "fields")
+	fields := s.Gettop()
+	s.Pushnil()
+	for s.Next(fields) != 0 {
+		t, saved := s.Gettop()-1, s.Gettop()
+		s.Pushnil()
+		for s.Next(t) != 0 {
+			s.Pop(1)
+			s.Pushvalue(-1)
+			s.Rawget(saved)
+			if s.Isnil(-1) {
+				s.Pushvalue(-2)
+				s.Insert(-2)
+				s.Rawset(t)
+			} else {
+				s.Pop(1)
+			}
+		}
+		s.Pushnil()
+		for s.Next(saved) != 0 {
+			s.Pushvalue(-2)
+			s.Insert(-2)
+			s.Rawset(t)
+		}
+		s.Pushvalue(t)
+		s.Rawget(fields - 1)
+		if !s.Istable(-1) {
+			s.Pop(1)
+			s.Pushnil()
+		}
+		C.lua_setmetatable(s.live(), C.int(t))
+		s.Pop(1)
+	}
+	s.Pushstring("")
+	s.Getfield(-4, "stringmeta")
+	C.lua_setmetatable(s.live(), -2)
+	s.Pop(4)
+	return nil
+}
+
+// Releases the snapshot, whose values may then be collected. The snapshot
+// cannot be used afterwards. Releasing a snapshot whose State is closed
+// does nothing.
+func (sn *Snapshot) Release() {
+	if sn.ref != C.LUA_NOREF && !sn.s.Closed() {
+		C.luaL_unref(sn.s.live(), C.LUA_REGISTRYINDEX, C.int(sn.ref))
+		sn.ref = C.LUA_NOREF
+	}
+}
@@ -0,0 +1,77 @@
+package luajit
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSnapshotglobals(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	run := func(code string) error {
+		err := s.Loadstring(code)
+		if err == nil {
+			err = s.Pcall(0, 0, 0)
+		}
+		if err != nil {
+			defer s.Pop(1)
+			return fmt.Errorf("%w: %s", err, s.Tostring(-1))
+		}
+		return nil
+	}
+	if err := s.Preloadchunk("mod", []byte(`return {}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(`config = {name = "host", limits = {n = 1}}`); err != nil {
+		t.Fatal(err)
+	}
+	sn, err := s.Snapshotglobals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sn.Release()
+
+	for i := 0; i < 2; i++ {
+		err := run(`
+			assert(leaked == nil and string.upper("x") == "X" and config.name == "host")
+			assert(package.loaded.mod == nil and getmetatable(_G) == nil and ("x"):len() == 1)
+			leaked = true
+			string.upper = nil
+			config.name = "changed"
+			config.limits = nil
+			require("mod")
+			setmetatable(_G, {__index = function() return 1 end})
+			getmetatable("").__index = {}
+			next = nil
+		`)
+		if err != nil {
+			t.Fatalf("run %d: %s", i+1, err.Error())
+		}
+		if err := s.Restoreglobals(sn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Loadstring(`return config.limits.n, type(next), leaked`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[1 function <nil>]" {
+		t.Errorf("unexpected globals %v", v)
+	}
+
+	other := Newstate()
+	if other == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer other.Close()
+	if other.Restoreglobals(sn) == nil {
+		t.Error("expected an error restoring a snapshot of another state")
+	}
+}
@@ -0,0 +1,117 @@
+package luajit
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Key of the sources kept by Keepsources in the Go data of a state, a
+// map from short source names to sources.
+type sourceskey struct{}
+
+// Makes s keep the source of every text chunk loaded from now on by Load,
+// Loadstring, Loadbuffer, and Loadfile, and so by Preloadchunk and the
+// searcher of Addsearcher, for Formaterror to show the lines that error
+// messages refer to. Sources are kept under their short source names (see
+// Shortsrc), so a chunk replaces any earlier one shown by the same name,
+// until Keepsources(false) forgets them all.
+func (s *State) Keepsources(on bool) {
+	if on {
+		if s.Data(sourceskey{}) == nil {
+			s.Setdata(sourceskey{}, make(map[string][]byte))
+		}
+	} else {
+		s.Setdata(sourceskey{}, nil)
+	}
+}
+
+func (s *State) keepsource(src []byte, chunkname string) {
+	if sources, ok := s.Data(sourceskey{}).(map[string][]byte); ok {
+		sources[Shortsrc(chunkname)] = bytes.Clone(src)
+	}
+}
+
+// Returns the error message msg with an excerpt of the source it refers
+// to, as Excerpt, taking sources from those kept by Keepsources.
+func (s *State) Formaterror(msg string) string {
+	sources, _ := s.Data(sourceskey{}).(map[string][]byte)
+	return Excerpt(msg, func(shortsrc string) []byte {
+		return sources[shortsrc]
+	})
+}
+
+// The position at the start of an error message, and the first name or
+// token the message quotes.
+var (
+	errorposition = regexp.MustCompile(`^([^\n]*?):(\d+): `)
+	errorquote    = regexp.MustCompile(`'([^'\n]+)'`)
+)
+
+// Returns the error message msg followed by the line of source it refers
+// to, for messages that start with a position such as "main.lua:3:", as
+// Lua's do. The source of the chunk is given by source, which is called
+// with the short source name of the position and returns nil if the source
+// is unknown, in which case msg is returned as it is. Under the line,
+// carets mark the first name or token that the message quotes, as in
+// "attempt to call global 'f'", if it appears on the line:
+//
+//	main.lua:3: attempt to call global 'f' (a nil value)
+//	    3 | local x = f(1)
+//	      |           ^
+func Excerpt(msg string, source func(shortsrc string) []byte) string {
+	m := errorposition.FindStringSubmatch(msg)
+	if m == nil {
+		return msg
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil || n < 1 {
+		return msg
+	}
+	src := source(m[1])
+	if src == nil {
+		return msg
+	}
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	if n > len(lines) {
+		return msg
+	}
+	first, rest, traceback := strings.Cut(msg, "\n")
+	quote := ""
+	if q := errorquote.FindStringSubmatch(first[len(m[0]):]); q != nil {
+		quote = q[1]
+	}
+	first += excerpt(lines[n-1], n, quote)
+	if traceback {
+		return first + "\n" + rest
+	}
+	return first
+}
+
+// Returns line n of a source, preceded by a line break, with carets under
+// quote, or under its first character if quote is not on the line.
+func excerpt(line string, n int, quote string) string {
+	line = strings.TrimRight(line, " \t\r")
+	gutter := strconv.Itoa(n)
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n    %s | %s", gutter, line)
+	col, width := strings.IndexFunc(line, func(r rune) bool { return r != ' ' && r != '\t' }), 1
+	if i := strings.Index(line, quote); quote != "" && i >= 0 {
+		col, width = i, len([]rune(quote))
+	}
+	if col < 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\n    %s | ", strings.Repeat(" ", len(gutter)))
+	for _, r := range line[:col] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", width))
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package luajit
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestExcerpt(t *testing.T) {
+	src := []byte("local t = {}\n\tlocal x = f(1)\n")
+	source := func(shortsrc string) []byte {
+		if shortsrc == "main.lua" {
+			return src
+		}
+		return nil
+	}
+	for _, test := range []struct {
+		msg, want string
+	}{
+		{"main.lua:2: attempt to call global 'f' (a nil value)",
+			"main.lua:2: attempt to call global 'f' (a nil value)\n    2 | \tlocal x = f(1)\n      | \t          ^"},
+		{"main.lua:1: boom\nstack traceback:\n\t[C]: in ?",
+			"main.lua:1: boom\n    1 | local t = {}\n      | ^\nstack traceback:\n\t[C]: in ?"},
+		{"other.lua:1: boom", "other.lua:1: boom"},
+		{"main.lua:9: boom", "main.lua:9: boom"},
+		{"no position", "no position"},
+	} {
+		if got := Excerpt(test.msg, source); got != test.want {
+			t.Errorf("expected %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestFormaterror(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	s.Keepsources(true)
+	fsys := fstest.MapFS{"util.lua": {Data: []byte("return {\n\tcheck = function(v) return v.field end,\n}")}}
+	if err := s.Addsearcher(fsys, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Loadbuffer([]byte("local util = require('util')\nutil.check(nil)"), Chunkfile("main.lua")); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "util.lua:2: attempt to index local 'v' (a nil value)\n" +
+		"    2 | \tcheck = function(v) return v.field end,\n" +
+		"      | \t                 ^"
+	if got := s.Formaterror(s.Tostring(-1)); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
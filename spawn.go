@@ -0,0 +1,150 @@
+package luajit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A function started with the spawn module of a Loop.
+type spawned struct {
+	l       *Loop // the loop that spawned it, through which await waits
+	done    chan struct{}
+	results []interface{}
+	err     error
+}
+
+// Makes the module "spawn" available to require, for scripts run by the
+// loop to run Lua functions in parallel on states of the pool p:
+//
+//	local spawn = require("spawn")
+//	h = spawn(fn, ...)	starts fn(...) on a pooled state
+//	... = h:await()		waits for fn and returns its results, or nil
+//				and the error message if it failed
+//	done = h:done()		reports whether fn has returned
+//
+// At most max spawned functions run at once; the others wait for their
+// turn, as they do for a state of the pool. Since fn runs in another
+// state, it is copied from its bytecode: it must not have upvalues, and
+// it sees the globals of the pooled state. Its arguments and results are
+// converted as by Tovalue and Push, so only plain data crosses states.
+// Like operations started with Async, await only lets other coroutines
+// run when called from a coroutine spawned by the loop. The package
+// library must be open.
+func (l *Loop) Openspawn(p *Pool, max int) error {
+	if max < 1 {
+		return errors.New("spawn limit must be positive")
+	}
+	sem := make(chan struct{}, max)
+	return l.s.Preload("spawn", func(s *State) int {
+		s.Pushfunction(func(s *State) int {
+			return l.spawn(s, p, sem)
+		})
+		return 1
+	})
+}
+
+// Starts the function called by spawn, and pushes its handle.
+func (l *Loop) spawn(s *State, p *Pool, sem chan struct{}) int {
+	if !s.Isfunction(1) || s.Iscfunction(1) {
+		return s.Errorf("bad argument #1 (Lua function expected, got %s)", s.Typename(s.Type(1)))
+	}
+	if _, err := s.Getupvalue(1, 1); err == nil {
+		return s.Errorf("bad argument #1 (function with upvalues cannot be spawned)")
+	}
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	s.Pushvalue(1)
+	err := s.Dump(w)
+	s.Pop(1)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return s.Errorf("cannot dump function: %s", err.Error())
+	}
+	args := make([]interface{}, s.Gettop()-1)
+	for i := range args {
+		if args[i], err = s.Tovalue(i + 2); err != nil {
+			return s.Errorf("bad argument #%d (%s)", i+2, err.Error())
+		}
+	}
+
+	h := &spawned{l: l, done: make(chan struct{})}
+	go func() {
+		defer close(h.done)
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		h.results, h.err = runspawned(p, buf.Bytes(), args)
+	}()
+
+	if err := s.grow(3); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	s.pushhandle(h)
+	if s.proxymeta("luajit.spawned") {
+		s.Createtable(0, 2)
+		s.Pushfunction(spawnedawait)
+		s.Setfield(-2, "await")
+		s.Pushfunction(spawneddone)
+		s.Setfield(-2, "done")
+		s.Setfield(-2, "__index")
+	}
+	s.Setmetatable(-2)
+	return 1
+}
+
+// Runs the function with bytecode code on a state of p, and returns its
+// results.
+func runspawned(p *Pool, code []byte, args []interface{}) ([]interface{}, error) {
+	t, err := p.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer p.Put(t)
+	if err := t.Loadbuffer(code, "=spawn"); err != nil {
+		err = fmt.Errorf("%w: %s", err, t.Tostring(-1))
+		t.Pop(1)
+		return nil, err
+	}
+	return t.callvalues("spawned function", args)
+}
+
+// Returns the handle that is the first argument of a Go function.
+func tospawned(s *State) (*spawned, error) {
+	obj, _ := s.toobject(1)
+	h, ok := obj.(*spawned)
+	if !ok {
+		return nil, fmt.Errorf("bad argument #1 (spawn handle expected, got %s)", s.Typename(s.Type(1)))
+	}
+	return h, nil
+}
+
+// The metatable of handles is shared by all the loops of a state, so the
+// methods find the loop in the handle.
+var spawnedawait Gofunction = func(s *State) int {
+	h, err := tospawned(s)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return h.l.wait(s, func() ([]interface{}, error) {
+		<-h.done
+		return h.results, h.err
+	})
+}
+
+var spawneddone Gofunction = func(s *State) int {
+	h, err := tospawned(s)
+	if err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	select {
+	case <-h.done:
+		s.Pushboolean(true)
+	default:
+		s.Pushboolean(false)
+	}
+	return 1
+}
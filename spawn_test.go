@@ -0,0 +1,138 @@
+package luajit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSpawn(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	p, err := Newpool(2, func(s *State) error {
+		s.Openlibs()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	l := s.Newloop()
+	if err := l.Openspawn(p, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Loadstring(`
+		local spawn = require("spawn")
+		local hs = {}
+		for i = 1, 4 do
+			hs[i] = spawn(function(n) return n * n end, i)
+		end
+		sum = 0
+		for _, h in ipairs(hs) do
+			sum = sum + h:await()
+		end
+		failed, msg = spawn(function() error("boom") end):await()
+		local x = 1
+		ok = pcall(spawn, function() return x end)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := l.Spawn(-1); err != nil {
+		t.Fatal(err)
+	}
+	s.Pop(1)
+	if err := l.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Getglobal("sum")
+	if n := s.Tointeger(-1); n != 30 {
+		t.Errorf("expected sum 30, got %d", n)
+	}
+	s.Getglobal("failed")
+	if !s.Isnil(-1) {
+		t.Errorf("expected nil from failed function, got %s", s.Typename(s.Type(-1)))
+	}
+	s.Getglobal("msg")
+	if !s.Isstring(-1) {
+		t.Errorf("expected error message, got %s", s.Typename(s.Type(-1)))
+	}
+	s.Getglobal("ok")
+	if s.Toboolean(-1) {
+		t.Error("spawned a function with upvalues")
+	}
+	s.Pop(4)
+}
+
+func TestSpawntwoloops(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	p, err := Newpool(1, func(s *State) error {
+		s.Openlibs()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// The first loop creates the metatable of handles.
+	l1 := s.Newloop()
+	if err := l1.Openspawn(p, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Loadstring(`require("spawn")(function() end):await()
+		package.loaded.spawn = nil
+		order = {}`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	// Handles of the second loop must wait through it, letting its other
+	// coroutines run.
+	l2 := s.Newloop()
+	if err := l2.Openspawn(p, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Loadstring(`return function()
+			local h = require("spawn")(function() return 1 end)
+			order[#order + 1] = "a"
+			h:await()
+			order[#order + 1] = "c"
+		end, function() order[#order + 1] = "b" end`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for _, index := range []int{1, 2} {
+		if err := l2.Spawn(index); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Pop(2)
+	if err := l2.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Getglobal("order")
+	order, err := s.Tostringslice(-1)
+	s.Pop(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("expected [a b c], got %v", order)
+	}
+}
@@ -1,6 +1,7 @@
 #include <lua.h>
 #include <lauxlib.h>
 #include <stddef.h>
+#include <stdint.h>
 #include <stdlib.h>
 #include <string.h>
 #include "_cgo_export.h"
@@ -11,9 +12,8 @@ enum {
 
 typedef struct Readbuf	Readbuf;
 struct Readbuf {
-	void*	reader;
-	char*	buf;
-	size_t	bufsz;
+	uintptr_t	reader;
+	char	buf[Bufsz];
 };
 
 /* a lua_Reader */
@@ -22,15 +22,11 @@ readchunk(lua_State *l, void *data, size_t *size)
 {
 	Readbuf *rb;
 	size_t sz;
-	
+
 	rb = data;
-	memset(rb->buf, 0, rb->bufsz);
-	sz = goreadchunk(rb->reader, rb->buf, rb->bufsz);
-	if(sz < 1){
-		free(rb->buf);
-		free(rb);
+	sz = goreadchunk(rb->reader, rb->buf, Bufsz);
+	if(sz < 1)
 		return NULL;
-	}
 	*size = sz;
 	return rb->buf;
 }
@@ -39,7 +35,7 @@ readchunk(lua_State *l, void *data, size_t *size)
 static int
 writechunk(lua_State *l, const void *p, size_t sz, void *ud)
 {
-	if(gowritechunk(ud, (void*)p, sz) != sz)
+	if(gowritechunk(*(uintptr_t*)ud, (void*)p, sz) != sz)
 		return 1;
 	return 0;
 }
@@ -51,43 +47,79 @@ newstate(void)
 }
 
 int
-load(lua_State *l, void *reader, const char *chunkname)
+load(lua_State *l, uintptr_t reader, const char *chunkname)
 {
-	char *buf;
 	Readbuf *rb;
-	
-	buf = malloc(Bufsz);		/* both allocs are freed by readchunk */
-	if(buf == NULL)
-		return LUA_ERRMEM;
+	int r;
+
 	rb = malloc(sizeof *rb);
-	if(rb == NULL){
-		free(buf);
+	if(rb == NULL)
 		return LUA_ERRMEM;
-	}
 	rb->reader = reader;
-	rb->buf = buf;
-	rb->bufsz = Bufsz;
-	return lua_load(l, readchunk, rb, chunkname);
+	r = lua_load(l, readchunk, rb, chunkname);
+	free(rb);
+	return r;
 }
 
 int
-dump(lua_State *l, void *ud)
+dump(lua_State *l, uintptr_t writer)
+{
+	return lua_dump(l, writechunk, &writer);
+}
+
+/* a lua_CFunction: the __gc metamethod of userdata holding a cgo.Handle */
+static int
+gchandle(lua_State *s)
+{
+	uintptr_t *h;
+
+	h = lua_touserdata(s, 1);
+	if(h != NULL && *h != 0){
+		godeletehandle(*h);
+		*h = 0;
+	}
+	return 0;
+}
+
+/* pushes a userdata holding the cgo.Handle h, which its __gc deletes */
+void
+pushgohandle(lua_State *s, uintptr_t h)
 {
-	return lua_dump(l, writechunk, ud);
+	uintptr_t *p;
+
+	p = lua_newuserdata(s, sizeof *p);
+	*p = h;
+	if(luaL_newmetatable(s, "luajit.handle")){
+		lua_pushcfunction(s, gchandle);
+		lua_setfield(s, -2, "__gc");
+	}
+	lua_setmetatable(s, -2);
 }
 
 /* a lua_CFunction */
 static int
 bounce(lua_State* s)
 {
-	void *fn;
+	uintptr_t *h;
+	int n;
 
-	fn = lua_touserdata(s, lua_upvalueindex(1));
-	return docallback(fn, s);
+	h = lua_touserdata(s, lua_upvalueindex(1));
+	n = docallback(*h, s);
+	if(n == Errorreturn)	/* raise the error on top of the stack */
+		return lua_error(s);
+	return n;		/* results, or -1 from lua_yield */
 }
 
 void
-pushclosure(lua_State *s, int n)
+pushclosure(lua_State *s, uintptr_t fn, int n)
 {
+	pushgohandle(s, fn);
+	lua_insert(s, -(n + 1));	/* the function goes in upvalue 1 */
 	lua_pushcclosure(s, bounce, n + 1);
 }
+
+int
+isgofunction(lua_State *s, int idx)
+{
+	return lua_tocfunction(s, idx) == bounce;
+}
@@ -1,28 +1,33 @@
 package luajit
 
 /*
-#cgo LDFLAGS: -lluajit
-#cgo linux LDFLAGS: -lm -ldl
-
 #include <lua.h>
 #include <lauxlib.h>
 #include <luajit.h>
 #include <lualib.h>
 #include <stddef.h>
+#include <stdint.h>
 #include <stdlib.h>
 
 extern lua_State*	newstate(void);
-extern int			load(lua_State*, void*, const char*);
-extern int			dump(lua_State*, void*);
-extern void		pushclosure(lua_State*, int);
+extern int			load(lua_State*, uintptr_t, const char*);
+extern int			dump(lua_State*, uintptr_t);
+extern void		pushclosure(lua_State*, uintptr_t, int);
+extern int			isgofunction(lua_State*, int);
+
+enum {
+	Errorreturn=	-2
+};
 */
 import "C"
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"reflect"
+	"os"
+	"runtime/cgo"
 	"unsafe"
 )
 
@@ -49,8 +54,7 @@ import (
 // 		sum := 0.0
 // 		for i := 1; i <= n; i++ {
 // 			if !s.Isnumber(i) {
-// 				s.Pushstring("incorrect argument")
-// 				s.Error()
+// 				return s.Errorf("incorrect argument")
 // 			}
 // 			sum += s.Tonumber(i)
 // 		}
@@ -58,19 +62,35 @@ import (
 // 		s.Pushnumber(sum)	// second result
 // 		return 2		// number of results
 // 	}
+//
+// A Go function must not call Error, as the long jump would skip over Go
+// frames; it raises errors by returning Errorf instead. A panic in a Go
+// function is turned into a Lua error as well.
 type Gofunction func(*State) int
 
+// Returned by a Go function to make the bouncer raise the error on top of
+// the stack. It must differ from the -1 returned by lua_yield.
+const errorreturn = C.Errorreturn
+
 // A State keeps all state of a LuaJIT interpreter.
 type State struct {
-	l *C.lua_State
+	l      *C.lua_State
+	anchor *anchor // for threads made by Newthread
+	closed *bool   // shared by a main state and its threads
 }
 
 // Creates & initializes a new State and returns a pointer to it. Returns
 // nil on error.
 func Newstate() *State {
-	s := &State{C.newstate()}
+	l := C.newstate()
+	if l == nil {
+		return nil
+	}
+	s := &State{l: l, closed: new(bool)}
 	s.Newtable()
 	s.Setglobal(namehooks)
+	s.newuniverse()
+	track(s)
 	return s
 }
 
@@ -83,7 +103,7 @@ func Newstate() *State {
 // flag can be Modeon to turn a feature on, Modeoff to turn a feature off,
 // or Modeflush to flush cached code.
 func (s *State) Setmode(idx, mode int) error {
-	if int(C.luaJIT_setmode(s.l, C.int(idx), C.int(mode))) == 0 {
+	if int(C.luaJIT_setmode(s.live(), C.int(idx), C.int(mode))) == 0 {
 		return nil
 	} else {
 		return errors.New("bad")
@@ -109,7 +129,7 @@ func (s *State) Setmode(idx, mode int) error {
 // Any error inside the called function is propagated upwards (with
 // a longjmp).
 func (s *State) Call(nargs, nresults int) {
-	C.lua_call(s.l, C.int(nargs), C.int(nresults))
+	C.lua_call(s.live(), C.int(nargs), C.int(nresults))
 }
 
 // Ensures that there are at least extra free stack slots in the stack. It
@@ -117,7 +137,19 @@ func (s *State) Call(nargs, nresults int) {
 // never shrinks the stack; if the stack is already larger than the new
 // size, it is left unchanged.
 func (s *State) Checkstack(extra int) bool {
-	return int(C.lua_checkstack(s.l, C.int(extra))) == 1
+	return int(C.lua_checkstack(s.live(), C.int(extra))) == 1
+}
+
+// Used by helpers that push several values: returns an error if the stack
+// cannot grow by extra slots, rather than letting LuaJIT overflow it.
+func (s *State) grow(extra int) error {
+	if s.Closed() {
+		return ErrClosed
+	}
+	if !s.Checkstack(extra) {
+		return errstack
+	}
+	return nil
 }
 
 // Destroys all objects in the given Lua state (calling the corresponding
@@ -127,8 +159,49 @@ func (s *State) Checkstack(extra int) bool {
 // host program ends. On the other hand, long-running programs, such as
 // a daemon or a web server, might need to release states as soon as they
 // are not needed, to avoid growing too large.
+//
+// Closing a closed state does nothing. Any other use of a closed state
+// panics with ErrClosed, although methods that return errors may return
+// ErrClosed instead. Closing a thread, such as one made by Newthread,
+// also does nothing, since LuaJIT would close its whole main state: the
+// thread is closed with it.
 func (s *State) Close() {
+	if s.Closed() || !s.ismain() {
+		return
+	}
+	untrack(s)
+	s.enduniverse()
 	C.lua_close(s.l)
+	s.l = nil
+	if s.closed != nil {
+		*s.closed = true
+	}
+}
+
+// Reports whether s is the main thread of its state, the one made by
+// Newstate.
+func (s *State) ismain() bool {
+	if int(C.lua_checkstack(s.l, 1)) == 0 {
+		panic(errstack)
+	}
+	main := int(C.lua_pushthread(s.l)) == 1
+	C.lua_settop(s.l, -2)
+	return main
+}
+
+// Returns true if the state has been closed, or is a thread whose main
+// state has been closed.
+func (s *State) Closed() bool {
+	return s.l == nil || s.closed != nil && *s.closed
+}
+
+// Returns the lua_State of s, panicking if s has been closed, so that
+// using a closed state fails in Go rather than crashing in LuaJIT.
+func (s *State) live() *C.lua_State {
+	if s.Closed() {
+		panic(ErrClosed)
+	}
+	return s.l
 }
 
 // Concatenates the n values at the top of the stack, pops them, and
@@ -137,59 +210,72 @@ func (s *State) Close() {
 // the result is the empty string. Concatenation is performed following
 // the usual semantics of Lua.
 func (s *State) Concat(n int) {
-	C.lua_concat(s.l, C.int(n))
+	C.lua_concat(s.live(), C.int(n))
 }
 
 // Returns true if the two values in valid indices i1 and i2 are equal,
 // following the semantics of the Lua == operator (that is, may call
 // metamethods). Otherwise returns false. Also returns false if any of the
-// indices is invalid.
+// indices is invalid. An error raised by a metamethod is not caught, as
+// with Call, so values with metamethods that may fail should be compared
+// in Lua under Pcall.
 func (s *State) Equal(i1, i2 int) bool {
-	return int(C.lua_equal(s.l, C.int(i1), C.int(i2))) == 1
+	return int(C.lua_equal(s.live(), C.int(i1), C.int(i2))) == 1
 }
 
 // Returns true if the value at valid index i1 is smaller than the value
 // at index i2, following the semantics of the Lua < operator (that is,
 // may call metamethods). Otherwise returns false. Also returns false if
-// any of the indices is invalid.
+// any of the indices is invalid. As with Equal, errors raised by
+// metamethods are not caught.
 func (s *State) Lessthan(i1, i2 int) bool {
-	return int(C.lua_lessthan(s.l, C.int(i1), C.int(i2))) == 1
+	return int(C.lua_lessthan(s.live(), C.int(i1), C.int(i2))) == 1
 }
 
+// The writer is passed to C as a cgo.Handle, since C may not keep Go
+// pointers, and the chunk is viewed in place as a slice.
+//
 //export gowritechunk
-func gowritechunk(writer, buf unsafe.Pointer, bufsz C.size_t) int {
-	w := (*bufio.Writer)(writer)
-	cb := (*C.char)(buf)
-	leng := int(bufsz)
-	var b []byte
-	hdr := (*reflect.SliceHeader)((unsafe.Pointer(&b)))
-	hdr.Cap = leng
-	hdr.Len = leng
-	hdr.Data = uintptr(unsafe.Pointer(cb))
-
-	n, _ := w.Write(b)
-	if n < leng {
-		return 0
-	}
-	return n
+func gowritechunk(writer C.uintptr_t, buf unsafe.Pointer, bufsz C.size_t) C.size_t {
+	w := cgo.Handle(writer).Value().(*bufio.Writer)
+	n, _ := w.Write(unsafe.Slice((*byte)(buf), int(bufsz)))
+	return C.size_t(n)
 }
 
 // Dumps a function as a binary chunk. Receives a Lua function on the top
 // of the stack and produces a binary chunk that, if loaded again, results
 // in a function equivalent to the one dumped. As it produces parts of the
-// chunk, Dump writes to w.
+// chunk, Dump writes to w; the caller is responsible for flushing it.
 //
 // This function does not pop the Lua function from the stack.
-func (s *State) Dump(w *io.Writer) error {
-	r := int(C.dump(s.l, unsafe.Pointer(w)))
+func (s *State) Dump(w *bufio.Writer) error {
+	h := cgo.NewHandle(w)
+	defer h.Delete()
+	r := int(C.dump(s.live(), C.uintptr_t(h)))
 	return numtoerror(r)
 }
 
 // Generates a Lua error. The error message (which can actually be a Lua
 // value of any type) must be on the stack top. This function does a long
 // jump, and therefore never returns.
+//
+// Go functions must not call it (see Gofunction): on Windows in particular,
+// where LuaJIT unwinds with structured exceptions, jumping over Go frames
+// crashes the program.
 func (s *State) Error() {
-	C.lua_error(s.l)
+	C.lua_error(s.live())
+}
+
+// Raises a Lua error from a Go function, with a message formatted as by
+// fmt.Sprintf and prefixed with the current position in the Lua code.
+// This function should only be called as the return expression of a Go
+// function, as follows:
+// 	return s.Errorf("bad value %d", n)
+func (s *State) Errorf(format string, v ...interface{}) int {
+	C.luaL_where(s.live(), 1)
+	s.Pushstring(fmt.Sprintf(format, v...))
+	s.Concat(2)
+	return errorreturn
 }
 
 // Controls the garbage collector.
@@ -197,21 +283,23 @@ func (s *State) Error() {
 // This function performs several tasks, according to the value of the
 // parameter what, which must be one of the luajit.GC* constants.
 func (s *State) Gc(what, data int) int {
-	return int(C.lua_gc(s.l, C.int(what), C.int(data)))
+	return int(C.lua_gc(s.live(), C.int(what), C.int(data)))
 }
 
 // Pushes onto the stack the environment table of the value at the given
 // index.
 func (s *State) Getfenv(index int) {
-	C.lua_getfenv(s.l, C.int(index))
+	C.lua_getfenv(s.live(), C.int(index))
 }
 
 // Pushes onto the stack the value t[k], where t is the value at the
 // given valid index.
 func (s *State) Getfield(index int, k string) {
-	cs := C.CString(k)
-	defer C.free(unsafe.Pointer(cs))
-	C.lua_getfield(s.l, C.int(index), cs)
+	cs, mustfree := cstring(k)
+	C.lua_getfield(s.live(), C.int(index), cs)
+	if mustfree {
+		C.free(unsafe.Pointer(cs))
+	}
 }
 
 // Gets information about a closure's upvalue. (For Lua functions, upvalues
@@ -226,7 +314,7 @@ func (s *State) Getfield(index int, k string) {
 // number of upvalues. For Go functions, this function uses the empty string
 // "" as a name for all upvalues.
 func (s *State) Getupvalue(funcindex, n int) (string, error) {
-	r := C.lua_getupvalue(s.l, C.int(funcindex), C.int(n))
+	r := C.lua_getupvalue(s.live(), C.int(funcindex), C.int(n))
 	if r == nil {
 		return "", errors.New("index exceeds number of upvalues")
 	}
@@ -241,7 +329,7 @@ func (s *State) Getglobal(name string) {
 // Pops a table from the stack and sets it as the new metatable for the
 // value at the given valid index.
 func (s *State) Setmetatable(index int) int {
-	return int(C.lua_setmetatable(s.l, C.int(index)))
+	return int(C.lua_setmetatable(s.live(), C.int(index)))
 }
 
 // Pushes onto the stack the value t[k], where t is the value at the
@@ -251,42 +339,63 @@ func (s *State) Setmetatable(index int) int {
 // in its place). As in Lua, this function may trigger a metamethod for
 // the "index" event
 func (s *State) Gettable(index int) {
-	C.lua_gettable(s.l, C.int(index))
+	C.lua_gettable(s.live(), C.int(index))
 }
 
 // Pushes onto the stack the metatable associated with name tname in the
 // registry.
 func (s *State) Getmetatable(index int) {
-	C.lua_getmetatable(s.l, C.int(index))
+	C.lua_getmetatable(s.live(), C.int(index))
+}
+
+// Pushes onto the stack the field e from the metatable of the object at
+// the given acceptable index and returns true. If the object does not
+// have a metatable, or if the metatable does not have this field, pushes
+// nothing and returns false. The field is read without invoking
+// metamethods.
+func (s *State) Getmetafield(obj int, e string) bool {
+	cs, mustfree := cstring(e)
+	if mustfree {
+		defer C.free(unsafe.Pointer(cs))
+	}
+	return int(C.luaL_getmetafield(s.live(), C.int(obj), cs)) != 0
+}
+
+// Calls a metamethod. If the object at index obj has a metatable and this
+// metatable has a field e, Callmeta calls this field, passing the object
+// as its only argument, pushes its result, and returns true. If there is
+// no metatable or no metamethod, Callmeta pushes nothing and returns
+// false. Unlike luaL_callmeta, the call is protected: if the metamethod
+// raises an error, Callmeta returns true and the error, leaving the error
+// message on the stack instead of the result, as Pcall.
+func (s *State) Callmeta(obj int, e string) (bool, error) {
+	obj = s.absindex(obj)
+	if !s.Getmetafield(obj, e) {
+		return false, nil
+	}
+	if err := s.grow(1); err != nil {
+		s.Pop(1)
+		return false, err
+	}
+	s.Pushvalue(obj)
+	return true, s.Pcall(1, 1, 0)
 }
 
 // Returns the index of the top element in the stack. Because indices start
 // at 1, this result is equal to the number of elements in the stack (and
 // so 0 means an empty stack).
 func (s *State) Gettop() int {
-	return int(C.lua_gettop(s.l))
+	return int(C.lua_gettop(s.live()))
 }
 
+// The reader is passed to C as a cgo.Handle, as for gowritechunk. A
+// result of 0 ends the chunk.
+//
 //export goreadchunk
-func goreadchunk(reader, buf unsafe.Pointer, buflen C.size_t) int {
-	r := (*bufio.Reader)(reader)
-	cb := (*C.char)(buf)
-	leng := int(buflen)
-	var b []byte
-	hdr := (*reflect.SliceHeader)((unsafe.Pointer(&b)))
-	hdr.Cap = leng
-	hdr.Len = leng
-	hdr.Data = uintptr(unsafe.Pointer(cb))
-	var i int
-
-	for i = 0; i < leng; i++ {
-		bb, err := r.ReadByte()
-		b[i] = bb
-		if bb < 1 || err != nil {
-			break
-		}
-	}
-	return i
+func goreadchunk(reader C.uintptr_t, buf unsafe.Pointer, buflen C.size_t) C.size_t {
+	r := cgo.Handle(reader).Value().(*bufio.Reader)
+	n, _ := r.Read(unsafe.Slice((*byte)(buf), int(buflen)))
+	return C.size_t(n)
 }
 
 // Reads a Lua chunk from a *bufio.Reader. If there are no errors, Load
@@ -301,9 +410,18 @@ func goreadchunk(reader, buf unsafe.Pointer, buflen C.size_t) int {
 // Load automatically detects whether the chunk is text or binary, and
 // loads it accordingly (see program luac).
 func (s *State) Load(chunk *bufio.Reader, chunkname string) error {
+	if s.loadhooked() {
+		src, err := io.ReadAll(chunk)
+		if err != nil {
+			return err
+		}
+		return s.hookedload(src, chunkname)
+	}
 	cs := C.CString(chunkname)
 	defer C.free(unsafe.Pointer(cs))
-	r := int(C.load(s.l, unsafe.Pointer(chunk), (*C.char)(unsafe.Pointer(cs))))
+	h := cgo.NewHandle(chunk)
+	defer h.Delete()
+	r := int(C.load(s.live(), C.uintptr_t(h), cs))
 	return numtoerror(r)
 }
 
@@ -311,9 +429,36 @@ func (s *State) Load(chunk *bufio.Reader, chunkname string) error {
 //
 // This function only loads the chunk; it does not run it.
 func (s *State) Loadstring(str string) error {
+	if s.loadhooked() {
+		return s.hookedload([]byte(str), str)
+	}
 	cs := C.CString(str)
 	defer C.free(unsafe.Pointer(cs))
-	r := int(C.luaL_loadstring(s.l, cs))
+	r := int(C.luaL_loadstring(s.live(), cs))
+	return numtoerror(r)
+}
+
+// Loads a buffer as a Lua chunk, which may be text or binary. Unlike
+// Loadstring, the chunk may contain embedded zeros, as precompiled chunks
+// do. The chunkname argument is used as in Load.
+//
+// This function only loads the chunk; it does not run it.
+func (s *State) Loadbuffer(buf []byte, chunkname string) error {
+	if s.loadhooked() {
+		return s.hookedload(buf, chunkname)
+	}
+	return s.loadbuffer(buf, chunkname)
+}
+
+// Loadbuffer without the preprocessor and the recording of sources.
+func (s *State) loadbuffer(buf []byte, chunkname string) error {
+	cs := C.CString(chunkname)
+	defer C.free(unsafe.Pointer(cs))
+	var p *C.char
+	if len(buf) > 0 {
+		p = (*C.char)(unsafe.Pointer(&buf[0]))
+	}
+	r := int(C.luaL_loadbuffer(s.live(), p, C.size_t(len(buf)), cs))
 	return numtoerror(r)
 }
 
@@ -322,9 +467,21 @@ func (s *State) Loadstring(str string) error {
 //
 // This function only loads the chunk; it does not run it.
 func (s *State) Loadfile(filename string) error {
+	if s.loadhooked() {
+		if src, err := os.ReadFile(filename); err == nil {
+			if len(src) > 0 && src[0] == '#' {
+				n := bytes.IndexAny(src, "\r\n")
+				if n < 0 {
+					n = len(src)
+				}
+				src = src[n:]
+			}
+			return s.hookedload(src, "@"+filename)
+		}
+	}
 	cs := C.CString(filename)
 	defer C.free(unsafe.Pointer(cs))
-	r := int(C.luaL_loadfile(s.l, cs))
+	r := int(C.luaL_loadfile(s.live(), cs))
 	return numtoerror(r)
 }
 
@@ -333,7 +490,7 @@ func (s *State) Loadfile(filename string) error {
 // elements. This pre-allocation is useful when you know exactly how many
 // elements the table will have. Otherwise you can use the function Newtable.
 func (s *State) Createtable(narr, nrec int) {
-	C.lua_createtable(s.l, C.int(narr), C.int(nrec))
+	C.lua_createtable(s.live(), C.int(narr), C.int(nrec))
 }
 
 // Creates a new empty table and pushes it onto the stack. It is equivalent
@@ -359,7 +516,7 @@ func (s *State) Newtable() {
 // 	}
 //
 func (s *State) Next(index int) int {
-	return int(C.lua_next(s.l, C.int(index)))
+	return int(C.lua_next(s.live(), C.int(index)))
 }
 
 // Creates a new thread, pushes it on the stack, and returns a pointer
@@ -368,14 +525,18 @@ func (s *State) Next(index int) int {
 // as tables), but has an independent execution stack.
 //
 // There is no explicit function to close or to destroy a thread. Threads
-// are subject to garbage collection, like any Lua object.
+// are subject to garbage collection, like any Lua object. The thread is
+// anchored in the registry, so that it is not collected while the
+// returned State is in use, even after it is popped from the stack; the
+// anchor is removed by Release, or some time after the State becomes
+// unreachable in Go.
 func (s *State) Newthread() *State {
-	l := C.lua_newthread(s.l)
-	return &State{l}
+	l := C.lua_newthread(s.live())
+	t := &State{l: l, closed: s.closed}
+	s.anchorthread(t)
+	return t
 }
 
-// void *lua_newuserdata (lua_State *L, size_t size);
-// TODO?
 // This function allocates a new block of memory with the given size,
 // pushes onto the stack a new full userdata with the block address, and
 // returns this address.
@@ -388,6 +549,11 @@ func (s *State) Newthread() *State {
 // When Lua collects a full userdata with a gc metamethod, Lua calls the
 // metamethod and marks the userdata as finalized. When this userdata is
 // collected again then Lua frees its corresponding memory.
+//
+// The block is C memory: it must not be used to hold Go pointers.
+func (s *State) Newuserdata(size int) unsafe.Pointer {
+	return C.lua_newuserdata(s.live(), C.size_t(size))
+}
 
 // Calls a function in protected mode.
 //
@@ -409,7 +575,7 @@ func (s *State) Newthread() *State {
 // information cannot be gathered after the return of Pcall, since by then
 // the stack has unwound.
 func (s *State) Pcall(nargs, nresults, errfunc int) error {
-	r := int(C.lua_pcall(s.l, C.int(nargs), C.int(nresults), C.int(errfunc)))
+	r := int(C.lua_pcall(s.live(), C.int(nargs), C.int(nresults), C.int(errfunc)))
 	return numtoerror(r)
 }
 
@@ -418,19 +584,19 @@ func (s *State) Pcall(nargs, nresults, errfunc int) error {
 // the length operator ('#'); for userdata, this is the size of the block
 // of memory allocated for the userdata; for other values, it is 0.
 func (s *State) Objlen(index int) int {
-	return int(C.lua_objlen(s.l, C.int(index)))
+	return int(C.lua_objlen(s.live(), C.int(index)))
 }
 
 // Opens all standard Lua libraries into the given state.
 func (s *State) Openlibs() {
-	C.luaL_openlibs(s.l)
+	C.luaL_openlibs(s.live())
 }
 
 // Accepts any valid index, or 0, and sets the stack top to this
 // index. If the new top is larger than the old one, then the new elements
 // are filled with nil. If index is 0, then all stack elements are removed.
 func (s *State) Settop(index int) {
-	C.lua_settop(s.l, C.int(index))
+	C.lua_settop(s.live(), C.int(index))
 }
 
 // Does the equivalent to t[k] = v, where t is the value at the given valid
@@ -440,7 +606,7 @@ func (s *State) Settop(index int) {
 // This function pops both the key and the value from the stack. As in Lua,
 // this function may trigger a metamethod for the "newindex" event.
 func (s *State) Settable(index int) {
-	C.lua_settable(s.l, C.int(index))
+	C.lua_settable(s.live(), C.int(index))
 }
 
 // Pops n elements from the stack.
@@ -452,7 +618,7 @@ func (s *State) Pop(index int) {
 // above this index to open space. Cannot be called with a pseudo-index,
 // because a pseudo-index is not an actual stack position.
 func (s *State) Insert(index int) {
-	C.lua_insert(s.l, C.int(index))
+	C.lua_insert(s.live(), C.int(index))
 }
 
 // Pops a value from the stack and sets it as the new value of global name.
@@ -466,9 +632,11 @@ func (s *State) Setglobal(name string) {
 // This function pops the value from the stack. As in Lua, this function
 // may trigger a metamethod for the "newindex" event
 func (s *State) Setfield(index int, k string) {
-	ck := C.CString(k)
-	defer C.free(unsafe.Pointer(ck))
-	C.lua_setfield(s.l, C.int(index), ck)
+	ck, mustfree := cstring(k)
+	C.lua_setfield(s.live(), C.int(index), ck)
+	if mustfree {
+		C.free(unsafe.Pointer(ck))
+	}
 }
 
 // Sets the value of a closure's upvalue. It assigns the value at the top
@@ -478,7 +646,7 @@ func (s *State) Setfield(index int, k string) {
 // Returns an error (and pops nothing) when the index is greater
 // than the number of upvalues.
 func (s *State) Setupvalue(funcindex, n int) (string, error) {
-	r := C.lua_setupvalue(s.l, C.int(funcindex), C.int(n))
+	r := C.lua_setupvalue(s.live(), C.int(funcindex), C.int(n))
 	if r == nil {
 		return "", errors.New("index exceeds number of upvalues")
 	}
@@ -491,18 +659,41 @@ func (s *State) Isfunction(index int) bool {
 	return s.Type(index) == Tfunction
 }
 
+// Returns true if the value at the given valid index is a C or Go
+// function, and false otherwise.
+func (s *State) Iscfunction(index int) bool {
+	return int(C.lua_iscfunction(s.live(), C.int(index))) != 0
+}
+
 // Returns true if the value at the given valid index is a number,
-// and false otherwise.
+// and false otherwise. Unlike lua_isnumber, Isnumber is false for
+// strings convertible to numbers; see Isnumberlike.
 func (s *State) Isnumber(index int) bool {
 	return s.Type(index) == Tnumber
 }
 
+// Returns true if the value at the given valid index is a number or a
+// string convertible to a number, and false otherwise, as lua_isnumber.
+// These are the values that Lua's arithmetic and Tonumber accept.
+func (s *State) Isnumberlike(index int) bool {
+	return int(C.lua_isnumber(s.live(), C.int(index))) != 0
+}
+
 // Returns true if the value at the given valid index is a string,
-// and false otherwise.
+// and false otherwise. Unlike lua_isstring, Isstring is false for
+// numbers; see Isstringlike.
 func (s *State) Isstring(index int) bool {
 	return s.Type(index) == Tstring
 }
 
+// Returns true if the value at the given valid index is a string or a
+// number, which is always convertible to a string, and false otherwise,
+// as lua_isstring. These are the values that Lua's concatenation and
+// Tostring accept.
+func (s *State) Isstringlike(index int) bool {
+	return int(C.lua_isstring(s.live(), C.int(index))) != 0
+}
+
 // Returns true if the value at the given valid index is a table,
 // and false otherwise.
 func (s *State) Istable(index int) bool {
@@ -522,10 +713,16 @@ func (s *State) Isuserdata(index int) bool {
 	return t == Tuserdata || t == Tlightuserdata
 }
 
+// Returns true if the value at the given acceptable index is a full
+// userdata, and false otherwise, including for light userdata.
+func (s *State) Isfulluserdata(index int) bool {
+	return s.Type(index) == Tuserdata
+}
+
 // Returns true if the value at the given valid index is a Go function,
 // and false otherwise.
 func (s *State) Isgofunction(index int) bool {
-	return int(C.lua_iscfunction(s.l, C.int(index))) == 1
+	return int(C.isgofunction(s.live(), C.int(index))) == 1
 }
 
 // Returns true if the value at the given valid index is nil,
@@ -562,17 +759,29 @@ func (s *State) Isnoneornil(index int) bool {
 // Pushes a boolean value with value b onto the stack.
 func (s *State) Pushboolean(b bool) {
 	if b {
-		C.lua_pushboolean(s.l, 1)
+		C.lua_pushboolean(s.live(), 1)
 	} else {
-		C.lua_pushboolean(s.l, 0)
+		C.lua_pushboolean(s.live(), 0)
 	}
 }
 
+// The Go function is passed to C as a cgo.Handle, held by a userdata in
+// the first upvalue of the C closure, whose __gc deletes the handle.
+//
 //export docallback
-func docallback(fp, sp unsafe.Pointer) int {
-	fn := *(*func(*State) int)(fp)
-	state := State{((*C.lua_State)(sp))}
-	return fn(&state)
+func docallback(fn C.uintptr_t, sp unsafe.Pointer) (n int) {
+	state := State{l: (*C.lua_State)(sp)}
+	defer func() {
+		if r := recover(); r != nil {
+			n = state.Errorf("%v", r)
+		}
+	}()
+	return cgo.Handle(fn).Value().(Gofunction)(&state)
+}
+
+//export godeletehandle
+func godeletehandle(h C.uintptr_t) {
+	cgo.Handle(h).Delete()
 }
 
 // Pushes a new Go closure onto the stack.
@@ -588,8 +797,8 @@ func docallback(fp, sp unsafe.Pointer) int {
 //
 // The maximum value for n is 254.
 func (s *State) Pushclosure(fn Gofunction, n int) {
-	C.lua_pushlightuserdata(s.l, unsafe.Pointer(&fn))
-	C.pushclosure(s.l, C.int(n))
+	defer s.balanced("Pushclosure", 1-n)()
+	C.pushclosure(s.live(), C.uintptr_t(cgo.NewHandle(fn)), C.int(n))
 }
 
 // Pushes a Go function onto the stack. This function receives a pointer to
@@ -606,16 +815,15 @@ func (s *State) Pushfunction(fn Gofunction) {
 // verbs found in package fmt.  Returns a pointer to the resultant
 // formatted string.
 func (s *State) Pushfstring(format string, v ...interface{}) *string {
-	str := fmt.Sprintf(format, v)
-	cs := C.CString(str)
-	defer C.free(unsafe.Pointer(cs))
-	C.lua_pushstring(s.l, cs)
+	defer s.balanced("Pushfstring", 1)()
+	str := fmt.Sprintf(format, v...)
+	s.Pushstring(str)
 	return &str
 }
 
 // Pushes a number with value n onto the stack.
 func (s *State) Pushinteger(n int) {
-	C.lua_pushinteger(s.l, C.lua_Integer(n))
+	C.lua_pushinteger(s.live(), C.lua_Integer(n))
 }
 
 // Pushes a light userdata onto the stack.
@@ -625,59 +833,68 @@ func (s *State) Pushinteger(n int) {
 // individual metatable, and it is not collected (as it was never created). A
 // light userdata is equal to "any" light userdata with the same address.
 func (s *State) Pushlightuserdata(p unsafe.Pointer) {
-	C.lua_pushlightuserdata(s.l, p)
+	C.lua_pushlightuserdata(s.live(), p)
 }
 
 // Pushes a nil value onto the stack.
 func (s *State) Pushnil() {
-	C.lua_pushnil(s.l)
+	C.lua_pushnil(s.live())
 }
 
 // Pushes a number with value n onto the stack.
 func (s *State) Pushnumber(n float64) {
-	C.lua_pushnumber(s.l, C.lua_Number(n))
+	C.lua_pushnumber(s.live(), C.lua_Number(n))
 }
 
-// Pushes the string str onto the stack.
+// Pushes the string str onto the stack. The string may contain zeros;
+// Lua makes its own copy of it.
 func (s *State) Pushstring(str string) {
-	cs := C.CString(str)
-	defer C.free(unsafe.Pointer(cs))
-	C.lua_pushstring(s.l, cs)
+	C.lua_pushlstring(s.live(), (*C.char)(unsafe.Pointer(unsafe.StringData(str))), C.size_t(len(str)))
+}
+
+// Pushes the bytes b onto the stack as a Lua string, like Pushstring.
+// Lua makes its own copy of b.
+func (s *State) Pushbytes(b []byte) {
+	var p *C.char
+	if len(b) > 0 {
+		p = (*C.char)(unsafe.Pointer(&b[0]))
+	}
+	C.lua_pushlstring(s.live(), p, C.size_t(len(b)))
 }
 
 // Pushes the thread represented by s onto the stack. Returns 1 if this
 // thread is the main thread of its state.
 func (s *State) Pushthread() int {
-	return int(C.lua_pushthread(s.l))
+	return int(C.lua_pushthread(s.live()))
 }
 
 // Pushes a copy of the element at the given valid index onto the stack.
 func (s *State) Pushvalue(index int) {
-	C.lua_pushvalue(s.l, C.int(index))
+	C.lua_pushvalue(s.live(), C.int(index))
 }
 
 // Returns true if the two values at valid indices i1 and i2 are
 // primitively equal (that is, without calling metamethods). Otherwise
 // returns false. Also returns false if any of the indices are invalid.
 func (s *State) Rawequal(i1, i2 int) bool {
-	return int(C.lua_rawequal(s.l, C.int(i1), C.int(i2))) == 1
+	return int(C.lua_rawequal(s.live(), C.int(i1), C.int(i2))) == 1
 }
 
 // Similar to Gettable, but does a raw access (i.e., without metamethods).
 func (s *State) Rawget(index int) {
-	C.lua_rawget(s.l, C.int(index))
+	C.lua_rawget(s.live(), C.int(index))
 }
 
 // Pushes onto the stack the value t[n], where t is the value at the given
 // valid index. The access is raw; that is, it does not invoke metamethods.
 func (s *State) Rawgeti(index, n int) {
-	C.lua_rawgeti(s.l, C.int(index), C.int(n))
+	C.lua_rawgeti(s.live(), C.int(index), C.int(n))
 }
 
 // Similar to Settable, but does a raw assignment (i.e., without
 // metamethods).
 func (s *State) Rawset(index int) {
-	C.lua_rawset(s.l, C.int(index))
+	C.lua_rawset(s.live(), C.int(index))
 }
 
 // Does the equivalent of t[n] = v, where t is the value at the given valid
@@ -686,27 +903,36 @@ func (s *State) Rawset(index int) {
 // This function pops the value from the stack. The assignment is raw;
 // that is, it does not invoke metamethods.
 func (s *State) Rawseti(index, n int) {
-	C.lua_rawseti(s.l, C.int(index), C.int(n))
+	C.lua_rawseti(s.live(), C.int(index), C.int(n))
 }
 
 // Sets the Go function fn as the new value of global name.
 func (s *State) Register(fn Gofunction, name string) {
+	defer s.balanced("Register", 0)()
 	s.Pushclosure(fn, 0)
 	s.Setglobal(name)
 }
 
+// Sets each Go function in fns as the new value of the global named by
+// its key, as Register does.
+func (s *State) Registerall(fns map[string]Gofunction) {
+	for name, fn := range fns {
+		s.Register(fn, name)
+	}
+}
+
 // Removes the element at the given valid index, shifting down the elements
 // above this index to fill the gap. Cannot be called with a pseudo-index,
 // because a pseudo-index is not an actual stack position.
 func (s *State) Remove(index int) {
-	C.lua_remove(s.l, C.int(index))
+	C.lua_remove(s.live(), C.int(index))
 }
 
 // Moves the top element into the given position (and pops it), without
 // shifting any element (therefore replacing the value at the given
 // position).
 func (s *State) Replace(index int) {
-	C.lua_replace(s.l, C.int(index))
+	C.lua_replace(s.live(), C.int(index))
 }
 
 // Starts and resumes a coroutine in a given thread.
@@ -727,7 +953,7 @@ func (s *State) Replace(index int) {
 // put on its stack only the values to be passed as results from the yield,
 // and then call Resume.
 func (s *State) Resume(narg int) (yield bool, e error) {
-	switch r := int(C.lua_resume(s.l, C.int(narg))); {
+	switch r := int(C.lua_resume(s.live(), C.int(narg))); {
 	case r == Yield:
 		return true, nil
 	case r == Ok:
@@ -743,7 +969,7 @@ func (s *State) Resume(narg int) (yield bool, e error) {
 // finished its execution with an error, or luajit.Yield if the thread
 // is suspended.
 func (s *State) Status() int {
-	return int(C.lua_status(s.l))
+	return int(C.lua_status(s.live()))
 }
 
 func (s *State) Strlen(index int) int {
@@ -756,12 +982,13 @@ func (s *State) Strlen(index int) int {
 // false when called with a non-valid index. (If you want to accept only
 // actual boolean values, use Isboolean to test the value's type.)
 func (s *State) Toboolean(index int) bool {
-	return int(C.lua_toboolean(s.l, C.int(index))) == 1
+	return int(C.lua_toboolean(s.live(), C.int(index))) == 1
 }
 
 // Converts a value at the given valid index to a Go function. That
 // value must be a Go function; otherwise, returns an error.
 func (s *State) Togofunction(index int) (Gofunction, error) {
+	defer s.balanced("Togofunction", 0)()
 	if !s.Isgofunction(index) {
 		nothing := func(s *State) int {
 			return 0
@@ -770,7 +997,7 @@ func (s *State) Togofunction(index int) (Gofunction, error) {
 	}
 	s.Getupvalue(index, 1)
 	defer s.Pop(1)
-	return *(*func(*State) int)(s.Touserdata(-1)), nil
+	return cgo.Handle(*(*C.uintptr_t)(s.Touserdata(-1))).Value().(Gofunction), nil
 }
 
 // Converts the Lua value at the given valid index to a Go int. The Lua
@@ -780,25 +1007,51 @@ func (s *State) Togofunction(index int) (Gofunction, error) {
 // If the number is not an integer, it is truncated in some non-specified
 // way.
 func (s *State) Tointeger(index int) int {
-	return int(C.lua_tointeger(s.l, C.int(index)))
+	return int(C.lua_tointeger(s.live(), C.int(index)))
+}
+
+// Like Tointeger, but also reports whether the value is a number or a
+// string convertible to a number, to tell a 0 from a value that is not a
+// number, as lua_tointegerx of Lua 5.2.
+func (s *State) Tointegerx(index int) (int, bool) {
+	if !s.Isnumberlike(index) {
+		return 0, false
+	}
+	return s.Tointeger(index), true
 }
 
 // Converts the Lua value at the given valid index to a float64. The
 // Lua value must be a number or a string convertible to a number; otherwise,
 // Tonumber returns 0.
 func (s *State) Tonumber(index int) float64 {
-	return float64(C.lua_tonumber(s.l, C.int(index)))
+	return float64(C.lua_tonumber(s.live(), C.int(index)))
+}
+
+// Like Tonumber, but also reports whether the value is a number or a
+// string convertible to a number, to tell a 0 from a value that is not a
+// number, as lua_tonumberx of Lua 5.2.
+func (s *State) Tonumberx(index int) (float64, bool) {
+	if !s.Isnumberlike(index) {
+		return 0, false
+	}
+	return s.Tonumber(index), true
 }
 
-// Converts the value at the given acceptable index to a uintptr. The
+// Converts the value at the given acceptable index to a pointer. The
 // value can be a userdata, a table, a thread, or a function; otherwise,
 // Topointer returns nil. Different objects will give different
 // pointers. There is no way to convert the pointer back to its original
 // value.
 //
-// Typically this function is used only for debug information.
+// LuaJIT does not move objects, so the pointer identifies the object for
+// as long as it is alive, and can serve as a map key for caches, memos,
+// and cycle detection, as Tovalue and Clone use it. Once the object is
+// collected its address may be reused, so a cache outliving the values
+// must keep them alive, for instance in a table in the registry (see
+// Setregistry). The pointer must not be dereferenced; convert it with
+// uintptr if an integer is wanted.
 func (s *State) Topointer(index int) unsafe.Pointer {
-	return C.lua_topointer(s.l, C.int(index))
+	return C.lua_topointer(s.live(), C.int(index))
 }
 
 // Converts the Lua value at the given valid index to a Go
@@ -809,29 +1062,42 @@ func (s *State) Topointer(index int) unsafe.Pointer {
 // traversal).  The string always has a zero ('\0') after its last
 // character (as in C), but can contain other zeros in its body.
 func (s *State) Tostring(index int) string {
-	str := C.lua_tolstring(s.l, C.int(index), nil)
+	var n C.size_t
+	str := C.lua_tolstring(s.live(), C.int(index), &n)
 	if str == nil {
 		return ""
 	}
-	return C.GoString(str)
+	return C.GoStringN(str, C.int(n))
+}
+
+// Converts the Lua value at the given valid index to a new byte slice
+// holding the whole string, zeros included, as Tostring does. Returns nil
+// if the value is neither a string nor a number.
+func (s *State) Tobytes(index int) []byte {
+	var n C.size_t
+	str := C.lua_tolstring(s.live(), C.int(index), &n)
+	if str == nil {
+		return nil
+	}
+	return C.GoBytes(unsafe.Pointer(str), C.int(n))
 }
 
 // Converts the value at the given valid index to a Lua thread
 // (represented as a *State). This value must be a thread; otherwise,
 // the function returns nil.
 func (s *State) Tothread(index int) *State {
-	t := C.lua_tothread(s.l, C.int(index))
+	t := C.lua_tothread(s.live(), C.int(index))
 	if t == nil {
 		return nil
 	}
-	return &State{t}
+	return &State{l: t, closed: s.closed}
 }
 
 // If the value at the given valid index is a full userdata, returns
 // its block address. If the value is a light userdata, returns its
 // pointer. Otherwise, returns unsafe.Pointer(nil).
 func (s *State) Touserdata(index int) unsafe.Pointer {
-	return C.lua_touserdata(s.l, C.int(index))
+	return C.lua_touserdata(s.live(), C.int(index))
 }
 
 // Returns the type of the value in the given valid index, or Tnone for
@@ -840,21 +1106,25 @@ func (s *State) Touserdata(index int) unsafe.Pointer {
 // const.go: Tnil, Tnumber, Tboolean, Tstring, Ttable, Tfunction, Tuserdata,
 // Tthread, and Tlightuserdata.
 func (s *State) Type(index int) int {
-	return int(C.lua_type(s.l, C.int(index)))
+	return int(C.lua_type(s.live(), C.int(index)))
 }
 
 // Returns the name of the type encoded by the value tp, which must be one
 // the values returned by Type.
 func (s *State) Typename(tp int) string {
-	return C.GoString(C.lua_typename(s.l, C.int(tp)))
+	return C.GoString(C.lua_typename(s.live(), C.int(tp)))
 }
 
 // Exchange values between different threads of the /same/ global state.
 //
 // This function pops n values from the stack from, and pushes them onto
-// the stack to.
+// the stack to. It panics if the two states do not share a global state,
+// instead of corrupting both.
 func (to *State) Xmove(from *State, n int) {
-	C.lua_xmove(from.l, to.l, C.int(n))
+	if !to.related(from) {
+		panic(errunrelated)
+	}
+	C.lua_xmove(from.live(), to.live(), C.int(n))
 }
 
 // Yields a coroutine.
@@ -868,5 +1138,5 @@ func (to *State) Xmove(from *State, n int) {
 // returns. The parameter nresults is the number of values from the stack
 // that are passed as results to Resume.
 func (s *State) Yield(nresults int) int {
-	return int(C.lua_yield(s.l, C.int(nresults)))
+	return int(C.lua_yield(s.live(), C.int(nresults)))
 }
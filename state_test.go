@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"runtime"
 	"strings"
+	"unsafe"
 )
 
 func (s *State) printstack(t *testing.T) {
@@ -153,6 +155,36 @@ func TestLoad(t *testing.T) {
 	s.Pop(3)
 }
 
+func TestLoaddump(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	if err := s.Loadstring(`local t = {} for i = 1, 300 do t[i] = i end return #t`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	var buf strings.Builder
+	w := bufio.NewWriter(&buf)
+	if err := s.Dump(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	s.Pop(1)
+
+	// binary chunks contain zeros and span several reads
+	if err := s.Load(bufio.NewReader(strings.NewReader(buf.String())), "=dumped"); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 300 {
+		t.Errorf("expected 300, got %d", n)
+	}
+	s.Pop(1)
+}
+
 func TestLoadstring(t *testing.T) {
 	txt := `
 		function f(x)
@@ -227,6 +259,70 @@ func TestRegister(t *testing.T) {
 	s.Pop(3)
 }
 
+func TestRegisterall(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s.Registerall(map[string]Gofunction{
+		"one": func(s *State) int { s.Pushnumber(1); return 1 },
+		"two": func(s *State) int { s.Pushnumber(2); return 1 },
+	})
+	if err := s.Loadstring(`return one() + two()`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	s.Pop(1)
+}
+
+func TestClose(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	if s.Closed() {
+		t.Error("expected open state")
+	}
+	s.Close()
+	s.Close()
+	if !s.Closed() {
+		t.Error("expected closed state")
+	}
+	if err := s.Push(1); err != ErrClosed {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	defer func() {
+		if r := recover(); r != ErrClosed {
+			t.Errorf("expected panic with ErrClosed, got %v", r)
+		}
+	}()
+	s.Pushnil()
+}
+
+func TestClosethread(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	th := s.Newthread()
+	th.Close()
+	if th.Closed() || s.Closed() {
+		t.Fatal("expected closing a thread to do nothing")
+	}
+	th.Pushinteger(1)
+	s.Pushinteger(2)
+	if th.Tointeger(-1) != 1 || s.Tointeger(-1) != 2 {
+		t.Errorf("expected 1 and 2, got %d and %d", th.Tointeger(-1), s.Tointeger(-1))
+	}
+}
+
 func TestXmove(t *testing.T) {
 	s := Newstate()
 	if s == nil {
@@ -261,6 +357,30 @@ func TestXmove(t *testing.T) {
 	}
 }
 
+func TestXmoveunrelated(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s.Close()
+	s2 := Newstate()
+	if s2 == nil {
+		t.Fatal("Newstate returned nil")
+	}
+	defer s2.Close()
+
+	s.Pushinteger(1)
+	defer func() {
+		if r := recover(); r != errunrelated {
+			t.Errorf("expected panic with %v, got %v", errunrelated, r)
+		}
+		if n := s.Gettop(); n != 1 {
+			t.Errorf("expected value left on stack, found %d elems", n)
+		}
+	}()
+	s2.Xmove(s, 1)
+}
+
 func TestResume(t *testing.T) {
 	txt := `
 		function f(x)
@@ -318,6 +438,36 @@ func TestResume(t *testing.T) {
 	}
 }
 
+func TestGofunctionGC(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	for i := 0; i < 100; i++ {
+		n := i
+		s.Pushfunction(func(s *State) int {
+			s.Pushinteger(n)
+			return 1
+		})
+		if i == 42 {
+			s.Setglobal("f")
+		} else {
+			s.Pop(1)
+		}
+	}
+	runtime.GC()
+	s.Gc(GCcollect, 0)
+	s.Getglobal("f")
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := s.Tointeger(-1); n != 42 {
+		t.Errorf("expected 42, got %d", n)
+	}
+}
+
 func TestTogofunction(t *testing.T) {
 	s := Newstate()
 	if s == nil {
@@ -356,3 +506,286 @@ func TestTogofunction(t *testing.T) {
 	}
 	s.Pop(1)
 }
+
+func TestPushclosure(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	s.Pushstring("a")
+	s.Pushnumber(2)
+	s.Pushclosure(func(s *State) int {
+		s.Pushvalue(Upvalueindex(1))
+		s.Pushvalue(Upvalueindex(2))
+		return 2
+	}, 2)
+	if s.Gettop() != 1 {
+		t.Fatalf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+	if _, err := s.Togofunction(-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if s.Tostring(1) != "a" || s.Tonumber(2) != 2 {
+		t.Errorf("expected a 2, got %s %s", s.Tostring(1), s.Tostring(2))
+	}
+}
+
+func TestPushstring(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	str := "a\x00b"
+	s.Pushstring(str)
+	s.Pushstring("")
+	if err := s.Push(str); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{str, "", str} {
+		if got := s.Tostring(i + 1); got != want {
+			t.Errorf("value %d: expected %q, got %q", i+1, want, got)
+		}
+	}
+	s.Pop(3)
+}
+
+func TestPushfstring(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	str := s.Pushfstring("%s=%d", "n", 3)
+	if *str != "n=3" || s.Tostring(-1) != "n=3" {
+		t.Errorf("expected n=3, got %q and %q", *str, s.Tostring(-1))
+	}
+	s.Pop(1)
+}
+
+func TestPushbytes(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	b := []byte("a\x00b\x00")
+	s.Pushbytes(b)
+	s.Pushbytes(nil)
+	if err := s.Push(b); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{len(b), 0, len(b)} {
+		if !s.Isstring(i + 1) {
+			t.Fatalf("value %d: expected string, got %s", i+1, s.Typename(s.Type(i+1)))
+		}
+		if n := s.Objlen(i + 1); n != want {
+			t.Errorf("value %d: expected length %d, got %d", i+1, want, n)
+		}
+	}
+	s.Pop(3)
+}
+
+func TestTobytes(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	b := []byte("a\x00b\x00")
+	s.Pushbytes(b)
+	if got := s.Tobytes(-1); string(got) != string(b) {
+		t.Errorf("expected %q, got %q", b, got)
+	}
+	if got := s.Tostring(-1); got != string(b) {
+		t.Errorf("expected %q, got %q", b, got)
+	}
+	s.Pushnumber(1.5)
+	if got := s.Tobytes(-1); string(got) != "1.5" {
+		t.Errorf("expected \"1.5\", got %q", got)
+	}
+	s.Pushnil()
+	if got := s.Tobytes(-1); got != nil {
+		t.Errorf("expected nil, got %q", got)
+	}
+	s.Pop(3)
+}
+
+func TestCallmeta(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`return setmetatable({}, {
+		__tostring = function() return "point" end,
+		__len = function() error("no length") end,
+		__index = function() return "computed" end,
+	}), {}`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 2, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	if !s.Getmetafield(1, "__index") || !s.Isfunction(-1) {
+		t.Error("expected the __index metamethod")
+	}
+	s.Pop(1)
+	if s.Getmetafield(1, "__call") || s.Getmetafield(2, "__index") {
+		t.Error("expected no metafield")
+	}
+	if ok, err := s.Callmeta(1, "__tostring"); !ok || err != nil || s.Tostring(-1) != "point" {
+		t.Errorf("unexpected result %v %v %s", ok, err, s.Tostring(-1))
+	}
+	s.Pop(1)
+	if ok, err := s.Callmeta(-2, "__len"); !ok || err == nil || !strings.HasSuffix(s.Tostring(-1), "no length") {
+		t.Errorf("expected an error, got %v %v %s", ok, err, s.Tostring(-1))
+	}
+	s.Pop(1)
+	if ok, err := s.Callmeta(2, "__tostring"); ok || err != nil {
+		t.Errorf("expected no metamethod, got %v %v", ok, err)
+	}
+	if s.Gettop() != 2 {
+		t.Errorf("expected 2 values on the stack, got %d", s.Gettop())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`
+		local mt = {
+			__eq = function(a, b) return a.v == b.v end,
+			__lt = function(a, b) return a.v < b.v end,
+		}
+		local function new(v) return setmetatable({v = v}, mt) end
+		return new(1), new(1), new(2)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 3, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if !s.Equal(1, 2) || s.Rawequal(1, 2) || s.Equal(1, 3) {
+		t.Error("expected __eq to decide equality")
+	}
+	if !s.Lessthan(1, 3) || s.Lessthan(3, 1) || s.Lessthan(1, 2) {
+		t.Error("expected __lt to decide order")
+	}
+	if s.Equal(1, 10) || s.Lessthan(1, 10) {
+		t.Error("expected false for an invalid index")
+	}
+}
+
+func TestTopointer(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`local t = {} return t, t, {}, print, 1`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 5, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	seen := make(map[unsafe.Pointer]int)
+	for i := 1; i <= 4; i++ {
+		p := s.Topointer(i)
+		if p == nil {
+			t.Fatalf("expected a pointer for value %d", i)
+		}
+		if _, ok := seen[p]; !ok {
+			seen[p] = i
+		}
+	}
+	s.Gc(GCcollect, 0)
+	if seen[s.Topointer(2)] != 1 || len(seen) != 3 {
+		t.Errorf("expected identities of 3 objects, got %v", seen)
+	}
+	if s.Topointer(5) != nil {
+		t.Error("expected nil for a number")
+	}
+}
+
+func TestIsnumberlike(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Pushnumber(1.5)
+	s.Pushstring(" 0x10 ")
+	s.Pushstring("ten")
+	s.Newuserdata(8)
+	s.Pushlightuserdata(s.Touserdata(-1))
+	s.Pushboolean(true)
+	for i, want := range []struct {
+		number, numberlike, str, strlike, full, ud bool
+	}{
+		{true, true, false, true, false, false},
+		{false, true, true, true, false, false},
+		{false, false, true, true, false, false},
+		{false, false, false, false, true, true},
+		{false, false, false, false, false, true},
+		{false, false, false, false, false, false},
+	} {
+		index := i + 1
+		got := struct {
+			number, numberlike, str, strlike, full, ud bool
+		}{s.Isnumber(index), s.Isnumberlike(index), s.Isstring(index),
+			s.Isstringlike(index), s.Isfulluserdata(index), s.Isuserdata(index)}
+		if got != want {
+			t.Errorf("value %d: expected %+v, got %+v", index, want, got)
+		}
+	}
+}
+
+func TestTonumberx(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Pushnumber(0)
+	s.Pushstring("2.5")
+	s.Pushstring("zero")
+	s.Pushnil()
+	for i, want := range []struct {
+		n  float64
+		i  int
+		ok bool
+	}{
+		{0, 0, true},
+		{2.5, 2, true},
+		{0, 0, false},
+		{0, 0, false},
+	} {
+		n, ok := s.Tonumberx(i + 1)
+		if n != want.n || ok != want.ok {
+			t.Errorf("Tonumberx(%d): expected %v %v, got %v %v", i+1, want.n, want.ok, n, ok)
+		}
+		in, ok := s.Tointegerx(i + 1)
+		if in != want.i || ok != want.ok {
+			t.Errorf("Tointegerx(%d): expected %v %v, got %v %v", i+1, want.i, want.ok, in, ok)
+		}
+	}
+}
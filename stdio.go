@@ -0,0 +1,187 @@
+package luajit
+
+import (
+	"io"
+	"strings"
+)
+
+// Registry field holding the default input and output files under
+// Setstdio, as fields input and output.
+const stdiofield = "luajit.stdio"
+
+// Gives the scripts of s standard streams of their own: io.stdin,
+// io.stdout, and io.stderr become files reading from stdin and writing to
+// stdout and stderr, so that a script can work as a filter between Go
+// readers and writers. A nil stdin reads as empty, and a nil stdout or
+// stderr discards what is written.
+//
+// The functions using the default files follow: io.read, io.lines without
+// a file name, io.write, io.flush, and io.close without a file start on
+// io.stdin and io.stdout, and io.input and io.output change the defaults,
+// opening files by name with io.open, so with Openfsio's io.open if that
+// was called first. print writes to stdout. Scripts cannot close the
+// standard files. If the io library is not open, Setstdio creates the io
+// table with the functions above.
+func (s *State) Setstdio(stdin io.Reader, stdout, stderr io.Writer) error {
+	defer s.balanced("Setstdio", 0)()
+	if stdin == nil {
+		stdin = strings.NewReader("")
+	}
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if err := s.grow(5); err != nil {
+		return err
+	}
+	s.iotable()
+	s.Createtable(0, 2)
+	for _, std := range []struct {
+		name, dflt string
+		f          interface{}
+	}{
+		{"stdin", "input", stdin},
+		{"stdout", "output", stdout},
+		{"stderr", "", stderr},
+	} {
+		s.pushfsfile(&fsfile{f: std.f, std: true})
+		if std.dflt != "" {
+			s.Pushvalue(-1)
+			s.Setfield(-3, std.dflt)
+		}
+		s.Setfield(-3, std.name)
+	}
+	s.Setfield(Registryindex, stdiofield)
+
+	s.Pushfunction(stdiomethod("input", "read"))
+	s.Setfield(-2, "read")
+	s.Pushfunction(stdiomethod("output", "write"))
+	s.Setfield(-2, "write")
+	s.Pushfunction(stdiomethod("output", "flush"))
+	s.Setfield(-2, "flush")
+	s.Getfield(-1, "close")
+	s.Pushclosure(stdiodefault(stdiomethod("output", "close")), 1)
+	s.Setfield(-2, "close")
+	s.Getfield(-1, "lines")
+	s.Pushclosure(stdiodefault(stdiomethod("input", "lines")), 1)
+	s.Setfield(-2, "lines")
+	s.Pushvalue(-1)
+	s.Pushclosure(stdioswitch("input", "r"), 1)
+	s.Setfield(-2, "input")
+	s.Pushvalue(-1)
+	s.Pushclosure(stdioswitch("output", "w"), 1)
+	s.Setfield(-2, "output")
+	s.Pop(1)
+
+	s.Pushfunction(func(s *State) int {
+		return stdioprint(s, stdout)
+	})
+	s.Setglobal("print")
+	return nil
+}
+
+// Pushes the default file named which.
+func (s *State) stdiofile(which string) {
+	s.Getfield(Registryindex, stdiofield)
+	s.Getfield(-1, which)
+	s.Remove(-2)
+}
+
+// Returns a function calling the method of the default file named which
+// with its arguments, as io.read calls the read method of the default
+// input.
+func stdiomethod(which, method string) Gofunction {
+	return func(s *State) int {
+		if err := s.grow(3); err != nil {
+			return s.Errorf("%s", err.Error())
+		}
+		s.stdiofile(which)
+		s.Getfield(-1, method)
+		s.Insert(1)
+		s.Insert(2)
+		if err := s.Pcall(s.Gettop()-1, Multret, 0); err != nil {
+			return errorreturn
+		}
+		return s.Gettop()
+	}
+}
+
+// Returns a function calling fn when called without arguments, and the
+// original function in upvalue 1 otherwise, as io.close without a file
+// closes the default output but io.close(f) closes f.
+func stdiodefault(fn Gofunction) Gofunction {
+	return func(s *State) int {
+		if s.Gettop() == 0 {
+			return fn(s)
+		}
+		s.Pushvalue(Upvalueindex(1))
+		s.Insert(1)
+		if err := s.Pcall(s.Gettop()-1, Multret, 0); err != nil {
+			return errorreturn
+		}
+		return s.Gettop()
+	}
+}
+
+// Returns io.input or io.output, which sets the default file named which
+// to a file, or to a file it opens by name with mode and the open function
+// of the io table in upvalue 1, and returns the default file.
+func stdioswitch(which, mode string) Gofunction {
+	return func(s *State) int {
+		s.Settop(1)
+		switch {
+		case s.Isnoneornil(1):
+		case s.Type(1) == Tstring || s.Type(1) == Tnumber:
+			s.Getfield(Upvalueindex(1), "open")
+			s.Pushvalue(1)
+			s.Pushstring(mode)
+			if err := s.Pcall(2, 2, 0); err != nil {
+				return errorreturn
+			}
+			if s.Isnil(-2) {
+				return s.Errorf("%s", s.Tostring(-1))
+			}
+			s.Pop(1)
+			s.Getfield(Registryindex, stdiofield)
+			s.Insert(-2)
+			s.Setfield(-2, which)
+			s.Pop(1)
+		default:
+			s.Getfield(Registryindex, stdiofield)
+			s.Pushvalue(1)
+			s.Setfield(-2, which)
+			s.Pop(1)
+		}
+		s.stdiofile(which)
+		return 1
+	}
+}
+
+// print, writing to w the arguments converted by the tostring function,
+// as the original print writes to the standard output of the process.
+func stdioprint(s *State, w io.Writer) int {
+	n := s.Gettop()
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		s.Getglobal("tostring")
+		s.Pushvalue(i)
+		if err := s.Pcall(1, 1, 0); err != nil {
+			return errorreturn
+		}
+		if !s.Isstring(-1) {
+			return s.Errorf("'tostring' must return a string to 'print'")
+		}
+		if i > 1 {
+			b.WriteByte('\t')
+		}
+		b.WriteString(s.Tostring(-1))
+		s.Pop(1)
+	}
+	b.WriteByte('\n')
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return 0
+}
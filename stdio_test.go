@@ -0,0 +1,46 @@
+package luajit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSetstdio(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	var stdout, stderr strings.Builder
+	if err := s.Setstdio(strings.NewReader("first 42\nsecond\nthird\n"), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Loadstring(`
+		local word, n = io.read("*l"):match("(%a+) (%d+)")
+		for line in io.lines() do
+			io.write(line:upper(), "\n")
+		end
+		print(word, tonumber(n) + 1)
+		io.stderr:write("warning")
+		return io.type(io.stdout), io.read(), select(2, io.close())
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	v, err := s.Pcallmulti(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(v) != "[file <nil> cannot close standard file]" {
+		t.Errorf("unexpected results %v", v)
+	}
+	if stdout.String() != "SECOND\nTHIRD\nfirst\t43\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+	if stderr.String() != "warning" {
+		t.Errorf("unexpected error output %q", stderr.String())
+	}
+}
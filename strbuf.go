@@ -0,0 +1,134 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+#include <stdlib.h>
+
+static void
+addchar(luaL_Buffer *b, char c)
+{
+	luaL_addchar(b, c);
+}
+*/
+import "C"
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+var errbufferdone = errors.New("use of buffer after Pushresult")
+
+// A Buffer builds a Lua string piece by piece, as luaL_Buffer does, without
+// concatenating on the stack or building the whole string in Go first. It
+// is also an io.Writer, so fmt.Fprintf and io.Copy can write into it.
+//
+// While a buffer is in use it keeps a variable number of values on the
+// stack, so a Go function cannot assume where the top of the stack is; it
+// may use the stack between additions as long as it leaves it balanced,
+// except for Addvalue, which takes the value on top. The string is pushed
+// by Pushresult, which must be called for the buffer to be finished.
+type Buffer struct {
+	s *State
+	b *C.luaL_Buffer
+}
+
+// Initializes a new Buffer building a string on the stack of s.
+func (s *State) Buffinit() *Buffer {
+	b := &Buffer{s: s, b: (*C.luaL_Buffer)(C.malloc(C.sizeof_luaL_Buffer))}
+	C.luaL_buffinit(s.live(), b.b)
+	runtime.SetFinalizer(b, (*Buffer).free)
+	return b
+}
+
+func (b *Buffer) free() {
+	if b.b != nil {
+		C.free(unsafe.Pointer(b.b))
+		b.b = nil
+	}
+}
+
+func (b *Buffer) live() *C.luaL_Buffer {
+	if b.b == nil {
+		panic(errbufferdone)
+	}
+	return b.b
+}
+
+// Adds the bytes of p to the buffer.
+func (b *Buffer) Addbytes(p []byte) {
+	if len(p) > 0 {
+		C.luaL_addlstring(b.live(), (*C.char)(unsafe.Pointer(&p[0])), C.size_t(len(p)))
+	}
+}
+
+// Adds the string str to the buffer.
+func (b *Buffer) Addstring(str string) {
+	if len(str) > 0 {
+		C.luaL_addlstring(b.live(), (*C.char)(unsafe.Pointer(unsafe.StringData(str))), C.size_t(len(str)))
+	}
+}
+
+// Adds the byte c to the buffer.
+func (b *Buffer) Addchar(c byte) {
+	C.addchar(b.live(), C.char(c))
+}
+
+// Adds the value on top of the stack, which must be a string or a number,
+// to the buffer and pops it.
+func (b *Buffer) Addvalue() {
+	C.luaL_addvalue(b.live())
+}
+
+// Finishes the buffer, leaving the string on top of the stack. The buffer
+// cannot be used afterwards.
+func (b *Buffer) Pushresult() {
+	C.luaL_pushresult(b.live())
+	b.free()
+	runtime.SetFinalizer(b, nil)
+}
+
+// Adds p to the buffer, for the io.Writer interface.
+func (b *Buffer) Write(p []byte) (int, error) {
+	if b.b == nil {
+		return 0, errbufferdone
+	}
+	b.Addbytes(p)
+	return len(p), nil
+}
+
+// Adds str to the buffer, for the io.StringWriter interface.
+func (b *Buffer) WriteString(str string) (int, error) {
+	if b.b == nil {
+		return 0, errbufferdone
+	}
+	b.Addstring(str)
+	return len(str), nil
+}
+
+// Adds c to the buffer, for the io.ByteWriter interface.
+func (b *Buffer) WriteByte(c byte) error {
+	if b.b == nil {
+		return errbufferdone
+	}
+	b.Addchar(c)
+	return nil
+}
+
+// Creates a copy of the string src replacing every occurrence of the
+// string pattern with the string repl, pushes it onto the stack, and
+// returns it, as luaL_gsub. The pattern is matched literally, not as a Lua
+// pattern; an empty pattern leaves src as it is. As the strings are passed
+// to C, they are cut at their first zero byte, if any.
+func (s *State) Gsub(src, pattern, repl string) string {
+	if pattern == "" {
+		s.Pushstring(src)
+		return src
+	}
+	csrc, cpattern, crepl := C.CString(src), C.CString(pattern), C.CString(repl)
+	defer C.free(unsafe.Pointer(csrc))
+	defer C.free(unsafe.Pointer(cpattern))
+	defer C.free(unsafe.Pointer(crepl))
+	return C.GoString(C.luaL_gsub(s.live(), csrc, cpattern, crepl))
+}
@@ -0,0 +1,75 @@
+package luajit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuffinit(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	s.Pushfunction(func(s *State) int {
+		n := s.Tointeger(1)
+		b := s.Buffinit()
+		for i := 1; i <= n; i++ {
+			if i > 1 {
+				b.Addchar(',')
+			}
+			fmt.Fprintf(b, "%d", i)
+		}
+		b.Addstring(";")
+		s.Pushnumber(1.5)
+		b.Addvalue()
+		b.Addbytes([]byte("\x00end"))
+		b.Pushresult()
+		return 1
+	})
+	s.Setglobal("join")
+
+	if err := s.Loadstring(`return join(1000)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	nums := make([]string, 1000)
+	for i := range nums {
+		nums[i] = fmt.Sprint(i + 1)
+	}
+	want := strings.Join(nums, ",") + ";1.5\x00end"
+	if got := s.Tostring(-1); got != want {
+		t.Errorf("unexpected result of length %d, %q", len(got), got[len(got)-20:])
+	}
+	if s.Gettop() != 1 {
+		t.Errorf("expected 1 value on the stack, got %d", s.Gettop())
+	}
+}
+
+func TestGsub(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	for _, test := range []struct {
+		src, pattern, repl, want string
+	}{
+		{"a.b.c", ".", "/", "a/b/c"},
+		{"?;?.lua", "?", "mod", "mod;mod.lua"},
+		{"%d%d", "%d", "x", "xx"},
+		{"abc", "", "x", "abc"},
+		{"abc", "z", "x", "abc"},
+	} {
+		got := s.Gsub(test.src, test.pattern, test.repl)
+		if got != test.want || s.Tostring(-1) != test.want {
+			t.Errorf("Gsub(%q, %q, %q): expected %q, got %q and %q on the stack",
+				test.src, test.pattern, test.repl, test.want, got, s.Tostring(-1))
+		}
+		s.Pop(1)
+	}
+}
@@ -0,0 +1,50 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// A Syntaxerror tells where a chunk fails to compile, as reported by
+// Checksyntax. It wraps the error for the status Errsyntax.
+type Syntaxerror struct {
+	Chunk string // the chunk name as shown in messages, such as [string "x"]
+	Line  int
+	Msg   string // the message without the position, such as "'=' expected near 'y'"
+}
+
+func (e *Syntaxerror) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Chunk, e.Line, e.Msg)
+}
+
+func (e *Syntaxerror) Unwrap() error {
+	return errs[Errsyntax]
+}
+
+var syntaxmessage = regexp.MustCompile(`(?s)^(.*?):(\d+): (.*)$`)
+
+// Compiles the Lua source src, without running it, and returns an error of
+// type *Syntaxerror if it is not valid. The name is used as the chunkname
+// in Load. Checksyntax compiles in a State of its own, so it may be
+// called from any goroutine, for instance to validate a script when a user
+// saves it.
+func Checksyntax(src []byte, name string) error {
+	s := Newstate()
+	if s == nil {
+		return errors.New("cannot create state: not enough memory")
+	}
+	defer s.Close()
+	err := s.Loadbuffer(src, name)
+	if err == nil || err != errs[Errsyntax] {
+		return err
+	}
+	msg := s.Tostring(-1)
+	m := syntaxmessage.FindStringSubmatch(msg)
+	if m == nil {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	line, _ := strconv.Atoi(m[2])
+	return &Syntaxerror{Chunk: m[1], Line: line, Msg: m[3]}
+}
@@ -0,0 +1,27 @@
+package luajit
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChecksyntax(t *testing.T) {
+	if err := Checksyntax([]byte("local x = 1\nreturn x + 1"), "=ok"); err != nil {
+		t.Fatal(err)
+	}
+	err := Checksyntax([]byte("local x = 1\nlocal y x = 2"), "=script.lua")
+	var serr *Syntaxerror
+	if !errors.As(err, &serr) {
+		t.Fatalf("expected a Syntaxerror, got %v", err)
+	}
+	if serr.Chunk != "script.lua" || serr.Line != 2 || serr.Msg != "'=' expected near 'x'" {
+		t.Errorf("unexpected error %#v", serr)
+	}
+	if !errors.Is(err, errs[Errsyntax]) {
+		t.Errorf("expected %v to wrap the syntax error status", err)
+	}
+	err = Checksyntax([]byte("f("), "a:b")
+	if !errors.As(err, &serr) || serr.Chunk != `[string "a:b"]` || serr.Line != 1 {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package luajit
+
+import "fmt"
+
+// Returns the number of keys in the table at the given valid index, in
+// both its array and hash parts, counting them with Next. Unlike Objlen,
+// which gives a border of the array part, Tablecount gives the number of
+// pairs that pairs would visit. Metamethods are not invoked. Returns 0 if
+// the value is not a table.
+func (s *State) Tablecount(index int) int {
+	if !s.Istable(index) || !s.Checkstack(2) {
+		return 0
+	}
+	index = s.absindex(index)
+	n := 0
+	s.Pushnil()
+	for s.Next(index) != 0 {
+		s.Pop(1)
+		n++
+	}
+	return n
+}
+
+// Returns the length of the sequence in the table at the given valid
+// index: the largest n such that the values at keys 1 to n are all
+// non-nil, which is where ipairs stops. For tables with holes, Objlen may
+// return any border, while Arraylen always returns the first. Values are
+// read with Rawgeti, without invoking metamethods. Returns 0 if the value
+// is not a table.
+func (s *State) Arraylen(index int) int {
+	if !s.Istable(index) || !s.Checkstack(1) {
+		return 0
+	}
+	n := 0
+	for {
+		s.Rawgeti(index, n+1)
+		isnil := s.Isnil(-1)
+		s.Pop(1)
+		if isnil {
+			return n
+		}
+		n++
+	}
+}
+
+// Returns the value at the given valid index formatted as tostring would
+// without metamethods: strings as they are, numbers as Lua formats them,
+// booleans and nil by name, and other values as their type and address,
+// such as "table: 0x40a1b2c8". Unlike Tostring, Keystring never changes
+// the value on the stack, so it is safe on a key during a traversal with
+// Next.
+func (s *State) Keystring(index int) string {
+	switch s.Type(index) {
+	case Tstring:
+		return s.Tostring(index)
+	case Tnumber:
+		if !s.Checkstack(1) {
+			return fmt.Sprint(s.Tonumber(index))
+		}
+		s.Pushvalue(index)
+		defer s.Pop(1)
+		return s.Tostring(-1)
+	case Tboolean:
+		return fmt.Sprint(s.Toboolean(index))
+	case Tnil, Tnone:
+		return "nil"
+	}
+	return fmt.Sprintf("%s: %p", s.Typename(s.Type(index)), s.Topointer(index))
+}
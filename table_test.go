@@ -0,0 +1,68 @@
+package luajit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTablecount(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	err := s.Loadstring(`
+		local holes = {1, 2, nil, 4}
+		holes[10] = 10
+		return {}, {1, 2, 3, x = 1, y = 2}, holes, setmetatable({}, {__index = {1, 2}}), "x"`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 5, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	for i, want := range []struct{ count, arraylen int }{
+		{0, 0}, {5, 3}, {4, 2}, {0, 0}, {0, 0},
+	} {
+		if c, n := s.Tablecount(i+1), s.Arraylen(-5+i); c != want.count || n != want.arraylen {
+			t.Errorf("value %d: expected %d keys and length %d, got %d and %d", i+1, want.count, want.arraylen, c, n)
+		}
+	}
+	if s.Gettop() != 5 {
+		t.Errorf("expected 5 values on the stack, got %d", s.Gettop())
+	}
+}
+
+func TestKeystring(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Loadstring(`return {[1] = "a", [2.5] = "b", x = "c", [true] = "d", [print] = "e"}`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	keys := make(map[string]string)
+	s.Pushnil()
+	for s.Next(1) != 0 {
+		k := s.Keystring(-2)
+		if s.Type(-2) == Tfunction {
+			if !strings.HasPrefix(k, "function: 0x") {
+				t.Errorf("unexpected function key %s", k)
+			}
+			k = "function"
+		}
+		keys[k] = s.Tostring(-1)
+		s.Pop(1)
+	}
+	want := map[string]string{"1": "a", "2.5": "b", "x": "c", "true": "d", "function": "e"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+}
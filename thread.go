@@ -0,0 +1,129 @@
+package luajit
+
+/*
+#include <lua.h>
+#include <lauxlib.h>
+
+// Returns the registry of the global state of l, which identifies it.
+static const void*
+registryof(lua_State *l)
+{
+	const void *p;
+
+	lua_pushvalue(l, LUA_REGISTRYINDEX);
+	p = lua_topointer(l, -1);
+	lua_pop(l, 1);
+	return p;
+}
+*/
+import "C"
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+var errunrelated = errors.New("cannot move values between unrelated states")
+
+// Registry field holding the id of the universe of a state, that is, of
+// the main state made by Newstate and its threads.
+const universefield = "luajit.universe"
+
+// The registry anchors of threads whose State was garbage collected, by
+// universe id, to be removed by the next Newthread in the same universe:
+// finalizers run on their own goroutine and cannot use the state. Only
+// universes that are still open are present, and ids are never reused,
+// so that a late finalizer cannot touch another state.
+var universes struct {
+	sync.Mutex
+	last    int
+	pending map[int][]int
+}
+
+func (s *State) newuniverse() {
+	universes.Lock()
+	if universes.pending == nil {
+		universes.pending = make(map[int][]int)
+	}
+	universes.last++
+	id := universes.last
+	universes.pending[id] = nil
+	universes.Unlock()
+	s.Pushinteger(id)
+	s.Setfield(Registryindex, universefield)
+}
+
+func (s *State) enduniverse() {
+	id := s.universe()
+	universes.Lock()
+	delete(universes.pending, id)
+	universes.Unlock()
+}
+
+// Returns the universe id of s.
+func (s *State) universe() int {
+	s.Getfield(Registryindex, universefield)
+	id := s.Tointeger(-1)
+	s.Pop(1)
+	return id
+}
+
+// Reports whether s and t are threads of the same global state, that is,
+// made from the same main state by Newthread or by Lua.
+func (s *State) related(t *State) bool {
+	if s.l == t.l {
+		return true
+	}
+	if int(C.lua_checkstack(s.live(), 1)) == 0 || int(C.lua_checkstack(t.live(), 1)) == 0 {
+		panic(errstack)
+	}
+	return C.registryof(s.l) == C.registryof(t.l)
+}
+
+// The registry reference keeping a thread made by Newthread alive.
+type anchor struct {
+	ref      int
+	universe int
+}
+
+// Anchors the thread t, on top of the stack, in the registry until it is
+// released or collected, and removes the anchors of collected threads.
+func (s *State) anchorthread(t *State) {
+	s.Pushvalue(-1)
+	a := &anchor{int(C.luaL_ref(s.l, C.LUA_REGISTRYINDEX)), s.universe()}
+	t.anchor = a
+	universes.Lock()
+	refs := universes.pending[a.universe]
+	if refs != nil {
+		universes.pending[a.universe] = nil
+	}
+	universes.Unlock()
+	for _, ref := range refs {
+		C.luaL_unref(s.l, C.LUA_REGISTRYINDEX, C.int(ref))
+	}
+	runtime.SetFinalizer(t, func(t *State) {
+		universes.Lock()
+		defer universes.Unlock()
+		if refs, ok := universes.pending[a.universe]; ok {
+			universes.pending[a.universe] = append(refs, a.ref)
+		}
+	})
+}
+
+// Removes the registry anchor of a thread made by Newthread, after which
+// the thread may be collected once Lua no longer refers to it. Does
+// nothing for other states, or if the thread's state is closed.
+func (s *State) Release() {
+	a := s.anchor
+	if a == nil {
+		return
+	}
+	s.anchor = nil
+	runtime.SetFinalizer(s, nil)
+	universes.Lock()
+	_, open := universes.pending[a.universe]
+	universes.Unlock()
+	if open {
+		C.luaL_unref(s.l, C.LUA_REGISTRYINDEX, C.int(a.ref))
+	}
+}
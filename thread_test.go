@@ -0,0 +1,55 @@
+package luajit
+
+import "testing"
+
+func TestNewthreadanchor(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	co := s.Newthread()
+	s.Pop(1)
+	s.Gc(GCcollect, 0)
+
+	if err := co.Loadstring(`return 1 + 2`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), co.Tostring(-1))
+	}
+	if _, err := co.Resume(0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), co.Tostring(-1))
+	}
+	if n := co.Tointeger(-1); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	co.Release()
+	co.Release()
+
+	s.Getfield(Registryindex, universefield)
+	if s.Tointeger(-1) == 0 {
+		t.Error("expected a universe id in the registry")
+	}
+	s.Pop(1)
+}
+
+func TestNewthreadclosed(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	co := s.Newthread()
+	other := s.Tothread(-1)
+	s.Close()
+	if !co.Closed() || !other.Closed() {
+		t.Fatal("expected threads of a closed state to be closed")
+	}
+	co.Close()
+	co.Release()
+	defer func() {
+		if r := recover(); r != ErrClosed {
+			t.Errorf("expected panic with ErrClosed, got %v", r)
+		}
+	}()
+	co.Pushnil()
+}
@@ -0,0 +1,163 @@
+package luajit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// The Go object through which Pushtime passes a time.Time to Lua, with
+// methods working in seconds, as Lua code does.
+type timevalue struct {
+	t time.Time
+}
+
+func (v timevalue) Unix() float64 {
+	return float64(v.t.UnixNano()) / 1e9
+}
+
+func (v timevalue) Format(layout string) string {
+	return v.t.Format(layout)
+}
+
+func (v timevalue) UTC() timevalue {
+	return timevalue{v.t.UTC()}
+}
+
+func (v timevalue) Date() (year, month, day int) {
+	y, m, d := v.t.Date()
+	return y, int(m), d
+}
+
+func (v timevalue) Clock() (hour, min, sec int) {
+	return v.t.Clock()
+}
+
+func (v timevalue) Add(sec float64) timevalue {
+	return timevalue{v.t.Add(seconds(sec))}
+}
+
+func (v timevalue) Sub(u timevalue) float64 {
+	return v.t.Sub(u.t).Seconds()
+}
+
+func (v timevalue) Equal(u timevalue) bool {
+	return v.t.Equal(u.t)
+}
+
+func (v timevalue) Less(u timevalue) bool {
+	return v.t.Before(u.t)
+}
+
+func (v timevalue) String() string {
+	return v.t.Format(time.RFC3339Nano)
+}
+
+// Returns the duration of sec seconds, rounded to the nanosecond.
+func seconds(sec float64) time.Duration {
+	return time.Duration(math.Round(sec * 1e9))
+}
+
+// Pushes t onto the stack as a userdata that keeps its full precision
+// and location, unlike the number of seconds Push gives. Lua code works
+// with it in seconds:
+//
+//	t:Unix()		seconds since January 1, 1970 UTC
+//	t:Format(layout)	formatted as by time.Time.Format
+//	t:UTC()			the same time in UTC
+//	t:Date(), t:Clock()	year, month and day; hour, minute and second
+//	t + sec			sec seconds later
+//	t - u			seconds from u to t
+//	t == u, t < u		comparisons
+//	tostring(t)		RFC 3339 with nanoseconds
+//
+// Unmarshal, and so Totime, convert such a userdata back to a time.Time.
+func (s *State) Pushtime(t time.Time) error {
+	return s.Pushobject(timevalue{t})
+}
+
+// Converts the value at the given valid index to a time.Time. It accepts
+// a userdata made by Pushtime, a number of seconds since January 1, 1970
+// UTC, or an RFC 3339 string.
+func (s *State) Totime(index int) (time.Time, error) {
+	var t time.Time
+	if s.Isnoneornil(index) {
+		return t, s.mismatch(index, "value", "time")
+	}
+	err := s.Unmarshal(index, &t)
+	return t, err
+}
+
+// Pushes d onto the stack as a number of seconds.
+func (s *State) Pushduration(d time.Duration) {
+	s.Pushnumber(d.Seconds())
+}
+
+// Converts the value at the given valid index to a time.Duration. It
+// accepts a number of seconds or a string parsed by time.ParseDuration,
+// such as "2h30m".
+func (s *State) Toduration(index int) (time.Duration, error) {
+	switch s.Type(index) {
+	case Tnumber:
+		return seconds(s.Tonumber(index)), nil
+	case Tstring:
+		return time.ParseDuration(s.Tostring(index))
+	}
+	return 0, fmt.Errorf("duration expected, got %s", s.Typename(s.Type(index)))
+}
+
+// Makes the module "time" available to require, for scripts to handle
+// times as Pushtime passes them:
+//
+//	time.now()			the current time
+//	time.unix(sec)			the time sec seconds after January 1,
+//					1970 UTC
+//	time.parse(value [, layout])	value parsed as by time.Parse, with
+//					layout defaulting to RFC 3339
+//	time.duration(str)		the seconds in a duration such as
+//					"2h30m"
+//
+// Parse errors are raised as Lua errors. The package library must be
+// open.
+func (s *State) Opentime() error {
+	return s.Preloadfuncs("time", map[string]Gofunction{
+		"now": func(s *State) int {
+			return pushtimeresult(s, time.Now())
+		},
+		"unix": func(s *State) int {
+			if !s.Isnumber(1) {
+				return s.Errorf("bad argument #1 (number expected, got %s)", s.Typename(s.Type(1)))
+			}
+			f := s.Tonumber(1)
+			sec := math.Floor(f)
+			return pushtimeresult(s, time.Unix(int64(sec), int64((f-sec)*1e9)))
+		},
+		"parse": func(s *State) int {
+			layout := time.RFC3339Nano
+			if s.Isstring(2) {
+				layout = s.Tostring(2)
+			}
+			t, err := time.Parse(layout, s.Tostring(1))
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			return pushtimeresult(s, t)
+		},
+		"duration": func(s *State) int {
+			d, err := time.ParseDuration(s.Tostring(1))
+			if err != nil {
+				return s.Errorf("%s", err.Error())
+			}
+			s.Pushduration(d)
+			return 1
+		},
+	})
+}
+
+// Pushes t as the result of a Go function.
+func pushtimeresult(s *State, t time.Time) int {
+	if err := s.Pushtime(t); err != nil {
+		return s.Errorf("%s", err.Error())
+	}
+	return 1
+}
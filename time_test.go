@@ -0,0 +1,58 @@
+package luajit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTime(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	if err := s.Opentime(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC)
+	err := s.Loadstring(`
+		local time = require("time")
+		local start = ...
+		local later = start + time.duration("2h30m")
+		assert(later - start == 9000)
+		assert(start < later and start == time.parse(tostring(start)))
+		local y, m, d = later:Date()
+		assert(y == 2024 and m == 3 and d == 1)
+		assert(later:Format("15:04") == "15:00")
+		assert(time.unix(0):UTC():Unix() == 0)
+		return later, "1.5s", 90
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pushtime(start); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Pcall(1, 3, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	later, err := s.Totime(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(150 * time.Minute); !later.Equal(want) {
+		t.Errorf("expected %v, got %v", want, later)
+	}
+	if d, err := s.Toduration(2); err != nil || d != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s, got %v, %v", d, err)
+	}
+	if d, err := s.Toduration(3); err != nil || d != 90*time.Second {
+		t.Errorf("expected 1m30s, got %v, %v", d, err)
+	}
+	s.Pop(3)
+	if _, err := s.Totime(1); err == nil {
+		t.Error("expected error converting none to time")
+	}
+}
@@ -0,0 +1,128 @@
+package luajit
+
+import (
+	"time"
+)
+
+// A timer set from Lua through the timer module of a Loop.
+type looptimer struct {
+	t     *time.Timer
+	fn    *Function
+	every time.Duration // zero for one-shot timers
+}
+
+// Makes the module "timer" available to require, for scripts run by the
+// loop to schedule callbacks without blocking the state:
+//
+//	id = timer.after(sec, fn)	calls fn once, after sec seconds
+//	id = timer.every(sec, fn)	calls fn every sec seconds, until
+//					cancelled
+//	timer.cancel(id)		cancels a timer
+//
+// Each callback runs as a new coroutine of the loop, so it may wait for
+// asynchronous operations. Run keeps running while timers are active.
+// Repeating timers are rearmed after each call, so they do not fire
+// faster than the loop can keep up with. The package library must be
+// open.
+func (l *Loop) Opentimer() error {
+	return l.s.Preloadfuncs("timer", map[string]Gofunction{
+		"after": func(s *State) int {
+			return l.settimer(s, false)
+		},
+		"every": func(s *State) int {
+			return l.settimer(s, true)
+		},
+		"cancel": func(s *State) int {
+			id := s.Tointeger(1)
+			if t, ok := l.timers[id]; ok {
+				t.t.Stop()
+				t.fn.Release()
+				delete(l.timers, id)
+			}
+			return 0
+		},
+	})
+}
+
+// Sets a timer for the arguments of timer.after or timer.every, and
+// returns its id.
+func (l *Loop) settimer(s *State, repeat bool) int {
+	d := time.Duration(s.Tonumber(1) * float64(time.Second))
+	if !s.Isnumber(1) || d < 0 || (repeat && d == 0) {
+		return s.Errorf("bad argument #1 (positive number of seconds expected)")
+	}
+	fn, err := s.Tofunction(2)
+	if err != nil {
+		return s.Errorf("bad argument #2 (%s)", err.Error())
+	}
+	l.lasttimer++
+	id := l.lasttimer
+	t := &looptimer{fn: fn}
+	if repeat {
+		t.every = d
+	}
+	t.t = time.AfterFunc(d, func() { l.timerfired(id) })
+	l.timers[id] = t
+	s.Pushinteger(id)
+	return 1
+}
+
+// Records that the timer id has fired, for Run to call its callback. It
+// never blocks, so that a timer firing after it was cancelled, or after
+// Run returned, does not leave its goroutine behind.
+func (l *Loop) timerfired(id int) {
+	l.firedmu.Lock()
+	l.fired = append(l.fired, id)
+	l.firedmu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Calls the callbacks of the timers that have fired. If one fails, the
+// timers after it are kept for the next call.
+func (l *Loop) firetimers() error {
+	l.firedmu.Lock()
+	ids := l.fired
+	l.fired = nil
+	l.firedmu.Unlock()
+	for i, id := range ids {
+		if err := l.firetimer(id); err != nil {
+			if rest := ids[i+1:]; len(rest) > 0 {
+				l.firedmu.Lock()
+				l.fired = append(rest, l.fired...)
+				l.firedmu.Unlock()
+				select {
+				case l.wake <- struct{}{}:
+				default:
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Calls the callback of the timer id, which has fired, unless it was
+// cancelled.
+func (l *Loop) firetimer(id int) error {
+	t, ok := l.timers[id]
+	if !ok {
+		return nil
+	}
+	if t.every > 0 {
+		t.t.Reset(t.every)
+	} else {
+		delete(l.timers, id)
+	}
+	if err := t.fn.Push(); err != nil {
+		return err
+	}
+	err := l.Spawn(-1)
+	l.s.Pop(1)
+	if t.every == 0 {
+		t.fn.Release()
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package luajit
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	l := s.Newloop()
+	if err := l.Opentimer(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.Loadstring(`
+		local timer = require("timer")
+		ticks, order = 0, {}
+		local id
+		id = timer.every(0.005, function()
+			ticks = ticks + 1
+			if ticks == 3 then timer.cancel(id) end
+		end)
+		timer.after(0.02, function() order[#order + 1] = "late" end)
+		timer.after(0, function() order[#order + 1] = "soon" end)
+		local never = timer.after(0.01, function() order[#order + 1] = "never" end)
+		timer.cancel(never)
+	`)
+	if err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := l.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s.Getglobal("ticks")
+	if n := s.Tointeger(-1); n != 3 {
+		t.Errorf("expected 3 ticks, got %d", n)
+	}
+	s.Pop(1)
+	s.Getglobal("order")
+	order, err := s.Tostringslice(-1)
+	s.Pop(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "soon" || order[1] != "late" {
+		t.Errorf("expected [soon late], got %v", order)
+	}
+}
+
+func TestTimercancelledafterfiring(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+	l := s.Newloop()
+	if err := l.Opentimer(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	if err := s.Loadstring(`id = require("timer").after(0, function() end)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	time.Sleep(20 * time.Millisecond) // the timer fires, but Run is not running
+	if err := s.Loadstring(`require("timer").cancel(id)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := l.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("expected at most %d goroutines, got %d", before, n)
+	}
+}
@@ -0,0 +1,41 @@
+package luajit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Pushes v onto the stack as a userdata of type T. Unlike Pushobject, the
+// value is kept exactly as given, so that Checkuserdata[T] gets it back
+// unchanged; its methods are available to Lua as described for
+// Pushobject. The metatable for T is registered once per State.
+func Pushuserdata[T any](s *State, v T) error {
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return errors.New("cannot push nil as userdata")
+	}
+	return s.pushobject(rv)
+}
+
+// Returns the value of type T held by the userdata at the given valid
+// index, which must have been pushed by Pushuserdata or Pushobject. If
+// the value is not a userdata holding a T, returns an error naming the
+// expected and actual types.
+func Checkuserdata[T any](s *State, index int) (T, error) {
+	var zero T
+	obj, ok := s.toobject(index)
+	if !ok {
+		return zero, fmt.Errorf("bad argument #%d (%s expected, got %s)",
+			index, reflect.TypeOf(&zero).Elem(), s.Typename(s.Type(index)))
+	}
+	v, ok := obj.(T)
+	if !ok {
+		return zero, fmt.Errorf("bad argument #%d (%s expected, got %T)",
+			index, reflect.TypeOf(&zero).Elem(), obj)
+	}
+	return v, nil
+}
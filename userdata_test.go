@@ -0,0 +1,43 @@
+package luajit
+
+import "testing"
+
+type testhandle struct{ id int }
+
+func (h testhandle) ID() int { return h.id }
+
+func TestUserdata(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+	s.Openlibs()
+
+	if err := Pushuserdata(s, testhandle{7}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := Checkuserdata[testhandle](s, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.id != 7 {
+		t.Errorf("expected 7, got %d", h.id)
+	}
+	if _, err := Checkuserdata[*testcounter](s, -1); err == nil {
+		t.Error("expected error for mismatched type")
+	}
+	s.Setglobal("h")
+	if err := s.Loadstring(`assert(h:ID() == 7)`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := s.Pcall(0, 0, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+
+	s.Pushinteger(1)
+	if _, err := Checkuserdata[testhandle](s, -1); err == nil {
+		t.Error("expected error for a number")
+	}
+	s.Pop(1)
+}
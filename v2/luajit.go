@@ -0,0 +1,157 @@
+// Package luajit provides an interface to LuaJIT, a just-in-time compiler
+// and interpreter for the Lua programming language.
+//
+// This is the second major version of the API. It follows Go naming
+// (GetTop, PushString, ToNumber), groups related constants under typed
+// enums such as Type and Status, and configures new states through
+// functional options:
+//
+//	s, err := luajit.New(luajit.WithLibs(), luajit.WithRandom(src))
+//
+// The first version, github.com/serialx/luajit, is unchanged and remains
+// supported. For now this package is a thin layer over it: V1 returns the
+// underlying State, through which any part of the original API not yet
+// mirrored here stays available.
+package luajit
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"time"
+
+	v1 "github.com/serialx/luajit"
+)
+
+const (
+	Version       = v1.Version
+	VersionNum    = v1.Versionnum
+	Copyright     = v1.Copyright
+	MultRet       = v1.Multret       // option for multiple returns in Call and PCall
+	MinStack      = v1.Minstack      // minimum Lua stack available to a Go function
+	RegistryIndex = v1.Registryindex // pseudo-index of the registry
+	EnvironIndex  = v1.Environindex  // pseudo-index of the running Go function's environment
+	GlobalsIndex  = v1.Globalsindex  // pseudo-index of the thread environment
+)
+
+// Returned by helpers, and used as the panic value by other methods, when
+// a State is used after Close.
+var ErrClosed = v1.ErrClosed
+
+// Returns the pseudo-index for the nth upvalue of a Go closure.
+func UpvalueIndex(n int) int {
+	return v1.Upvalueindex(n)
+}
+
+// The type of a Lua value.
+type Type int
+
+const (
+	TypeNone          Type = v1.Tnone
+	TypeNil           Type = v1.Tnil
+	TypeBoolean       Type = v1.Tboolean
+	TypeLightUserdata Type = v1.Tlightuserdata
+	TypeNumber        Type = v1.Tnumber
+	TypeString        Type = v1.Tstring
+	TypeTable         Type = v1.Ttable
+	TypeFunction      Type = v1.Tfunction
+	TypeUserdata      Type = v1.Tuserdata
+	TypeThread        Type = v1.Tthread
+	TypeCData         Type = v1.Tcdata
+)
+
+var typenames = map[Type]string{
+	TypeNone:          "no value",
+	TypeNil:           "nil",
+	TypeBoolean:       "boolean",
+	TypeLightUserdata: "userdata",
+	TypeNumber:        "number",
+	TypeString:        "string",
+	TypeTable:         "table",
+	TypeFunction:      "function",
+	TypeUserdata:      "userdata",
+	TypeThread:        "thread",
+	TypeCData:         "cdata",
+}
+
+// Returns the name Lua uses for the type, as the type function does.
+func (t Type) String() string {
+	if name, ok := typenames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// The status of a thread, or the outcome of loading or running a chunk.
+type Status int
+
+const (
+	StatusOK        Status = v1.Ok
+	StatusYield     Status = v1.Yield
+	StatusErrRun    Status = v1.Errrun
+	StatusErrSyntax Status = v1.Errsyntax
+	StatusErrMem    Status = v1.Errmem
+	StatusErrErr    Status = v1.Errerr
+)
+
+func (st Status) String() string {
+	return v1.Status(st).String()
+}
+
+// An Option configures a State created by New.
+type Option func(s *State) error
+
+// Opens all standard Lua libraries.
+func WithLibs() Option {
+	return func(s *State) error {
+		s.s.Openlibs()
+		return nil
+	}
+}
+
+// Draws math.random from src; see the Setrandom method of the first
+// version of the API.
+func WithRandom(src rand.Source) Option {
+	return func(s *State) error {
+		return s.s.Setrandom(src)
+	}
+}
+
+// Takes os.time, os.clock, and os.date from now; see the Setclock method
+// of the first version of the API.
+func WithClock(now func() time.Time) Option {
+	return func(s *State) error {
+		return s.s.Setclock(now)
+	}
+}
+
+// Lets require load modules from fsys, searched for along path; see the
+// Addsearcher method of the first version of the API.
+func WithSearcher(fsys fs.FS, path string) Option {
+	return func(s *State) error {
+		return s.s.Addsearcher(fsys, path)
+	}
+}
+
+// Runs setup on the new State, for configuration not covered by the other
+// options.
+func WithSetup(setup func(s *State) error) Option {
+	return setup
+}
+
+// Creates a new State and applies the options to it in order. If an option
+// fails, the State is closed and the error is returned.
+func New(opts ...Option) (*State, error) {
+	ls := v1.Newstate()
+	if ls == nil {
+		return nil, errors.New("cannot create state")
+	}
+	s := &State{s: ls}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,428 @@
+package luajit
+
+import (
+	v1 "github.com/serialx/luajit"
+)
+
+// A State keeps all state of a LuaJIT interpreter.
+type State struct {
+	s *v1.State
+}
+
+// A GoFunction is a Go function that may be registered with the Lua
+// interpreter and called by Lua programs. It follows the protocol of
+// Gofunction in the first version of the API: arguments arrive on the
+// stack in order, and the function pushes its results and returns how
+// many there are.
+type GoFunction func(s *State) int
+
+func (fn GoFunction) v1() v1.Gofunction {
+	return func(ls *v1.State) int {
+		return fn(&State{s: ls})
+	}
+}
+
+// Wraps a State of the first version of the API, such as one made by a
+// Pool, without taking ownership of it.
+func Wrap(s *v1.State) *State {
+	return &State{s: s}
+}
+
+// Returns the underlying State of the first version of the API, which
+// shares the interpreter and stack with s.
+func (s *State) V1() *v1.State {
+	return s.s
+}
+
+// Destroys all objects in the State and frees all dynamic memory it uses.
+func (s *State) Close() {
+	s.s.Close()
+}
+
+// Reports whether Close has been called.
+func (s *State) Closed() bool {
+	return s.s.Closed()
+}
+
+// Returns the index of the top element in the stack, which is also the
+// number of elements in it.
+func (s *State) GetTop() int {
+	return s.s.Gettop()
+}
+
+// Accepts any acceptable index, or 0, and sets the stack top to it,
+// filling new elements with nil or removing the excess.
+func (s *State) SetTop(index int) {
+	s.s.Settop(index)
+}
+
+// Pops n elements from the stack.
+func (s *State) Pop(n int) {
+	s.s.Pop(n)
+}
+
+// Pushes a copy of the element at the given valid index.
+func (s *State) PushValue(index int) {
+	s.s.Pushvalue(index)
+}
+
+// Removes the element at the given valid index, shifting down the
+// elements above it.
+func (s *State) Remove(index int) {
+	s.s.Remove(index)
+}
+
+// Moves the top element into the given valid index, shifting up the
+// elements above it.
+func (s *State) Insert(index int) {
+	s.s.Insert(index)
+}
+
+// Moves the top element into the given position, replacing the value
+// there, and pops it.
+func (s *State) Replace(index int) {
+	s.s.Replace(index)
+}
+
+// Ensures there are at least extra free stack slots. Returns false if it
+// cannot grow the stack to that size.
+func (s *State) CheckStack(extra int) bool {
+	return s.s.Checkstack(extra)
+}
+
+// Returns the type of the value at the given acceptable index, or
+// TypeNone for a non-valid index.
+func (s *State) Type(index int) Type {
+	return Type(s.s.Type(index))
+}
+
+// Reports whether the value at the given acceptable index is nil.
+func (s *State) IsNil(index int) bool {
+	return s.s.Isnil(index)
+}
+
+// Reports whether the given acceptable index is not valid.
+func (s *State) IsNone(index int) bool {
+	return s.s.Isnone(index)
+}
+
+// Reports whether the given acceptable index is not valid or holds nil.
+func (s *State) IsNoneOrNil(index int) bool {
+	return s.s.Isnoneornil(index)
+}
+
+// Reports whether the value at the given acceptable index is a boolean.
+func (s *State) IsBoolean(index int) bool {
+	return s.s.Isboolean(index)
+}
+
+// Reports whether the value at the given acceptable index is a number.
+// Unlike lua_isnumber, IsNumber is false for strings convertible to
+// numbers; see IsNumberLike.
+func (s *State) IsNumber(index int) bool {
+	return s.s.Isnumber(index)
+}
+
+// Reports whether the value at the given acceptable index is a number
+// or a string convertible to a number, as lua_isnumber.
+func (s *State) IsNumberLike(index int) bool {
+	return s.s.Isnumberlike(index)
+}
+
+// Reports whether the value at the given acceptable index is a string.
+// Unlike lua_isstring, IsString is false for numbers; see IsStringLike.
+func (s *State) IsString(index int) bool {
+	return s.s.Isstring(index)
+}
+
+// Reports whether the value at the given acceptable index is a string
+// or a number, which is always convertible to a string, as lua_isstring.
+func (s *State) IsStringLike(index int) bool {
+	return s.s.Isstringlike(index)
+}
+
+// Reports whether the value at the given acceptable index is a table.
+func (s *State) IsTable(index int) bool {
+	return s.s.Istable(index)
+}
+
+// Reports whether the value at the given acceptable index is a function,
+// either Lua or Go.
+func (s *State) IsFunction(index int) bool {
+	return s.s.Isfunction(index)
+}
+
+// Reports whether the value at the given acceptable index is a Go
+// function.
+func (s *State) IsGoFunction(index int) bool {
+	return s.s.Isgofunction(index)
+}
+
+// Reports whether the value at the given acceptable index is a userdata,
+// either full or light.
+func (s *State) IsUserdata(index int) bool {
+	return s.s.Isuserdata(index)
+}
+
+// Reports whether the value at the given acceptable index is a thread.
+func (s *State) IsThread(index int) bool {
+	return s.s.Isthread(index)
+}
+
+// Pushes a nil value onto the stack.
+func (s *State) PushNil() {
+	s.s.Pushnil()
+}
+
+// Pushes a boolean value onto the stack.
+func (s *State) PushBoolean(b bool) {
+	s.s.Pushboolean(b)
+}
+
+// Pushes a number onto the stack.
+func (s *State) PushNumber(n float64) {
+	s.s.Pushnumber(n)
+}
+
+// Pushes an integer onto the stack, as a number.
+func (s *State) PushInteger(n int) {
+	s.s.Pushinteger(n)
+}
+
+// Pushes a string onto the stack.
+func (s *State) PushString(str string) {
+	s.s.Pushstring(str)
+}
+
+// Pushes the contents of b onto the stack as a string.
+func (s *State) PushBytes(b []byte) {
+	s.s.Pushbytes(b)
+}
+
+// Converts the value at the given acceptable index to a boolean, which is
+// false only for false and nil.
+func (s *State) ToBoolean(index int) bool {
+	return s.s.Toboolean(index)
+}
+
+// Converts the value at the given acceptable index to a number, or 0 if
+// it is not convertible.
+func (s *State) ToNumber(index int) float64 {
+	return s.s.Tonumber(index)
+}
+
+// Converts the value at the given acceptable index to an integer,
+// truncating it, or 0 if it is not convertible.
+func (s *State) ToInteger(index int) int {
+	return s.s.Tointeger(index)
+}
+
+// Returns the string at the given acceptable index, converting numbers,
+// or the empty string for other values.
+func (s *State) ToString(index int) string {
+	return s.s.Tostring(index)
+}
+
+// Returns a copy of the string at the given acceptable index as bytes, as
+// ToString does, or nil for values that are not strings or numbers.
+func (s *State) ToBytes(index int) []byte {
+	return s.s.Tobytes(index)
+}
+
+// Returns the length of the value at the given acceptable index: the
+// length of a string, the # of a table, or the size of a userdata.
+func (s *State) Len(index int) int {
+	return s.s.Objlen(index)
+}
+
+// Reports whether the values at the two indices are primitively equal,
+// without calling metamethods.
+func (s *State) RawEqual(i1, i2 int) bool {
+	return s.s.Rawequal(i1, i2)
+}
+
+// Reports whether the values at the two indices are equal, following the
+// Lua == operator, which may call metamethods.
+func (s *State) Equal(i1, i2 int) bool {
+	return s.s.Equal(i1, i2)
+}
+
+// Reports whether the value at i1 is smaller than the value at i2,
+// following the Lua < operator, which may call metamethods.
+func (s *State) LessThan(i1, i2 int) bool {
+	return s.s.Lessthan(i1, i2)
+}
+
+// Concatenates the n values at the top of the stack, pops them, and pushes
+// the result.
+func (s *State) Concat(n int) {
+	s.s.Concat(n)
+}
+
+// Creates a new empty table and pushes it onto the stack.
+func (s *State) NewTable() {
+	s.s.Newtable()
+}
+
+// Creates a new empty table with space preallocated for narr array
+// elements and nrec other elements, and pushes it onto the stack.
+func (s *State) CreateTable(narr, nrec int) {
+	s.s.Createtable(narr, nrec)
+}
+
+// Pushes t[k], where t is the value at the given valid index and k is
+// the value at the top of the stack, which is popped.
+func (s *State) GetTable(index int) {
+	s.s.Gettable(index)
+}
+
+// Does t[k] = v, where t is the value at the given valid index, v is the
+// value at the top of the stack, and k is the value just below; both are
+// popped.
+func (s *State) SetTable(index int) {
+	s.s.Settable(index)
+}
+
+// Pushes t[k], where t is the value at the given valid index.
+func (s *State) GetField(index int, k string) {
+	s.s.Getfield(index, k)
+}
+
+// Does t[k] = v, where t is the value at the given valid index and v is
+// the value at the top of the stack, which is popped.
+func (s *State) SetField(index int, k string) {
+	s.s.Setfield(index, k)
+}
+
+// Like GetTable, but without calling metamethods.
+func (s *State) RawGet(index int) {
+	s.s.Rawget(index)
+}
+
+// Like SetTable, but without calling metamethods.
+func (s *State) RawSet(index int) {
+	s.s.Rawset(index)
+}
+
+// Pushes t[n], where t is the table at the given valid index, without
+// calling metamethods.
+func (s *State) RawGetI(index, n int) {
+	s.s.Rawgeti(index, n)
+}
+
+// Does t[n] = v, where t is the table at the given valid index and v is
+// the value at the top of the stack, which is popped, without calling
+// metamethods.
+func (s *State) RawSetI(index, n int) {
+	s.s.Rawseti(index, n)
+}
+
+// Pushes the value of the global name.
+func (s *State) GetGlobal(name string) {
+	s.s.Getglobal(name)
+}
+
+// Pops a value from the stack and sets it as the new value of global name.
+func (s *State) SetGlobal(name string) {
+	s.s.Setglobal(name)
+}
+
+// Pushes the metatable of the value at the given acceptable index and
+// returns true, or pushes nothing and returns false if it has none.
+func (s *State) GetMetatable(index int) bool {
+	top := s.s.Gettop()
+	s.s.Getmetatable(index)
+	return s.s.Gettop() > top
+}
+
+// Pops a key and pushes the next key-value pair of the table at the given
+// index, returning false, and pushing nothing, when there are no more.
+func (s *State) Next(index int) bool {
+	return s.s.Next(index) != 0
+}
+
+// Pops a table from the stack and sets it as the metatable of the value
+// at the given valid index.
+func (s *State) SetMetatable(index int) {
+	s.s.Setmetatable(index)
+}
+
+// Converts v to a Lua value and pushes it, as Push in the first version
+// of the API does.
+func (s *State) Push(v any) error {
+	return s.s.Push(v)
+}
+
+// Converts the value at the given valid index to a Go value, as Tovalue
+// in the first version of the API does.
+func (s *State) ToValue(index int) (any, error) {
+	return s.s.Tovalue(index)
+}
+
+// Stores the value at the given valid index into the Go value pointed to
+// by out, as Unmarshal in the first version of the API does.
+func (s *State) Unmarshal(index int, out any) error {
+	return s.s.Unmarshal(index, out)
+}
+
+// Pushes a Go function onto the stack.
+func (s *State) PushFunction(fn GoFunction) {
+	s.s.Pushfunction(fn.v1())
+}
+
+// Pushes a Go closure with the top n values of the stack as its upvalues,
+// popping them.
+func (s *State) PushClosure(fn GoFunction, n int) {
+	s.s.Pushclosure(fn.v1(), n)
+}
+
+// Sets the Go function fn as the new value of global name.
+func (s *State) Register(name string, fn GoFunction) {
+	s.s.Register(fn.v1(), name)
+}
+
+// Raises a Lua error from a Go function, with a message formatted as by
+// fmt.Sprintf. It should only be used as the return expression of a
+// GoFunction:
+//
+//	return s.Errorf("bad value %d", n)
+func (s *State) Errorf(format string, v ...any) int {
+	return s.s.Errorf(format, v...)
+}
+
+// Returns the status of the thread s.
+func (s *State) Status() Status {
+	return Status(s.s.Status())
+}
+
+// Calls a function, which must be pushed first, followed by its nargs
+// arguments. Errors are propagated to the caller as Lua errors.
+func (s *State) Call(nargs, nresults int) {
+	s.s.Call(nargs, nresults)
+}
+
+// Calls a function in protected mode, as Pcall in the first version of
+// the API does. On error, the error message is left on the stack.
+func (s *State) PCall(nargs, nresults, errfunc int) error {
+	return s.s.Pcall(nargs, nresults, errfunc)
+}
+
+// Loads a string as a Lua chunk without running it.
+func (s *State) LoadString(str string) error {
+	return s.s.Loadstring(str)
+}
+
+// Loads a buffer, text or binary, as a Lua chunk named chunkname without
+// running it.
+func (s *State) LoadBuffer(buf []byte, chunkname string) error {
+	return s.s.Loadbuffer(buf, chunkname)
+}
+
+// Loads and runs a string, leaving its results on the stack. On error, the
+// error message is left on the stack instead.
+func (s *State) DoString(str string) error {
+	if err := s.s.Loadstring(str); err != nil {
+		return err
+	}
+	return s.s.Pcall(0, MultRet, 0)
+}
@@ -0,0 +1,76 @@
+package luajit
+
+import (
+	"errors"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	s, err := New(WithLibs(), WithRandom(rand.NewPCG(1, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Register("double", func(s *State) int {
+		if s.Type(1) != TypeNumber {
+			return s.Errorf("number expected, got %s", s.Type(1))
+		}
+		s.PushNumber(s.ToNumber(1) * 2)
+		return 1
+	})
+	if err := s.DoString(`return double(21), math.random(100), #"abc"`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.ToString(-1))
+	}
+	if s.GetTop() != 3 || s.ToInteger(1) != 42 || s.ToInteger(3) != 3 {
+		t.Errorf("unexpected results %v %v %v", s.ToNumber(1), s.ToNumber(2), s.ToNumber(3))
+	}
+	s.SetTop(0)
+
+	if err := s.DoString(`return double("x")`); err == nil {
+		t.Error("expected error")
+	}
+	s.Pop(1)
+
+	if s.GetMetatable(GlobalsIndex) {
+		t.Error("expected no metatable on globals")
+	}
+	if s.GetTop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.GetTop())
+	}
+}
+
+func TestNewoption(t *testing.T) {
+	boom := errors.New("boom")
+	_, err := New(WithSetup(func(s *State) error { return boom }))
+	if err != boom {
+		t.Errorf("expected %v, got %v", boom, err)
+	}
+}
+
+func TestEnums(t *testing.T) {
+	if TypeTable.String() != "table" || TypeCData.String() != "cdata" || Type(99).String() != "unknown" {
+		t.Errorf("unexpected type names %v %v %v", TypeTable, TypeCData, Type(99))
+	}
+	if StatusOK.String() != "ok" || StatusErrSyntax.String() != "syntax error" {
+		t.Errorf("unexpected status names %v %v", StatusOK, StatusErrSyntax)
+	}
+}
+
+func TestIsNumberLike(t *testing.T) {
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.PushString("12")
+	s.PushNumber(3)
+	if s.IsNumber(1) || !s.IsNumberLike(1) || !s.IsString(1) || !s.IsStringLike(1) {
+		t.Error("unexpected checks of a numeric string")
+	}
+	if !s.IsNumber(2) || !s.IsNumberLike(2) || s.IsString(2) || !s.IsStringLike(2) {
+		t.Error("unexpected checks of a number")
+	}
+}
@@ -0,0 +1,7 @@
+package luajit
+
+import "github.com/serialx/luajit/vm"
+
+// State implements the interfaces of package vm, which code that should
+// not depend on cgo or on LuaJIT can accept instead of a *State.
+var _ vm.VM = (*State)(nil)
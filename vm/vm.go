@@ -0,0 +1,64 @@
+// Package vm defines the interfaces that luajit.State implements, for code
+// that should not depend on a particular Lua implementation. It does not
+// use cgo, so such code builds even where the luajit package cannot, and
+// may run on another implementation.
+package vm
+
+import "bufio"
+
+// StackOps is the part of luajit.State that manipulates the stack. Code
+// that needs only these operations can accept a StackOps instead of a
+// *luajit.State, so that its tests may pass a fake, or so that it may run
+// on another Lua implementation when cgo is not available.
+type StackOps interface {
+	Gettop() int
+	Settop(index int)
+	Pushvalue(index int)
+	Pop(n int)
+	Remove(index int)
+	Insert(index int)
+	Replace(index int)
+	Type(index int) int
+
+	Pushnil()
+	Pushboolean(b bool)
+	Pushnumber(n float64)
+	Pushinteger(n int)
+	Pushstring(str string)
+	Push(v interface{}) error
+
+	Toboolean(index int) bool
+	Tonumber(index int) float64
+	Tointeger(index int) int
+	Tostring(index int) string
+	Tovalue(index int) (interface{}, error)
+
+	Newtable()
+	Getfield(index int, k string)
+	Setfield(index int, k string)
+	Getglobal(name string)
+	Setglobal(name string)
+}
+
+// Caller is the part of luajit.State that calls functions.
+type Caller interface {
+	Call(nargs, nresults int)
+	Pcall(nargs, nresults, errfunc int) error
+	Callglobal(name string, args ...interface{}) ([]interface{}, error)
+}
+
+// Loader is the part of luajit.State that loads chunks.
+type Loader interface {
+	Load(chunk *bufio.Reader, chunkname string) error
+	Loadstring(str string) error
+	Loadbuffer(buf []byte, chunkname string) error
+}
+
+// VM combines the interfaces that luajit.State implements for use by code that
+// should not depend on a particular Lua implementation.
+type VM interface {
+	StackOps
+	Caller
+	Loader
+	Close()
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// Runs src, which must return a number.
+func evalnumber(v VM, src string) (float64, error) {
+	if err := v.Loadstring(src); err != nil {
+		return 0, err
+	}
+	if err := v.Pcall(0, 1, 0); err != nil {
+		return 0, err
+	}
+	defer v.Pop(1)
+	return v.Tonumber(-1), nil
+}
+
+// A fake VM implementing just what evalnumber uses.
+type fakevm struct {
+	VM
+	src string
+}
+
+func (f *fakevm) Loadstring(src string) error {
+	f.src = src
+	return nil
+}
+
+func (f *fakevm) Pcall(nargs, nresults, errfunc int) error {
+	if f.src == "" {
+		return errors.New("empty chunk")
+	}
+	return nil
+}
+
+func (f *fakevm) Tonumber(index int) float64 { return float64(len(f.src)) }
+func (f *fakevm) Pop(n int)                  {}
+
+func TestVM(t *testing.T) {
+	f := &fakevm{}
+	if n, err := evalnumber(f, "abc"); err != nil || n != 3 {
+		t.Errorf("expected 3 from fake, got %v %v", n, err)
+	}
+	if _, err := evalnumber(f, ""); err == nil {
+		t.Error("expected error from fake")
+	}
+}
@@ -0,0 +1,30 @@
+package luajit
+
+import (
+	"testing"
+
+	"github.com/serialx/luajit/vm"
+)
+
+func TestVM(t *testing.T) {
+	s := Newstate()
+	if s == nil {
+		t.Fatal("Newstate failed")
+	}
+	defer s.Close()
+
+	var v vm.VM = s
+	if err := v.Loadstring(`return 6 * 7`); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if err := v.Pcall(0, 1, 0); err != nil {
+		t.Fatalf("%s -- %s", err.Error(), s.Tostring(-1))
+	}
+	if n := v.Tonumber(-1); n != 42 {
+		t.Errorf("expected 42, got %v", n)
+	}
+	v.Pop(1)
+	if s.Gettop() != 0 {
+		t.Errorf("expected empty stack, got %d values", s.Gettop())
+	}
+}